@@ -2,25 +2,38 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"time"
 
 	"auth-service/internal/database"
 	"auth-service/internal/events"
 	"auth-service/internal/handlers"
+	"auth-service/internal/metrics"
+	"auth-service/internal/middleware"
+	"auth-service/internal/oauth"
+	"auth-service/internal/passwordpolicy"
+	"auth-service/internal/ratelimit"
 	"auth-service/internal/routes"
+	"auth-service/internal/utils"
 	"auth-service/repository"
+	"cozy-go/shared/logging"
+	"cozy-go/shared/outbox"
+	"cozy-go/shared/requestid"
 
 	"github.com/rs/cors"
 )
 
 func main() {
-	log.Println("Auth Service Starting...") // Add initial log message
+	logging.Setup("auth-service")
+	slog.Info("Auth Service Starting...")
 
 	// Initialize database connection first
 	dbpool, err := database.InitDB() // Assuming InitDB returns (error, *pgxpool.Pool)
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		slog.Error("Failed to initialize database", "error", err)
+		os.Exit(1)
 	}
 	// Defer closing the database pool using the global variable set in InitDB
 	// Note: Ensure InitDB actually sets a global `database.DB` or returns the pool to be closed.
@@ -29,11 +42,20 @@ func main() {
 	// Assuming CloseDB uses the global var for now based on previous context.
 	defer database.CloseDB()
 
+	// Report connection pool statistics on /metrics
+	metrics.RegisterPool(database.DB.Stat)
+
+	// Load JWT signing keys up front so a bad key configuration fails fast
+	if err := utils.InitKeys(); err != nil {
+		slog.Error("Failed to load JWT signing keys", "error", err)
+		os.Exit(1)
+	}
+
 	// Setup Event Publisher (Service Bus or RabbitMQ based on env)
 	// Use context.Background() for setup, consider more specific contexts if needed
 	eventPublisher, publisherCloser := events.NewEventPublisherFromEnv(context.Background())
 	if eventPublisher == nil {
-		log.Println("Warning: Event Publisher could not be initialized. Running without event publishing.")
+		slog.Warn("Event publisher could not be initialized, running without event publishing")
 		// No need to fatal here, handler checks for nil publisher
 	}
 	// Defer closing the publisher's underlying connection/client
@@ -44,37 +66,82 @@ func main() {
 	// Initialize repositories using the obtained dbpool
 	authRepo := repository.NewAuthRepository(dbpool)
 	healthRepo := repository.NewHealthRepository(dbpool)
+	auditRepo := repository.NewAuditRepository(dbpool)
+	outboxRepo := repository.NewOutboxRepository(dbpool)
+
+	// Publish the events queued in the outbox (e.g. by registration). Without a
+	// publisher they stay there until the service runs with one.
+	if eventPublisher != nil {
+		go outbox.NewRelay(outboxRepo, eventPublisher, outbox.ConfigFromEnv()).Run(context.Background())
+	} else {
+		slog.Warn("Outbox relay not started, queued events will be published once an event publisher is configured")
+	}
 
 	// Initialize HTTP handlers
 	// Pass the EventPublisher interface (which might be nil)
 	authHandler := handlers.NewAuthHandler(authRepo, eventPublisher)
+	authHandler.SetAuditLog(auditRepo) // Logins, token issuance etc. end up in auth_audit_log
+	authHandler.SetPasswordPolicy(passwordpolicy.FromEnv())
+	// Shared with task-service, so only other services can introspect tokens
+	if secret := os.Getenv("INTROSPECTION_SECRET"); secret != "" {
+		authHandler.SetIntrospectionSecret(secret)
+	} else {
+		slog.Warn("INTROSPECTION_SECRET not set, POST /token/introspect is open to any client")
+	}
 	healthHandler := handlers.NewHealthHandler(healthRepo)
 	protectedHandler := handlers.NewProtectedHandler()
+	jwksHandler := handlers.NewJWKSHandler()
+	// Third-party login providers are configured with OAUTH_PROVIDERS (none by default)
+	oauthHandler := handlers.NewOAuthHandler(authHandler, oauth.NewRegistryFromEnv())
+
+	// Brute-force protection. Buckets live in memory, so limits apply per instance.
+	limitStore := ratelimit.NewMemoryStore()
+	limiters := routes.RateLimiters{
+		Login:              ratelimit.NewLimiter(limitStore, "login-ip", ratelimit.LimitFromEnv("RATE_LIMIT_LOGIN_IP", ratelimit.Limit{Requests: 20, Per: time.Minute})),
+		Register:           ratelimit.NewLimiter(limitStore, "register-ip", ratelimit.LimitFromEnv("RATE_LIMIT_REGISTER_IP", ratelimit.Limit{Requests: 10, Per: time.Hour})),
+		ForgotPassword:     ratelimit.NewLimiter(limitStore, "forgot-password-ip", ratelimit.LimitFromEnv("RATE_LIMIT_FORGOT_PASSWORD_IP", ratelimit.Limit{Requests: 10, Per: time.Hour})),
+		ResendVerification: ratelimit.NewLimiter(limitStore, "resend-verification-ip", ratelimit.LimitFromEnv("RATE_LIMIT_RESEND_VERIFICATION_IP", ratelimit.Limit{Requests: 10, Per: time.Hour})),
+		// task-service caches introspection results, so even a busy instance stays well below this
+		Introspect: ratelimit.NewLimiter(limitStore, "introspect-ip", ratelimit.LimitFromEnv("RATE_LIMIT_INTROSPECT_IP", ratelimit.Limit{Requests: 600, Per: time.Minute})),
+	}
+	authHandler.SetAccountLimiter(ratelimit.NewLimiter(limitStore, "login-account", ratelimit.LimitFromEnv("RATE_LIMIT_LOGIN_ACCOUNT", ratelimit.Limit{Requests: 10, Per: 15 * time.Minute})))
+	authHandler.SetPasswordResetLimiter(ratelimit.NewLimiter(limitStore, "forgot-password-email", ratelimit.LimitFromEnv("RATE_LIMIT_FORGOT_PASSWORD_EMAIL", ratelimit.Limit{Requests: 3, Per: time.Hour})))
+	authHandler.SetMagicLinkLimiter(ratelimit.NewLimiter(limitStore, "magic-link-email", ratelimit.LimitFromEnv("RATE_LIMIT_MAGIC_LINK_EMAIL", ratelimit.Limit{Requests: 3, Per: time.Hour})))
+	authHandler.SetVerificationResendLimiter(ratelimit.NewLimiter(limitStore, "resend-verification-email", ratelimit.LimitFromEnv("RATE_LIMIT_RESEND_VERIFICATION_EMAIL", ratelimit.Limit{Requests: 3, Per: time.Hour})))
+
+	// The auth repository doubles as the revocation checker for protected routes
+	authenticator := middleware.NewAuthenticator(authRepo)
+	// ...and keeps the last-seen time of GET /me/sessions up to date
+	authenticator.TrackSessions(authRepo, utils.SessionTouchInterval())
 
 	// Start HTTP server
 	mux := http.NewServeMux()
-	routes.RegisterRoutes(mux, authHandler, healthHandler, protectedHandler)
+	routes.RegisterRoutes(mux, authenticator, authHandler, healthHandler, protectedHandler, jwksHandler, oauthHandler, limiters)
 
 	// Configure CORS
 	// TODO: Consider using an environment variable for allowed origins in production
 	// For local dev with docker-compose, allowing '*' might be okay, but tighten for Azure.
 	allowedOrigins := []string{"*"} // Consider restricting this more
-	log.Printf("Configuring CORS for origins: %v", allowedOrigins)
+	slog.Info("Configuring CORS for origins", "allowed_origins", allowedOrigins)
 
 	c := cors.New(cors.Options{
 		AllowedOrigins:   allowedOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", requestid.Header},
+		ExposedHeaders:   []string{"Retry-After", requestid.Header}, // Lets browser clients read 429 back-off hints and report request IDs
 		AllowCredentials: true,
 		// Enable Debugging for testing, consider disabling in production
 		// Debug: true,
 	})
 
-	handler := c.Handler(mux)
+	// Every request gets an ID, echoed in X-Request-ID and in error responses.
+	// It is assigned before the access log so every record of the request carries it.
+	handler := c.Handler(requestid.Middleware(logging.AccessLog(metrics.Instrument(mux))))
 
-	log.Println("Starting HTTP server on port 8080")
+	slog.Info("Starting HTTP server on port 8080")
 	err = http.ListenAndServe(":8080", handler) // Use the CORS wrapped handler
 	if err != nil {
-		log.Fatalf("Failed to start HTTP server: %v", err)
+		slog.Error("Failed to start HTTP server", "error", err)
+		os.Exit(1)
 	}
 }
@@ -3,7 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"time"
 
@@ -20,11 +20,11 @@ func InitDB() (*pgxpool.Pool, error) {
 	// Try DATABASE_URL first (set by Terraform for Azure)
 	databaseURL := os.Getenv("DATABASE_URL")
 	if databaseURL != "" {
-		log.Println("Using DATABASE_URL environment variable (expected in Azure).")
+		slog.Info("Using DATABASE_URL environment variable (expected in Azure)")
 		connString = databaseURL // Assume it includes sslmode=require from Terraform
 	} else {
 		// Fallback to individual variables (for local/docker-compose)
-		log.Println("DATABASE_URL not set, using individual POSTGRES_* variables (expected locally).")
+		slog.Info("DATABASE_URL not set, using individual POSTGRES_* variables (expected locally)")
 		dbHost := os.Getenv("POSTGRES_HOST")
 		dbPort := os.Getenv("POSTGRES_PORT")
 		dbUser := os.Getenv("POSTGRES_USER")
@@ -49,7 +49,7 @@ func InitDB() (*pgxpool.Pool, error) {
 	config.MaxConnLifetime = time.Hour
 	config.MaxConnIdleTime = 30 * time.Minute
 
-	log.Println("Attempting to connect to database...")
+	slog.Info("Attempting to connect to database...")
 
 	// Connect to the database with retry logic
 	var pool *pgxpool.Pool
@@ -62,14 +62,14 @@ func InitDB() (*pgxpool.Pool, error) {
 			// Try pinging the database
 			err = pool.Ping(context.Background())
 			if err == nil {
-				log.Println("Database connection successful!")
+				slog.Info("Database connection successful!")
 				DB = pool // Assign the successful pool to the global variable
 				return DB, nil
 			}
-			log.Printf("Database ping failed: %v. Retrying...", err)
+			slog.Warn("Database ping failed, retrying", "error", err)
 			pool.Close() // Close the pool if ping failed
 		} else {
-			log.Printf("Database connection attempt %d failed: %v. Retrying...", i+1, err)
+			slog.Warn("Database connection attempt failed, retrying", "attempt", i+1, "error", err)
 		}
 
 		if i < maxRetries-1 {
@@ -84,7 +84,7 @@ func InitDB() (*pgxpool.Pool, error) {
 // CloseDB closes the database connection pool.
 func CloseDB() {
 	if DB != nil {
-		log.Println("Closing database connection pool...")
+		slog.Info("Closing database connection pool...")
 		DB.Close()
 	}
 }
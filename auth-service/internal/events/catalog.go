@@ -0,0 +1,144 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"cozy-go/shared/cloudevents"
+	"cozy-go/shared/requestid"
+)
+
+// Source identifies auth-service as the producer of an event.
+const Source = "auth-service"
+
+// Event types published by auth-service. Consumers subscribe by type, so
+// these names are part of the service's public contract.
+const (
+	TypeUserRegistered         = "user.registered"
+	TypeUserLoggedIn           = "user.logged_in"
+	TypePasswordChanged        = "user.password_changed"
+	TypeUserDeleted            = "user.deleted"
+	TypePasswordResetRequested = "user.password_reset_requested"
+	TypeMagicLinkRequested     = "user.magic_link_requested"
+	TypeEmailChanged           = "user.email_changed"
+	TypeVerificationRequested  = "user.verification_requested"
+)
+
+// catalog maps every event type to the current version of its data schema.
+// A change to an event's JSON that consumers cannot ignore (a removed or
+// renamed field, a changed meaning) needs a new version and a new file in
+// schemas/; adding an optional field does not.
+var catalog = map[string]int{
+	TypeUserRegistered:         1,
+	TypeUserLoggedIn:           1,
+	TypePasswordChanged:        1,
+	TypeUserDeleted:            1,
+	TypePasswordResetRequested: 1,
+	TypeMagicLinkRequested:     1,
+	TypeEmailChanged:           1,
+	TypeVerificationRequested:  1,
+}
+
+// Event is a typed domain event that can be published with EventPublisher.
+type Event interface {
+	// EventType returns one of the Type constants.
+	EventType() string
+	// EventSubject identifies what the event is about; for user events it is the user ID.
+	EventSubject() string
+}
+
+func (UserRegisteredEvent) EventType() string         { return TypeUserRegistered }
+func (UserLoggedInEvent) EventType() string           { return TypeUserLoggedIn }
+func (PasswordChangedEvent) EventType() string        { return TypePasswordChanged }
+func (UserDeletedEvent) EventType() string            { return TypeUserDeleted }
+func (PasswordResetRequestedEvent) EventType() string { return TypePasswordResetRequested }
+func (MagicLinkRequestedEvent) EventType() string     { return TypeMagicLinkRequested }
+func (EmailChangedEvent) EventType() string           { return TypeEmailChanged }
+func (VerificationRequestedEvent) EventType() string  { return TypeVerificationRequested }
+
+func (e UserRegisteredEvent) EventSubject() string         { return strconv.Itoa(e.UserID) }
+func (e UserLoggedInEvent) EventSubject() string           { return strconv.Itoa(e.UserID) }
+func (e PasswordChangedEvent) EventSubject() string        { return strconv.Itoa(e.UserID) }
+func (e UserDeletedEvent) EventSubject() string            { return strconv.Itoa(e.UserID) }
+func (e PasswordResetRequestedEvent) EventSubject() string { return strconv.Itoa(e.UserID) }
+func (e MagicLinkRequestedEvent) EventSubject() string     { return strconv.Itoa(e.UserID) }
+func (e EmailChangedEvent) EventSubject() string           { return strconv.Itoa(e.UserID) }
+func (e VerificationRequestedEvent) EventSubject() string  { return strconv.Itoa(e.UserID) }
+
+// Types returns every event type in the catalog, sorted.
+func Types() []string {
+	types := make([]string, 0, len(catalog))
+	for eventType := range catalog {
+		types = append(types, eventType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// DataVersion returns the current data schema version of eventType, or 0 if
+// the type is not in the catalog.
+func DataVersion(eventType string) int {
+	return catalog[eventType]
+}
+
+// Envelope is what goes on the wire for every event; see cloudevents.Envelope.
+type Envelope = cloudevents.Envelope
+
+// NewEnvelope wraps event for publishing. It fails for events whose type is
+// not in the catalog.
+func NewEnvelope(ctx context.Context, event Event) (Envelope, error) {
+	eventType := event.EventType()
+	version, ok := catalog[eventType]
+	if !ok {
+		return Envelope{}, fmt.Errorf("unknown event type %q", eventType)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("failed to marshal %s event data: %w", eventType, err)
+	}
+	return Envelope{
+		SpecVersion:     cloudevents.SpecVersion,
+		ID:              newEventID(),
+		Source:          Source,
+		Type:            eventType,
+		Subject:         event.EventSubject(),
+		Time:            time.Now().UTC(),
+		DataContentType: cloudevents.DataContentType,
+		DataVersion:     version,
+		CorrelationID:   requestid.FromContext(ctx),
+		Data:            data,
+	}, nil
+}
+
+// newEventID returns a random (version 4) UUID.
+func newEventID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic("events: failed to read random bytes: " + err.Error())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+//go:embed schemas/*.json
+var schemas embed.FS
+
+// EnvelopeSchema returns the JSON schema of Envelope.
+func EnvelopeSchema() ([]byte, error) {
+	return schemas.ReadFile("schemas/envelope.json")
+}
+
+// Schema returns the JSON schema of the data of eventType at version. The
+// schemas are the contract with consumers and are checked against the Go
+// types in tests.
+func Schema(eventType string, version int) ([]byte, error) {
+	return schemas.ReadFile(fmt.Sprintf("schemas/%s.v%d.json", eventType, version))
+}
@@ -2,8 +2,11 @@ package events
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"os"
+
+	"cozy-go/shared/cloudevents"
+	"cozy-go/topology"
 	// We need access to the constructors and setup functions
 	// but the specific types (like *amqp.Connection, *ServiceBusClient)
 	// are handled within their respective files.
@@ -12,44 +15,52 @@ import (
 // NewEventPublisherFromEnv creates an EventPublisher based on environment variables.
 // It prioritizes Azure Service Bus if SERVICEBUS_CONNECTION_STRING is set,
 // otherwise it falls back to RabbitMQ using RABBITMQ_URL.
+// CLOUDEVENTS_MODE selects the CloudEvents content mode, "structured" (default) or "binary".
 // It returns the publisher and a closer function for the underlying connection/client.
 func NewEventPublisherFromEnv(ctx context.Context) (EventPublisher, func(ctx context.Context)) {
+	mode, err := cloudevents.ParseContentMode(os.Getenv("CLOUDEVENTS_MODE"))
+	if err != nil {
+		slog.WarnContext(ctx, "Invalid CLOUDEVENTS_MODE, using structured mode", "error", err)
+		mode = cloudevents.ContentModeStructured
+	}
 	serviceBusConnString := os.Getenv("SERVICEBUS_CONNECTION_STRING")
 
 	if serviceBusConnString != "" {
-		log.Println("SERVICEBUS_CONNECTION_STRING found, attempting to connect to Azure Service Bus...")
+		slog.InfoContext(ctx, "SERVICEBUS_CONNECTION_STRING found, attempting to connect to Azure Service Bus...")
 		// Call SetupServiceBus from servicebus.go
 		sbClient, err := SetupServiceBus(ctx)
 		if err != nil {
-			log.Printf("Warning: Failed to setup Azure Service Bus: %v. Event publishing will be disabled.", err)
+			slog.WarnContext(ctx, "Failed to set up Azure Service Bus, event publishing will be disabled", "error", err)
 			return nil, func(ctx context.Context) {} // Return no-op closer
 		}
 		// Use NewServiceBusPublisher from servicebus.go
-		publisher := NewServiceBusPublisher(sbClient)
+		publisher := NewServiceBusPublisher(sbClient, mode)
 		closer := func(ctx context.Context) {
-			log.Println("Closing Azure Service Bus client...")
+			slog.InfoContext(ctx, "Closing Azure Service Bus client...")
 			sbClient.Close(ctx) // Use the Close method from servicebus.go
 		}
-		log.Println("Successfully connected to Azure Service Bus.")
+		slog.InfoContext(ctx, "Successfully connected to Azure Service Bus", "cloudevents_mode", mode)
 		return publisher, closer
 	} else {
-		log.Println("SERVICEBUS_CONNECTION_STRING not found, attempting to connect to RabbitMQ...")
+		slog.InfoContext(ctx, "SERVICEBUS_CONNECTION_STRING not found, attempting to connect to RabbitMQ...")
 		// Call SetupRabbitMQ from rabbitmq.go
 		rabbitConn, err := SetupRabbitMQ()
 		if err != nil {
-			log.Printf("Warning: Failed to setup RabbitMQ: %v. Event publishing will be disabled.", err)
-			return nil, func(ctx context.Context) {} // Return no-op closer
+			// The publisher still starts and dials again on every publish, so
+			// the outbox relay catches up once the broker is reachable
+			slog.WarnContext(ctx, "Failed to set up RabbitMQ, events will be published once it is reachable", "error", err)
 		}
+		// Dial again when the connection is lost, e.g. by a broker restart
+		redialer := topology.NewRedialer(rabbitConn, DialRabbitMQ)
 		// Use NewRabbitMqPublisher from rabbitmq.go
-		publisher := NewRabbitMqPublisher(rabbitConn)
+		publisher := NewRabbitMqPublisher(redialer, mode)
 		closer := func(ctx context.Context) {
-			log.Println("Closing RabbitMQ connection...")
-			// rabbitConn is *amqp.Connection, its Close doesn't take context or return error
-			if err := rabbitConn.Close(); err != nil {
-				log.Printf("Error closing RabbitMQ connection: %v", err)
+			slog.InfoContext(ctx, "Closing RabbitMQ connection...")
+			if err := redialer.Close(); err != nil {
+				slog.ErrorContext(ctx, "Error closing RabbitMQ connection", "error", err)
 			}
 		}
-		log.Println("Successfully connected to RabbitMQ.")
+		slog.InfoContext(ctx, "RabbitMQ event publisher ready", "cloudevents_mode", mode)
 		return publisher, closer
 	}
 }
@@ -2,20 +2,113 @@ package events
 
 import (
 	"context"
+	"errors"
+	"time"
 	// Removed unused imports: "encoding/json", "fmt", "log", "os"
 	// Removed unused import: "github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
 )
 
+// ErrNotConnected is returned when the publisher has no usable connection.
+// The outbox relay retries such events later.
+var ErrNotConnected = errors.New("event publisher is not connected")
+
 // EventPublisher defines the interface for publishing events.
+// Publish wraps event in an Envelope and routes it by its type; see catalog.go
+// for the event types and the versions of their data schemas.
+// PublishEnvelope sends an envelope built earlier, keeping its ID, so an event
+// stored in the outbox is published with the same message ID on every attempt.
 type EventPublisher interface {
-	PublishUserRegisteredEvent(ctx context.Context, userEmail string) error
+	Publish(ctx context.Context, event Event) error
+	PublishEnvelope(ctx context.Context, envelope Envelope) error
 }
 
-// Event structure (example, adjust as needed)
-// Keep this shared definition here or move to a models package if preferred
+// UserRegisteredEvent is published after a new account is created.
+// VerificationToken is the raw email verification token; notification-service
+// emails it to the user. It is empty when no verification email should be sent.
 type UserRegisteredEvent struct {
-	Email string `json:"email"`
-	// Add other relevant fields, e.g., UserID, Timestamp
+	UserID                int        `json:"user_id"`
+	Email                 string     `json:"email"`
+	Username              string     `json:"username"`
+	VerificationToken     string     `json:"verification_token,omitempty"`
+	VerificationExpiresAt *time.Time `json:"verification_expires_at,omitempty"`
+}
+
+// UserLoggedInEvent is published after every successful sign-in, whatever the method.
+type UserLoggedInEvent struct {
+	UserID   int    `json:"user_id"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	// Method is the audit reason of the login: "password", "magic_link", "totp",
+	// "recovery_code" or "oauth:<provider>".
+	Method    string `json:"method"`
+	IPAddress string `json:"ip_address,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// Reasons carried by PasswordChangedEvent.
+const (
+	PasswordChangedByUser  = "changed"
+	PasswordChangedByReset = "reset"
+)
+
+// PasswordChangedEvent is published after a password was changed by its owner
+// or set through a reset link. notification-service sends a security notice.
+type PasswordChangedEvent struct {
+	UserID   int    `json:"user_id"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Reason   string `json:"reason"`
+}
+
+// PasswordResetRequestedEvent asks notification-service to email a reset link.
+// Token is the raw single-use token; it is only ever sent to the account's email address.
+type PasswordResetRequestedEvent struct {
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	Username  string    `json:"username"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// MagicLinkRequestedEvent asks notification-service to email a sign-in link.
+// Token is the raw single-use token; it is only ever sent to the account's email address.
+type MagicLinkRequestedEvent struct {
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	Username  string    `json:"username"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// VerificationRequestedEvent asks notification-service to email a new
+// verification link to an account that has not verified its address yet.
+// Token is the raw email verification token.
+type VerificationRequestedEvent struct {
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	Username  string    `json:"username"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// EmailChangedEvent is published when a user changes their email address.
+// notification-service sends the verification link to the new address and a
+// notice to the old one.
+type EmailChangedEvent struct {
+	UserID                int       `json:"user_id"`
+	Username              string    `json:"username"`
+	OldEmail              string    `json:"old_email"`
+	NewEmail              string    `json:"new_email"`
+	VerificationToken     string    `json:"verification_token"`
+	VerificationExpiresAt time.Time `json:"verification_expires_at"`
+}
+
+// UserDeletedEvent is published after an account is deleted, so other services
+// (task-service) can purge the user's data.
+type UserDeletedEvent struct {
+	UserID   int    `json:"user_id"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
 }
 
 // NOTE: serviceBusPublisher struct, NewServiceBusPublisher function,
@@ -2,12 +2,14 @@ package events
 
 import (
 	"context"
-	"encoding/json" // Added for publisher marshalling
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"time"
 
+	"auth-service/internal/metrics"
+	"cozy-go/shared/cloudevents"
+
 	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus"
 )
 
@@ -27,7 +29,7 @@ func SetupServiceBus(ctx context.Context) (*ServiceBusClient, error) {
 	queueName := os.Getenv("SERVICEBUS_QUEUE_NAME") // Get queue name from env var
 	if queueName == "" {
 		queueName = "user_registered" // Default if not set
-		log.Printf("SERVICEBUS_QUEUE_NAME not set, using default: %s", queueName)
+		slog.InfoContext(ctx, "SERVICEBUS_QUEUE_NAME not set, using default", "queue", queueName)
 	}
 
 	var client *azservicebus.Client
@@ -38,15 +40,15 @@ func SetupServiceBus(ctx context.Context) (*ServiceBusClient, error) {
 	retryDelay := 3 * time.Second
 
 	for i := 0; i < maxRetries; i++ {
-		log.Printf("Attempting to connect to Azure Service Bus (attempt %d/%d)...", i+1, maxRetries)
+		slog.InfoContext(ctx, "Attempting to connect to Azure Service Bus", "attempt", i+1, "max_retries", maxRetries)
 		client, err = azservicebus.NewClientFromConnectionString(connectionString, nil)
 		if err == nil {
-			log.Println("Successfully created Service Bus client.")
+			slog.InfoContext(ctx, "Successfully created Service Bus client")
 			break // Client created successfully
 		}
-		log.Printf("Failed to create Service Bus client (attempt %d/%d): %v", i+1, maxRetries, err)
+		slog.WarnContext(ctx, "Failed to create Service Bus client", "attempt", i+1, "max_retries", maxRetries, "error", err)
 		if i < maxRetries-1 {
-			log.Printf("Retrying in %v...", retryDelay)
+			slog.InfoContext(ctx, "Retrying", "retry_delay", retryDelay)
 			time.Sleep(retryDelay)
 		}
 	}
@@ -55,14 +57,14 @@ func SetupServiceBus(ctx context.Context) (*ServiceBusClient, error) {
 	}
 
 	// Create a sender for the specific queue
-	log.Printf("Creating sender for queue: %s", queueName)
+	slog.InfoContext(ctx, "Creating Service Bus sender", "queue", queueName)
 	sender, err := client.NewSender(queueName, nil)
 	if err != nil {
 		// Clean up client if sender creation fails
 		_ = client.Close(ctx)
 		return nil, fmt.Errorf("failed to create Service Bus sender for queue %s: %w", queueName, err)
 	}
-	log.Printf("Successfully created sender for queue: %s", queueName)
+	slog.InfoContext(ctx, "Successfully created Service Bus sender", "queue", queueName)
 
 	return &ServiceBusClient{
 		Client: client,
@@ -73,15 +75,15 @@ func SetupServiceBus(ctx context.Context) (*ServiceBusClient, error) {
 // Close cleans up the Service Bus sender and client.
 func (sb *ServiceBusClient) Close(ctx context.Context) {
 	if sb.Sender != nil {
-		log.Println("Closing Service Bus sender...")
+		slog.InfoContext(ctx, "Closing Service Bus sender...")
 		if err := sb.Sender.Close(ctx); err != nil {
-			log.Printf("Error closing Service Bus sender: %v", err)
+			slog.ErrorContext(ctx, "Error closing Service Bus sender", "error", err)
 		}
 	}
 	if sb.Client != nil {
-		log.Println("Closing Service Bus client...")
+		slog.InfoContext(ctx, "Closing Service Bus client...")
 		if err := sb.Client.Close(ctx); err != nil {
-			log.Printf("Error closing Service Bus client: %v", err)
+			slog.ErrorContext(ctx, "Error closing Service Bus client", "error", err)
 		}
 	}
 }
@@ -91,51 +93,74 @@ func (sb *ServiceBusClient) Close(ctx context.Context) {
 // serviceBusPublisher implements EventPublisher using Azure Service Bus.
 type serviceBusPublisher struct {
 	sender *azservicebus.Sender
+	mode   cloudevents.ContentMode
 }
 
 // NewServiceBusPublisher creates a new publisher that uses Azure Service Bus.
 // It now takes the ServiceBusClient which contains the sender.
-func NewServiceBusPublisher(client *ServiceBusClient) EventPublisher {
+// Events are sent as CloudEvents in mode.
+func NewServiceBusPublisher(client *ServiceBusClient, mode cloudevents.ContentMode) EventPublisher {
 	if client == nil || client.Sender == nil {
-		log.Println("Warning: Service Bus client or sender provided to NewServiceBusPublisher is nil.")
+		slog.Warn("Service Bus client or sender provided to NewServiceBusPublisher is nil")
 		return nil // Or perhaps return a no-op publisher implementation?
 	}
-	return &serviceBusPublisher{sender: client.Sender}
+	return &serviceBusPublisher{sender: client.Sender, mode: mode}
 }
 
-// PublishUserRegisteredEvent sends a message to the Azure Service Bus queue.
-// This is now a method on the serviceBusPublisher struct.
-func (p *serviceBusPublisher) PublishUserRegisteredEvent(ctx context.Context, userEmail string) error {
-	if p == nil || p.sender == nil {
-		log.Println("Error: serviceBusPublisher or its sender is nil, cannot publish event.")
-		return nil // Match previous behavior
+// Publish wraps event in an Envelope and sends it to the queue. The subject is
+// set to the event type so consumers sharing the single queue can filter on it.
+func (p *serviceBusPublisher) Publish(ctx context.Context, event Event) error {
+	envelope, err := NewEnvelope(ctx, event)
+	if err != nil {
+		return err
 	}
+	return p.PublishEnvelope(ctx, envelope)
+}
 
-	// Assumes UserRegisteredEvent struct is defined elsewhere (e.g., publisher.go)
-	event := UserRegisteredEvent{
-		Email: userEmail,
+// PublishEnvelope sends envelope with its ID as the message ID, which lets
+// Service Bus drop a retried send of the same event when duplicate detection
+// is enabled on the queue.
+func (p *serviceBusPublisher) PublishEnvelope(ctx context.Context, envelope Envelope) error {
+	slog.InfoContext(ctx, "Publishing event via Service Bus", "event_type", envelope.Type, "event_id", envelope.ID, "subject", envelope.Subject)
+	if err := p.sendEnvelope(ctx, envelope); err != nil {
+		slog.ErrorContext(ctx, "Error sending event", "event_type", envelope.Type, "event_id", envelope.ID, "error", err)
+		return err
 	}
+	slog.InfoContext(ctx, "Successfully published event via Service Bus", "event_type", envelope.Type, "event_id", envelope.ID)
+	return nil
+}
 
-	messageBody, err := json.Marshal(event)
+// sendEnvelope encodes envelope in the publisher's content mode and sends it with
+// the message subject set to the event type, so subscription rules can route on
+// it. In binary mode the CloudEvents attributes travel as application properties.
+func (p *serviceBusPublisher) sendEnvelope(ctx context.Context, envelope Envelope) (err error) {
+	if p == nil || p.sender == nil {
+		slog.ErrorContext(ctx, "serviceBusPublisher or its sender is nil, cannot publish event")
+		metrics.EventPublished(envelope.Type, ErrNotConnected)
+		return ErrNotConnected
+	}
+	defer func() { metrics.EventPublished(envelope.Type, err) }()
+
+	encoded, err := cloudevents.EncodeMessage(envelope, p.mode)
 	if err != nil {
-		log.Printf("Error marshalling UserRegisteredEvent for email %s: %v", userEmail, err)
-		return fmt.Errorf("failed to marshal event data: %w", err)
+		return err
 	}
 
 	message := &azservicebus.Message{
-		Body:        messageBody,
-		ContentType: Ptr("application/json"), // Assumes Ptr helper is defined elsewhere
+		Body:                  encoded.Body,
+		ContentType:           Ptr(encoded.ContentType),
+		MessageID:             Ptr(envelope.ID),
+		Subject:               Ptr(envelope.Type),
+		ApplicationProperties: encoded.Attributes,
+	}
+	// Carry the ID of the request that caused the event so consumers can log it
+	if envelope.CorrelationID != "" {
+		message.CorrelationID = Ptr(envelope.CorrelationID)
 	}
 
-	log.Printf("Publishing UserRegisteredEvent via Service Bus for email: %s", userEmail)
-
-	err = p.sender.SendMessage(ctx, message, nil)
-	if err != nil {
-		log.Printf("Error sending message to Service Bus for email %s: %v", userEmail, err)
+	if err := p.sender.SendMessage(ctx, message, nil); err != nil {
 		return fmt.Errorf("failed to send message to service bus: %w", err)
 	}
-
-	log.Printf("Successfully published UserRegisteredEvent via Service Bus for email: %s", userEmail)
 	return nil
 }
 
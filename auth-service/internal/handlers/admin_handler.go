@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"auth-service/internal/models"
+	"auth-service/repository"
+	"cozy-go/shared/problem"
+)
+
+// Page sizes for the paginated list endpoints.
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// queryInt reads a positive integer query parameter, returning def if it is absent.
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	val := r.URL.Query().Get(name)
+	if val == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 1 {
+		return 0, errors.New("invalid " + name)
+	}
+	return n, nil
+}
+
+// adminTargetID parses the {id} path value of the admin user routes.
+func adminTargetID(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid user ID")
+	}
+	return id, nil
+}
+
+// ListUsers handles GET /admin/users?search=&page=&page_size=.
+func (h *AuthHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	page, err := queryInt(r, "page", 1)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pageSize, err := queryInt(r, "page_size", defaultPageSize)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pageSize = min(pageSize, maxPageSize)
+
+	filter := models.UserListFilter{
+		Search: strings.TrimSpace(r.URL.Query().Get("search")),
+		Limit:  pageSize,
+		Offset: (page - 1) * pageSize,
+	}
+	users, total, err := h.repo.ListUsers(r.Context(), filter)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list users", "error", err)
+		problem.Error(w, r, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+
+	resp := models.AdminUserListResponse{
+		Users:    make([]models.AdminUserResponse, len(users)),
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}
+	for i := range users {
+		resp.Users[i] = *models.NewAdminUserResponse(&users[i])
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// AdminUpdateUser handles PATCH /admin/users/{id}, which disables or enables an
+// account or changes its role. Admins cannot change their own account this way,
+// so they cannot lock themselves (or the last admin) out.
+func (h *AuthHandler) AdminUpdateUser(w http.ResponseWriter, r *http.Request) {
+	adminID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	targetID, err := adminTargetID(r)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req models.AdminUpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+	if targetID == adminID {
+		problem.Error(w, r, "Admins cannot change their own role or status", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.repo.AdminUpdateUser(r.Context(), targetID, req)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			problem.Error(w, r, "User not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Admin failed to update user", "admin_id", adminID, "target_id", targetID, "error", err)
+		problem.Error(w, r, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, models.AuditAdminUserUpdated, targetID, models.AuditSuccess, adminChangeSummary(adminID, req))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.NewAdminUserResponse(user))
+	slog.InfoContext(r.Context(), "Admin updated user", "admin_id", adminID, "target_id", targetID)
+}
+
+// ForceLogout handles POST /admin/users/{id}/force-logout, which invalidates every
+// access and refresh token of the user.
+func (h *AuthHandler) ForceLogout(w http.ResponseWriter, r *http.Request) {
+	adminID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	targetID, err := adminTargetID(r)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.ForceLogout(r.Context(), targetID); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			problem.Error(w, r, "User not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Admin failed to force logout", "admin_id", adminID, "target_id", targetID, "error", err)
+		problem.Error(w, r, "Failed to log out user", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, models.AuditAdminForceLogout, targetID, models.AuditSuccess, "by admin "+strconv.Itoa(adminID))
+
+	w.WriteHeader(http.StatusNoContent)
+	slog.InfoContext(r.Context(), "Admin forced logout", "admin_id", adminID, "target_id", targetID)
+}
+
+// adminChangeSummary describes an admin update for the audit log,
+// e.g. "by admin 1: role=admin disabled=false".
+func adminChangeSummary(adminID int, req models.AdminUpdateUserRequest) string {
+	summary := "by admin " + strconv.Itoa(adminID) + ":"
+	if req.Role != nil {
+		summary += " role=" + *req.Role
+	}
+	if req.Disabled != nil {
+		summary += " disabled=" + strconv.FormatBool(*req.Disabled)
+	}
+	return summary
+}
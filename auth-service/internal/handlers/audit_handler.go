@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"auth-service/internal/metrics"
+	"auth-service/internal/middleware"
+	"auth-service/internal/models"
+	"auth-service/repository"
+	"cozy-go/shared/problem"
+)
+
+// maxUserAgentLength bounds the user agent stored with audit events.
+const maxUserAgentLength = 512
+
+// SetAuditLog enables the security audit log. Without it events are not recorded
+// and the endpoints that read the log respond with 503.
+func (h *AuthHandler) SetAuditLog(auditLog repository.AuditRepository) {
+	h.auditLog = auditLog
+}
+
+// audit records an authentication event for userID (0 if unknown) with the
+// client's IP address and user agent. Failures to write the log are logged
+// but never fail the request. Login events are also counted in the
+// auth_logins_total metric, with or without an audit log.
+func (h *AuthHandler) audit(r *http.Request, eventType string, userID int, outcome string, reason string) {
+	if eventType == models.AuditLogin || eventType == models.AuditLoginMFA {
+		metrics.Login(eventType, outcome, reason)
+	}
+	if h.auditLog == nil {
+		return
+	}
+	event := models.AuditEvent{
+		EventType: eventType,
+		IPAddress: middleware.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Outcome:   outcome,
+		Reason:    reason,
+	}
+	if userID != 0 {
+		event.UserID = &userID
+	}
+	if len(event.UserAgent) > maxUserAgentLength {
+		event.UserAgent = event.UserAgent[:maxUserAgentLength]
+	}
+	// The event is recorded even if the client has gone away
+	if err := h.auditLog.RecordAuditEvent(context.WithoutCancel(r.Context()), event); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to record audit event", "event_type", eventType, "user_id", userID, "error", err)
+	}
+}
+
+// queryTime reads an RFC 3339 timestamp query parameter; absent means the zero time.
+func queryTime(r *http.Request, name string) (time.Time, error) {
+	val := r.URL.Query().Get(name)
+	if val == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, errors.New("invalid " + name + ", expected an RFC 3339 timestamp")
+	}
+	return t, nil
+}
+
+// auditLogFilter builds the time range and page of an audit log query from
+// the from, to, page and page_size query parameters.
+func auditLogFilter(r *http.Request) (models.AuditLogFilter, int, error) {
+	var filter models.AuditLogFilter
+	var err error
+	if filter.From, err = queryTime(r, "from"); err != nil {
+		return filter, 0, err
+	}
+	if filter.To, err = queryTime(r, "to"); err != nil {
+		return filter, 0, err
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, 0, errors.New("from must be before to")
+	}
+	page, err := queryInt(r, "page", 1)
+	if err != nil {
+		return filter, 0, err
+	}
+	pageSize, err := queryInt(r, "page_size", defaultPageSize)
+	if err != nil {
+		return filter, 0, err
+	}
+	filter.Limit = min(pageSize, maxPageSize)
+	filter.Offset = (page - 1) * filter.Limit
+	return filter, page, nil
+}
+
+// writeAuditLog runs filter against the audit log and writes the page of events.
+func (h *AuthHandler) writeAuditLog(w http.ResponseWriter, r *http.Request, filter models.AuditLogFilter, page int) {
+	if h.auditLog == nil {
+		problem.Error(w, r, "Audit log is not available", http.StatusServiceUnavailable)
+		return
+	}
+	events, err := h.auditLog.ListAuditEvents(r.Context(), filter)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list audit events", "error", err)
+		problem.Error(w, r, "Failed to list security events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.AuditLogResponse{Events: events, Page: page, PageSize: filter.Limit})
+}
+
+// ListSecurityEvents handles GET /me/security-events?from=&to=&page=&page_size=,
+// the authenticated user's own recent activity, newest first.
+func (h *AuthHandler) ListSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	filter, page, err := auditLogFilter(r)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.UserID = &userID
+	h.writeAuditLog(w, r, filter, page)
+}
+
+// ListAuditLog handles GET /admin/audit-log?user_id=&event_type=&from=&to=&page=&page_size=.
+func (h *AuthHandler) ListAuditLog(w http.ResponseWriter, r *http.Request) {
+	filter, page, err := auditLogFilter(r)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if val := r.URL.Query().Get("user_id"); val != "" {
+		userID, err := strconv.Atoi(val)
+		if err != nil {
+			problem.Error(w, r, "invalid user_id", http.StatusBadRequest)
+			return
+		}
+		filter.UserID = &userID
+	}
+	filter.EventType = r.URL.Query().Get("event_type")
+	h.writeAuditLog(w, r, filter, page)
+}
@@ -1,42 +1,108 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"strconv" // Import strconv
+	"strings"
+	"time"
 
 	"auth-service/internal/events"
 	"auth-service/internal/middleware" // Import middleware
 	"auth-service/internal/models"
+	"auth-service/internal/passwordpolicy"
+	"auth-service/internal/ratelimit"
 	"auth-service/internal/utils"
 	"auth-service/repository"
-
+	"cozy-go/shared/problem"
 	// "github.com/Azure/azure-sdk-for-go/sdk/messaging/azservicebus" // No longer needed directly
-	"github.com/go-playground/validator/v10"
+)
+
+// Problem codes for login failures that clients handle differently (e.g. by
+// offering to resend the verification email).
+const (
+	codeInvalidCredentials = "invalid_credentials"
+	codeAccountDisabled    = "account_disabled"
+	codeEmailNotVerified   = "email_not_verified"
 )
 
 type AuthHandler struct {
 	repo           repository.AuthRepository
-	eventPublisher events.EventPublisher // Use the EventPublisher interface
+	eventPublisher events.EventPublisher      // Use the EventPublisher interface
+	accountLimiter *ratelimit.Limiter         // Per-account login limit; nil disables it
+	resetLimiter   *ratelimit.Limiter         // Per-email limit of password reset emails; nil disables it
+	resendLimiter  *ratelimit.Limiter         // Per-email limit of resent verification emails; nil disables it
+	linkLimiter    *ratelimit.Limiter         // Per-email limit of sign-in link emails; nil disables it
+	auditLog       repository.AuditRepository // Security audit log; nil disables it
+	passwordPolicy *passwordpolicy.Policy     // Requirements for new passwords
+	serviceSecret  string                     // Bearer credential required by /token/introspect; empty disables the check
 }
 
 // NewAuthHandler updated to accept an events.EventPublisher
 func NewAuthHandler(repo repository.AuthRepository, publisher events.EventPublisher) *AuthHandler {
-	return &AuthHandler{repo: repo, eventPublisher: publisher}
+	return &AuthHandler{repo: repo, eventPublisher: publisher, passwordPolicy: passwordpolicy.Default()}
+}
+
+// SetPasswordPolicy replaces the default requirements for new passwords
+// (registration, password reset and password change).
+func (h *AuthHandler) SetPasswordPolicy(policy *passwordpolicy.Policy) {
+	h.passwordPolicy = policy
+}
+
+// SetAccountLimiter enables per-account rate limiting of /login.
+// Per-IP limits are applied by middleware in routes.
+func (h *AuthHandler) SetAccountLimiter(limiter *ratelimit.Limiter) {
+	h.accountLimiter = limiter
+}
+
+// SetPasswordResetLimiter enables per-email rate limiting of /password/forgot,
+// so it cannot be used to flood an inbox. Per-IP limits are applied by
+// middleware in routes.
+func (h *AuthHandler) SetPasswordResetLimiter(limiter *ratelimit.Limiter) {
+	h.resetLimiter = limiter
+}
+
+// SetVerificationResendLimiter enables per-email rate limiting of
+// /verify-email/resend, so it cannot be used to flood an inbox. Per-IP limits
+// are applied by middleware in routes.
+func (h *AuthHandler) SetVerificationResendLimiter(limiter *ratelimit.Limiter) {
+	h.resendLimiter = limiter
+}
+
+// SetMagicLinkLimiter enables per-email rate limiting of /login/magic-link,
+// so it cannot be used to flood an inbox. Per-IP limits are applied by
+// middleware in routes.
+func (h *AuthHandler) SetMagicLinkLimiter(limiter *ratelimit.Limiter) {
+	h.linkLimiter = limiter
+}
+
+// SetIntrospectionSecret makes POST /token/introspect require secret as a
+// bearer token, so only services sharing it can probe tokens.
+func (h *AuthHandler) SetIntrospectionSecret(secret string) {
+	h.serviceSecret = secret
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req models.RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
+	// Stored the way logins and uniqueness checks compare them
+	req.Username = utils.NormalizeUsername(req.Username)
+	req.Email = utils.NormalizeEmail(req.Email)
 
 	// Validate the request struct
-	validate := validator.New()
+	validate := problem.NewValidator()
 	if err := validate.Struct(req); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		problem.Validation(w, r, err)
+		return
+	}
+
+	if !h.checkPasswordPolicy(w, r, "password", req.Password, req.Username, req.Email) {
 		return
 	}
 
@@ -50,32 +116,45 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	// Hash the user's password
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
-		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		problem.Error(w, r, "Failed to hash password", http.StatusInternalServerError)
 		return
 	}
 	user.Password = hashedPassword
 
-	// Save user to the database
-	_, err = h.repo.Register(user)
+	// notification-service emails the verification link carried by the event
+	verificationToken, err := utils.GenerateOpaqueToken()
 	if err != nil {
-		log.Printf("Failed to register user: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError) // Set the status code before writing the JSON
-		json.NewEncoder(w).Encode(map[string]string{"message": "Failed to register user"})
+		problem.Error(w, r, "Failed to register user", http.StatusInternalServerError)
 		return
 	}
+	verification := &models.EmailVerificationToken{
+		TokenHash: utils.HashToken(verificationToken),
+		ExpiresAt: time.Now().Add(utils.EmailVerificationTTL()),
+	}
 
-	// Publish event after successful registration
-	if h.eventPublisher != nil { // Check if publisher is configured
-		err = h.eventPublisher.PublishUserRegisteredEvent(r.Context(), user.Email)
-		if err != nil {
-			// Log the error but don't fail the registration request
-			log.Printf("Warning: Failed to publish user registered event for email %s: %v", user.Email, err)
-			// Decide if this should be a hard failure or just a warning
+	// Save the user together with the user registered event. The event is
+	// published from the outbox by the relay, so a broker outage delays the
+	// verification email instead of losing it.
+	userID, err := h.repo.Register(r.Context(), user, verification, func(userID int) events.Event {
+		return events.UserRegisteredEvent{
+			UserID:                userID,
+			Email:                 user.Email,
+			Username:              user.Username,
+			VerificationToken:     verificationToken,
+			VerificationExpiresAt: &verification.ExpiresAt,
+		}
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrUsernameTaken) || errors.Is(err, repository.ErrEmailTaken) {
+			writeIdentityConflict(w, r, err)
+			return
 		}
-	} else {
-		log.Println("Warning: Event publisher not configured in handler, skipping event publication for registration.")
+		slog.ErrorContext(r.Context(), "Failed to register user", "error", err)
+		problem.Error(w, r, "Failed to register user", http.StatusInternalServerError)
+		return
 	}
+	user.ID = userID
+	h.audit(r, models.AuditRegister, user.ID, models.AuditSuccess, "")
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -85,83 +164,235 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req models.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
 	// Validate the request struct
-	validate := validator.New()
+	validate := problem.NewValidator()
 	if err := validate.Struct(req); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		problem.Validation(w, r, err)
+		return
+	}
+
+	identifier := req.Identifier()
+
+	// Fetch full user details (including ID and lockout state)
+	dbUser, err := h.getLoginUser(r.Context(), identifier)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to retrieve user details", "identifier", identifier, "error", err)
+		problem.Error(w, r, "Failed to retrieve user details", http.StatusInternalServerError)
+		return
+	}
+
+	// Per-account rate limit, keyed by user ID so that logins by username and
+	// by email share one budget. Guessing against unknown accounts is limited
+	// by the identifier, which is case-insensitive either way.
+	limitKey := "unknown:" + strings.ToLower(identifier)
+	if dbUser != nil {
+		limitKey = "user:" + strconv.Itoa(dbUser.ID)
+	}
+	if ok, retryAfter := h.accountLimiter.Allow(r.Context(), limitKey); !ok {
+		slog.InfoContext(r.Context(), "Login rate limit exceeded for account", "identifier", identifier)
+		middleware.WriteTooManyRequests(w, r, retryAfter, "Too many login attempts, please try again later")
+		return
+	}
+	now := time.Now()
+	if dbUser != nil && dbUser.Locked(now) {
+		slog.InfoContext(r.Context(), "Login refused: account locked", "user_id", dbUser.ID, "locked_until", dbUser.LockedUntil.Format(time.RFC3339))
+		h.audit(r, models.AuditLogin, dbUser.ID, models.AuditFailure, "account_locked")
+		middleware.WriteTooManyRequests(w, r, dbUser.LockedUntil.Sub(now), "Too many failed login attempts, please try again later")
 		return
 	}
 
-	// Authenticate the user
+	// Authenticate the user. Unknown accounts and wrong passwords take the same
+	// time and get the same response.
 	user := models.User{
-		Email:    req.Email,
+		Email:    identifier,
 		Password: req.Password,
 	}
+	if dbUser != nil {
+		// Authenticate looks the password up by email, also for username logins
+		user.Email = dbUser.Email
+	}
 
 	valid, err := h.repo.Authenticate(user)
-	if err != nil || !valid {
-		log.Printf("Failed to authenticate user: %v", err)
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to authenticate user", "error", err)
+		problem.Error(w, r, "Failed to authenticate", http.StatusInternalServerError)
 		return
 	}
-
-	// Fetch full user details (including ID) after successful authentication
-	dbUser, err := h.repo.GetUserByEmail(r.Context(), req.Email)
-	if err != nil {
-		log.Printf("Failed to retrieve user details after authentication for email %s: %v", req.Email, err)
-		http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+	if !valid {
+		if dbUser != nil {
+			h.recordFailedLogin(r.Context(), dbUser.ID)
+			h.audit(r, models.AuditLogin, dbUser.ID, models.AuditFailure, "invalid_credentials")
+		} else {
+			h.audit(r, models.AuditLogin, 0, models.AuditFailure, "unknown_account")
+		}
+		problem.ErrorCode(w, r, "Invalid username, email or password", http.StatusUnauthorized, codeInvalidCredentials)
 		return
 	}
 	if dbUser == nil {
-		log.Printf("User %s authenticated but not found in database.", req.Email)
-		http.Error(w, "User not found after authentication", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "User authenticated but not found in database", "identifier", identifier)
+		problem.Error(w, r, "User not found after authentication", http.StatusInternalServerError)
 		return
 	}
+	if dbUser.Disabled() {
+		slog.InfoContext(r.Context(), "Login refused: account disabled", "user_id", dbUser.ID)
+		h.audit(r, models.AuditLogin, dbUser.ID, models.AuditFailure, "account_disabled")
+		problem.ErrorCode(w, r, "Account is disabled", http.StatusForbidden, codeAccountDisabled)
+		return
+	}
+	h.resetFailedLogins(r.Context(), dbUser)
+
+	// Unverified accounts may be refused depending on EMAIL_VERIFICATION_POLICY
+	if !utils.GetEmailVerificationPolicy().LoginAllowed(dbUser.EmailVerified(), dbUser.CreatedAt, time.Now()) {
+		slog.InfoContext(r.Context(), "Login refused: email address not verified", "user_id", dbUser.ID)
+		h.audit(r, models.AuditLogin, dbUser.ID, models.AuditFailure, "email_not_verified")
+		problem.ErrorCode(w, r, "Email address not verified", http.StatusForbidden, codeEmailNotVerified)
+		return
+	}
+
+	// Accounts with two-factor authentication get a challenge instead of tokens;
+	// the second step is POST /login/mfa
+	if dbUser.MFAEnabled {
+		h.writeMFAChallenge(w, r, dbUser)
+		return
+	}
+
+	h.completeLogin(w, r, dbUser, "password")
+}
+
+// writeIdentityConflict replies 409 for repository.ErrUsernameTaken or
+// repository.ErrEmailTaken, naming the field so forms can show it inline.
+func writeIdentityConflict(w http.ResponseWriter, r *http.Request, err error) {
+	field := "username"
+	if errors.Is(err, repository.ErrEmailTaken) {
+		field = "email"
+	}
+	problem.Write(w, r, problem.Problem{
+		Status: http.StatusConflict,
+		Detail: err.Error(),
+		Code:   field + "_taken",
+		Errors: []problem.FieldError{{Field: field, Code: "taken", Message: err.Error()}},
+	})
+}
+
+// getLoginUser looks up the account for a login identifier, which is an email
+// address if it contains "@" and a username otherwise. Case is ignored.
+// Returns nil if there is no such account.
+func (h *AuthHandler) getLoginUser(ctx context.Context, identifier string) (*models.User, error) {
+	if utils.IsEmailLogin(identifier) {
+		return h.repo.GetUserByEmail(ctx, identifier)
+	}
+	return h.repo.GetUserByUsername(ctx, identifier)
+}
 
-	// Generate JWT token using the fetched user details (especially ID)
-	token, err := utils.GenerateJWT(*dbUser)
+// recordFailedLogin counts a wrong password or second factor against userID and
+// locks the account according to the lockout policy.
+func (h *AuthHandler) recordFailedLogin(ctx context.Context, userID int) {
+	failures, err := h.repo.RecordFailedLogin(ctx, userID)
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		slog.ErrorContext(ctx, "Failed to record failed login", "user_id", userID, "error", err)
 		return
 	}
+	slog.InfoContext(ctx, "Failed login", "user_id", userID, "consecutive_failures", failures)
+	if d := utils.GetLockoutPolicy().LockDuration(failures); d > 0 {
+		if err := h.repo.LockAccount(ctx, userID, time.Now().Add(d)); err != nil {
+			slog.ErrorContext(ctx, "Failed to lock account", "user_id", userID, "error", err)
+		}
+	}
+}
 
-	// Emit login event using the EventPublisher interface
-	if h.eventPublisher != nil { // Check if publisher is configured
-		// TODO: Consider creating a specific PublishUserLoggedInEvent method/event type
-		err = h.eventPublisher.PublishUserRegisteredEvent(r.Context(), dbUser.Email) // Using the interface method
-		if err != nil {
-			// Log the error but maybe don't fail the login just because event publishing failed?
-			// Depends on requirements. For now, we'll log and continue.
-			log.Printf("Failed to publish login event for user %s: %v", dbUser.Email, err)
-			// Optionally return error if event publishing is critical
-			// http.Error(w, "Failed to process login event", http.StatusInternalServerError)
-			// return
-		} // <<< Ensure this closing brace is present
-	} else {
-		log.Println("Warning: Event publisher not configured in handler, skipping event publication for login.")
+// resetFailedLogins clears the failed login count and lock of user, if any,
+// after a successful login step.
+func (h *AuthHandler) resetFailedLogins(ctx context.Context, user *models.User) {
+	if user.FailedLoginAttempts == 0 && user.LockedUntil == nil {
+		return
+	}
+	if err := h.repo.ResetFailedLogins(ctx, user.ID); err != nil {
+		slog.ErrorContext(ctx, "Failed to reset failed logins", "user_id", user.ID, "error", err)
 	}
+}
+
+// loginRefused replies with the reason a login to dbUser is refused if the
+// account is locked or disabled, and reports whether it did. Every login
+// method checks it before issuing tokens or an MFA challenge.
+func (h *AuthHandler) loginRefused(w http.ResponseWriter, r *http.Request, dbUser *models.User) bool {
+	now := time.Now()
+	if dbUser.Locked(now) {
+		slog.InfoContext(r.Context(), "Login refused: account locked", "user_id", dbUser.ID, "locked_until", dbUser.LockedUntil.Format(time.RFC3339))
+		h.audit(r, models.AuditLogin, dbUser.ID, models.AuditFailure, "account_locked")
+		middleware.WriteTooManyRequests(w, r, dbUser.LockedUntil.Sub(now), "Too many failed login attempts, please try again later")
+		return true
+	}
+	if dbUser.Disabled() {
+		slog.InfoContext(r.Context(), "Login refused: account disabled", "user_id", dbUser.ID)
+		h.audit(r, models.AuditLogin, dbUser.ID, models.AuditFailure, "account_disabled")
+		problem.ErrorCode(w, r, "Account is disabled", http.StatusForbidden, codeAccountDisabled)
+		return true
+	}
+	return false
+}
 
-	// Prepare the response including token and user details
-	responseUser := models.UserResponse{
-		ID:       dbUser.ID,
-		Username: dbUser.Username,
-		Email:    dbUser.Email,
+// completeLogin issues tokens for an authenticated user and writes the login response.
+// method records how the user authenticated in the audit log.
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, dbUser *models.User, method string) {
+	// Checked again here for the second login step; the account may have been
+	// locked or disabled after the first step
+	if h.loginRefused(w, r, dbUser) {
+		return
 	}
-	responsePayload := map[string]interface{}{
-		"token": token,
-		"user":  responseUser,
+
+	// Generate the access token and a new refresh token family for this login
+	tokens, err := h.issueTokens(r, *dbUser, "")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to issue tokens", "user_id", dbUser.ID, "error", err)
+		problem.Error(w, r, "Failed to generate token", http.StatusInternalServerError)
+		return
 	}
 
+	h.audit(r, models.AuditLogin, dbUser.ID, models.AuditSuccess, method)
+	h.publishLoggedIn(r, dbUser, method)
+
+	// Prepare the response including tokens and user details
+	tokens.User = models.NewUserResponse(dbUser)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(responsePayload); err != nil {
-		log.Printf("Error encoding login response for user %s: %v", dbUser.Email, err)
+	if err := json.NewEncoder(w).Encode(tokens); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding login response", "email", dbUser.Email, "error", err)
+	}
+	slog.InfoContext(r.Context(), "Successfully handled Login request", "user_id", dbUser.ID)
+}
+
+// publishLoggedIn publishes a UserLoggedInEvent for a successful sign-in.
+// method is the audit reason of the login ("password", "oauth:google", ...).
+func (h *AuthHandler) publishLoggedIn(r *http.Request, user *models.User, method string) {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	h.publishEvent(r.Context(), events.UserLoggedInEvent{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Username:  user.Username,
+		Method:    method,
+		IPAddress: middleware.ClientIP(r),
+		UserAgent: userAgent,
+	})
+}
+
+// publishEvent publishes event if a publisher is configured. Failures are only
+// logged: the request that caused the event has already succeeded.
+func (h *AuthHandler) publishEvent(ctx context.Context, event events.Event) {
+	if h.eventPublisher == nil {
+		slog.DebugContext(ctx, "Event publisher not configured in handler, skipping event publication", "event_type", event.EventType())
+		return
+	}
+	if err := h.eventPublisher.Publish(ctx, event); err != nil {
+		slog.WarnContext(ctx, "Failed to publish event", "event_type", event.EventType(), "error", err)
 	}
-	log.Printf("Successfully handled Login request for user ID: %d", dbUser.ID)
 }
 
 // GetMe handles requests to fetch the current user's details based on JWT.
@@ -169,39 +400,39 @@ func (h *AuthHandler) GetMe(w http.ResponseWriter, r *http.Request) {
 	// Extract userID string from context (set by JWTAuth middleware)
 	userIDStr, ok := r.Context().Value(middleware.UserIDContextKey).(string)
 	if !ok || userIDStr == "" {
-		log.Println("Error: User ID string not found in context or is empty")
-		http.Error(w, "Unauthorized: User ID missing from token context", http.StatusUnauthorized)
+		slog.ErrorContext(r.Context(), "User ID not found in request context")
+		problem.Error(w, r, "Unauthorized: User ID missing from token context", http.StatusUnauthorized)
 		return
 	}
 
 	// Convert userID string to int
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
-		log.Printf("Error converting userID string '%s' to int: %v", userIDStr, err)
-		http.Error(w, "Unauthorized: Invalid user ID format in token", http.StatusUnauthorized)
+		slog.ErrorContext(r.Context(), "Invalid user ID in request context", "user_id", userIDStr, "error", err)
+		problem.Error(w, r, "Unauthorized: Invalid user ID format in token", http.StatusUnauthorized)
 		return
 	}
 
 	// Fetch user details from repository using the ID
 	user, err := h.repo.GetUserByID(r.Context(), userID)
 	if err != nil {
-		log.Printf("Error fetching user details for ID %d: %v", userID, err)
-		http.Error(w, "Failed to retrieve user information", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error fetching user details", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to retrieve user information", http.StatusInternalServerError)
 		return
 	}
 	if user == nil {
 		// This case should ideally not happen if the token was valid,
 		// but handle it defensively (e.g., user deleted after token issued).
-		log.Printf("User with ID %d from token not found in database", userID)
-		http.Error(w, "Unauthorized: User not found", http.StatusUnauthorized)
+		slog.InfoContext(r.Context(), "User from token not found in database", "user_id", userID)
+		problem.Error(w, r, "Unauthorized: User not found", http.StatusUnauthorized)
 		return
 	}
 
 	// Respond with user details (excluding password)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(user); err != nil {
-		log.Printf("Error encoding GetMe response for user ID %d: %v", userID, err)
+	if err := json.NewEncoder(w).Encode(models.NewUserResponse(user)); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding GetMe response", "user_id", userID, "error", err)
 	}
-	log.Printf("Successfully handled GetMe request for user ID: %d", userID)
+	slog.InfoContext(r.Context(), "Successfully handled GetMe request", "user_id", userID)
 }
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"auth-service/repository"
+	"cozy-go/shared/problem"
 )
 
 type HealthHandler struct {
@@ -16,7 +17,7 @@ func NewHealthHandler(repo repository.HealthRepository) *HealthHandler {
 
 func (h *HealthHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	if err := h.repo.CheckHealth(); err != nil {
-		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		problem.Error(w, r, "Service Unavailable", http.StatusServiceUnavailable)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
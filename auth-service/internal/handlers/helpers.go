@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"auth-service/internal/middleware"
+	"auth-service/internal/utils"
+)
+
+// userIDFromContext extracts the authenticated user's ID (set by JWTAuth) as an int.
+func userIDFromContext(r *http.Request) (int, error) {
+	userIDStr, ok := r.Context().Value(middleware.UserIDContextKey).(string)
+	if !ok || userIDStr == "" {
+		return 0, errors.New("user ID not found in context")
+	}
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return 0, errors.New("invalid user ID format in context")
+	}
+	return userID, nil
+}
+
+// claimsFromContext returns the access token claims stored by JWTAuth.
+func claimsFromContext(r *http.Request) (*utils.Claims, bool) {
+	claims, ok := r.Context().Value(middleware.ClaimsContextKey).(*utils.Claims)
+	return claims, ok && claims != nil
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"auth-service/internal/utils"
+	"cozy-go/shared/problem"
+)
+
+// JWKSHandler publishes the public keys used to verify access tokens.
+type JWKSHandler struct{}
+
+func NewJWKSHandler() *JWKSHandler {
+	return &JWKSHandler{}
+}
+
+// ServeJWKS handles GET /.well-known/jwks.json.
+func (h *JWKSHandler) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	keys, err := utils.Keys()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error loading signing keys for JWKS", "error", err)
+		problem.Error(w, r, "Signing keys unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	// Verifiers may cache the set briefly; they refetch when they meet an unknown kid
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(keys.JWKS()); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding JWKS response", "error", err)
+	}
+}
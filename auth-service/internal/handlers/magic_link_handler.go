@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"auth-service/internal/events"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+	"cozy-go/shared/problem"
+)
+
+// magicLinkMessage is returned for every well-formed request, so the response
+// never reveals whether an account exists for the email.
+const magicLinkMessage = "If an account exists for that email, a sign-in link has been sent"
+
+// RequestMagicLink handles POST /login/magic-link.
+// Known, enabled accounts are emailed a single-use sign-in link; the response is
+// the same whether or not the email belongs to an account.
+func (h *AuthHandler) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	var req models.MagicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	req.Email = utils.NormalizeEmail(req.Email)
+
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	// Requests over the per-email limit get the same response, they just send nothing
+	if ok, _ := h.linkLimiter.Allow(r.Context(), req.Email); ok {
+		// Detach from the request so the work is not cancelled once the response is sent
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), emailRequestTimeout)
+		go func() {
+			defer cancel()
+			h.sendMagicLink(ctx, req.Email)
+		}()
+	} else {
+		slog.InfoContext(r.Context(), "Sign-in link rate limit exceeded for email, not sending")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": magicLinkMessage})
+}
+
+// sendMagicLink creates a sign-in link token for the account with email (if any)
+// and publishes a MagicLinkRequestedEvent for notification-service to email.
+func (h *AuthHandler) sendMagicLink(ctx context.Context, email string) {
+	user, err := h.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error looking up user for sign-in link", "error", err)
+		return
+	}
+	if user == nil {
+		slog.InfoContext(ctx, "Sign-in link requested for unknown email, ignoring")
+		return
+	}
+	if user.Disabled() {
+		slog.InfoContext(ctx, "Sign-in link requested for disabled user, ignoring", "user_id", user.ID)
+		return
+	}
+
+	rawToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to generate sign-in link token", "user_id", user.ID, "error", err)
+		return
+	}
+	expiresAt := time.Now().Add(utils.MagicLinkTTL())
+
+	if err := h.repo.CreateMagicLinkToken(ctx, user.ID, utils.HashToken(rawToken), expiresAt); err != nil {
+		slog.ErrorContext(ctx, "Failed to store sign-in link token", "user_id", user.ID, "error", err)
+		return
+	}
+
+	if h.eventPublisher == nil {
+		slog.WarnContext(ctx, "Event publisher not configured in handler, sign-in link email will not be sent")
+		return
+	}
+	event := events.MagicLinkRequestedEvent{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Username:  user.Username,
+		Token:     rawToken,
+		ExpiresAt: expiresAt,
+	}
+	if err := h.eventPublisher.Publish(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish sign-in link event", "user_id", user.ID, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "Sign-in link requested", "user_id", user.ID)
+}
+
+// VerifyMagicLink handles POST /login/magic-link/verify.
+// A valid token is redeemed for the same response as a password login,
+// including the MFA challenge for accounts with two-factor authentication.
+func (h *AuthHandler) VerifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	var req models.MagicLinkVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	userID, err := h.repo.ConsumeMagicLinkToken(r.Context(), utils.HashToken(req.Token))
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidMagicLink) {
+			h.audit(r, models.AuditLogin, 0, models.AuditFailure, "invalid_magic_link")
+			problem.Error(w, r, "Invalid or expired sign-in link", http.StatusBadRequest)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Error redeeming sign-in link", "error", err)
+		problem.Error(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.repo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching user for sign-in link", "user_id", userID, "error", err)
+		problem.Error(w, r, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		problem.Error(w, r, "Invalid or expired sign-in link", http.StatusBadRequest)
+		return
+	}
+
+	// The same account checks as a password login; the email needs no check,
+	// since redeeming the link has just verified it
+	if h.loginRefused(w, r, user) {
+		return
+	}
+
+	if user.MFAEnabled {
+		h.writeMFAChallenge(w, r, user)
+		return
+	}
+
+	h.completeLogin(w, r, user, "magic_link")
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"auth-service/internal/middleware"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+	"cozy-go/shared/problem"
+)
+
+// recoveryCodeCount is the number of recovery codes issued when 2FA is enabled.
+const recoveryCodeCount = 10
+
+// EnrollTOTP handles POST /me/mfa/totp/enroll.
+// It generates a new TOTP secret; 2FA is only enforced once ConfirmTOTP succeeds.
+func (h *AuthHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	user, err := h.repo.GetUserByID(r.Context(), userID)
+	if err != nil || user == nil {
+		slog.ErrorContext(r.Context(), "Error fetching user", "user_id", userID, "error", err)
+		problem.Error(w, r, "Unauthorized: User not found", http.StatusUnauthorized)
+		return
+	}
+	if user.MFAEnabled {
+		problem.Error(w, r, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		problem.Error(w, r, "Failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+	if err := h.repo.SaveTOTPEnrollment(r.Context(), userID, secret); err != nil {
+		if errors.Is(err, repository.ErrMFAAlreadyEnabled) {
+			problem.Error(w, r, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to save TOTP enrollment", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	resp := models.TOTPEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(utils.TOTPIssuer(), user.Email, secret),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+	slog.InfoContext(r.Context(), "Successfully handled EnrollTOTP request", "user_id", userID)
+}
+
+// ConfirmTOTP handles POST /me/mfa/totp/confirm.
+// A valid code from the authenticator app enables 2FA and returns the recovery codes.
+func (h *AuthHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ConfirmTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	enrollment, err := h.repo.GetTOTPEnrollment(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to get TOTP enrollment", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to confirm enrollment", http.StatusInternalServerError)
+		return
+	}
+	if enrollment == nil {
+		problem.Error(w, r, "No pending two-factor enrollment; call /me/mfa/totp/enroll first", http.StatusBadRequest)
+		return
+	}
+	if enrollment.ConfirmedAt != nil {
+		problem.Error(w, r, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	step, ok := utils.ValidateTOTP(enrollment.Secret, req.Code, time.Now())
+	if !ok {
+		problem.Error(w, r, "Invalid authentication code", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		problem.Error(w, r, "Failed to confirm enrollment", http.StatusInternalServerError)
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashRecoveryCode(code)
+	}
+	if err := h.repo.ConfirmTOTP(r.Context(), userID, step, hashes); err != nil {
+		if errors.Is(err, repository.ErrMFAAlreadyEnabled) {
+			problem.Error(w, r, "Two-factor authentication is already enabled", http.StatusConflict)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to confirm TOTP enrollment", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to confirm enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, models.AuditMFAEnabled, userID, models.AuditSuccess, "totp")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.RecoveryCodesResponse{RecoveryCodes: codes})
+	slog.InfoContext(r.Context(), "Successfully handled ConfirmTOTP request", "user_id", userID)
+}
+
+// DisableTOTP handles DELETE /me/mfa/totp. The current password is required.
+func (h *AuthHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req models.DisableTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	if !h.checkCurrentPassword(w, r, userID, req.Password, models.AuditMFADisabled) {
+		return
+	}
+	if err := h.repo.DisableTOTP(r.Context(), userID); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to disable TOTP", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	h.audit(r, models.AuditMFADisabled, userID, models.AuditSuccess, "totp")
+
+	w.WriteHeader(http.StatusNoContent)
+	slog.InfoContext(r.Context(), "Successfully handled DisableTOTP request", "user_id", userID)
+}
+
+// createMFAChallenge stores a challenge for user, who has passed the first
+// login step, and returns the response telling the client to send a code.
+func (h *AuthHandler) createMFAChallenge(ctx context.Context, user *models.User) (*models.MFAChallengeResponse, error) {
+	rawToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	ttl := utils.MFAChallengeTTL()
+	if err := h.repo.CreateMFAChallenge(ctx, user.ID, utils.HashToken(rawToken), time.Now().Add(ttl)); err != nil {
+		return nil, err
+	}
+	return &models.MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    rawToken,
+		ExpiresIn:   int(ttl.Seconds()),
+		Methods:     []string{"totp", "recovery_code"},
+	}, nil
+}
+
+// writeMFAChallenge answers a successful password check with an MFA challenge.
+func (h *AuthHandler) writeMFAChallenge(w http.ResponseWriter, r *http.Request, user *models.User) {
+	challenge, err := h.createMFAChallenge(r.Context(), user)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to create MFA challenge", "user_id", user.ID, "error", err)
+		problem.Error(w, r, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(challenge)
+	slog.InfoContext(r.Context(), "Password accepted, waiting for second factor", "user_id", user.ID)
+}
+
+// LoginMFA handles POST /login/mfa, the second login step for accounts with 2FA.
+// The MFA token from /login is exchanged, together with a TOTP or recovery code,
+// for the access and refresh tokens.
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var req models.LoginMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	tokenHash := utils.HashToken(req.MFAToken)
+	userID, err := h.repo.GetMFAChallenge(r.Context(), tokenHash)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidMFAChallenge) {
+			problem.Error(w, r, "Invalid or expired MFA token", http.StatusUnauthorized)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to look up MFA challenge", "error", err)
+		problem.Error(w, r, "Failed to verify authentication code", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.repo.GetUserByID(r.Context(), userID)
+	if err != nil || user == nil {
+		slog.ErrorContext(r.Context(), "Failed to retrieve user for MFA", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to retrieve user details", http.StatusInternalServerError)
+		return
+	}
+	// Wrong codes count toward the same lockout as wrong passwords, so a
+	// stolen password does not buy unlimited guesses at the second factor
+	now := time.Now()
+	if user.Locked(now) {
+		slog.InfoContext(r.Context(), "MFA login refused: account locked", "user_id", userID, "locked_until", user.LockedUntil.Format(time.RFC3339))
+		h.audit(r, models.AuditLoginMFA, userID, models.AuditFailure, "account_locked")
+		middleware.WriteTooManyRequests(w, r, user.LockedUntil.Sub(now), "Too many failed login attempts, please try again later")
+		return
+	}
+
+	valid, err := h.checkSecondFactor(r.Context(), userID, req)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to verify second factor", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to verify authentication code", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		if err := h.repo.RecordMFAChallengeFailure(r.Context(), tokenHash); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to record MFA failure", "user_id", userID, "error", err)
+		}
+		slog.InfoContext(r.Context(), "Invalid second factor", "user_id", userID)
+		h.recordFailedLogin(r.Context(), userID)
+		h.audit(r, models.AuditLoginMFA, userID, models.AuditFailure, "invalid_code")
+		problem.Error(w, r, "Invalid authentication code", http.StatusUnauthorized)
+		return
+	}
+
+	// Redeem the challenge only after the code checked out, so a typo does not
+	// force the user to start over; concurrent redemptions lose here.
+	if _, err := h.repo.ConsumeMFAChallenge(r.Context(), tokenHash); err != nil {
+		if errors.Is(err, repository.ErrInvalidMFAChallenge) {
+			problem.Error(w, r, "Invalid or expired MFA token", http.StatusUnauthorized)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to redeem MFA challenge", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to verify authentication code", http.StatusInternalServerError)
+		return
+	}
+
+	h.resetFailedLogins(r.Context(), user)
+
+	method := "totp"
+	if req.Code == "" {
+		method = "recovery_code"
+	}
+	h.completeLogin(w, r, user, method)
+}
+
+// checkSecondFactor verifies the TOTP or recovery code in req for userID.
+// TOTP codes are single-use: a code for an already used time step is rejected.
+func (h *AuthHandler) checkSecondFactor(ctx context.Context, userID int, req models.LoginMFARequest) (bool, error) {
+	if req.Code == "" {
+		return h.repo.UseRecoveryCode(ctx, userID, utils.HashRecoveryCode(req.RecoveryCode))
+	}
+
+	enrollment, err := h.repo.GetTOTPEnrollment(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if enrollment == nil || enrollment.ConfirmedAt == nil {
+		return false, nil
+	}
+	step, ok := utils.ValidateTOTP(enrollment.Secret, req.Code, time.Now())
+	if !ok || step <= enrollment.LastUsedStep {
+		return false, nil
+	}
+	return h.repo.RecordTOTPStep(ctx, userID, step)
+}
@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-service/internal/events"
+	"auth-service/internal/models"
+	"auth-service/internal/oauth"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+	"cozy-go/shared/problem"
+
+	"golang.org/x/oauth2"
+)
+
+// oauthStateCookie binds a pending third-party login to the browser that started it.
+const oauthStateCookie = "oauth_state"
+
+// maxUsernameAttempts bounds how many suffixed usernames are tried for a new OAuth account.
+const maxUsernameAttempts = 5
+
+// errEmailBelongsToAccount is returned when a provider asserts an unverified email
+// that already belongs to a local account. Linking it would let anyone who can
+// register that address at the provider take over the account.
+var errEmailBelongsToAccount = errors.New("email belongs to an existing account")
+
+// OAuthHandler handles login with third-party OpenID Connect providers.
+type OAuthHandler struct {
+	auth      *AuthHandler
+	providers *oauth.Registry
+}
+
+// NewOAuthHandler creates an OAuthHandler that issues tokens through auth.
+func NewOAuthHandler(auth *AuthHandler, providers *oauth.Registry) *OAuthHandler {
+	return &OAuthHandler{auth: auth, providers: providers}
+}
+
+// Start handles GET /oauth/{provider}/start.
+// It stores the state, nonce and PKCE verifier for the login and redirects the
+// browser to the provider.
+func (h *OAuthHandler) Start(w http.ResponseWriter, r *http.Request) {
+	provider, err := h.providers.Get(r.PathValue("provider"))
+	if err != nil {
+		problem.Error(w, r, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	state, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		problem.Error(w, r, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		problem.Error(w, r, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	authReq := oauth.AuthRequest{State: state, Nonce: nonce, CodeVerifier: oauth2.GenerateVerifier()}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), authReq)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to build OAuth authorization URL", "provider", provider.Name(), "error", err)
+		problem.Error(w, r, "Login provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	ttl := utils.OAuthStateTTL()
+	stored := models.OAuthState{
+		StateHash:    utils.HashToken(state),
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: authReq.CodeVerifier,
+		ExpiresAt:    time.Now().Add(ttl),
+	}
+	if err := h.auth.repo.CreateOAuthState(r.Context(), stored); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to store OAuth state", "error", err)
+		problem.Error(w, r, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/oauth/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode, // Sent on the top-level redirect back from the provider
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback handles GET /oauth/{provider}/callback.
+// It redeems the authorization code, finds or creates the local account and
+// issues tokens exactly like /login.
+func (h *OAuthHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	provider, err := h.providers.Get(r.PathValue("provider"))
+	if err != nil {
+		problem.Error(w, r, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		slog.InfoContext(r.Context(), "OAuth login failed at the provider", "provider", provider.Name(), "error", providerErr)
+		problem.Error(w, r, "Login was cancelled or denied by the provider", http.StatusBadRequest)
+		return
+	}
+
+	// The state must match the cookie set by Start, so a callback URL cannot be
+	// replayed in another browser (login CSRF).
+	state := query.Get("state")
+	cookie, err := r.Cookie(oauthStateCookie)
+	if state == "" || err != nil || subtle.ConstantTimeCompare([]byte(state), []byte(cookie.Value)) != 1 {
+		problem.Error(w, r, "Invalid OAuth state", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Value: "", Path: "/oauth/", MaxAge: -1, HttpOnly: true})
+
+	stored, err := h.auth.repo.ConsumeOAuthState(r.Context(), utils.HashToken(state))
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidOAuthState) {
+			problem.Error(w, r, "Invalid or expired OAuth state", http.StatusBadRequest)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to redeem OAuth state", "error", err)
+		problem.Error(w, r, "Failed to complete login", http.StatusInternalServerError)
+		return
+	}
+	if stored.Provider != provider.Name() {
+		problem.Error(w, r, "Invalid OAuth state", http.StatusBadRequest)
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		problem.Error(w, r, "Missing authorization code", http.StatusBadRequest)
+		return
+	}
+	identity, err := provider.Exchange(r.Context(), code, oauth.AuthRequest{State: state, Nonce: stored.Nonce, CodeVerifier: stored.CodeVerifier})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to complete OAuth login", "provider", provider.Name(), "error", err)
+		problem.Error(w, r, "Failed to verify login with provider", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.resolveUser(r, identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, errEmailBelongsToAccount), errors.Is(err, repository.ErrEmailTaken):
+			problem.Error(w, r, "An account already exists for this email address; log in with your password instead", http.StatusConflict)
+		case errors.Is(err, repository.ErrIdentityConflict):
+			problem.Error(w, r, "Your account is already linked to a different "+provider.Name()+" account", http.StatusConflict)
+		default:
+			slog.ErrorContext(r.Context(), "Failed to resolve OAuth identity", "provider", provider.Name(), "subject", identity.Subject, "error", err)
+			problem.Error(w, r, "Failed to complete login", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The same account checks as every other login method
+	if h.auth.loginRefused(w, r, user) {
+		return
+	}
+
+	// The same verification policy as /login applies to accounts whose email
+	// address the provider did not vouch for.
+	if !utils.GetEmailVerificationPolicy().LoginAllowed(user.EmailVerified(), user.CreatedAt, time.Now()) {
+		slog.InfoContext(r.Context(), "OAuth login refused: email address not verified", "user_id", user.ID)
+		h.auth.audit(r, models.AuditLogin, user.ID, models.AuditFailure, "email_not_verified")
+		problem.ErrorCode(w, r, "Email address not verified", http.StatusForbidden, codeEmailNotVerified)
+		return
+	}
+
+	frontendURL := os.Getenv("OAUTH_FRONTEND_REDIRECT_URL")
+
+	// A third-party login replaces the password, not the second factor
+	if user.MFAEnabled {
+		challenge, err := h.auth.createMFAChallenge(r.Context(), user)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to create MFA challenge", "user_id", user.ID, "error", err)
+			problem.Error(w, r, "Failed to generate token", http.StatusInternalServerError)
+			return
+		}
+		if frontendURL != "" {
+			fragment := url.Values{
+				"mfa_required": {"true"},
+				"mfa_token":    {challenge.MFAToken},
+				"expires_in":   {strconv.Itoa(challenge.ExpiresIn)},
+			}
+			http.Redirect(w, r, frontendURL+"#"+fragment.Encode(), http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(challenge)
+		return
+	}
+
+	tokens, err := h.auth.issueTokens(r, *user, "")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to issue tokens", "user_id", user.ID, "error", err)
+		problem.Error(w, r, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	h.auth.audit(r, models.AuditLogin, user.ID, models.AuditSuccess, "oauth:"+provider.Name())
+	h.auth.publishLoggedIn(r, user, "oauth:"+provider.Name())
+	tokens.User = models.NewUserResponse(user)
+
+	// Browser flows hand the tokens to the frontend in the URL fragment, which
+	// is never sent to a server.
+	if frontendURL != "" {
+		fragment := url.Values{
+			"access_token":  {tokens.Token},
+			"refresh_token": {tokens.RefreshToken},
+			"token_type":    {tokens.TokenType},
+			"expires_in":    {strconv.Itoa(tokens.ExpiresIn)},
+		}
+		http.Redirect(w, r, frontendURL+"#"+fragment.Encode(), http.StatusFound)
+		slog.InfoContext(r.Context(), "Successfully handled OAuth login", "provider", provider.Name(), "user_id", user.ID)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(tokens); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding OAuth login response", "user_id", user.ID, "error", err)
+	}
+	slog.InfoContext(r.Context(), "Successfully handled OAuth login", "provider", provider.Name(), "user_id", user.ID)
+}
+
+// resolveUser returns the local account for identity:
+//  1. the account already linked to it,
+//  2. else the account with the same email, which is linked if the provider verified the email,
+//  3. else a newly created account.
+func (h *OAuthHandler) resolveUser(r *http.Request, identity *oauth.Identity) (*models.User, error) {
+	ctx := r.Context()
+	user, err := h.auth.repo.GetUserByIdentity(ctx, identity.Provider, identity.Subject)
+	if err != nil || user != nil {
+		return user, err
+	}
+
+	if identity.Email == "" {
+		return nil, fmt.Errorf("provider returned no email address")
+	}
+	link := models.UserIdentity{Provider: identity.Provider, Subject: identity.Subject, Email: identity.Email}
+
+	existing, err := h.auth.repo.GetUserByEmail(ctx, identity.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		if !identity.EmailVerified {
+			return nil, errEmailBelongsToAccount
+		}
+		link.UserID = existing.ID
+		if err := h.auth.repo.LinkIdentity(ctx, link, true); err != nil {
+			return nil, err
+		}
+		slog.InfoContext(ctx, "Linked OAuth identity to existing user by verified email", "provider", identity.Provider, "user_id", existing.ID)
+		return h.auth.repo.GetUserByID(ctx, existing.ID)
+	}
+
+	return h.createUser(r, identity, link)
+}
+
+// createUser registers a new account for identity. The account gets a random
+// password nobody knows; the user can set one later with the password reset flow.
+func (h *OAuthHandler) createUser(r *http.Request, identity *oauth.Identity, link models.UserIdentity) (*models.User, error) {
+	ctx := r.Context()
+	randomPassword, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := utils.HashPassword(randomPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	user := models.User{
+		Email:       utils.NormalizeEmail(identity.Email),
+		Password:    hashedPassword,
+		DisplayName: identity.Name,
+		AvatarURL:   identity.Picture,
+	}
+	if identity.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	// An account whose email the provider did not verify gets a verification
+	// email, so its registered event carries a verification token.
+	var verificationToken string
+	var verification *models.EmailVerificationToken
+	if !identity.EmailVerified {
+		verificationToken, err = utils.GenerateOpaqueToken()
+		if err != nil {
+			return nil, err
+		}
+		verification = &models.EmailVerificationToken{
+			TokenHash: utils.HashToken(verificationToken),
+			ExpiresAt: time.Now().Add(utils.EmailVerificationTTL()),
+		}
+	}
+	newEvent := func(userID int) events.Event {
+		event := events.UserRegisteredEvent{
+			UserID:   userID,
+			Email:    user.Email,
+			Username: user.Username,
+		}
+		if verification != nil {
+			event.VerificationToken = verificationToken
+			event.VerificationExpiresAt = &verification.ExpiresAt
+		}
+		return event
+	}
+
+	base := usernameFromEmail(identity.Email)
+	var userID int
+	for attempt := 0; attempt < maxUsernameAttempts; attempt++ {
+		user.Username = base
+		if attempt > 0 {
+			user.Username = fmt.Sprintf("%s%d", base, rand.IntN(10000))
+		}
+		userID, err = h.auth.repo.CreateUserWithIdentity(ctx, user, link, verification, newEvent)
+		if !errors.Is(err, repository.ErrUsernameTaken) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Registered user via OAuth login", "user_id", userID, "username", user.Username, "provider", identity.Provider)
+	h.auth.audit(r, models.AuditRegister, userID, models.AuditSuccess, "oauth:"+identity.Provider)
+
+	return h.auth.repo.GetUserByID(ctx, userID)
+}
+
+// usernameFromEmail derives a username from the local part of email, keeping
+// only letters, digits, dots, dashes and underscores.
+func usernameFromEmail(email string) string {
+	local, _, _ := strings.Cut(email, "@")
+	var b strings.Builder
+	for _, r := range strings.ToLower(local) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '-' || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+	name := b.String()
+	if len(name) > 24 { // Leaves room for a numeric suffix within the 30 character limit
+		name = name[:24]
+	}
+	if len(name) < 2 {
+		name = "user"
+	}
+	return name
+}
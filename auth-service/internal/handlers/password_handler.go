@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"auth-service/internal/events"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+	"cozy-go/shared/problem"
+)
+
+// forgotPasswordMessage is returned for every well-formed request, so the
+// response never reveals whether an account exists for the email.
+const forgotPasswordMessage = "If an account exists for that email, a password reset link has been sent"
+
+// emailRequestTimeout bounds the background work started by ForgotPassword and ResendVerification.
+const emailRequestTimeout = 10 * time.Second
+
+// checkPasswordPolicy checks a new password, sent in the request field field,
+// against the policy. personalInfo (username, email) must not appear in it. If
+// the password is rejected, a 400 listing every broken rule is written and
+// false is returned.
+func (h *AuthHandler) checkPasswordPolicy(w http.ResponseWriter, r *http.Request, field, password string, personalInfo ...string) bool {
+	if h.passwordPolicy == nil {
+		return true
+	}
+	violations := h.passwordPolicy.Check(password, personalInfo...)
+	if len(violations) == 0 {
+		return true
+	}
+	fields := make([]problem.FieldError, 0, len(violations))
+	for _, v := range violations {
+		fields = append(fields, problem.FieldError{Field: field, Code: v.Rule, Message: v.Message})
+	}
+	problem.Fields(w, r, "Password does not meet the requirements", fields...)
+	return false
+}
+
+// ForgotPassword handles POST /password/forgot.
+// The lookup, token creation and event publishing run in the background so the
+// response time is the same whether or not the email belongs to an account.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	// Requests over the per-email limit get the same response, they just send nothing
+	if ok, _ := h.resetLimiter.Allow(r.Context(), utils.NormalizeEmail(req.Email)); ok {
+		// Detach from the request so the work is not cancelled once the response is sent
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), emailRequestTimeout)
+		go func() {
+			defer cancel()
+			h.sendPasswordReset(ctx, req.Email)
+		}()
+	} else {
+		slog.InfoContext(r.Context(), "Password reset rate limit exceeded for email, not sending")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": forgotPasswordMessage})
+}
+
+// sendPasswordReset creates a reset token for the account with email (if any)
+// and publishes a PasswordResetRequestedEvent for notification-service to email.
+func (h *AuthHandler) sendPasswordReset(ctx context.Context, email string) {
+	user, err := h.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error looking up user for password reset", "error", err)
+		return
+	}
+	if user == nil {
+		slog.InfoContext(ctx, "Password reset requested for unknown email, ignoring")
+		return
+	}
+
+	rawToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to generate password reset token", "user_id", user.ID, "error", err)
+		return
+	}
+	expiresAt := time.Now().Add(utils.PasswordResetTTL())
+
+	if err := h.repo.CreatePasswordResetToken(ctx, user.ID, utils.HashToken(rawToken), expiresAt); err != nil {
+		slog.ErrorContext(ctx, "Failed to store password reset token", "user_id", user.ID, "error", err)
+		return
+	}
+
+	if h.eventPublisher == nil {
+		slog.WarnContext(ctx, "Event publisher not configured in handler, password reset email will not be sent")
+		return
+	}
+	event := events.PasswordResetRequestedEvent{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Username:  user.Username,
+		Token:     rawToken,
+		ExpiresAt: expiresAt,
+	}
+	if err := h.eventPublisher.Publish(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish password reset event", "user_id", user.ID, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "Password reset requested", "user_id", user.ID)
+}
+
+// ResetPassword handles POST /password/reset.
+// A valid token sets the new password and signs the user out of every session.
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	// Look up the account first so the new password can be checked against its username and email
+	tokenHash := utils.HashToken(req.Token)
+	user, err := h.repo.GetPasswordResetUser(r.Context(), tokenHash)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to look up password reset token", "error", err)
+		problem.Error(w, r, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		h.audit(r, models.AuditPasswordReset, 0, models.AuditFailure, "invalid_token")
+		problem.Error(w, r, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+	if !h.checkPasswordPolicy(w, r, "new_password", req.NewPassword, user.Username, user.Email) {
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		problem.Error(w, r, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	// The token is redeemed atomically here; it may have been used since the lookup
+	userID, err := h.repo.ResetPassword(r.Context(), tokenHash, hashedPassword, func(userID int) events.Event {
+		return events.PasswordChangedEvent{
+			UserID:   userID,
+			Email:    user.Email,
+			Username: user.Username,
+			Reason:   events.PasswordChangedByReset,
+		}
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidResetToken) {
+			h.audit(r, models.AuditPasswordReset, 0, models.AuditFailure, "invalid_token")
+			problem.Error(w, r, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to reset password", "error", err)
+		problem.Error(w, r, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	h.audit(r, models.AuditPasswordReset, userID, models.AuditSuccess, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password has been reset"})
+	slog.InfoContext(r.Context(), "Successfully handled ResetPassword request", "user_id", userID)
+}
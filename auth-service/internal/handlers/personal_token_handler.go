@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+	"cozy-go/shared/problem"
+)
+
+// defaultPersonalTokenDays is the lifetime of a personal access token when the
+// request does not set expires_in_days.
+const defaultPersonalTokenDays = 90
+
+// personalTokenPrefixLen is how much of a token is kept in clear text for display.
+const personalTokenPrefixLen = len(utils.PersonalAccessTokenPrefix) + 4
+
+// CreatePersonalAccessToken handles POST /me/tokens.
+// The token is returned once; only its hash is stored.
+func (h *AuthHandler) CreatePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreatePersonalAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	rawToken, err := utils.GeneratePersonalAccessToken()
+	if err != nil {
+		problem.Error(w, r, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+	token := models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      req.Name,
+		TokenHash: utils.HashToken(rawToken),
+		Prefix:    rawToken[:personalTokenPrefixLen],
+		Scopes:    req.Scopes,
+	}
+	days := defaultPersonalTokenDays
+	if req.ExpiresInDays != nil {
+		days = *req.ExpiresInDays
+	}
+	if days > 0 {
+		expiresAt := time.Now().AddDate(0, 0, days)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := h.repo.CreatePersonalAccessToken(r.Context(), &token); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to create personal access token", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to create token", http.StatusInternalServerError)
+		return
+	}
+	h.audit(r, models.AuditPersonalTokenCreated, userID, models.AuditSuccess, "token "+strconv.FormatInt(token.ID, 10))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.CreatePersonalAccessTokenResponse{Token: rawToken, PersonalAccessToken: token})
+	slog.InfoContext(r.Context(), "Created personal access token", "token_id", token.ID, "scopes", strings.Join(token.Scopes, " "), "user_id", userID)
+}
+
+// ListPersonalAccessTokens handles GET /me/tokens.
+func (h *AuthHandler) ListPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	tokens, err := h.repo.ListPersonalAccessTokens(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list personal access tokens", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to list tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// DeletePersonalAccessToken handles DELETE /me/tokens/{id}.
+func (h *AuthHandler) DeletePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		problem.Error(w, r, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.DeletePersonalAccessToken(r.Context(), userID, id); err != nil {
+		if errors.Is(err, repository.ErrTokenNotFound) {
+			problem.Error(w, r, "Token not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to delete personal access token", "token_id", id, "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to delete token", http.StatusInternalServerError)
+		return
+	}
+	h.audit(r, models.AuditPersonalTokenDeleted, userID, models.AuditSuccess, "token "+strconv.FormatInt(id, 10))
+
+	w.WriteHeader(http.StatusNoContent)
+	slog.InfoContext(r.Context(), "Deleted personal access token", "token_id", id, "user_id", userID)
+}
+
+// introspectPersonalAccessToken answers POST /token/introspect for a personal
+// access token, reporting its owner and scopes. Each introspection counts as a use.
+func (h *AuthHandler) introspectPersonalAccessToken(w http.ResponseWriter, r *http.Request, rawToken string) {
+	resp := models.IntrospectionResponse{Active: false}
+
+	token, err := h.repo.UsePersonalAccessToken(r.Context(), utils.HashToken(rawToken))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to introspect personal access token", "error", err)
+		problem.Error(w, r, "Failed to introspect token", http.StatusInternalServerError)
+		return
+	}
+	if token != nil {
+		resp = models.IntrospectionResponse{
+			Active:    true,
+			Subject:   strconv.Itoa(token.UserID),
+			TokenID:   "pat-" + strconv.FormatInt(token.ID, 10),
+			TokenType: "personal_access_token",
+			Scope:     strings.Join(token.Scopes, " "),
+		}
+		if token.ExpiresAt != nil {
+			resp.ExpiresAt = token.ExpiresAt.Unix()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding introspection response", "error", err)
+	}
+}
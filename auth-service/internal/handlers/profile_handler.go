@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"auth-service/internal/events"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+	"cozy-go/shared/problem"
+)
+
+// UpdateMe handles PATCH /me.
+// Only the fields present in the body are changed. A new email address must be
+// verified again; notification-service emails the link (and tells the old address).
+func (h *AuthHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req models.UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	// Normalized the same way as at registration
+	if req.Username != nil {
+		*req.Username = utils.NormalizeUsername(*req.Username)
+	}
+	if req.Email != nil {
+		*req.Email = utils.NormalizeEmail(*req.Email)
+	}
+
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	current, err := h.repo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching user for profile update", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+	if current == nil {
+		problem.Error(w, r, "Unauthorized: User not found", http.StatusUnauthorized)
+		return
+	}
+
+	// A new address gets a verification link, sent by notification-service
+	// from the EmailChangedEvent queued with the update
+	var verification *models.EmailVerificationToken
+	var newEvent func(user models.User, oldEmail string) events.Event
+	if req.Email != nil {
+		verificationToken, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			problem.Error(w, r, "Failed to update profile", http.StatusInternalServerError)
+			return
+		}
+		verification = &models.EmailVerificationToken{
+			TokenHash: utils.HashToken(verificationToken),
+			ExpiresAt: time.Now().Add(utils.EmailVerificationTTL()),
+		}
+		newEvent = func(user models.User, oldEmail string) events.Event {
+			return events.EmailChangedEvent{
+				UserID:                user.ID,
+				Username:              user.Username,
+				OldEmail:              oldEmail,
+				NewEmail:              user.Email,
+				VerificationToken:     verificationToken,
+				VerificationExpiresAt: verification.ExpiresAt,
+			}
+		}
+	}
+
+	updated, err := h.repo.UpdateProfile(r.Context(), userID, req, verification, newEvent)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrUsernameTaken), errors.Is(err, repository.ErrEmailTaken):
+			writeIdentityConflict(w, r, err)
+		case errors.Is(err, repository.ErrUserNotFound):
+			problem.Error(w, r, "Unauthorized: User not found", http.StatusUnauthorized)
+		default:
+			slog.ErrorContext(r.Context(), "Failed to update profile", "user_id", userID, "error", err)
+			problem.Error(w, r, "Failed to update profile", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(models.NewUserResponse(updated)); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding UpdateMe response", "user_id", userID, "error", err)
+	}
+	slog.InfoContext(r.Context(), "Successfully handled UpdateMe request", "user_id", userID)
+}
+
+// ChangePassword handles POST /me/password.
+// Changing the password signs out every session; the response carries fresh
+// tokens so the client making the change stays logged in.
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	if !h.checkCurrentPassword(w, r, userID, req.CurrentPassword, models.AuditPasswordChange) {
+		return
+	}
+	current, err := h.repo.GetUserByID(r.Context(), userID)
+	if err != nil || current == nil {
+		slog.ErrorContext(r.Context(), "Error fetching user", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+	if !h.checkPasswordPolicy(w, r, "new_password", req.NewPassword, current.Username, current.Email) {
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		problem.Error(w, r, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+	event := events.PasswordChangedEvent{
+		UserID:   current.ID,
+		Email:    current.Email,
+		Username: current.Username,
+		Reason:   events.PasswordChangedByUser,
+	}
+	if err := h.repo.UpdatePassword(r.Context(), userID, hashedPassword, event); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to update password", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+	h.audit(r, models.AuditPasswordChange, userID, models.AuditSuccess, "")
+
+	// Re-read the user to pick up the bumped token version
+	user, err := h.repo.GetUserByID(r.Context(), userID)
+	if err != nil || user == nil {
+		slog.ErrorContext(r.Context(), "Error fetching user", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+	tokens, err := h.issueTokens(r, *user, "")
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to issue tokens", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	tokens.User = models.NewUserResponse(user)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(tokens); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding ChangePassword response", "user_id", userID, "error", err)
+	}
+	slog.InfoContext(r.Context(), "Successfully handled ChangePassword request", "user_id", userID)
+}
+
+// DeleteMe handles DELETE /me.
+// The account is deleted together with a UserDeletedEvent in the outbox, which
+// lets task-service purge the user's projects and tasks.
+func (h *AuthHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	user, err := h.repo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching user", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		problem.Error(w, r, "Unauthorized: User not found", http.StatusUnauthorized)
+		return
+	}
+
+	if !h.checkCurrentPassword(w, r, userID, req.Password, models.AuditAccountDeleted) {
+		return
+	}
+
+	event := events.UserDeletedEvent{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Username: user.Username,
+	}
+	if err := h.repo.DeleteUser(r.Context(), userID, event); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to delete user", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	h.audit(r, models.AuditAccountDeleted, userID, models.AuditSuccess, "")
+
+	w.WriteHeader(http.StatusNoContent)
+	slog.InfoContext(r.Context(), "Successfully handled DeleteMe request", "user_id", userID)
+}
+
+// checkCurrentPassword verifies password against the user's stored hash and
+// writes an error response if it does not match. A wrong password is recorded in
+// the audit log as a failed eventType.
+func (h *AuthHandler) checkCurrentPassword(w http.ResponseWriter, r *http.Request, userID int, password string, eventType string) bool {
+	hash, err := h.repo.GetPasswordHash(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			problem.Error(w, r, "Unauthorized: User not found", http.StatusUnauthorized)
+			return false
+		}
+		slog.ErrorContext(r.Context(), "Error fetching password hash", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to verify password", http.StatusInternalServerError)
+		return false
+	}
+	if !utils.CheckPassword(hash, password) {
+		h.audit(r, eventType, userID, models.AuditFailure, "invalid_current_password")
+		problem.Error(w, r, "Current password is incorrect", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"auth-service/internal/models"
+	"auth-service/repository"
+	"cozy-go/shared/problem"
+)
+
+// ListSessions handles GET /me/sessions, the devices the user is logged in on.
+// The session of the access token used for the request is marked as current.
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := h.repo.ListSessions(r.Context(), userID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list sessions", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+	if claims, ok := claimsFromContext(r); ok && claims.SessionID != "" {
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == claims.SessionID
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RevokeSession handles DELETE /me/sessions/{id}. The session's refresh tokens
+// stop working immediately and its access tokens fail the revocation check.
+// Revoking the current session is allowed and works like POST /logout.
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	sessionID := r.PathValue("id")
+	validate := problem.NewValidator()
+	if err := validate.Var(sessionID, "required,uuid"); err != nil {
+		problem.Error(w, r, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.RevokeSession(r.Context(), userID, sessionID); err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			problem.Error(w, r, "Session not found", http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to revoke session", "session_id", sessionID, "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, models.AuditSessionRevoked, userID, models.AuditSuccess, "session "+sessionID)
+
+	w.WriteHeader(http.StatusNoContent)
+	slog.InfoContext(r.Context(), "User", "user_id", userID, "session_id", sessionID)
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-service/internal/middleware"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+	"cozy-go/shared/problem"
+)
+
+// RefreshToken handles POST /token/refresh.
+// It exchanges a valid refresh token for a new access token and a new refresh token.
+// The presented token is revoked (rotated). Presenting an already rotated token is
+// treated as theft: the whole token family is revoked and the client must log in again.
+func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	stored, err := h.repo.GetRefreshTokenByHash(r.Context(), utils.HashToken(req.RefreshToken))
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error looking up refresh token", "error", err)
+		problem.Error(w, r, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+	if stored == nil {
+		h.audit(r, models.AuditTokenRefresh, 0, models.AuditFailure, "invalid_token")
+		problem.Error(w, r, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// A revoked token being presented again means it leaked (or a client replayed it).
+	if stored.RevokedAt != nil {
+		slog.InfoContext(r.Context(), "Refresh token reuse detected", "user_id", stored.UserID, "family_id", stored.FamilyID)
+		h.revokeFamily(r.Context(), stored.FamilyID)
+		h.audit(r, models.AuditTokenRefresh, stored.UserID, models.AuditFailure, "reuse_detected")
+		problem.Error(w, r, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		h.audit(r, models.AuditTokenRefresh, stored.UserID, models.AuditFailure, "expired")
+		problem.Error(w, r, "Refresh token expired", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := h.repo.GetUserByID(r.Context(), stored.UserID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Error fetching user", "user_id", stored.UserID, "error", err)
+		problem.Error(w, r, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+	if user == nil || user.Disabled() {
+		// User deleted (or disabled) since the token was issued
+		h.revokeFamily(r.Context(), stored.FamilyID)
+		problem.Error(w, r, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// The token family is the session, so the new access token stays in it
+	accessToken, err := utils.GenerateJWT(*user, stored.FamilyID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to generate access token", "user_id", user.ID, "error", err)
+		problem.Error(w, r, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	rawRefresh, next, err := newRefreshToken(user.ID, stored.FamilyID)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to generate refresh token", "user_id", user.ID, "error", err)
+		problem.Error(w, r, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.repo.RotateRefreshToken(r.Context(), stored.ID, next); err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenReused) {
+			// Lost a race with another refresh of the same token; treat it as reuse
+			slog.InfoContext(r.Context(), "Concurrent refresh token reuse detected", "user_id", stored.UserID, "family_id", stored.FamilyID)
+			h.revokeFamily(r.Context(), stored.FamilyID)
+			h.audit(r, models.AuditTokenRefresh, stored.UserID, models.AuditFailure, "reuse_detected")
+			problem.Error(w, r, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to rotate refresh token", "user_id", user.ID, "error", err)
+		problem.Error(w, r, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+	h.audit(r, models.AuditTokenRefresh, user.ID, models.AuditSuccess, "")
+
+	resp := models.TokenResponse{
+		Token:        accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+		RefreshToken: rawRefresh,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding refresh response", "user_id", user.ID, "error", err)
+	}
+	slog.InfoContext(r.Context(), "Successfully rotated refresh token", "user_id", user.ID)
+}
+
+// issueTokens creates an access token and a stored refresh token for user.
+// An empty familyID starts a new token family, i.e. a new login, and records
+// a session for it with the client's user agent and IP address.
+func (h *AuthHandler) issueTokens(r *http.Request, user models.User, familyID string) (*models.TokenResponse, error) {
+	ctx := r.Context()
+	if familyID == "" {
+		var err error
+		familyID, err = utils.NewUUID()
+		if err != nil {
+			return nil, err
+		}
+		session := &models.Session{
+			ID:        familyID,
+			UserID:    user.ID,
+			UserAgent: r.UserAgent(),
+			IPAddress: middleware.ClientIP(r),
+		}
+		if len(session.UserAgent) > maxUserAgentLength {
+			session.UserAgent = session.UserAgent[:maxUserAgentLength]
+		}
+		if err := h.repo.CreateSession(ctx, session); err != nil {
+			return nil, err
+		}
+	}
+
+	accessToken, err := utils.GenerateJWT(user, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	rawRefresh, stored, err := newRefreshToken(user.ID, familyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.repo.CreateRefreshToken(ctx, stored); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return &models.TokenResponse{
+		Token:        accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+		RefreshToken: rawRefresh,
+	}, nil
+}
+
+// revokeFamily revokes a refresh token family, logging (but not returning) failures.
+func (h *AuthHandler) revokeFamily(ctx context.Context, familyID string) {
+	if err := h.repo.RevokeRefreshTokenFamily(ctx, familyID); err != nil {
+		slog.ErrorContext(ctx, "Error revoking refresh token family", "family_id", familyID, "error", err)
+	}
+}
+
+// newRefreshToken generates a raw refresh token and the record to store for it.
+func newRefreshToken(userID int, familyID string) (string, *models.RefreshToken, error) {
+	raw, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+	return raw, &models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(raw),
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL()),
+	}, nil
+}
+
+// Logout handles POST /logout.
+// It revokes the access token used for the request and ends its session. If a
+// refresh token is supplied in the body, the refresh token family it belongs to
+// is revoked as well.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := claimsFromContext(r)
+	if !ok {
+		problem.Error(w, r, "Unauthorized: Token claims missing from context", http.StatusUnauthorized)
+		return
+	}
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// The body is optional; an empty body just logs out the access token
+	var req models.LogoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	expiresAt := time.Now().Add(utils.AccessTokenTTL())
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	if err := h.repo.RevokeAccessToken(r.Context(), claims.ID, userID, expiresAt); err != nil {
+		problem.Error(w, r, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	if req.RefreshToken != "" {
+		stored, err := h.repo.GetRefreshTokenByHash(r.Context(), utils.HashToken(req.RefreshToken))
+		if err != nil {
+			problem.Error(w, r, "Failed to log out", http.StatusInternalServerError)
+			return
+		}
+		// Never let one user revoke another user's session
+		if stored != nil && stored.UserID == userID {
+			if err := h.repo.RevokeRefreshTokenFamily(r.Context(), stored.FamilyID); err != nil {
+				problem.Error(w, r, "Failed to log out", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	// Tokens issued before session tracking have no session
+	if claims.SessionID != "" {
+		if err := h.repo.RevokeSession(r.Context(), userID, claims.SessionID); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+			problem.Error(w, r, "Failed to log out", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.audit(r, models.AuditLogout, userID, models.AuditSuccess, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out"})
+	slog.InfoContext(r.Context(), "Successfully handled Logout request", "user_id", userID)
+}
+
+// LogoutAll handles POST /logout-all.
+// It invalidates every access token and refresh token issued to the user.
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r)
+	if err != nil {
+		problem.Error(w, r, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	if _, err := h.repo.IncrementTokenVersion(r.Context(), userID); err != nil {
+		problem.Error(w, r, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+	if err := h.repo.RevokeAllRefreshTokens(r.Context(), userID); err != nil {
+		problem.Error(w, r, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, models.AuditLogoutAll, userID, models.AuditSuccess, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out of all sessions"})
+	slog.InfoContext(r.Context(), "Successfully handled LogoutAll request", "user_id", userID)
+}
+
+// Introspect handles POST /token/introspect.
+// Other services (task-service) use it to learn whether an access token is still
+// active, i.e. validly signed, unexpired and not revoked. Invalid tokens are not
+// an error: the response is simply {"active": false}. Callers must present the
+// introspection secret as a bearer token if one is set.
+func (h *AuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	if h.serviceSecret != "" {
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(secret), []byte(h.serviceSecret)) != 1 {
+			problem.Error(w, r, "Invalid service credentials", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var req models.IntrospectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	resp := models.IntrospectionResponse{Active: false}
+
+	if utils.IsPersonalAccessToken(req.Token) {
+		h.introspectPersonalAccessToken(w, r, req.Token)
+		return
+	}
+
+	claims, err := utils.ParseJWT(req.Token)
+	if err == nil {
+		userID, convErr := strconv.Atoi(claims.Subject)
+		if convErr == nil {
+			revoked, err := h.repo.IsAccessTokenRevoked(r.Context(), claims.ID, userID, claims.TokenVersion, claims.SessionID)
+			if err != nil {
+				problem.Error(w, r, "Failed to introspect token", http.StatusInternalServerError)
+				return
+			}
+			if !revoked {
+				resp = models.IntrospectionResponse{
+					Active:    true,
+					Subject:   claims.Subject,
+					TokenID:   claims.ID,
+					TokenType: "access_token",
+				}
+				if claims.ExpiresAt != nil {
+					resp.ExpiresAt = claims.ExpiresAt.Unix()
+				}
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.ErrorContext(r.Context(), "Error encoding introspection response", "error", err)
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"auth-service/internal/events"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+	"cozy-go/shared/problem"
+)
+
+// resendVerificationMessage is returned for every well-formed resend request,
+// so the response never reveals whether an account exists for the email.
+const resendVerificationMessage = "If an unverified account exists for that email, a new verification link has been sent"
+
+// VerifyEmail handles GET /verify-email?token=.
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		problem.Error(w, r, "Missing verification token", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := h.repo.VerifyEmail(r.Context(), utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidVerificationToken) {
+			problem.Error(w, r, "Invalid or expired verification token", http.StatusBadRequest)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Failed to verify email", "error", err)
+		problem.Error(w, r, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email address verified"})
+	slog.InfoContext(r.Context(), "Successfully handled VerifyEmail request", "user_id", userID)
+}
+
+// ResendVerification handles POST /verify-email/resend.
+// Like ForgotPassword, the work runs in the background and the response is the
+// same whether or not the email belongs to an unverified account.
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	var req models.ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	validate := problem.NewValidator()
+	if err := validate.Struct(req); err != nil {
+		problem.Validation(w, r, err)
+		return
+	}
+
+	// Requests over the per-email limit get the same response, they just send nothing
+	if ok, _ := h.resendLimiter.Allow(r.Context(), utils.NormalizeEmail(req.Email)); ok {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), emailRequestTimeout)
+		go func() {
+			defer cancel()
+			h.resendVerification(ctx, req.Email)
+		}()
+	} else {
+		slog.InfoContext(r.Context(), "Verification resend rate limit exceeded for email, not sending")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": resendVerificationMessage})
+}
+
+// resendVerification issues a new verification token for an unverified account
+// and publishes a VerificationRequestedEvent so notification-service emails it.
+func (h *AuthHandler) resendVerification(ctx context.Context, email string) {
+	user, err := h.repo.GetUserByEmail(ctx, email)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error looking up user for verification resend", "error", err)
+		return
+	}
+	if user == nil || user.EmailVerified() {
+		return
+	}
+	if h.eventPublisher == nil {
+		slog.InfoContext(ctx, "Event publisher not configured in handler, verification email will not be sent")
+		return
+	}
+
+	token, expiresAt, err := h.createVerificationToken(ctx, user.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create email verification token", "user_id", user.ID, "error", err)
+		return
+	}
+	event := events.VerificationRequestedEvent{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Username:  user.Username,
+		Token:     token,
+		ExpiresAt: expiresAt,
+	}
+	if err := h.eventPublisher.Publish(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish verification event", "user_id", user.ID, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "Verification email re-requested", "user_id", user.ID)
+}
+
+// createVerificationToken stores a new email verification token for userID and
+// returns the raw token with its expiry.
+func (h *AuthHandler) createVerificationToken(ctx context.Context, userID int) (string, time.Time, error) {
+	rawToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(utils.EmailVerificationTTL())
+	if err := h.repo.CreateEmailVerificationToken(ctx, userID, utils.HashToken(rawToken), expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+	return rawToken, expiresAt, nil
+}
@@ -2,79 +2,157 @@ package middleware
 
 import (
 	"context" // Import context
-	"errors"  // Import errors
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/golang-jwt/jwt/v5"
+	"auth-service/internal/utils"
+	"cozy-go/shared/logging"
+	"cozy-go/shared/problem"
 )
 
 // Define context key type (can be shared or redefined)
 type contextKey string
+
 const UserIDContextKey contextKey = "userID"
 
+// ClaimsContextKey holds the *utils.Claims of the validated access token.
+const ClaimsContextKey contextKey = "claims"
+
+// RevocationChecker decides whether a validly signed access token has been revoked.
+// It is implemented by repository.AuthRepository.
+type RevocationChecker interface {
+	IsAccessTokenRevoked(ctx context.Context, jti string, userID int, tokenVersion int, sessionID string) (bool, error)
+}
+
+// SessionTracker records that a login session is still in use.
+// It is implemented by repository.AuthRepository.
+type SessionTracker interface {
+	TouchSession(ctx context.Context, sessionID string, staleBefore time.Time) error
+}
+
+// Authenticator validates bearer tokens for protected routes.
+type Authenticator struct {
+	revocations RevocationChecker
+
+	// Optional session last-seen tracking, see TrackSessions
+	sessions      SessionTracker
+	touchInterval time.Duration
+	touchMu       sync.Mutex
+	lastTouched   map[string]time.Time
+}
+
+// NewAuthenticator creates an Authenticator. A nil checker disables revocation checks.
+func NewAuthenticator(revocations RevocationChecker) *Authenticator {
+	return &Authenticator{revocations: revocations}
+}
+
+// TrackSessions makes JWTAuth update the last-seen time of the session an access
+// token belongs to. Updates are lazy: a session is written at most once per
+// interval per instance, and the tracker skips rows seen within the interval.
+func (a *Authenticator) TrackSessions(tracker SessionTracker, interval time.Duration) {
+	a.sessions = tracker
+	a.touchInterval = interval
+	a.lastTouched = make(map[string]time.Time)
+}
+
+// touchSession updates the last-seen time of sessionID unless this instance
+// already did so within the touch interval. Failures are logged only.
+func (a *Authenticator) touchSession(ctx context.Context, sessionID string) {
+	if a.sessions == nil || sessionID == "" {
+		return
+	}
+	now := time.Now()
+	a.touchMu.Lock()
+	if last, ok := a.lastTouched[sessionID]; ok && now.Sub(last) < a.touchInterval {
+		a.touchMu.Unlock()
+		return
+	}
+	a.lastTouched[sessionID] = now
+	// Forget sessions that have not been used for a while so the map stays small
+	if len(a.lastTouched) > 10000 {
+		for id, last := range a.lastTouched {
+			if now.Sub(last) >= a.touchInterval {
+				delete(a.lastTouched, id)
+			}
+		}
+	}
+	a.touchMu.Unlock()
 
-func JWTAuth(next http.Handler) http.Handler {
+	if err := a.sessions.TouchSession(ctx, sessionID, now.Add(-a.touchInterval)); err != nil {
+		slog.ErrorContext(ctx, "Failed to update session last seen", "session_id", sessionID, "error", err)
+	}
+}
+
+func (a *Authenticator) JWTAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Missing token", http.StatusUnauthorized)
+			problem.Error(w, r, "Missing token", http.StatusUnauthorized)
 			return
 		}
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		log.Println("Auth Service Middleware: Received Token:", tokenString)
 
-		// Use the correct environment variable and handle missing secret
-		secretKey := os.Getenv("JWT_SECRET")
-		if secretKey == "" {
-			log.Println("Error: JWT_SECRET environment variable not set in auth-service middleware.")
-			http.Error(w, "Internal server configuration error", http.StatusInternalServerError)
+		// Parse using the same claims as generation and task-service validation
+		claims, err := utils.ParseJWT(tokenString)
+		if err != nil {
+			slog.InfoContext(r.Context(), "Token parsing/validation failed", "error", err)
+			problem.Error(w, r, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
-		// Parse using RegisteredClaims to match generation and task-service validation
-		token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				// Log the unexpected algorithm type found in the token's header
-				alg := "unknown"
-				if token.Header != nil {
-					if algStr, ok := token.Header["alg"].(string); ok {
-						alg = algStr
-					}
-				}
-				log.Printf("Auth Service Middleware: Unexpected signing method: %v", alg)
-				return nil, errors.New("invalid signing method") // Return a specific error
-			}
-			return []byte(secretKey), nil
-		})
-
+		userIDStr := claims.Subject
+		userID, err := strconv.Atoi(userIDStr)
 		if err != nil {
-			log.Printf("Auth Service Middleware: Token parsing/validation error: %v", err)
-			// Check for specific errors if needed (e.g., expired token)
-			// if errors.Is(err, jwt.ErrTokenExpired) { ... }
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			slog.InfoContext(r.Context(), "Invalid user ID (sub) in token claims", "sub", userIDStr)
+			problem.Error(w, r, "Invalid token claims", http.StatusUnauthorized)
 			return
 		}
 
-		// Extract claims if needed within auth-service protected routes
-		if claims, ok := token.Claims.(*jwt.RegisteredClaims); ok && token.Valid {
-			userIDStr := claims.Subject
-			if userIDStr == "" {
-				log.Println("Auth Service Middleware: User ID (sub) not found in token claims")
-				http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		if a.revocations != nil {
+			revoked, err := a.revocations.IsAccessTokenRevoked(r.Context(), claims.ID, userID, claims.TokenVersion, claims.SessionID)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Token revocation check failed", "error", err)
+				problem.Error(w, r, "Unable to verify token", http.StatusServiceUnavailable)
 				return
 			}
-			log.Printf("Auth Service Middleware: Token validated for user ID (sub): %s", userIDStr)
-			// Add user ID to context if subsequent handlers in auth-service need it
-			ctx := context.WithValue(r.Context(), UserIDContextKey, userIDStr)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		} else {
-			log.Println("Auth Service Middleware: Invalid Token (claims parsing failed or token invalid)")
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			if revoked {
+				slog.InfoContext(r.Context(), "Revoked token presented", "jti", claims.ID, "user_id", userIDStr)
+				problem.Error(w, r, "Token has been revoked", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		a.touchSession(r.Context(), claims.SessionID)
+
+		slog.DebugContext(r.Context(), "Token validated", "user_id", userIDStr)
+		// Tag the request's log records and access log line with the user
+		logging.SetUserID(r.Context(), userIDStr)
+		// Add user ID and claims to context for subsequent handlers in auth-service
+		ctx := context.WithValue(r.Context(), UserIDContextKey, userIDStr)
+		ctx = context.WithValue(ctx, ClaimsContextKey, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireRole rejects requests whose access token does not carry role with 403.
+// It must be wrapped by JWTAuth, which stores the claims.
+func RequireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(ClaimsContextKey).(*utils.Claims)
+		if !ok || claims == nil {
+			problem.Error(w, r, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if claims.Role != role {
+			slog.InfoContext(r.Context(), "Access denied for role", "user_id", claims.Subject, "role", claims.Role, "method", r.Method, "path", r.URL.Path)
+			problem.Error(w, r, "Forbidden", http.StatusForbidden)
 			return
 		}
+		next.ServeHTTP(w, r)
 	})
 }
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-service/internal/ratelimit"
+	"cozy-go/shared/problem"
+)
+
+// ClientIP returns the IP address of the client that sent r. X-Forwarded-For is
+// only trusted when TRUST_PROXY_HEADERS=true (i.e. auth-service runs behind a
+// reverse proxy); the last entry is used because it is the one the proxy added.
+func ClientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY_HEADERS") == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// WriteTooManyRequests sends 429 with a Retry-After header (whole seconds, rounded up).
+func WriteTooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	problem.Error(w, r, message, http.StatusTooManyRequests)
+}
+
+// IPRateLimit rejects requests from client IPs that have exceeded limiter.
+func IPRateLimit(limiter *ratelimit.Limiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r)
+		if ok, retryAfter := limiter.Allow(r.Context(), ip); !ok {
+			slog.InfoContext(r.Context(), "Rate limit exceeded", "method", r.Method, "path", r.URL.Path, "ip", ip)
+			WriteTooManyRequests(w, r, retryAfter, "Too many requests, please try again later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -1,27 +1,432 @@
 package models
 
+import (
+	"strings"
+	"time"
+)
+
 type User struct {
 	ID       int    `json:"id"`
 	Username string `json:"username" validate:"required"`
 	Password string `json:"password" validate:"required"`
 	Email    string `json:"email" validate:"required,email"`
+	// TokenVersion is bumped to invalidate every access token issued to the user
+	TokenVersion int `json:"-"`
+	// EmailVerifiedAt is nil until the user follows the verification link
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	// Profile fields, editable via PATCH /me
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
+	Timezone    string `json:"timezone"` // IANA name, e.g. "Europe/Berlin"
+	Locale      string `json:"locale"`   // BCP 47 tag, e.g. "en-GB"
+	// MFAEnabled is true once the user has confirmed a TOTP enrollment
+	MFAEnabled bool `json:"-"`
+	// Brute-force protection: consecutive failed logins and the lockout they caused
+	FailedLoginAttempts int        `json:"-"`
+	LockedUntil         *time.Time `json:"-"`
+	// Role is RoleUser or RoleAdmin and is carried in access tokens
+	Role string `json:"-"`
+	// DisabledAt is set when an admin disables the account; disabled accounts cannot log in
+	DisabledAt *time.Time `json:"-"`
+}
+
+// Roles a user can have. Admins may use the /admin API.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Disabled reports whether an admin has disabled the account.
+func (u *User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
+// Locked reports whether the account is locked out at now.
+func (u *User) Locked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// EmailVerified reports whether the user has verified their email address.
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
 }
 
 type RegisterRequest struct {
-	Username string `json:"username" validate:"required"`
+	Username string `json:"username" validate:"required,excludes=@"`
 	Password string `json:"password" validate:"required"`
 	Email    string `json:"email" validate:"required,email"`
 }
 
+// LoginRequest is the payload for POST /login. Login is a username or an email
+// address; Email is still accepted from clients that predate username login.
 type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email"`
+	Login    string `json:"login,omitempty" validate:"required_without=Email,max=255"`
+	Email    string `json:"email,omitempty" validate:"required_without=Login,omitempty,email"`
 	Password string `json:"password" validate:"required"`
 }
 
+// Identifier returns the username or email address to log in with.
+func (r LoginRequest) Identifier() string {
+	if r.Login != "" {
+		return strings.TrimSpace(r.Login)
+	}
+	return strings.TrimSpace(r.Email)
+}
+
+// RefreshRequest is the payload for POST /token/refresh.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// LogoutRequest is the optional payload for POST /logout.
+// When a refresh token is given, its whole family is revoked as well.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// ForgotPasswordRequest is the payload for POST /password/forgot.
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordRequest is the payload for POST /password/reset.
+// Token is the raw token from the reset email.
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required"`
+}
+
+// MagicLinkRequest is the payload for POST /login/magic-link.
+type MagicLinkRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// MagicLinkVerifyRequest is the payload for POST /login/magic-link/verify.
+// Token is the raw token from the sign-in email.
+type MagicLinkVerifyRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ResendVerificationRequest is the payload for POST /verify-email/resend.
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// IntrospectionRequest is the payload for POST /token/introspect.
+type IntrospectionRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// IntrospectionResponse follows the shape of RFC 7662. Inactive tokens
+// only report {"active": false}.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Subject   string `json:"sub,omitempty"`
+	TokenID   string `json:"jti,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	// TokenType is "access_token" or "personal_access_token"
+	TokenType string `json:"token_type,omitempty"`
+	// Scope is the space separated list of scopes of a personal access token.
+	// Access tokens from /login are not scoped.
+	Scope string `json:"scope,omitempty"`
+}
+
 // UserResponse defines the user data sent back to the client (omits password)
 type UserResponse struct {
 	ID       int    `json:"id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	// EmailVerified lets clients prompt unverified users to check their inbox
+	EmailVerified bool   `json:"email_verified"`
+	DisplayName   string `json:"display_name"`
+	AvatarURL     string `json:"avatar_url"`
+	Timezone      string `json:"timezone"`
+	Locale        string `json:"locale"`
+	MFAEnabled    bool   `json:"mfa_enabled"`
+	Role          string `json:"role"`
 	// Add other safe fields here if needed
 }
+
+// NewUserResponse builds the client representation of user.
+func NewUserResponse(user *User) *UserResponse {
+	return &UserResponse{
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified(),
+		DisplayName:   user.DisplayName,
+		AvatarURL:     user.AvatarURL,
+		Timezone:      user.Timezone,
+		Locale:        user.Locale,
+		MFAEnabled:    user.MFAEnabled,
+		Role:          user.Role,
+	}
+}
+
+// UpdateProfileRequest is the payload for PATCH /me. Omitted (null) fields are left
+// unchanged; an empty display name or avatar URL clears the field. Changing the
+// email resets the account to unverified.
+type UpdateProfileRequest struct {
+	Username    *string `json:"username" validate:"omitnil,min=2,max=30,excludes=@"`
+	Email       *string `json:"email" validate:"omitnil,email,max=255"`
+	DisplayName *string `json:"display_name" validate:"omitnil,max=100"`
+	AvatarURL   *string `json:"avatar_url" validate:"omitnil,max=2048,eq=|http_url"`
+	Timezone    *string `json:"timezone" validate:"omitnil,timezone"`
+	Locale      *string `json:"locale" validate:"omitnil,bcp47_language_tag"`
+}
+
+// ChangePasswordRequest is the payload for POST /me/password.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+// DeleteAccountRequest is the payload for DELETE /me. The password confirms
+// the deletion, so a stolen access token alone cannot delete the account.
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// TokenResponse is returned by Login and by the refresh endpoint.
+// "token" is kept as the access token key for frontend compatibility.
+type TokenResponse struct {
+	Token        string        `json:"token"`
+	TokenType    string        `json:"token_type"`
+	ExpiresIn    int           `json:"expires_in"` // Access token lifetime in seconds
+	RefreshToken string        `json:"refresh_token"`
+	User         *UserResponse `json:"user,omitempty"`
+}
+
+// RefreshToken is a stored (hashed) refresh token.
+// The raw token value is never persisted.
+type RefreshToken struct {
+	ID         int64
+	UserID     int
+	FamilyID   string // Shared by every token rotated from the same login
+	TokenHash  string
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	RevokedAt  *time.Time
+	ReplacedBy *int64
+}
+
+// UserIdentity links an external identity provider account to a user.
+type UserIdentity struct {
+	ID          int64
+	UserID      int
+	Provider    string
+	Subject     string
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt *time.Time
+}
+
+// OAuthState is a pending OAuth login. The state value itself is only stored hashed.
+type OAuthState struct {
+	StateHash    string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
+
+// TOTPEnrollment is a user's TOTP secret. ConfirmedAt is nil until the user has
+// proven their authenticator app works by entering a code.
+type TOTPEnrollment struct {
+	UserID       int
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64 // Most recent accepted time step, to reject replayed codes
+}
+
+// TOTPEnrollmentResponse is returned by POST /me/mfa/totp/enroll.
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"` // Render as a QR code for authenticator apps
+}
+
+// ConfirmTOTPRequest is the payload for POST /me/mfa/totp/confirm.
+type ConfirmTOTPRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// RecoveryCodesResponse returns freshly generated recovery codes. They are only
+// shown once; the server stores hashes.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// DisableTOTPRequest is the payload for DELETE /me/mfa/totp.
+type DisableTOTPRequest struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// MFAChallengeResponse is returned by /login instead of tokens when the account
+// has 2FA enabled. The MFA token is exchanged at POST /login/mfa.
+type MFAChallengeResponse struct {
+	MFARequired bool     `json:"mfa_required"`
+	MFAToken    string   `json:"mfa_token"`
+	ExpiresIn   int      `json:"expires_in"`
+	Methods     []string `json:"methods"`
+}
+
+// LoginMFARequest is the payload for POST /login/mfa. Exactly one of Code (from
+// the authenticator app) or RecoveryCode is expected.
+type LoginMFARequest struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=32"`
+}
+
+// PersonalAccessToken is a long-lived, scoped API token for scripts and CI.
+type PersonalAccessToken struct {
+	ID         int64      `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-"`
+	Prefix     string     `json:"prefix"` // First characters of the token, for recognising it
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"` // Nil means the token never expires
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreatePersonalAccessTokenRequest is the payload for POST /me/tokens.
+// ExpiresInDays defaults to 90; 0 creates a token that never expires.
+type CreatePersonalAccessTokenRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,unique,dive,oneof=tasks:read tasks:write"`
+	ExpiresInDays *int     `json:"expires_in_days" validate:"omitnil,min=0,max=365"`
+}
+
+// CreatePersonalAccessTokenResponse returns the new token. Token is only ever
+// shown in this response.
+type CreatePersonalAccessTokenResponse struct {
+	Token string `json:"token"`
+	PersonalAccessToken
+}
+
+// AdminUserResponse is a user as seen through the admin API, including account state.
+type AdminUserResponse struct {
+	UserResponse
+	Disabled    bool       `json:"disabled"`
+	DisabledAt  *time.Time `json:"disabled_at"`
+	LockedUntil *time.Time `json:"locked_until"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// NewAdminUserResponse builds the admin representation of user.
+func NewAdminUserResponse(user *User) *AdminUserResponse {
+	return &AdminUserResponse{
+		UserResponse: *NewUserResponse(user),
+		Disabled:     user.Disabled(),
+		DisabledAt:   user.DisabledAt,
+		LockedUntil:  user.LockedUntil,
+		CreatedAt:    user.CreatedAt,
+	}
+}
+
+// UserListFilter selects a page of users for GET /admin/users. Search matches
+// the username, email or display name, case-insensitively.
+type UserListFilter struct {
+	Search string
+	Limit  int
+	Offset int
+}
+
+// AdminUserListResponse is a page of users returned by GET /admin/users.
+type AdminUserListResponse struct {
+	Users    []AdminUserResponse `json:"users"`
+	Total    int                 `json:"total"`
+	Page     int                 `json:"page"`
+	PageSize int                 `json:"page_size"`
+}
+
+// AdminUpdateUserRequest is the payload for PATCH /admin/users/{id}. Omitted
+// fields are left unchanged.
+type AdminUpdateUserRequest struct {
+	Role     *string `json:"role" validate:"omitnil,oneof=user admin"`
+	Disabled *bool   `json:"disabled"`
+}
+
+// Audit event types recorded in auth_audit_log.
+const (
+	AuditRegister             = "register"
+	AuditLogin                = "login"
+	AuditLoginMFA             = "login_mfa"
+	AuditTokenRefresh         = "token_refresh"
+	AuditLogout               = "logout"
+	AuditLogoutAll            = "logout_all"
+	AuditPasswordChange       = "password_change"
+	AuditPasswordReset        = "password_reset"
+	AuditMFAEnabled           = "mfa_enabled"
+	AuditMFADisabled          = "mfa_disabled"
+	AuditPersonalTokenCreated = "personal_token_created"
+	AuditPersonalTokenDeleted = "personal_token_deleted"
+	AuditAccountDeleted       = "account_deleted"
+	AuditAdminUserUpdated     = "admin_user_updated"
+	AuditAdminForceLogout     = "admin_force_logout"
+	AuditSessionRevoked       = "session_revoked"
+	// AuditIdentityRenamed is only written by the migration that made usernames
+	// and emails case-insensitive, for accounts whose duplicate name was replaced
+	AuditIdentityRenamed = "identity_renamed"
+)
+
+// Audit event outcomes.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditEvent is an entry of the security audit log. UserID is nil when the
+// event could not be tied to an account. Reason explains failures (e.g.
+// "invalid_credentials") or adds detail to successes (e.g. "oauth:google").
+type AuditEvent struct {
+	ID        int64     `json:"id"`
+	EventType string    `json:"event_type"`
+	UserID    *int      `json:"user_id,omitempty"`
+	IPAddress string    `json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Outcome   string    `json:"outcome"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AuditLogFilter selects audit events, newest first. Zero fields do not filter.
+type AuditLogFilter struct {
+	UserID    *int
+	EventType string
+	From      time.Time // Inclusive
+	To        time.Time // Exclusive
+	Limit     int
+	Offset    int
+}
+
+// AuditLogResponse is a page of audit events.
+type AuditLogResponse struct {
+	Events   []AuditEvent `json:"events"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+}
+
+// Session is a login on one device. Its ID is shared by the refresh token
+// family and the sid claim of the access tokens issued for the login.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int       `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// Current marks the session of the access token used for the request
+	Current bool `json:"current"`
+}
+
+
+// EmailVerificationToken is a new email verification token to store. Only the
+// hash of the emailed token is kept.
+type EmailVerificationToken struct {
+	TokenHash string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,121 @@
+// Package oauth implements third-party login ("Sign in with Google") using the
+// OpenID Connect authorization code flow with PKCE.
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownProvider is returned for provider names that are not configured.
+var ErrUnknownProvider = errors.New("unknown OAuth provider")
+
+// Identity is the user information asserted by a provider after a successful login.
+type Identity struct {
+	Provider      string
+	Subject       string // Stable user ID at the provider ("sub" claim)
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// AuthRequest holds the per-login secrets generated by the start endpoint.
+// State protects the callback against CSRF, Nonce binds the ID token to this
+// login, and CodeVerifier is the PKCE secret whose hash is sent to the provider.
+type AuthRequest struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+// Provider is an external identity provider.
+type Provider interface {
+	// Name is the provider's path segment in /oauth/{provider}/...
+	Name() string
+	// AuthCodeURL returns the provider URL the browser is sent to.
+	AuthCodeURL(ctx context.Context, req AuthRequest) (string, error)
+	// Exchange redeems the authorization code and returns the verified identity.
+	Exchange(ctx context.Context, code string, req AuthRequest) (*Identity, error)
+}
+
+// Registry holds the configured providers by name.
+type Registry struct {
+	providers map[string]Provider
+}
+
+// NewRegistry creates a Registry from providers.
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: make(map[string]Provider, len(providers))}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+	return r
+}
+
+// Get returns the provider called name.
+func (r *Registry) Get(name string) (Provider, error) {
+	if r != nil {
+		if p, ok := r.providers[name]; ok {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownProvider, name)
+}
+
+// Names returns the configured provider names, sorted.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// wellKnownIssuers are used when OAUTH_<NAME>_ISSUER is not set.
+var wellKnownIssuers = map[string]string{
+	"google": "https://accounts.google.com",
+}
+
+// NewRegistryFromEnv configures the providers listed in OAUTH_PROVIDERS
+// (comma separated, e.g. "google"). Each provider NAME is configured with:
+//
+//   - OAUTH_<NAME>_CLIENT_ID and OAUTH_<NAME>_CLIENT_SECRET (required)
+//   - OAUTH_<NAME>_REDIRECT_URL: this service's callback URL, e.g.
+//     http://localhost:8080/oauth/google/callback (required)
+//   - OAUTH_<NAME>_ISSUER: the OIDC issuer URL (defaults for well known providers)
+//
+// Misconfigured providers are skipped with a warning.
+func NewRegistryFromEnv() *Registry {
+	var providers []Provider
+	for _, name := range strings.Split(os.Getenv("OAUTH_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+		cfg := OIDCConfig{
+			Name:         name,
+			IssuerURL:    os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		}
+		if cfg.IssuerURL == "" {
+			cfg.IssuerURL = wellKnownIssuers[name]
+		}
+		if cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+			slog.Warn("OAuth provider is missing ISSUER, CLIENT_ID or REDIRECT_URL, skipping it", "name", name, "env_prefix", prefix)
+			continue
+		}
+		providers = append(providers, NewOIDCProvider(cfg))
+		slog.Info("Configured OAuth provider", "name", name, "issuer", cfg.IssuerURL)
+	}
+	return NewRegistry(providers...)
+}
@@ -0,0 +1,157 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// prefixLength is the number of hex characters of the SHA-1 hash that are used
+// to look up a password, as in the Pwned Passwords range API.
+const prefixLength = 5
+
+// RangeSource returns the breached password hashes sharing a prefix, k-anonymity
+// style: the source only ever sees the first five hex characters of a hash.
+type RangeSource interface {
+	// Range returns the uppercase hex SHA-1 suffixes (the hash without the
+	// prefix) of breached passwords whose hash starts with prefix.
+	Range(prefix string) ([]string, error)
+}
+
+// IsBreached reports whether password appears in src. The full hash never
+// leaves this function; only its prefix is passed to the source.
+func IsBreached(src RangeSource, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := src.Range(hash[:prefixLength])
+	if err != nil {
+		return false, err
+	}
+	for _, suffix := range suffixes {
+		if suffix == hash[prefixLength:] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HashFile is a local, offline RangeSource: a text file with one SHA-1 hash per
+// line, optionally followed by ":<count>", sorted by hash. This is the format of
+// the "ordered by hash" Pwned Passwords download. The file is binary searched
+// on every lookup rather than loaded, so multi-gigabyte files are fine.
+type HashFile struct {
+	file *os.File
+	size int64
+}
+
+// OpenHashFile opens a breached password hash file.
+func OpenHashFile(path string) (*HashFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat breached password file: %w", err)
+	}
+	return &HashFile{file: file, size: info.Size()}, nil
+}
+
+// Close closes the underlying file.
+func (f *HashFile) Close() error {
+	return f.file.Close()
+}
+
+// Range returns the suffixes of the hashes in the file that start with prefix.
+func (f *HashFile) Range(prefix string) ([]string, error) {
+	prefix = strings.ToUpper(prefix)
+	start, err := f.firstLineFrom(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var suffixes []string
+	scanner := bufio.NewScanner(io.NewSectionReader(f.file, start, f.size-start))
+	for scanner.Scan() {
+		hash := lineHash(scanner.Bytes())
+		if len(hash) <= prefixLength || hash[:prefixLength] != prefix {
+			break
+		}
+		suffixes = append(suffixes, hash[prefixLength:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read breached password file: %w", err)
+	}
+	return suffixes, nil
+}
+
+// firstLineFrom binary searches for the offset of the first line whose hash
+// prefix is not less than prefix (f.size if there is none).
+func (f *HashFile) firstLineFrom(prefix string) (int64, error) {
+	lo, hi := int64(0), f.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, err := f.lineStartFrom(mid)
+		if err != nil {
+			return 0, err
+		}
+		if start >= f.size {
+			hi = mid
+			continue
+		}
+		line, err := f.lineAt(start)
+		if err != nil {
+			return 0, err
+		}
+		if hash := lineHash(line); len(hash) >= prefixLength && hash[:prefixLength] < prefix {
+			lo = start + 1
+		} else {
+			hi = mid
+		}
+	}
+	return f.lineStartFrom(lo)
+}
+
+// lineStartFrom returns the offset of the first line starting at or after off.
+func (f *HashFile) lineStartFrom(off int64) (int64, error) {
+	if off == 0 {
+		return 0, nil
+	}
+	// The line starts after the first newline at or after off-1
+	buf := make([]byte, 128)
+	for pos := off - 1; pos < f.size; {
+		n, err := f.file.ReadAt(buf, pos)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return pos + int64(i) + 1, nil
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read breached password file: %w", err)
+		}
+		pos += int64(n)
+	}
+	return f.size, nil
+}
+
+// lineAt reads the line starting at off, without the line ending.
+func (f *HashFile) lineAt(off int64) ([]byte, error) {
+	line, err := bufio.NewReader(io.NewSectionReader(f.file, off, f.size-off)).ReadSlice('\n')
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read breached password file: %w", err)
+	}
+	return line, nil
+}
+
+// lineHash extracts the uppercase hash from a "<hash>[:<count>]" line.
+func lineHash(line []byte) string {
+	hash, _, _ := bytes.Cut(bytes.TrimSpace(line), []byte(":"))
+	return strings.ToUpper(string(hash))
+}
@@ -0,0 +1,198 @@
+// Package passwordpolicy decides whether a new password is acceptable. Every
+// rule that a password breaks is reported separately, so clients can show the
+// user exactly what to fix.
+package passwordpolicy
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rule names reported in Violation.Rule.
+const (
+	RuleMinLength        = "min_length"
+	RuleMaxLength        = "max_length"
+	RuleCharacterClasses = "character_classes"
+	RulePersonalInfo     = "personal_info"
+	RuleBreached         = "breached"
+)
+
+// MaxBytes is the longest password bcrypt can hash; it ignores everything after
+// the first 72 bytes, which would silently weaken longer passwords.
+const MaxBytes = 72
+
+// minPersonalInfoLength keeps very short usernames (e.g. "al") from rejecting
+// every password that happens to contain them.
+const minPersonalInfoLength = 3
+
+// Violation is one rule a password breaks.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Policy holds the password requirements.
+type Policy struct {
+	// MinLength is the minimum number of characters (not bytes).
+	MinLength int
+	// MaxBytes is the maximum length in bytes; 0 means MaxBytes.
+	MaxBytes int
+	// MinCharacterClasses is how many of lowercase letters, uppercase letters,
+	// digits and symbols the password must mix (0 to 4).
+	MinCharacterClasses int
+	// DisallowPersonalInfo rejects passwords containing the username or email.
+	DisallowPersonalInfo bool
+	// Breached, if set, rejects passwords that appear in known data breaches.
+	Breached RangeSource
+}
+
+// Default returns the policy used when nothing is configured.
+func Default() *Policy {
+	return &Policy{
+		MinLength:            8,
+		MaxBytes:             MaxBytes,
+		MinCharacterClasses:  2,
+		DisallowPersonalInfo: true,
+	}
+}
+
+// FromEnv reads the policy from PASSWORD_MIN_LENGTH (default 8),
+// PASSWORD_MIN_CHARACTER_CLASSES (default 2), PASSWORD_DISALLOW_PERSONAL_INFO
+// (default true) and PASSWORD_BREACHED_HASHES_FILE (unset disables the breach check).
+// The breach check is skipped with a warning if the file cannot be opened.
+func FromEnv() *Policy {
+	p := Default()
+	p.MinLength = intFromEnv("PASSWORD_MIN_LENGTH", p.MinLength, 1, MaxBytes)
+	p.MinCharacterClasses = intFromEnv("PASSWORD_MIN_CHARACTER_CLASSES", p.MinCharacterClasses, 0, 4)
+	if value := os.Getenv("PASSWORD_DISALLOW_PERSONAL_INFO"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			slog.Warn("Invalid PASSWORD_DISALLOW_PERSONAL_INFO, using default", "value", value, "default", p.DisallowPersonalInfo)
+		} else {
+			p.DisallowPersonalInfo = parsed
+		}
+	}
+	if path := os.Getenv("PASSWORD_BREACHED_HASHES_FILE"); path != "" {
+		file, err := OpenHashFile(path)
+		if err != nil {
+			slog.Warn("Breached password check disabled", "error", err)
+		} else {
+			p.Breached = file
+			slog.Info("Checking new passwords against breached password hashes", "path", path)
+		}
+	}
+	return p
+}
+
+// intFromEnv reads an integer between lo and hi from the environment variable name.
+func intFromEnv(name string, def, lo, hi int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < lo || parsed > hi {
+		slog.Warn("Invalid setting, using default", "name", name, "value", value, "default", def)
+		return def
+	}
+	return parsed
+}
+
+// Check returns the rules password breaks, or nil if it is acceptable.
+// personalInfo holds values the password must not contain, such as the
+// username and email address; empty values are ignored.
+func (p *Policy) Check(password string, personalInfo ...string) []Violation {
+	var violations []Violation
+
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+	maxBytes := p.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = MaxBytes
+	}
+	if len(password) > maxBytes {
+		violations = append(violations, Violation{
+			Rule:    RuleMaxLength,
+			Message: fmt.Sprintf("Password must be at most %d bytes long", maxBytes),
+		})
+	}
+	if characterClasses(password) < p.MinCharacterClasses {
+		violations = append(violations, Violation{
+			Rule: RuleCharacterClasses,
+			Message: fmt.Sprintf("Password must contain at least %d of: lowercase letters, uppercase letters, digits, symbols",
+				p.MinCharacterClasses),
+		})
+	}
+	if p.DisallowPersonalInfo && containsPersonalInfo(password, personalInfo) {
+		violations = append(violations, Violation{
+			Rule:    RulePersonalInfo,
+			Message: "Password must not contain your username or email address",
+		})
+	}
+	// Only look up passwords that are otherwise acceptable
+	if p.Breached != nil && len(violations) == 0 {
+		breached, err := IsBreached(p.Breached, password)
+		if err != nil {
+			// An unreadable hash file should not block every password change
+			slog.Warn("Breached password check failed", "error", err)
+		} else if breached {
+			violations = append(violations, Violation{
+				Rule:    RuleBreached,
+				Message: "Password has appeared in a data breach, please choose a different one",
+			})
+		}
+	}
+	return violations
+}
+
+// characterClasses counts which of lowercase, uppercase, digits and symbols password uses.
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		case !unicode.IsSpace(c):
+			symbol = true
+		}
+	}
+	n := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			n++
+		}
+	}
+	return n
+}
+
+// containsPersonalInfo reports whether password contains any of the values,
+// ignoring case. For email addresses the local part is checked as well.
+func containsPersonalInfo(password string, values []string) bool {
+	lowered := strings.ToLower(password)
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		candidates := []string{value}
+		if local, _, ok := strings.Cut(value, "@"); ok {
+			candidates = append(candidates, local)
+		}
+		for _, candidate := range candidates {
+			if utf8.RuneCountInString(candidate) >= minPersonalInfoLength && strings.Contains(lowered, candidate) {
+				return true
+			}
+		}
+	}
+	return false
+}
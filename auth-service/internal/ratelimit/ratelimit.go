@@ -0,0 +1,168 @@
+// Package ratelimit implements token bucket rate limiting with a pluggable
+// bucket store. The in-memory store is enough for a single instance; a shared
+// store (e.g. Redis) can implement Store when auth-service is scaled out.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests per Per on average, with bursts of up to Requests.
+// A Limit with Requests <= 0 is unlimited.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// String formats the limit the way ParseLimit reads it, e.g. "10/1m0s".
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// ParseLimit parses "<requests>/<duration>", e.g. "10/1m". "off" disables limiting.
+func ParseLimit(s string) (Limit, error) {
+	if strings.EqualFold(strings.TrimSpace(s), "off") {
+		return Limit{}, nil
+	}
+	reqStr, perStr, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<duration>", s)
+	}
+	requests, err := strconv.Atoi(strings.TrimSpace(reqStr))
+	if err != nil {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: %w", s, err)
+	}
+	per, err := time.ParseDuration(strings.TrimSpace(perStr))
+	if err != nil || per <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: bad duration", s)
+	}
+	return Limit{Requests: requests, Per: per}, nil
+}
+
+// LimitFromEnv reads a limit from the environment variable name, falling back to def.
+func LimitFromEnv(name string, def Limit) Limit {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	limit, err := ParseLimit(value)
+	if err != nil {
+		slog.Warn("Invalid rate limit, using default", "name", name, "default", def, "error", err)
+		return def
+	}
+	return limit
+}
+
+// Store keeps token buckets by key.
+type Store interface {
+	// Take removes one token from the bucket for key at time now. If the bucket
+	// is empty it returns false and how long until a token is available.
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error)
+}
+
+// Limiter applies a Limit to keys (client IPs, email addresses, ...).
+type Limiter struct {
+	store Store
+	name  string
+	limit Limit
+	now   func() time.Time
+}
+
+// NewLimiter creates a Limiter. name namespaces its keys in the store, so several
+// limiters can share one store.
+func NewLimiter(store Store, name string, limit Limit) *Limiter {
+	return &Limiter{store: store, name: name, limit: limit, now: time.Now}
+}
+
+// Allow reports whether a request for key may proceed, and otherwise how long
+// the caller should wait. A nil Limiter allows everything. Store errors fail
+// open: an outage of the store must not lock everybody out.
+func (l *Limiter) Allow(ctx context.Context, key string) (bool, time.Duration) {
+	if l == nil || l.limit.Requests <= 0 {
+		return true, 0
+	}
+	ok, retryAfter, err := l.store.Take(ctx, l.name+":"+key, l.limit, l.now())
+	if err != nil {
+		slog.ErrorContext(ctx, "Rate limiter store error, allowing request", "limiter", l.name, "error", err)
+		return true, 0
+	}
+	return ok, retryAfter
+}
+
+// bucket is a token bucket; tokens are refilled lazily when it is used.
+type bucket struct {
+	tokens        float64
+	updated       time.Time
+	ratePerSecond float64
+	capacity      float64
+}
+
+// full reports whether the bucket has refilled completely by now.
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.updated).Seconds()*b.ratePerSecond >= b.capacity
+}
+
+// MemoryStore is a Store that keeps buckets in process memory.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+// pruneInterval is how often MemoryStore drops buckets that have refilled completely.
+const pruneInterval = time.Minute
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+// Take implements Store.
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit, now time.Time) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	capacity := float64(limit.Requests)
+	ratePerSecond := capacity / limit.Per.Seconds()
+
+	if now.Sub(s.lastPrune) > pruneInterval {
+		s.prune(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	}
+	b.ratePerSecond, b.capacity = ratePerSecond, capacity
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+elapsed*ratePerSecond)
+		b.updated = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	wait := time.Duration((1 - b.tokens) / ratePerSecond * float64(time.Second))
+	return false, wait, nil
+}
+
+// prune deletes buckets that have refilled completely; they behave exactly
+// like missing buckets, so memory only grows with recently active keys.
+func (s *MemoryStore) prune(now time.Time) {
+	for key, b := range s.buckets {
+		if b.full(now) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastPrune = now
+}
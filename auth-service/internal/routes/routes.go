@@ -4,15 +4,64 @@ import (
 	"net/http"
 
 	"auth-service/internal/handlers"
+	"auth-service/internal/metrics"
 	"auth-service/internal/middleware"
+	"auth-service/internal/models"
+	"auth-service/internal/ratelimit"
 )
 
-func RegisterRoutes(mux *http.ServeMux, authHandler *handlers.AuthHandler, healthHandler *handlers.HealthHandler, protectedHandler *handlers.ProtectedHandler) {
-	mux.HandleFunc("/register", authHandler.Register)
-	mux.HandleFunc("/login", authHandler.Login)
+// RateLimiters are the per-IP limits for the credential endpoints. A nil limiter disables limiting.
+type RateLimiters struct {
+	Login              *ratelimit.Limiter // /login, /login/mfa and /login/magic-link
+	Register           *ratelimit.Limiter
+	ForgotPassword     *ratelimit.Limiter
+	ResendVerification *ratelimit.Limiter
+	Introspect         *ratelimit.Limiter
+}
+
+func RegisterRoutes(mux *http.ServeMux, authenticator *middleware.Authenticator, authHandler *handlers.AuthHandler, healthHandler *handlers.HealthHandler, protectedHandler *handlers.ProtectedHandler, jwksHandler *handlers.JWKSHandler, oauthHandler *handlers.OAuthHandler, limiters RateLimiters) {
+	mux.Handle("/register", middleware.IPRateLimit(limiters.Register, http.HandlerFunc(authHandler.Register)))
+	mux.Handle("/login", middleware.IPRateLimit(limiters.Login, http.HandlerFunc(authHandler.Login)))
+	mux.Handle("POST /login/mfa", middleware.IPRateLimit(limiters.Login, http.HandlerFunc(authHandler.LoginMFA)))                // Second login step for accounts with 2FA
+	mux.Handle("POST /login/magic-link", middleware.IPRateLimit(limiters.Login, http.HandlerFunc(authHandler.RequestMagicLink))) // Always 202, emails a single-use sign-in link
+	mux.Handle("POST /login/magic-link/verify", middleware.IPRateLimit(limiters.Login, http.HandlerFunc(authHandler.VerifyMagicLink)))
 	mux.HandleFunc("/health", healthHandler.HealthCheck)
+	mux.Handle("GET /metrics", metrics.Handler())                   // Prometheus scrape endpoint
+	mux.HandleFunc("POST /token/refresh", authHandler.RefreshToken) // Rotates the refresh token on every use
+	// Used by task-service to check revocation; requires the introspection secret if one is set
+	mux.Handle("POST /token/introspect", middleware.IPRateLimit(limiters.Introspect, http.HandlerFunc(authHandler.Introspect)))
+	mux.Handle("POST /password/forgot", middleware.IPRateLimit(limiters.ForgotPassword, http.HandlerFunc(authHandler.ForgotPassword))) // Always 202, never reveals whether the email exists
+	mux.HandleFunc("POST /password/reset", authHandler.ResetPassword)
+	mux.HandleFunc("GET /verify-email", authHandler.VerifyEmail) // Target of the link in the verification email
+	mux.Handle("POST /verify-email/resend", middleware.IPRateLimit(limiters.ResendVerification, http.HandlerFunc(authHandler.ResendVerification)))
+	mux.HandleFunc("GET /.well-known/jwks.json", jwksHandler.ServeJWKS) // Public keys for verifying access tokens
+	mux.HandleFunc("GET /oauth/{provider}/start", oauthHandler.Start)   // Redirects to the provider (see OAUTH_PROVIDERS)
+	mux.HandleFunc("GET /oauth/{provider}/callback", oauthHandler.Callback)
 
 	// Protected routes
-	mux.Handle("/protected", middleware.JWTAuth(http.HandlerFunc(protectedHandler.Protected)))
-	mux.Handle("GET /me", middleware.JWTAuth(http.HandlerFunc(authHandler.GetMe))) // Add GET /me route
+	mux.Handle("/protected", authenticator.JWTAuth(http.HandlerFunc(protectedHandler.Protected)))
+	mux.Handle("GET /me", authenticator.JWTAuth(http.HandlerFunc(authHandler.GetMe))) // Add GET /me route
+	mux.Handle("PATCH /me", authenticator.JWTAuth(http.HandlerFunc(authHandler.UpdateMe)))
+	mux.Handle("DELETE /me", authenticator.JWTAuth(http.HandlerFunc(authHandler.DeleteMe)))
+	mux.Handle("POST /me/password", authenticator.JWTAuth(http.HandlerFunc(authHandler.ChangePassword)))
+	mux.Handle("POST /me/mfa/totp/enroll", authenticator.JWTAuth(http.HandlerFunc(authHandler.EnrollTOTP)))
+	mux.Handle("POST /me/mfa/totp/confirm", authenticator.JWTAuth(http.HandlerFunc(authHandler.ConfirmTOTP)))
+	mux.Handle("DELETE /me/mfa/totp", authenticator.JWTAuth(http.HandlerFunc(authHandler.DisableTOTP)))
+	mux.Handle("POST /me/tokens", authenticator.JWTAuth(http.HandlerFunc(authHandler.CreatePersonalAccessToken))) // Token is shown once
+	mux.Handle("GET /me/tokens", authenticator.JWTAuth(http.HandlerFunc(authHandler.ListPersonalAccessTokens)))
+	mux.Handle("DELETE /me/tokens/{id}", authenticator.JWTAuth(http.HandlerFunc(authHandler.DeletePersonalAccessToken)))
+	mux.Handle("GET /me/security-events", authenticator.JWTAuth(http.HandlerFunc(authHandler.ListSecurityEvents))) // ?from=&to=&page=&page_size=
+	mux.Handle("GET /me/sessions", authenticator.JWTAuth(http.HandlerFunc(authHandler.ListSessions)))
+	mux.Handle("DELETE /me/sessions/{id}", authenticator.JWTAuth(http.HandlerFunc(authHandler.RevokeSession))) // Signs the device out
+	mux.Handle("POST /logout", authenticator.JWTAuth(http.HandlerFunc(authHandler.Logout)))
+	mux.Handle("POST /logout-all", authenticator.JWTAuth(http.HandlerFunc(authHandler.LogoutAll)))
+
+	// Admin routes
+	admin := func(handler http.HandlerFunc) http.Handler {
+		return authenticator.JWTAuth(middleware.RequireRole(models.RoleAdmin, handler))
+	}
+	mux.Handle("GET /admin/users", admin(authHandler.ListUsers)) // ?search=&page=&page_size=
+	mux.Handle("PATCH /admin/users/{id}", admin(authHandler.AdminUpdateUser))
+	mux.Handle("POST /admin/users/{id}/force-logout", admin(authHandler.ForceLogout))
+	mux.Handle("GET /admin/audit-log", admin(authHandler.ListAuditLog)) // ?user_id=&event_type=&from=&to=&page=&page_size=
 }
@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"auth-service/internal/handlers"
+	"auth-service/internal/middleware"
+	"auth-service/internal/models"
+	"auth-service/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireRole_ChecksRoleClaim(t *testing.T) {
+	protected := middleware.NewAuthenticator(nil).JWTAuth(middleware.RequireRole(models.RoleAdmin,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })))
+
+	for role, want := range map[string]int{models.RoleUser: http.StatusForbidden, models.RoleAdmin: http.StatusTeapot} {
+		token, _ := issueTestToken(t, models.User{ID: 7, Role: role})
+		req, _ := http.NewRequest("GET", "/admin/users", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		protected.ServeHTTP(rr, req)
+		assert.Equal(t, want, rr.Code, "role %s", role)
+	}
+}
+
+func TestListUsers_PaginatesAndSearches(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	// The page size is capped at 100
+	filter := models.UserListFilter{Search: "ada", Limit: 100, Offset: 100}
+	disabledAt := time.Now()
+	mockRepo.On("ListUsers", mock.Anything, filter).
+		Return([]models.User{{ID: 101, Email: "ada@example.com", Role: models.RoleUser, DisabledAt: &disabledAt}}, 101, nil)
+
+	rr := httptest.NewRecorder()
+	handlers.NewAuthHandler(mockRepo, nil).ListUsers(rr, authedRequest("GET", "/admin/users?search=+ada+&page=2&page_size=500", nil, 1))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp models.AdminUserListResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, 101, resp.Total)
+	assert.Equal(t, 2, resp.Page)
+	assert.Equal(t, 100, resp.PageSize)
+	require.Len(t, resp.Users, 1)
+	assert.True(t, resp.Users[0].Disabled)
+	assert.Equal(t, models.RoleUser, resp.Users[0].Role)
+
+	rr = httptest.NewRecorder()
+	handlers.NewAuthHandler(mockRepo, nil).ListUsers(rr, authedRequest("GET", "/admin/users?page=0", nil, 1))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+// adminRequest builds a request by admin 1 for a route with an {id} path value.
+func adminRequest(method, url, id string, body interface{}) *http.Request {
+	req := authedRequest(method, url, body, 1)
+	req.SetPathValue("id", id)
+	return req
+}
+
+func TestAdminUpdateUser_DisablesAccount(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	disabled := true
+	update := models.AdminUpdateUserRequest{Disabled: &disabled}
+	disabledAt := time.Now()
+	mockRepo.On("AdminUpdateUser", mock.Anything, 5, update).Return(&models.User{ID: 5, Role: models.RoleUser, DisabledAt: &disabledAt}, nil)
+
+	rr := httptest.NewRecorder()
+	handlers.NewAuthHandler(mockRepo, nil).AdminUpdateUser(rr, adminRequest("PATCH", "/admin/users/5", "5", update))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp models.AdminUserResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.True(t, resp.Disabled)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAdminUpdateUser_RejectsInvalidChanges(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("AdminUpdateUser", mock.Anything, 404, mock.Anything).Return(nil, repository.ErrUserNotFound)
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+
+	cases := []struct {
+		name string
+		id   string
+		body interface{}
+		want int
+	}{
+		{"own account", "1", map[string]string{"role": "user"}, http.StatusBadRequest},
+		{"unknown role", "5", map[string]string{"role": "root"}, http.StatusBadRequest},
+		{"bad id", "abc", map[string]bool{"disabled": true}, http.StatusBadRequest},
+		{"missing user", "404", map[string]bool{"disabled": true}, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		rr := httptest.NewRecorder()
+		handler.AdminUpdateUser(rr, adminRequest("PATCH", "/admin/users/"+tc.id, tc.id, tc.body))
+		assert.Equal(t, tc.want, rr.Code, tc.name)
+	}
+}
+
+func TestForceLogout(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("ForceLogout", mock.Anything, 5).Return(nil)
+	mockRepo.On("ForceLogout", mock.Anything, 404).Return(repository.ErrUserNotFound)
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+
+	rr := httptest.NewRecorder()
+	handler.ForceLogout(rr, adminRequest("POST", "/admin/users/5/force-logout", "5", nil))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ForceLogout(rr, adminRequest("POST", "/admin/users/404/force-logout", "404", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestLogin_DisabledAccountIsRefused(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	disabledAt := time.Now()
+	user := &models.User{ID: 5, Email: "gone@example.com", EmailVerifiedAt: &disabledAt, DisabledAt: &disabledAt}
+	mockRepo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+	mockRepo.On("Authenticate", mock.Anything).Return(true, nil)
+
+	body, _ := json.Marshal(models.LoginRequest{Email: user.Email, Password: "password123"})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handlers.NewAuthHandler(mockRepo, nil).Login(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	mockRepo.AssertNotCalled(t, "CreateRefreshToken", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"auth-service/internal/handlers"
+	"auth-service/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogin_FailureIsAudited(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockAudit := new(MockAuditRepository)
+	user := &models.User{ID: 3, Email: "ada@example.com"}
+	mockRepo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+	mockRepo.On("Authenticate", mock.Anything).Return(false, nil)
+	mockRepo.On("RecordFailedLogin", mock.Anything, 3).Return(1, nil)
+
+	var recorded models.AuditEvent
+	mockAudit.On("RecordAuditEvent", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { recorded = args.Get(1).(models.AuditEvent) }).
+		Return(nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+	handler.SetAuditLog(mockAudit)
+	body, _ := json.Marshal(models.LoginRequest{Email: user.Email, Password: "wrong-password"})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	req.RemoteAddr = "198.51.100.7:5555"
+	req.Header.Set("User-Agent", "curl/8.0")
+	rr := httptest.NewRecorder()
+	handler.Login(rr, req)
+
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, models.AuditLogin, recorded.EventType)
+	assert.Equal(t, models.AuditFailure, recorded.Outcome)
+	assert.Equal(t, "invalid_credentials", recorded.Reason)
+	require.NotNil(t, recorded.UserID)
+	assert.Equal(t, 3, *recorded.UserID)
+	assert.Equal(t, "198.51.100.7", recorded.IPAddress)
+	assert.Equal(t, "curl/8.0", recorded.UserAgent)
+}
+
+func TestListSecurityEvents_OnlyReturnsOwnEvents(t *testing.T) {
+	mockAudit := new(MockAuditRepository)
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	userID := 7
+	filter := models.AuditLogFilter{UserID: &userID, From: from, Limit: 20}
+	mockAudit.On("ListAuditEvents", mock.Anything, filter).
+		Return([]models.AuditEvent{{ID: 1, EventType: models.AuditLogin, UserID: &userID, Outcome: models.AuditSuccess}}, nil)
+
+	handler := handlers.NewAuthHandler(new(MockAuthRepository), nil)
+	handler.SetAuditLog(mockAudit)
+	rr := httptest.NewRecorder()
+	handler.ListSecurityEvents(rr, authedRequest("GET", "/me/security-events?from=2026-10-01T00:00:00Z", nil, 7))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp models.AuditLogResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	require.Len(t, resp.Events, 1)
+	assert.Equal(t, models.AuditLogin, resp.Events[0].EventType)
+	mockAudit.AssertExpectations(t)
+}
+
+func TestListAuditLog_Filters(t *testing.T) {
+	mockAudit := new(MockAuditRepository)
+	userID := 5
+	filter := models.AuditLogFilter{
+		UserID:    &userID,
+		EventType: models.AuditTokenRefresh,
+		From:      time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		To:        time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC),
+		Limit:     10,
+		Offset:    10,
+	}
+	mockAudit.On("ListAuditEvents", mock.Anything, filter).Return([]models.AuditEvent{}, nil)
+
+	handler := handlers.NewAuthHandler(new(MockAuthRepository), nil)
+	handler.SetAuditLog(mockAudit)
+	rr := httptest.NewRecorder()
+	handler.ListAuditLog(rr, authedRequest("GET", "/admin/audit-log?user_id=5&event_type=token_refresh&from=2026-10-01T00:00:00Z&to=2026-10-02T00:00:00Z&page=2&page_size=10", nil, 1))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	mockAudit.AssertExpectations(t)
+}
+
+func TestListAuditLog_RejectsInvalidRange(t *testing.T) {
+	handler := handlers.NewAuthHandler(new(MockAuthRepository), nil)
+	handler.SetAuditLog(new(MockAuditRepository))
+
+	for _, query := range []string{"from=yesterday", "from=2026-10-02T00:00:00Z&to=2026-10-01T00:00:00Z", "user_id=abc"} {
+		rr := httptest.NewRecorder()
+		handler.ListAuditLog(rr, authedRequest("GET", "/admin/audit-log?"+query, nil, 1))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
@@ -17,6 +17,8 @@ import (
 	"auth-service/internal/handlers"
 	"auth-service/internal/models"
 	"auth-service/repository"
+	"cozy-go/shared/cloudevents"
+	"cozy-go/topology"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/jackc/pgx/v5/stdlib" // Import pgx stdlib driver for database/sql
@@ -88,7 +90,7 @@ func setupIntegrationTest(t *testing.T) func() {
 	// --- Initialize Dependencies ---
 	authRepo := repository.NewAuthRepository(testDbPool)
 	// Use the RabbitMQ publisher for local integration tests
-	eventPublisher := events.NewRabbitMqPublisher(testRabbitConn)
+	eventPublisher := events.NewRabbitMqPublisher(topology.NewConnection(testRabbitConn), cloudevents.ContentModeStructured)
 	require.NotNil(t, eventPublisher, "Event publisher should not be nil")
 
 	testAuthHandler = handlers.NewAuthHandler(authRepo, eventPublisher)
@@ -10,15 +10,18 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
-	_ "auth-service/internal/events" // Use blank identifier for events import
+	"auth-service/internal/events"
 	"auth-service/internal/handlers"
 	"auth-service/internal/models"
-	_ "auth-service/repository" // Use blank identifier for repository import
+	"auth-service/internal/utils"
+	"auth-service/repository"
 
 	// "github.com/jackc/pgx/v5/pgxpool" // No longer needed
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock" // Import testify mock
+	"github.com/stretchr/testify/require"
 )
 
 // --- Mock AuthRepository ---
@@ -31,8 +34,8 @@ func (m *MockAuthRepository) Authenticate(user models.User) (bool, error) {
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockAuthRepository) Register(user models.User) (int, error) {
-	args := m.Called(user)
+func (m *MockAuthRepository) Register(ctx context.Context, user models.User, verification *models.EmailVerificationToken, newEvent func(userID int) events.Event) (int, error) {
+	args := m.Called(ctx, user, verification, newEvent)
 	return args.Int(0), args.Error(1)
 }
 
@@ -53,13 +56,313 @@ func (m *MockAuthRepository) GetUserByEmail(ctx context.Context, email string) (
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
+func (m *MockAuthRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	args := m.Called(ctx, username)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockAuthRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.RefreshToken), args.Error(1)
+}
+
+func (m *MockAuthRepository) RotateRefreshToken(ctx context.Context, oldID int64, next *models.RefreshToken) error {
+	args := m.Called(ctx, oldID, next)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	args := m.Called(ctx, familyID)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) RevokeAllRefreshTokens(ctx context.Context, userID int) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) RevokeAccessToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	args := m.Called(ctx, jti, userID, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) IncrementTokenVersion(ctx context.Context, userID int) (int, error) {
+	args := m.Called(ctx, userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockAuthRepository) IsAccessTokenRevoked(ctx context.Context, jti string, userID int, tokenVersion int, sessionID string) (bool, error) {
+	args := m.Called(ctx, jti, userID, tokenVersion, sessionID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockAuthRepository) CreateEmailVerificationToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userID, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) VerifyEmail(ctx context.Context, tokenHash string) (int, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockAuthRepository) CreatePasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userID, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) GetPasswordResetUser(ctx context.Context, tokenHash string) (*models.User, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockAuthRepository) ResetPassword(ctx context.Context, tokenHash string, newPasswordHash string, newEvent func(userID int) events.Event) (int, error) {
+	args := m.Called(ctx, tokenHash, newPasswordHash, newEvent)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockAuthRepository) CreateMagicLinkToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userID, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) ConsumeMagicLinkToken(ctx context.Context, tokenHash string) (int, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockAuthRepository) UpdateProfile(ctx context.Context, userID int, update models.UpdateProfileRequest, verification *models.EmailVerificationToken, newEvent func(user models.User, oldEmail string) events.Event) (*models.User, error) {
+	args := m.Called(ctx, userID, update, verification, newEvent)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockAuthRepository) GetPasswordHash(ctx context.Context, userID int) (string, error) {
+	args := m.Called(ctx, userID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockAuthRepository) UpdatePassword(ctx context.Context, userID int, newPasswordHash string, event events.Event) error {
+	args := m.Called(ctx, userID, newPasswordHash, event)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) DeleteUser(ctx context.Context, userID int, event events.Event) error {
+	args := m.Called(ctx, userID, event)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) GetUserByIdentity(ctx context.Context, provider string, subject string) (*models.User, error) {
+	args := m.Called(ctx, provider, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockAuthRepository) LinkIdentity(ctx context.Context, identity models.UserIdentity, markEmailVerified bool) error {
+	args := m.Called(ctx, identity, markEmailVerified)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) CreateUserWithIdentity(ctx context.Context, user models.User, identity models.UserIdentity, verification *models.EmailVerificationToken, newEvent func(userID int) events.Event) (int, error) {
+	args := m.Called(ctx, user, identity, verification, newEvent)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockAuthRepository) CreateOAuthState(ctx context.Context, state models.OAuthState) error {
+	args := m.Called(ctx, state)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) ConsumeOAuthState(ctx context.Context, stateHash string) (*models.OAuthState, error) {
+	args := m.Called(ctx, stateHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.OAuthState), args.Error(1)
+}
+
+func (m *MockAuthRepository) SaveTOTPEnrollment(ctx context.Context, userID int, secret string) error {
+	args := m.Called(ctx, userID, secret)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) GetTOTPEnrollment(ctx context.Context, userID int) (*models.TOTPEnrollment, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.TOTPEnrollment), args.Error(1)
+}
+
+func (m *MockAuthRepository) ConfirmTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	args := m.Called(ctx, userID, step, recoveryCodeHashes)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) RecordTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	args := m.Called(ctx, userID, step)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockAuthRepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	args := m.Called(ctx, userID, codeHash)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockAuthRepository) DisableTOTP(ctx context.Context, userID int) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) CreateMFAChallenge(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userID, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) GetMFAChallenge(ctx context.Context, tokenHash string) (int, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockAuthRepository) RecordMFAChallengeFailure(ctx context.Context, tokenHash string) error {
+	args := m.Called(ctx, tokenHash)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) ConsumeMFAChallenge(ctx context.Context, tokenHash string) (int, error) {
+	args := m.Called(ctx, tokenHash)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockAuthRepository) RecordFailedLogin(ctx context.Context, userID int) (int, error) {
+	args := m.Called(ctx, userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockAuthRepository) LockAccount(ctx context.Context, userID int, until time.Time) error {
+	args := m.Called(ctx, userID, until)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) ResetFailedLogins(ctx context.Context, userID int) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) CreatePersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) ListPersonalAccessTokens(ctx context.Context, userID int) ([]models.PersonalAccessToken, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.PersonalAccessToken), args.Error(1)
+}
+
+func (m *MockAuthRepository) DeletePersonalAccessToken(ctx context.Context, userID int, id int64) error {
+	args := m.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) UsePersonalAccessToken(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.PersonalAccessToken), args.Error(1)
+}
+
+func (m *MockAuthRepository) ListUsers(ctx context.Context, filter models.UserListFilter) ([]models.User, int, error) {
+	args := m.Called(ctx, filter)
+	users, _ := args.Get(0).([]models.User)
+	return users, args.Int(1), args.Error(2)
+}
+
+func (m *MockAuthRepository) AdminUpdateUser(ctx context.Context, userID int, update models.AdminUpdateUserRequest) (*models.User, error) {
+	args := m.Called(ctx, userID, update)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (m *MockAuthRepository) ForceLogout(ctx context.Context, userID int) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	args := m.Called(ctx, session)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) ListSessions(ctx context.Context, userID int) ([]models.Session, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Session), args.Error(1)
+}
+
+func (m *MockAuthRepository) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockAuthRepository) TouchSession(ctx context.Context, sessionID string, staleBefore time.Time) error {
+	args := m.Called(ctx, sessionID, staleBefore)
+	return args.Error(0)
+}
+
+// --- Mock AuditRepository ---
+type MockAuditRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditRepository) RecordAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+func (m *MockAuditRepository) ListAuditEvents(ctx context.Context, filter models.AuditLogFilter) ([]models.AuditEvent, error) {
+	args := m.Called(ctx, filter)
+	events, _ := args.Get(0).([]models.AuditEvent)
+	return events, args.Error(1)
+}
+
 // --- Mock EventPublisher ---
 type MockEventPublisher struct {
 	mock.Mock
 }
 
-func (m *MockEventPublisher) PublishUserRegisteredEvent(ctx context.Context, userEmail string) error {
-	args := m.Called(ctx, userEmail)
+func (m *MockEventPublisher) Publish(ctx context.Context, event events.Event) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+func (m *MockEventPublisher) PublishEnvelope(ctx context.Context, envelope events.Envelope) error {
+	args := m.Called(ctx, envelope)
 	return args.Error(0)
 }
 
@@ -84,8 +387,14 @@ func TestRegisterHandler_Success(t *testing.T) {
 	expectedUserID := 1 // Example user ID returned by mock repo
 
 	// Configure mock expectations
-	mockRepo.On("Register", expectedUserArg).Return(expectedUserID, nil)
-	mockPublisher.On("PublishUserRegisteredEvent", mock.AnythingOfType("*context.valueCtx"), registerReq.Email).Return(nil) // Use AnythingOfType for context
+	var verification *models.EmailVerificationToken
+	var newEvent func(userID int) events.Event
+	mockRepo.On("Register", mock.Anything, expectedUserArg, mock.AnythingOfType("*models.EmailVerificationToken"), mock.Anything).
+		Run(func(args mock.Arguments) {
+			verification = args.Get(2).(*models.EmailVerificationToken)
+			newEvent = args.Get(3).(func(userID int) events.Event)
+		}).
+		Return(expectedUserID, nil)
 
 	// 2. Create Handler with Mocks
 	handler := handlers.NewAuthHandler(mockRepo, mockPublisher)
@@ -107,12 +416,24 @@ func TestRegisterHandler_Success(t *testing.T) {
 
 	// 6. Verify Mock Expectations
 	mockRepo.AssertExpectations(t)
-	mockPublisher.AssertExpectations(t)
+	// The event goes to the outbox with the user, not straight to the broker
+	mockPublisher.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+
+	// The event carries the raw token; only its hash is stored
+	require.NotNil(t, verification)
+	assert.WithinDuration(t, time.Now().Add(utils.EmailVerificationTTL()), verification.ExpiresAt, time.Minute)
+	event, ok := newEvent(expectedUserID).(events.UserRegisteredEvent)
+	require.True(t, ok)
+	assert.Equal(t, expectedUserID, event.UserID)
+	assert.Equal(t, registerReq.Email, event.Email)
+	assert.Equal(t, registerReq.Username, event.Username)
+	assert.NotEmpty(t, event.VerificationToken)
+	assert.Equal(t, verification.TokenHash, utils.HashToken(event.VerificationToken))
+	assert.Equal(t, verification.ExpiresAt, *event.VerificationExpiresAt)
 }
 
 // TODO: Add TestRegisterHandler_UserExistsError
 // TODO: Add TestRegisterHandler_HashingError (harder to trigger without more mocking)
-// TODO: Add TestRegisterHandler_EventPublishError
 
 func TestLoginHandler_Success(t *testing.T) {
 	// 1. Setup Mock
@@ -130,21 +451,36 @@ func TestLoginHandler_Success(t *testing.T) {
 		Password: loginReq.Password,
 	}
 	// User data returned by GetUserByEmail mock
+	verifiedAt := time.Now().Add(-time.Hour)
 	mockDbUser := &models.User{
-		ID:       1,
-		Username: "testuser",
-		Email:    loginReq.Email,
-		Password: "hashedpassword", // The repo returns the hashed password
+		ID:              1,
+		Username:        "testuser",
+		Email:           loginReq.Email,
+		Password:        "hashedpassword", // The repo returns the hashed password
+		EmailVerifiedAt: &verifiedAt,
 	}
 
 	// Configure mock expectations
 	mockRepo.On("Authenticate", expectedAuthUserArg).Return(true, nil)
-	mockRepo.On("GetUserByEmail", mock.AnythingOfType("*context.valueCtx"), loginReq.Email).Return(mockDbUser, nil) // Use AnythingOfType for context
-	// Expect event to be published on successful login
-	mockPublisher.On("PublishUserRegisteredEvent", mock.AnythingOfType("*context.valueCtx"), loginReq.Email).Return(nil) // Use AnythingOfType for context
+	mockRepo.On("GetUserByEmail", mock.Anything, loginReq.Email).Return(mockDbUser, nil) // Use AnythingOfType for context
+	mockRepo.On("CreateSession", mock.Anything, mock.MatchedBy(func(session *models.Session) bool {
+		return session.UserID == mockDbUser.ID && session.ID != ""
+	})).Return(nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, mock.MatchedBy(func(token *models.RefreshToken) bool {
+		return token.UserID == mockDbUser.ID && token.FamilyID != "" && len(token.TokenHash) == 64
+	})).Return(nil)
+	// Expect the login to be recorded in the audit log and published as its own event type
+	mockAudit := new(MockAuditRepository)
+	mockAudit.On("RecordAuditEvent", mock.Anything, mock.MatchedBy(func(event models.AuditEvent) bool {
+		return event.EventType == models.AuditLogin && event.Outcome == models.AuditSuccess && *event.UserID == mockDbUser.ID
+	})).Return(nil)
+	mockPublisher.On("Publish", mock.Anything, mock.MatchedBy(func(event events.UserLoggedInEvent) bool {
+		return event.UserID == mockDbUser.ID && event.Email == mockDbUser.Email && event.Method == "password"
+	})).Return(nil)
 
 	// 2. Create Handler with Mock
 	handler := handlers.NewAuthHandler(mockRepo, mockPublisher) // Pass mock publisher
+	handler.SetAuditLog(mockAudit)
 
 	// 3. Prepare HTTP Request
 	body, _ := json.Marshal(loginReq)
@@ -160,17 +496,19 @@ func TestLoginHandler_Success(t *testing.T) {
 	err := json.NewDecoder(rr.Body).Decode(&response)
 	assert.NoError(t, err, "Response body should be valid JSON")
 	assert.NotEmpty(t, response["token"], "Response should contain a token")
+	assert.NotEmpty(t, response["refresh_token"], "Response should contain a refresh token")
 
 	userData, ok := response["user"].(map[string]interface{})
 	assert.True(t, ok, "Response should contain user data")
 	if ok {
-		assert.Equal(t, float64(mockDbUser.ID), userData["ID"], "User ID in response should match")
-		assert.Equal(t, mockDbUser.Username, userData["Username"], "Username in response should match")
-		assert.Equal(t, mockDbUser.Email, userData["Email"], "Email in response should match")
+		assert.Equal(t, float64(mockDbUser.ID), userData["id"], "User ID in response should match")
+		assert.Equal(t, mockDbUser.Username, userData["username"], "Username in response should match")
+		assert.Equal(t, mockDbUser.Email, userData["email"], "Email in response should match")
 	}
 
 	// 6. Verify Mock Expectations
 	mockRepo.AssertExpectations(t)
+	mockAudit.AssertExpectations(t)
 	mockPublisher.AssertExpectations(t)
 }
 
@@ -178,3 +516,100 @@ func TestLoginHandler_Success(t *testing.T) {
 // TODO: Add TestLoginHandler_UserNotFound
 // TODO: Add TestLoginHandler_TokenGenerationError
 // TODO: Add TestLoginHandler_EventPublishError
+
+func TestRefreshToken_Rotates(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+
+	rawToken := "raw-refresh-token"
+	stored := &models.RefreshToken{
+		ID:        10,
+		UserID:    1,
+		FamilyID:  "family-1",
+		TokenHash: utils.HashToken(rawToken),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	user := &models.User{ID: 1, Username: "testuser", Email: "test@example.com"}
+
+	mockRepo.On("GetRefreshTokenByHash", mock.Anything, stored.TokenHash).Return(stored, nil)
+	mockRepo.On("GetUserByID", mock.Anything, 1).Return(user, nil)
+	mockRepo.On("RotateRefreshToken", mock.Anything, int64(10), mock.MatchedBy(func(next *models.RefreshToken) bool {
+		// The replacement stays in the same family but has a different value
+		return next.FamilyID == stored.FamilyID && next.TokenHash != stored.TokenHash
+	})).Return(nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+
+	body, _ := json.Marshal(models.RefreshRequest{RefreshToken: rawToken})
+	req, _ := http.NewRequest("POST", "/token/refresh", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+
+	handler.RefreshToken(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response models.TokenResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	assert.NotEmpty(t, response.Token)
+	assert.NotEmpty(t, response.RefreshToken)
+	assert.NotEqual(t, rawToken, response.RefreshToken, "Refresh token should be rotated")
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRefreshToken_ReuseRevokesFamily(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+
+	rawToken := "already-rotated-token"
+	revokedAt := time.Now().Add(-time.Minute)
+	stored := &models.RefreshToken{
+		ID:        11,
+		UserID:    1,
+		FamilyID:  "family-2",
+		TokenHash: utils.HashToken(rawToken),
+		ExpiresAt: time.Now().Add(time.Hour),
+		RevokedAt: &revokedAt,
+	}
+
+	mockRepo.On("GetRefreshTokenByHash", mock.Anything, stored.TokenHash).Return(stored, nil)
+	mockRepo.On("RevokeRefreshTokenFamily", mock.Anything, "family-2").Return(nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+
+	body, _ := json.Marshal(models.RefreshRequest{RefreshToken: rawToken})
+	req, _ := http.NewRequest("POST", "/token/refresh", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+
+	handler.RefreshToken(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "RotateRefreshToken", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRefreshToken_ConcurrentRotationRevokesFamily(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+
+	rawToken := "raced-token"
+	stored := &models.RefreshToken{
+		ID:        12,
+		UserID:    1,
+		FamilyID:  "family-3",
+		TokenHash: utils.HashToken(rawToken),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	mockRepo.On("GetRefreshTokenByHash", mock.Anything, stored.TokenHash).Return(stored, nil)
+	mockRepo.On("GetUserByID", mock.Anything, 1).Return(&models.User{ID: 1}, nil)
+	mockRepo.On("RotateRefreshToken", mock.Anything, int64(12), mock.Anything).Return(repository.ErrRefreshTokenReused)
+	mockRepo.On("RevokeRefreshTokenFamily", mock.Anything, "family-3").Return(nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+
+	body, _ := json.Marshal(models.RefreshRequest{RefreshToken: rawToken})
+	req, _ := http.NewRequest("POST", "/token/refresh", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+
+	handler.RefreshToken(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,199 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"auth-service/internal/events"
+	"auth-service/internal/handlers"
+	"auth-service/internal/models"
+	"auth-service/internal/ratelimit"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestVerifyEmail_Success(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("VerifyEmail", mock.Anything, utils.HashToken("emailed-token")).Return(3, nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+	req, _ := http.NewRequest("GET", "/verify-email?token=emailed-token", nil)
+	rr := httptest.NewRecorder()
+
+	handler.VerifyEmail(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestVerifyEmail_InvalidToken(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("VerifyEmail", mock.Anything, mock.Anything).Return(0, repository.ErrInvalidVerificationToken)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+
+	for _, url := range []string{"/verify-email?token=used-token", "/verify-email"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		rr := httptest.NewRecorder()
+		handler.VerifyEmail(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, url)
+	}
+}
+
+// loginUnverified logs in as a user registered at createdAt who never verified their email.
+func loginUnverified(createdAt time.Time) *httptest.ResponseRecorder {
+	mockRepo := new(MockAuthRepository)
+	mockPublisher := new(MockEventPublisher)
+	user := &models.User{ID: 4, Username: "unverified", Email: "unverified@example.com", CreatedAt: createdAt}
+
+	mockRepo.On("Authenticate", mock.Anything).Return(true, nil)
+	mockRepo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+	mockRepo.On("CreateSession", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+	mockPublisher.On("Publish", mock.Anything, mock.Anything).Return(nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, mockPublisher)
+	body, _ := json.Marshal(models.LoginRequest{Email: user.Email, Password: "password123"})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.Login(rr, req)
+	return rr
+}
+
+func TestLogin_UnverifiedPolicy(t *testing.T) {
+	justRegistered := time.Now().Add(-time.Hour)
+	longAgo := time.Now().Add(-30 * 24 * time.Hour)
+
+	tests := []struct {
+		policy    string
+		createdAt time.Time
+		want      int
+	}{
+		{"allow", longAgo, http.StatusOK},
+		{"require", justRegistered, http.StatusForbidden},
+		{"limit", justRegistered, http.StatusOK},
+		{"limit", longAgo, http.StatusForbidden},
+		{"", longAgo, http.StatusForbidden}, // Defaults to limit
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			t.Setenv("EMAIL_VERIFICATION_POLICY", tt.policy)
+			t.Setenv("EMAIL_VERIFICATION_GRACE_PERIOD", "72h")
+
+			rr := loginUnverified(tt.createdAt)
+			assert.Equal(t, tt.want, rr.Code)
+			if rr.Code == http.StatusOK {
+				var resp models.TokenResponse
+				assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+				assert.False(t, resp.User.EmailVerified)
+			}
+		})
+	}
+}
+
+func TestResendVerification_SkipsVerifiedAccounts(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockPublisher := new(MockEventPublisher)
+
+	verifiedAt := time.Now()
+	lookedUp := make(chan struct{}, 1)
+	mockRepo.On("GetUserByEmail", mock.Anything, "verified@example.com").
+		Run(func(mock.Arguments) { lookedUp <- struct{}{} }).
+		Return(&models.User{ID: 5, Email: "verified@example.com", EmailVerifiedAt: &verifiedAt}, nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, mockPublisher)
+	body, _ := json.Marshal(models.ResendVerificationRequest{Email: "verified@example.com"})
+	req, _ := http.NewRequest("POST", "/verify-email/resend", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+
+	handler.ResendVerification(rr, req)
+
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	select {
+	case <-lookedUp:
+	case <-time.After(2 * time.Second):
+		t.Fatal("user lookup did not run")
+	}
+	// Give the background goroutine a moment to (not) continue
+	time.Sleep(50 * time.Millisecond)
+	mockRepo.AssertNotCalled(t, "CreateEmailVerificationToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockPublisher.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+}
+
+// postResendVerification sends POST /verify-email/resend for email to handler.
+func postResendVerification(handler *handlers.AuthHandler, email string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.ResendVerificationRequest{Email: email})
+	req, _ := http.NewRequest("POST", "/verify-email/resend", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.ResendVerification(rr, req)
+	return rr
+}
+
+func TestResendVerification_PerEmailLimitSendsNothingMore(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	lookedUp := make(chan struct{}, 3)
+	mockRepo.On("GetUserByEmail", mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { lookedUp <- struct{}{} }).
+		Return(nil, nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+	handler.SetVerificationResendLimiter(ratelimit.NewLimiter(ratelimit.NewMemoryStore(), "resend-verification-email", ratelimit.Limit{Requests: 2, Per: time.Hour}))
+
+	first := postResendVerification(handler, "victim@example.com")
+	postResendVerification(handler, "Victim@example.com")
+	limited := postResendVerification(handler, "victim@example.com")
+
+	// The limit is not revealed to the caller
+	assert.Equal(t, http.StatusAccepted, limited.Code)
+	assert.Equal(t, first.Body.String(), limited.Body.String())
+	for range 2 {
+		select {
+		case <-lookedUp:
+		case <-time.After(2 * time.Second):
+			t.Fatal("background verification resend work did not run")
+		}
+	}
+	select {
+	case <-lookedUp:
+		t.Fatal("request over the per-email limit was processed")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestResendVerification_PublishesVerificationRequested(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockPublisher := new(MockEventPublisher)
+
+	var storedHash string
+	mockRepo.On("GetUserByEmail", mock.Anything, "ada@example.com").
+		Return(&models.User{ID: 7, Username: "ada", Email: "ada@example.com"}, nil)
+	mockRepo.On("CreateEmailVerificationToken", mock.Anything, 7, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { storedHash = args.String(2) }).
+		Return(nil)
+	published := make(chan events.VerificationRequestedEvent, 1)
+	mockPublisher.On("Publish", mock.Anything, mock.AnythingOfType("events.VerificationRequestedEvent")).
+		Run(func(args mock.Arguments) { published <- args.Get(1).(events.VerificationRequestedEvent) }).
+		Return(nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, mockPublisher)
+	rr := postResendVerification(handler, "ada@example.com")
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	select {
+	case event := <-published:
+		// A dedicated event, so consumers of user.registered do not see a second registration
+		assert.Equal(t, 7, event.UserID)
+		assert.Equal(t, "ada@example.com", event.Email)
+		assert.Equal(t, storedHash, utils.HashToken(event.Token))
+		assert.WithinDuration(t, time.Now().Add(utils.EmailVerificationTTL()), event.ExpiresAt, time.Minute)
+	case <-time.After(2 * time.Second):
+		t.Fatal("verification requested event was not published")
+	}
+}
@@ -0,0 +1,201 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"auth-service/internal/events"
+	"cozy-go/shared/cloudevents"
+	"cozy-go/shared/requestid"
+	"cozy-go/topology"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sampleEvents holds a fully populated event of every type in the catalog.
+func sampleEvents() map[string]events.Event {
+	expiresAt := time.Now().Add(time.Hour)
+	return map[string]events.Event{
+		events.TypeUserRegistered: events.UserRegisteredEvent{
+			UserID: 1, Email: "ada@example.com", Username: "ada",
+			VerificationToken: "verify-token", VerificationExpiresAt: &expiresAt,
+		},
+		events.TypeUserLoggedIn: events.UserLoggedInEvent{
+			UserID: 1, Email: "ada@example.com", Username: "ada", Method: "oauth:google",
+			IPAddress: "192.0.2.1", UserAgent: "Mozilla/5.0",
+		},
+		events.TypePasswordChanged: events.PasswordChangedEvent{
+			UserID: 1, Email: "ada@example.com", Username: "ada", Reason: events.PasswordChangedByReset,
+		},
+		events.TypeUserDeleted: events.UserDeletedEvent{UserID: 1, Email: "ada@example.com", Username: "ada"},
+		events.TypePasswordResetRequested: events.PasswordResetRequestedEvent{
+			UserID: 1, Email: "ada@example.com", Username: "ada", Token: "reset-token", ExpiresAt: expiresAt,
+		},
+		events.TypeMagicLinkRequested: events.MagicLinkRequestedEvent{
+			UserID: 1, Email: "ada@example.com", Username: "ada", Token: "link-token", ExpiresAt: expiresAt,
+		},
+		events.TypeEmailChanged: events.EmailChangedEvent{
+			UserID: 1, Username: "ada", OldEmail: "ada@example.com", NewEmail: "ada@example.org",
+			VerificationToken: "verify-token", VerificationExpiresAt: expiresAt,
+		},
+		events.TypeVerificationRequested: events.VerificationRequestedEvent{
+			UserID: 1, Email: "ada@example.com", Username: "ada", Token: "verify-token", ExpiresAt: expiresAt,
+		},
+	}
+}
+
+// compileSchema compiles a schema returned by the events package.
+func compileSchema(t *testing.T, name string, schema []byte) *jsonschema.Schema {
+	t.Helper()
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.AssertFormat = true
+	require.NoError(t, compiler.AddResource(name, bytes.NewReader(schema)))
+	compiled, err := compiler.Compile(name)
+	require.NoError(t, err)
+	return compiled
+}
+
+// validateJSON checks that data conforms to schema.
+func validateJSON(schema *jsonschema.Schema, data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return schema.Validate(value)
+}
+
+func TestEvents_CatalogMatchesSchemas(t *testing.T) {
+	samples := sampleEvents()
+	envelopeSchema, err := events.EnvelopeSchema()
+	require.NoError(t, err)
+	envelope := compileSchema(t, "envelope.json", envelopeSchema)
+	ctx := requestid.NewContext(context.Background(), "req-321")
+
+	for _, eventType := range events.Types() {
+		t.Run(eventType, func(t *testing.T) {
+			event, ok := samples[eventType]
+			require.True(t, ok, "add a sample event for %s", eventType)
+			assert.Equal(t, eventType, event.EventType())
+			if eventType != events.TypeUserLoggedIn { // Published for future consumers; nothing handles logins yet
+				assert.NotEmpty(t, topology.Routes(eventType), "no consumer queue is bound to the event type")
+			}
+
+			version := events.DataVersion(eventType)
+			raw, err := events.Schema(eventType, version)
+			require.NoError(t, err, "add schemas/%s.v%d.json", eventType, version)
+			schema := compileSchema(t, eventType+".json", raw)
+
+			env, err := events.NewEnvelope(ctx, event)
+			require.NoError(t, err)
+			structured, err := cloudevents.EncodeMessage(env, cloudevents.ContentModeStructured)
+			require.NoError(t, err)
+			assert.NoError(t, validateJSON(envelope, structured.Body))
+			assert.NoError(t, validateJSON(schema, env.Data))
+
+			// Schemas are closed, so a field added to the Go type without updating its schema fails here
+			var data map[string]any
+			require.NoError(t, json.Unmarshal(env.Data, &data))
+			data["undocumented"] = true
+			extended, _ := json.Marshal(data)
+			assert.Error(t, validateJSON(schema, extended))
+		})
+	}
+	assert.Len(t, samples, len(events.Types()), "sample for an event type missing from the catalog")
+}
+
+func TestEvents_EnvelopeMetadata(t *testing.T) {
+	ctx := requestid.NewContext(context.Background(), "req-321")
+	event := events.UserDeletedEvent{UserID: 42, Email: "ada@example.com", Username: "ada"}
+
+	first, err := events.NewEnvelope(ctx, event)
+	require.NoError(t, err)
+	second, err := events.NewEnvelope(context.Background(), event)
+	require.NoError(t, err)
+
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), first.ID)
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.Equal(t, "1.0", first.SpecVersion)
+	assert.Equal(t, events.TypeUserDeleted, first.Type)
+	assert.Equal(t, events.Source, first.Source)
+	assert.Equal(t, "42", first.Subject)
+	assert.Equal(t, 1, first.DataVersion)
+	assert.WithinDuration(t, time.Now(), first.Time, time.Minute)
+	assert.Equal(t, "req-321", first.CorrelationID)
+	assert.Empty(t, second.CorrelationID)
+
+	var data events.UserDeletedEvent
+	require.NoError(t, json.Unmarshal(first.Data, &data))
+	assert.Equal(t, event, data)
+}
+
+// unknownEvent is not in the catalog.
+type unknownEvent struct{}
+
+func (unknownEvent) EventType() string    { return "user.teleported" }
+func (unknownEvent) EventSubject() string { return "1" }
+
+func TestEvents_UnknownTypeIsRejected(t *testing.T) {
+	_, err := events.NewEnvelope(context.Background(), unknownEvent{})
+	assert.ErrorContains(t, err, "unknown event type")
+}
+
+func TestEvents_EncodeMessageModes(t *testing.T) {
+	ctx := requestid.NewContext(context.Background(), "req-321")
+	env, err := events.NewEnvelope(ctx, events.UserDeletedEvent{UserID: 42, Email: "ada@example.com", Username: "ada"})
+	require.NoError(t, err)
+
+	// Structured mode: the whole CloudEvent is the JSON body
+	structured, err := cloudevents.EncodeMessage(env, cloudevents.ContentModeStructured)
+	require.NoError(t, err)
+	assert.Equal(t, "application/cloudevents+json; charset=utf-8", structured.ContentType)
+	assert.Nil(t, structured.Attributes)
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(structured.Body, &body))
+	assert.Equal(t, "1.0", body["specversion"])
+	assert.Equal(t, env.ID, body["id"])
+	assert.Equal(t, "user.deleted", body["type"])
+	assert.Equal(t, "application/json", body["datacontenttype"])
+	assert.EqualValues(t, 1, body["dataversion"])
+	assert.Equal(t, "req-321", body["correlationid"])
+	assert.Equal(t, map[string]any{"user_id": float64(42), "email": "ada@example.com", "username": "ada"}, body["data"])
+
+	// Binary mode: the body is the data and the attributes are prefixed headers
+	binary, err := cloudevents.EncodeMessage(env, cloudevents.ContentModeBinary)
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", binary.ContentType)
+	assert.JSONEq(t, `{"user_id": 42, "email": "ada@example.com", "username": "ada"}`, string(binary.Body))
+	assert.Equal(t, map[string]any{
+		"cloudEvents:specversion":   "1.0",
+		"cloudEvents:id":            env.ID,
+		"cloudEvents:source":        "auth-service",
+		"cloudEvents:type":          "user.deleted",
+		"cloudEvents:subject":       "42",
+		"cloudEvents:time":          env.Time.Format(time.RFC3339Nano),
+		"cloudEvents:dataversion":   1,
+		"cloudEvents:correlationid": "req-321",
+	}, binary.Attributes)
+
+	_, err = cloudevents.EncodeMessage(env, "batched")
+	assert.Error(t, err)
+}
+
+func TestEvents_ParseContentMode(t *testing.T) {
+	for input, want := range map[string]cloudevents.ContentMode{
+		"":           cloudevents.ContentModeStructured,
+		"structured": cloudevents.ContentModeStructured,
+		"binary":     cloudevents.ContentModeBinary,
+	} {
+		mode, err := cloudevents.ParseContentMode(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, mode, input)
+	}
+	_, err := cloudevents.ParseContentMode("Binary")
+	assert.Error(t, err)
+}
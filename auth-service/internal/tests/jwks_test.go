@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-service/internal/handlers"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useTestKeys installs keys as the process-wide key set for the duration of the test.
+func useTestKeys(t *testing.T, keys []*utils.SigningKey, activeKID string) {
+	t.Helper()
+	previous, _ := utils.Keys()
+	ks, err := utils.NewKeySet(keys, activeKID)
+	require.NoError(t, err)
+	utils.SetKeys(ks)
+	t.Cleanup(func() { utils.SetKeys(previous) })
+}
+
+func TestJWKS_PublishesAllKeys(t *testing.T) {
+	rsaKey, err := utils.GenerateSigningKey("RS256")
+	require.NoError(t, err)
+	edKey, err := utils.GenerateSigningKey("EdDSA")
+	require.NoError(t, err)
+	useTestKeys(t, []*utils.SigningKey{rsaKey, edKey}, edKey.ID)
+
+	req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	rr := httptest.NewRecorder()
+	handlers.NewJWKSHandler().ServeJWKS(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var set utils.JWKS
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&set))
+	require.Len(t, set.Keys, 2)
+
+	byKid := map[string]utils.JWK{}
+	for _, k := range set.Keys {
+		byKid[k.KeyID] = k
+	}
+	assert.Equal(t, "RSA", byKid[rsaKey.ID].KeyType)
+	assert.Equal(t, "RS256", byKid[rsaKey.ID].Algorithm)
+	assert.NotEmpty(t, byKid[rsaKey.ID].N)
+	assert.Equal(t, "OKP", byKid[edKey.ID].KeyType)
+	assert.Equal(t, "Ed25519", byKid[edKey.ID].Curve)
+	assert.NotEmpty(t, byKid[edKey.ID].X)
+}
+
+func TestJWT_KeyRotationKeepsOldTokensValid(t *testing.T) {
+	oldKey, err := utils.GenerateSigningKey("RS256")
+	require.NoError(t, err)
+	newKey, err := utils.GenerateSigningKey("EdDSA")
+	require.NoError(t, err)
+
+	// Sign with the old key first
+	useTestKeys(t, []*utils.SigningKey{oldKey}, oldKey.ID)
+	oldToken, err := utils.GenerateJWT(models.User{ID: 1}, "")
+	require.NoError(t, err)
+
+	// Rotate: the new key signs, the old key is still trusted
+	useTestKeys(t, []*utils.SigningKey{oldKey, newKey}, newKey.ID)
+	newToken, err := utils.GenerateJWT(models.User{ID: 2}, "")
+	require.NoError(t, err)
+
+	claims, err := utils.ParseJWT(oldToken)
+	require.NoError(t, err)
+	assert.Equal(t, "1", claims.Subject)
+
+	claims, err = utils.ParseJWT(newToken)
+	require.NoError(t, err)
+	assert.Equal(t, "2", claims.Subject)
+
+	// Once the old key is retired its tokens are rejected
+	useTestKeys(t, []*utils.SigningKey{newKey}, newKey.ID)
+	_, err = utils.ParseJWT(oldToken)
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"auth-service/internal/handlers"
+	"auth-service/internal/models"
+	"auth-service/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func postJSON(handler http.HandlerFunc, url string, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(payload))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestLogin_ByUsername(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	verifiedAt := time.Now()
+	user := &models.User{ID: 4, Username: "Bob", Email: "bob@example.com", EmailVerifiedAt: &verifiedAt}
+	mockRepo.On("GetUserByUsername", mock.Anything, "BOB").Return(user, nil)
+	// The password is checked against the account's email even for username logins
+	mockRepo.On("Authenticate", models.User{Email: "bob@example.com", Password: "password123"}).Return(true, nil)
+	mockRepo.On("CreateSession", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+
+	rr := postJSON(handlers.NewAuthHandler(mockRepo, nil).Login, "/login", models.LoginRequest{Login: " BOB ", Password: "password123"})
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	mockRepo.AssertNotCalled(t, "GetUserByEmail", mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLogin_ByEmailInLoginField(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("GetUserByEmail", mock.Anything, "Bob@Example.com").Return(nil, nil)
+	mockRepo.On("Authenticate", models.User{Email: "Bob@Example.com", Password: "password123"}).Return(false, nil)
+
+	rr := postJSON(handlers.NewAuthHandler(mockRepo, nil).Login, "/login", models.LoginRequest{Login: "Bob@Example.com", Password: "password123"})
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	mockRepo.AssertNotCalled(t, "GetUserByUsername", mock.Anything, mock.Anything)
+}
+
+func TestLogin_RequiresIdentifier(t *testing.T) {
+	for _, body := range []models.LoginRequest{
+		{Password: "password123"},
+		{Email: "not-an-email", Password: "password123"},
+	} {
+		rr := postJSON(handlers.NewAuthHandler(new(MockAuthRepository), nil).Login, "/login", body)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "%+v", body)
+	}
+}
+
+func TestRegister_NormalizesIdentity(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("Register", mock.Anything, mock.MatchedBy(func(user models.User) bool {
+		return user.Username == "Bob" && user.Email == "bob@example.com"
+	}), mock.Anything, mock.Anything).Return(9, nil)
+
+	rr := postJSON(handlers.NewAuthHandler(mockRepo, nil).Register, "/register",
+		models.RegisterRequest{Username: "  Bob ", Email: " Bob@Example.COM", Password: "password123"})
+
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRegister_Conflicts(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("Register", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(0, repository.ErrEmailTaken)
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+
+	rr := postJSON(handler.Register, "/register", models.RegisterRequest{Username: "bob", Email: "BOB@example.com", Password: "password123"})
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	// "@" is reserved for telling emails and usernames apart at login
+	rr = postJSON(handler.Register, "/register", models.RegisterRequest{Username: "bob@home", Email: "bob@example.com", Password: "password123"})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	mockRepo.AssertNumberOfCalls(t, "Register", 1)
+}
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-service/internal/handlers"
+	"auth-service/internal/middleware"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// issueTestToken returns a signed access token for user and its parsed claims.
+func issueTestToken(t *testing.T, user models.User) (string, *utils.Claims) {
+	t.Helper()
+	token, err := utils.GenerateJWT(user, "")
+	require.NoError(t, err)
+	claims, err := utils.ParseJWT(token)
+	require.NoError(t, err)
+	return token, claims
+}
+
+func TestJWTAuth_RejectsRevokedToken(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	token, claims := issueTestToken(t, models.User{ID: 7, TokenVersion: 2})
+
+	mockRepo.On("IsAccessTokenRevoked", mock.Anything, claims.ID, 7, 2, "").Return(true, nil)
+
+	authenticator := middleware.NewAuthenticator(mockRepo)
+	called := false
+	protected := authenticator.JWTAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	protected.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.False(t, called, "Handler must not run for a revoked token")
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLogout_RevokesAccessTokenAndRefreshFamily(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	token, claims := issueTestToken(t, models.User{ID: 7})
+
+	rawRefresh := "refresh-token"
+	mockRepo.On("IsAccessTokenRevoked", mock.Anything, claims.ID, 7, 0, "").Return(false, nil)
+	mockRepo.On("RevokeAccessToken", mock.Anything, claims.ID, 7, claims.ExpiresAt.Time).Return(nil)
+	mockRepo.On("GetRefreshTokenByHash", mock.Anything, utils.HashToken(rawRefresh)).
+		Return(&models.RefreshToken{ID: 1, UserID: 7, FamilyID: "family-7"}, nil)
+	mockRepo.On("RevokeRefreshTokenFamily", mock.Anything, "family-7").Return(nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+	authenticator := middleware.NewAuthenticator(mockRepo)
+
+	body, _ := json.Marshal(models.LogoutRequest{RefreshToken: rawRefresh})
+	req, _ := http.NewRequest("POST", "/logout", bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	authenticator.JWTAuth(http.HandlerFunc(handler.Logout)).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLogoutAll_BumpsTokenVersion(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	token, claims := issueTestToken(t, models.User{ID: 7})
+
+	mockRepo.On("IsAccessTokenRevoked", mock.Anything, claims.ID, 7, 0, "").Return(false, nil)
+	mockRepo.On("IncrementTokenVersion", mock.Anything, 7).Return(1, nil)
+	mockRepo.On("RevokeAllRefreshTokens", mock.Anything, 7).Return(nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+	authenticator := middleware.NewAuthenticator(mockRepo)
+
+	req, _ := http.NewRequest("POST", "/logout-all", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	authenticator.JWTAuth(http.HandlerFunc(handler.LogoutAll)).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestIntrospect_ReportsRevokedTokenInactive(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	token, claims := issueTestToken(t, models.User{ID: 7})
+
+	mockRepo.On("IsAccessTokenRevoked", mock.Anything, claims.ID, 7, 0, "").Return(true, nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+
+	body, _ := json.Marshal(models.IntrospectionRequest{Token: token})
+	req, _ := http.NewRequest("POST", "/token/introspect", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.Introspect(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp models.IntrospectionResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.False(t, resp.Active)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestIntrospect_RequiresServiceSecret(t *testing.T) {
+	token, _ := issueTestToken(t, models.User{ID: 7})
+	handler := handlers.NewAuthHandler(new(MockAuthRepository), nil)
+	handler.SetIntrospectionSecret("s3cret")
+
+	for _, credential := range []string{"", "Bearer wrong", "s3cret"} {
+		body, _ := json.Marshal(models.IntrospectionRequest{Token: token})
+		req, _ := http.NewRequest("POST", "/token/introspect", bytes.NewBuffer(body))
+		if credential != "" {
+			req.Header.Set("Authorization", credential)
+		}
+		rr := httptest.NewRecorder()
+		handler.Introspect(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, credential)
+	}
+}
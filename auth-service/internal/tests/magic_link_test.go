@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"auth-service/internal/events"
+	"auth-service/internal/handlers"
+	"auth-service/internal/models"
+	"auth-service/internal/ratelimit"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestMagicLink_PublishesEvent(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockPublisher := new(MockEventPublisher)
+
+	user := &models.User{ID: 5, Username: "linkuser", Email: "link@example.com"}
+	var storedHash string
+	mockRepo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+	mockRepo.On("CreateMagicLinkToken", mock.Anything, 5, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+		Run(func(args mock.Arguments) { storedHash = args.String(2) }).
+		Return(nil)
+
+	published := make(chan events.MagicLinkRequestedEvent, 1)
+	mockPublisher.On("Publish", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { published <- args.Get(1).(events.MagicLinkRequestedEvent) }).
+		Return(nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, mockPublisher)
+	rr := postJSON(handler.RequestMagicLink, "/login/magic-link", models.MagicLinkRequest{Email: " Link@Example.com"})
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	select {
+	case event := <-published:
+		assert.Equal(t, 5, event.UserID)
+		assert.Equal(t, user.Email, event.Email)
+		// Only the hash of the emailed token is stored
+		assert.Equal(t, utils.HashToken(event.Token), storedHash)
+		assert.WithinDuration(t, time.Now().Add(utils.MagicLinkTTL()), event.ExpiresAt, time.Minute)
+	case <-time.After(2 * time.Second):
+		t.Fatal("MagicLinkRequestedEvent was not published")
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestRequestMagicLink_UnknownEmailLooksTheSame(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockPublisher := new(MockEventPublisher)
+	lookedUp := make(chan struct{}, 1)
+	mockRepo.On("GetUserByEmail", mock.Anything, "nobody@example.com").
+		Run(func(mock.Arguments) { lookedUp <- struct{}{} }).
+		Return(nil, nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, mockPublisher)
+	rr := postJSON(handler.RequestMagicLink, "/login/magic-link", models.MagicLinkRequest{Email: "nobody@example.com"})
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	select {
+	case <-lookedUp:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Unknown email was not looked up")
+	}
+	mockRepo.AssertNotCalled(t, "CreateMagicLinkToken", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockPublisher.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+}
+
+func TestVerifyMagicLink_IssuesTokens(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	verifiedAt := time.Now()
+	mockRepo.On("ConsumeMagicLinkToken", mock.Anything, utils.HashToken("link-token")).Return(5, nil)
+	mockRepo.On("GetUserByID", mock.Anything, 5).Return(&models.User{ID: 5, Email: "link@example.com", EmailVerifiedAt: &verifiedAt}, nil)
+	mockRepo.On("CreateSession", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+
+	rr := postJSON(handlers.NewAuthHandler(mockRepo, nil).VerifyMagicLink, "/login/magic-link/verify", models.MagicLinkVerifyRequest{Token: "link-token"})
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp models.TokenResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.NotEmpty(t, resp.Token)
+	assert.NotEmpty(t, resp.RefreshToken)
+	assert.Equal(t, "link@example.com", resp.User.Email)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestVerifyMagicLink_RejectsInvalidToken(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("ConsumeMagicLinkToken", mock.Anything, utils.HashToken("used-token")).Return(0, repository.ErrInvalidMagicLink)
+
+	rr := postJSON(handlers.NewAuthHandler(mockRepo, nil).VerifyMagicLink, "/login/magic-link/verify", models.MagicLinkVerifyRequest{Token: "used-token"})
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	mockRepo.AssertNotCalled(t, "GetUserByID", mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "CreateRefreshToken", mock.Anything, mock.Anything)
+}
+
+func TestVerifyMagicLink_WithMFAReturnsChallenge(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("ConsumeMagicLinkToken", mock.Anything, utils.HashToken("link-token")).Return(8, nil)
+	mockRepo.On("GetUserByID", mock.Anything, 8).Return(&models.User{ID: 8, Email: "mfa@example.com", MFAEnabled: true}, nil)
+	mockRepo.On("CreateMFAChallenge", mock.Anything, 8, mock.Anything, mock.Anything).Return(nil)
+
+	rr := postJSON(handlers.NewAuthHandler(mockRepo, nil).VerifyMagicLink, "/login/magic-link/verify", models.MagicLinkVerifyRequest{Token: "link-token"})
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp map[string]interface{}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, true, resp["mfa_required"])
+	assert.NotContains(t, resp, "token")
+	mockRepo.AssertNotCalled(t, "CreateRefreshToken", mock.Anything, mock.Anything)
+}
+
+func TestRequestMagicLink_PerEmailLimitSendsNothingMore(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	lookedUp := make(chan struct{}, 3)
+	mockRepo.On("GetUserByEmail", mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { lookedUp <- struct{}{} }).
+		Return(nil, nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+	handler.SetMagicLinkLimiter(ratelimit.NewLimiter(ratelimit.NewMemoryStore(), "magic-link-email", ratelimit.Limit{Requests: 2, Per: time.Hour}))
+
+	first := postJSON(handler.RequestMagicLink, "/login/magic-link", models.MagicLinkRequest{Email: "victim@example.com"})
+	postJSON(handler.RequestMagicLink, "/login/magic-link", models.MagicLinkRequest{Email: " Victim@Example.com"})
+	limited := postJSON(handler.RequestMagicLink, "/login/magic-link", models.MagicLinkRequest{Email: "victim@example.com"})
+
+	// The limit is not revealed to the caller
+	assert.Equal(t, http.StatusAccepted, limited.Code)
+	assert.Equal(t, first.Body.String(), limited.Body.String())
+	for range 2 {
+		select {
+		case <-lookedUp:
+		case <-time.After(2 * time.Second):
+			t.Fatal("background sign-in link work did not run")
+		}
+	}
+	select {
+	case <-lookedUp:
+		t.Fatal("request over the per-email limit was processed")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,270 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-service/internal/handlers"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the RFC 6238 test key "12345678901234567890" in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	// The RFC lists 8 digit codes; the last 6 digits are the 6 digit codes
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		code, err := utils.TOTPCode(rfcSecret, utils.TOTPStep(time.Unix(unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, want, code, "time %d", unix)
+	}
+}
+
+func TestValidateTOTP_AllowsOneStepOfClockDrift(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := utils.TOTPStep(now)
+
+	for offset, want := range map[int64]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+		code, _ := utils.TOTPCode(rfcSecret, current+offset)
+		step, ok := utils.ValidateTOTP(rfcSecret, code, now)
+		assert.Equal(t, want, ok, "offset %d", offset)
+		if ok {
+			assert.Equal(t, current+offset, step)
+		}
+	}
+	_, ok := utils.ValidateTOTP(rfcSecret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestHashRecoveryCode_IgnoresFormatting(t *testing.T) {
+	codes, err := utils.GenerateRecoveryCodes(3)
+	require.NoError(t, err)
+	require.Len(t, codes, 3)
+	assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0])
+	assert.Equal(t, utils.HashRecoveryCode(codes[0]), utils.HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))))
+}
+
+func TestEnrollAndConfirmTOTP(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+
+	var secret string
+	mockRepo.On("GetUserByID", mock.Anything, 7).Return(&models.User{ID: 7, Email: "ada@example.com"}, nil)
+	mockRepo.On("SaveTOTPEnrollment", mock.Anything, 7, mock.Anything).
+		Run(func(args mock.Arguments) { secret = args.String(2) }).
+		Return(nil)
+
+	rr := httptest.NewRecorder()
+	handler.EnrollTOTP(rr, authedRequest("POST", "/me/mfa/totp/enroll", nil, 7))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var enrollment models.TOTPEnrollmentResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&enrollment))
+	assert.Equal(t, secret, enrollment.Secret)
+	uri, err := url.Parse(enrollment.OTPAuthURI)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, secret, uri.Query().Get("secret"))
+
+	// Confirm with the code the authenticator app would show
+	now := time.Now()
+	code, err := utils.TOTPCode(secret, utils.TOTPStep(now))
+	require.NoError(t, err)
+	mockRepo.On("GetTOTPEnrollment", mock.Anything, 7).Return(&models.TOTPEnrollment{UserID: 7, Secret: secret}, nil)
+	var storedHashes []string
+	mockRepo.On("ConfirmTOTP", mock.Anything, 7, mock.AnythingOfType("int64"), mock.Anything).
+		Run(func(args mock.Arguments) { storedHashes = args.Get(3).([]string) }).
+		Return(nil)
+
+	rr = httptest.NewRecorder()
+	handler.ConfirmTOTP(rr, authedRequest("POST", "/me/mfa/totp/confirm", models.ConfirmTOTPRequest{Code: code}, 7))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp models.RecoveryCodesResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	require.Len(t, resp.RecoveryCodes, 10)
+	require.Len(t, storedHashes, 10)
+	// Only hashes are stored
+	assert.Equal(t, utils.HashRecoveryCode(resp.RecoveryCodes[0]), storedHashes[0])
+	assert.NotContains(t, storedHashes, resp.RecoveryCodes[0])
+}
+
+func TestConfirmTOTP_RejectsWrongCode(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	secret, _ := utils.GenerateTOTPSecret()
+	mockRepo.On("GetTOTPEnrollment", mock.Anything, 7).Return(&models.TOTPEnrollment{UserID: 7, Secret: secret}, nil)
+
+	rr := httptest.NewRecorder()
+	handlers.NewAuthHandler(mockRepo, nil).ConfirmTOTP(rr, authedRequest("POST", "/me/mfa/totp/confirm", models.ConfirmTOTPRequest{Code: "000000"}, 7))
+
+	// A random secret has a one in a million chance of producing 000000 here
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	mockRepo.AssertNotCalled(t, "ConfirmTOTP", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestLogin_WithMFAReturnsChallenge(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	verifiedAt := time.Now()
+	user := &models.User{ID: 8, Email: "mfa@example.com", EmailVerifiedAt: &verifiedAt, MFAEnabled: true}
+
+	mockRepo.On("Authenticate", mock.Anything).Return(true, nil)
+	mockRepo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+	mockRepo.On("CreateMFAChallenge", mock.Anything, 8, mock.Anything, mock.Anything).Return(nil)
+
+	body, _ := json.Marshal(models.LoginRequest{Email: user.Email, Password: "password123"})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handlers.NewAuthHandler(mockRepo, nil).Login(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var resp map[string]interface{}
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, true, resp["mfa_required"])
+	assert.NotEmpty(t, resp["mfa_token"])
+	assert.NotContains(t, resp, "token")
+	mockRepo.AssertNotCalled(t, "CreateRefreshToken", mock.Anything, mock.Anything)
+}
+
+// loginMFA posts req to /login/mfa for a user with a confirmed TOTP secret.
+func loginMFA(mockRepo *MockAuthRepository, req models.LoginMFARequest) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(req)
+	httpReq, _ := http.NewRequest("POST", "/login/mfa", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handlers.NewAuthHandler(mockRepo, nil).LoginMFA(rr, httpReq)
+	return rr
+}
+
+func mfaTestRepo(lastUsedStep int64) *MockAuthRepository {
+	return mfaTestRepoFor(&models.User{ID: 8, Email: "mfa@example.com", MFAEnabled: true}, lastUsedStep)
+}
+
+// mfaTestRepoFor is mfaTestRepo for an MFA challenge of user, whose ID must be 8.
+func mfaTestRepoFor(user *models.User, lastUsedStep int64) *MockAuthRepository {
+	mockRepo := new(MockAuthRepository)
+	confirmedAt := time.Now()
+	mockRepo.On("GetMFAChallenge", mock.Anything, utils.HashToken("challenge")).Return(8, nil)
+	mockRepo.On("GetUserByID", mock.Anything, 8).Return(user, nil)
+	mockRepo.On("GetTOTPEnrollment", mock.Anything, 8).
+		Return(&models.TOTPEnrollment{UserID: 8, Secret: rfcSecret, ConfirmedAt: &confirmedAt, LastUsedStep: lastUsedStep}, nil)
+	return mockRepo
+}
+
+func TestLoginMFA_ValidCodeIssuesTokens(t *testing.T) {
+	mockRepo := mfaTestRepo(0)
+	step := utils.TOTPStep(time.Now())
+	code, _ := utils.TOTPCode(rfcSecret, step)
+
+	mockRepo.On("RecordTOTPStep", mock.Anything, 8, step).Return(true, nil)
+	mockRepo.On("ConsumeMFAChallenge", mock.Anything, utils.HashToken("challenge")).Return(8, nil)
+	mockRepo.On("CreateSession", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+
+	rr := loginMFA(mockRepo, models.LoginMFARequest{MFAToken: "challenge", Code: code})
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp models.TokenResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.NotEmpty(t, resp.Token)
+	assert.True(t, resp.User.MFAEnabled)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLoginMFA_RejectsReusedCode(t *testing.T) {
+	step := utils.TOTPStep(time.Now())
+	code, _ := utils.TOTPCode(rfcSecret, step)
+	mockRepo := mfaTestRepo(step) // The code for this step was already used
+	mockRepo.On("RecordMFAChallengeFailure", mock.Anything, utils.HashToken("challenge")).Return(nil)
+	mockRepo.On("RecordFailedLogin", mock.Anything, 8).Return(1, nil)
+
+	rr := loginMFA(mockRepo, models.LoginMFARequest{MFAToken: "challenge", Code: code})
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	mockRepo.AssertCalled(t, "RecordMFAChallengeFailure", mock.Anything, utils.HashToken("challenge"))
+	mockRepo.AssertNotCalled(t, "ConsumeMFAChallenge", mock.Anything, mock.Anything)
+}
+
+func TestLoginMFA_WrongCodeCountsTowardLockout(t *testing.T) {
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "5")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "1m")
+	mockRepo := mfaTestRepoFor(&models.User{ID: 8, MFAEnabled: true, FailedLoginAttempts: 4}, 0)
+	mockRepo.On("RecordMFAChallengeFailure", mock.Anything, utils.HashToken("challenge")).Return(nil)
+	mockRepo.On("RecordFailedLogin", mock.Anything, 8).Return(5, nil)
+	mockRepo.On("LockAccount", mock.Anything, 8, mock.MatchedBy(func(until time.Time) bool {
+		return time.Until(until) > 55*time.Second && time.Until(until) <= time.Minute
+	})).Return(nil)
+
+	rr := loginMFA(mockRepo, models.LoginMFARequest{MFAToken: "challenge", Code: "000000"})
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLoginMFA_LockedAccountGets429(t *testing.T) {
+	lockedUntil := time.Now().Add(2 * time.Minute)
+	mockRepo := mfaTestRepoFor(&models.User{ID: 8, MFAEnabled: true, FailedLoginAttempts: 5, LockedUntil: &lockedUntil}, 0)
+	step := utils.TOTPStep(time.Now())
+	code, _ := utils.TOTPCode(rfcSecret, step)
+
+	rr := loginMFA(mockRepo, models.LoginMFARequest{MFAToken: "challenge", Code: code})
+
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+	mockRepo.AssertNotCalled(t, "GetTOTPEnrollment", mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "ConsumeMFAChallenge", mock.Anything, mock.Anything)
+}
+
+func TestLoginMFA_SuccessResetsFailedAttempts(t *testing.T) {
+	mockRepo := mfaTestRepoFor(&models.User{ID: 8, MFAEnabled: true, FailedLoginAttempts: 3}, 0)
+	step := utils.TOTPStep(time.Now())
+	code, _ := utils.TOTPCode(rfcSecret, step)
+	mockRepo.On("RecordTOTPStep", mock.Anything, 8, step).Return(true, nil)
+	mockRepo.On("ConsumeMFAChallenge", mock.Anything, utils.HashToken("challenge")).Return(8, nil)
+	mockRepo.On("ResetFailedLogins", mock.Anything, 8).Return(nil)
+	mockRepo.On("CreateSession", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+
+	rr := loginMFA(mockRepo, models.LoginMFARequest{MFAToken: "challenge", Code: code})
+
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLoginMFA_RecoveryCode(t *testing.T) {
+	mockRepo := mfaTestRepo(0)
+	mockRepo.On("UseRecoveryCode", mock.Anything, 8, utils.HashRecoveryCode("abcde-fghij")).Return(true, nil)
+	mockRepo.On("ConsumeMFAChallenge", mock.Anything, utils.HashToken("challenge")).Return(8, nil)
+	mockRepo.On("CreateSession", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+
+	rr := loginMFA(mockRepo, models.LoginMFARequest{MFAToken: "challenge", RecoveryCode: "ABCDE FGHIJ"})
+
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+}
+
+func TestLoginMFA_InvalidChallenge(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("GetMFAChallenge", mock.Anything, mock.Anything).Return(0, repository.ErrInvalidMFAChallenge)
+
+	rr := loginMFA(mockRepo, models.LoginMFARequest{MFAToken: "expired", Code: "123456"})
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// A code or recovery code is required
+	rr = loginMFA(new(MockAuthRepository), models.LoginMFARequest{MFAToken: "challenge"})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,377 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"auth-service/internal/events"
+	"auth-service/internal/handlers"
+	"auth-service/internal/models"
+	"auth-service/internal/oauth"
+	"auth-service/internal/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const fakeClientID = "cozy-test-client"
+
+// fakeIdentity is the user the fake OIDC server logs in.
+type fakeIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// fakeOIDCServer is a minimal OpenID Connect provider: discovery, JWKS, an
+// authorize endpoint that approves every request, and a token endpoint that
+// checks the PKCE verifier before returning a signed ID token.
+type fakeOIDCServer struct {
+	*httptest.Server
+	key  *utils.SigningKey
+	user fakeIdentity
+
+	mu    sync.Mutex
+	codes map[string]url.Values // Authorization code -> the authorize request
+}
+
+func newFakeOIDCServer(t *testing.T, user fakeIdentity) *fakeOIDCServer {
+	t.Helper()
+	key, err := utils.GenerateSigningKey("RS256")
+	require.NoError(t, err)
+	keys, err := utils.NewKeySet([]*utils.SigningKey{key}, key.ID)
+	require.NoError(t, err)
+
+	f := &fakeOIDCServer{key: key, user: user, codes: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                f.URL,
+			"authorization_endpoint":                f.URL + "/authorize",
+			"token_endpoint":                        f.URL + "/token",
+			"jwks_uri":                              f.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(keys.JWKS())
+	})
+	mux.HandleFunc("GET /authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+			http.Error(w, "PKCE required", http.StatusBadRequest)
+			return
+		}
+		code, _ := utils.GenerateOpaqueToken()
+		f.mu.Lock()
+		f.codes[code] = q
+		f.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{"code": {code}, "state": {q.Get("state")}}.Encode(), http.StatusFound)
+	})
+	mux.HandleFunc("POST /token", f.token)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeOIDCServer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	f.mu.Lock()
+	authReq, ok := f.codes[r.PostForm.Get("code")]
+	delete(f.codes, r.PostForm.Get("code"))
+	f.mu.Unlock()
+	if !ok {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != authReq.Get("code_challenge") {
+		http.Error(w, `{"error":"invalid_grant","error_description":"PKCE verification failed"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            f.URL,
+		"aud":            authReq.Get("client_id"),
+		"sub":            f.user.Subject,
+		"email":          f.user.Email,
+		"email_verified": f.user.EmailVerified,
+		"name":           "Test User",
+		"nonce":          authReq.Get("nonce"),
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	})
+	idToken.Header["kid"] = f.key.ID
+	signed, _ := idToken.SignedString(f.key.Private)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "provider-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+// oauthLogin runs a complete browser login against the fake provider and returns
+// the response of the auth-service callback. The mock repository keeps the OAuth
+// state stored by Start; tamper, if set, alters it before the callback redeems it.
+func oauthLogin(t *testing.T, fake *fakeOIDCServer, mockRepo *MockAuthRepository, publisher *MockEventPublisher, tamper func(*models.OAuthState)) *httptest.ResponseRecorder {
+	t.Helper()
+	provider := oauth.NewOIDCProvider(oauth.OIDCConfig{
+		Name:         "fake",
+		IssuerURL:    fake.URL,
+		ClientID:     fakeClientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://auth.test/oauth/fake/callback",
+	})
+	// A nil *MockEventPublisher must not end up as a non-nil EventPublisher
+	var eventPublisher events.EventPublisher
+	if publisher != nil {
+		eventPublisher = publisher
+	}
+	handler := handlers.NewOAuthHandler(handlers.NewAuthHandler(mockRepo, eventPublisher), oauth.NewRegistry(provider))
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /oauth/{provider}/start", handler.Start)
+	mux.HandleFunc("GET /oauth/{provider}/callback", handler.Callback)
+
+	var stored models.OAuthState
+	mockRepo.On("CreateOAuthState", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			stored = args.Get(1).(models.OAuthState)
+			if tamper != nil {
+				tamper(&stored)
+			}
+		}).
+		Return(nil)
+	mockRepo.On("ConsumeOAuthState", mock.Anything, mock.MatchedBy(func(hash string) bool { return hash == stored.StateHash })).
+		Return(&stored, nil)
+
+	// 1. auth-service redirects the browser to the provider
+	startRR := httptest.NewRecorder()
+	mux.ServeHTTP(startRR, httptest.NewRequest("GET", "/oauth/fake/start", nil))
+	require.Equal(t, http.StatusFound, startRR.Code)
+	cookies := startRR.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	// 2. The provider authenticates the user and redirects back with a code
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(startRR.Header().Get("Location"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	callbackURL, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+
+	// 3. The browser follows the redirect to the callback with the state cookie
+	callbackReq := httptest.NewRequest("GET", callbackURL.RequestURI(), nil)
+	callbackReq.AddCookie(cookies[0])
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, callbackReq)
+	return rr
+}
+
+func TestOAuthLogin_CreatesUserForNewIdentity(t *testing.T) {
+	fake := newFakeOIDCServer(t, fakeIdentity{Subject: "sub-1", Email: "new.user@example.com", EmailVerified: true})
+	mockRepo := new(MockAuthRepository)
+	mockPublisher := new(MockEventPublisher)
+
+	verifiedAt := time.Now()
+	created := &models.User{ID: 42, Username: "new.user", Email: "new.user@example.com", EmailVerifiedAt: &verifiedAt, CreatedAt: verifiedAt}
+	mockRepo.On("GetUserByIdentity", mock.Anything, "fake", "sub-1").Return(nil, nil)
+	mockRepo.On("GetUserByEmail", mock.Anything, "new.user@example.com").Return(nil, nil)
+	var newEvent func(userID int) events.Event
+	mockRepo.On("CreateUserWithIdentity", mock.Anything, mock.MatchedBy(func(u models.User) bool {
+		return u.Username == "new.user" && u.EmailVerifiedAt != nil && u.DisplayName == "Test User" && u.Password != ""
+	}), models.UserIdentity{Provider: "fake", Subject: "sub-1", Email: "new.user@example.com"}, (*models.EmailVerificationToken)(nil), mock.Anything).
+		Run(func(args mock.Arguments) {
+			newEvent = args.Get(4).(func(userID int) events.Event)
+		}).
+		Return(42, nil)
+	mockRepo.On("GetUserByID", mock.Anything, 42).Return(created, nil)
+	mockRepo.On("CreateSession", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+	mockPublisher.On("Publish", mock.Anything, mock.MatchedBy(func(e events.UserLoggedInEvent) bool {
+		return e.UserID == 42 && e.Method == "oauth:fake"
+	})).Return(nil)
+
+	rr := oauthLogin(t, fake, mockRepo, mockPublisher, nil)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp models.TokenResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.NotEmpty(t, resp.Token)
+	assert.NotEmpty(t, resp.RefreshToken)
+	assert.Equal(t, 42, resp.User.ID)
+	assert.True(t, resp.User.EmailVerified)
+	mockRepo.AssertExpectations(t)
+	mockPublisher.AssertExpectations(t)
+
+	// The registered event goes to the outbox with the account
+	mockPublisher.AssertNotCalled(t, "Publish", mock.Anything, mock.AnythingOfType("events.UserRegisteredEvent"))
+	require.NotNil(t, newEvent)
+	event, ok := newEvent(42).(events.UserRegisteredEvent)
+	require.True(t, ok)
+	assert.Equal(t, 42, event.UserID)
+	assert.Equal(t, "new.user", event.Username)
+	assert.Empty(t, event.VerificationToken) // The provider already verified the email
+}
+
+func TestOAuthLogin_NewIdentityWithUnverifiedEmailGetsVerificationToken(t *testing.T) {
+	fake := newFakeOIDCServer(t, fakeIdentity{Subject: "sub-5", Email: "unverified@example.com", EmailVerified: false})
+	mockRepo := new(MockAuthRepository)
+
+	var verification *models.EmailVerificationToken
+	var newEvent func(userID int) events.Event
+	mockRepo.On("GetUserByIdentity", mock.Anything, "fake", "sub-5").Return(nil, nil)
+	mockRepo.On("GetUserByEmail", mock.Anything, "unverified@example.com").Return(nil, nil)
+	mockRepo.On("CreateUserWithIdentity", mock.Anything, mock.MatchedBy(func(u models.User) bool {
+		return u.EmailVerifiedAt == nil
+	}), mock.Anything, mock.AnythingOfType("*models.EmailVerificationToken"), mock.Anything).
+		Run(func(args mock.Arguments) {
+			verification = args.Get(3).(*models.EmailVerificationToken)
+			newEvent = args.Get(4).(func(userID int) events.Event)
+		}).
+		Return(43, nil)
+	mockRepo.On("GetUserByID", mock.Anything, 43).
+		Return(&models.User{ID: 43, Username: "unverified", Email: "unverified@example.com", CreatedAt: time.Now()}, nil)
+	mockRepo.On("CreateSession", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+
+	rr := oauthLogin(t, fake, mockRepo, nil, nil)
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	mockRepo.AssertExpectations(t)
+
+	// The event carries the raw token; only its hash is stored
+	require.NotNil(t, verification)
+	event, ok := newEvent(43).(events.UserRegisteredEvent)
+	require.True(t, ok)
+	assert.NotEmpty(t, event.VerificationToken)
+	assert.Equal(t, verification.TokenHash, utils.HashToken(event.VerificationToken))
+	assert.Equal(t, verification.ExpiresAt, *event.VerificationExpiresAt)
+}
+
+func TestOAuthLogin_ExistingIdentityLogsIn(t *testing.T) {
+	fake := newFakeOIDCServer(t, fakeIdentity{Subject: "sub-2", Email: "linked@example.com", EmailVerified: true})
+	mockRepo := new(MockAuthRepository)
+
+	verifiedAt := time.Now()
+	mockRepo.On("GetUserByIdentity", mock.Anything, "fake", "sub-2").
+		Return(&models.User{ID: 7, Username: "linked", Email: "linked@example.com", EmailVerifiedAt: &verifiedAt}, nil)
+	mockRepo.On("CreateSession", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+
+	rr := oauthLogin(t, fake, mockRepo, nil, nil)
+
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	mockRepo.AssertNotCalled(t, "CreateUserWithIdentity", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "LinkIdentity", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestOAuthLogin_LockedAccountGets429(t *testing.T) {
+	fake := newFakeOIDCServer(t, fakeIdentity{Subject: "sub-6", Email: "locked@example.com", EmailVerified: true})
+	mockRepo := new(MockAuthRepository)
+
+	verifiedAt := time.Now()
+	lockedUntil := time.Now().Add(2 * time.Minute)
+	mockRepo.On("GetUserByIdentity", mock.Anything, "fake", "sub-6").
+		Return(&models.User{ID: 12, Email: "locked@example.com", EmailVerifiedAt: &verifiedAt, FailedLoginAttempts: 6, LockedUntil: &lockedUntil}, nil)
+
+	rr := oauthLogin(t, fake, mockRepo, nil, nil)
+
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code, rr.Body.String())
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+	mockRepo.AssertNotCalled(t, "CreateRefreshToken", mock.Anything, mock.Anything)
+}
+
+func TestOAuthLogin_DisabledAccountIsRefused(t *testing.T) {
+	fake := newFakeOIDCServer(t, fakeIdentity{Subject: "sub-7", Email: "disabled@example.com", EmailVerified: true})
+	mockRepo := new(MockAuthRepository)
+
+	verifiedAt := time.Now()
+	mockRepo.On("GetUserByIdentity", mock.Anything, "fake", "sub-7").
+		Return(&models.User{ID: 13, Email: "disabled@example.com", EmailVerifiedAt: &verifiedAt, DisabledAt: &verifiedAt}, nil)
+
+	rr := oauthLogin(t, fake, mockRepo, nil, nil)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code, rr.Body.String())
+	mockRepo.AssertNotCalled(t, "CreateRefreshToken", mock.Anything, mock.Anything)
+}
+
+func TestOAuthLogin_LinksAccountWithVerifiedEmail(t *testing.T) {
+	fake := newFakeOIDCServer(t, fakeIdentity{Subject: "sub-3", Email: "existing@example.com", EmailVerified: true})
+	mockRepo := new(MockAuthRepository)
+
+	existing := &models.User{ID: 9, Username: "existing", Email: "existing@example.com", CreatedAt: time.Now()}
+	mockRepo.On("GetUserByIdentity", mock.Anything, "fake", "sub-3").Return(nil, nil)
+	mockRepo.On("GetUserByEmail", mock.Anything, "existing@example.com").Return(existing, nil)
+	mockRepo.On("LinkIdentity", mock.Anything, models.UserIdentity{UserID: 9, Provider: "fake", Subject: "sub-3", Email: "existing@example.com"}, true).Return(nil)
+	mockRepo.On("GetUserByID", mock.Anything, 9).Return(existing, nil)
+	mockRepo.On("CreateSession", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+
+	rr := oauthLogin(t, fake, mockRepo, nil, nil)
+
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	mockRepo.AssertExpectations(t)
+}
+
+func TestOAuthLogin_RefusesUnverifiedEmailOfExistingAccount(t *testing.T) {
+	fake := newFakeOIDCServer(t, fakeIdentity{Subject: "attacker", Email: "victim@example.com", EmailVerified: false})
+	mockRepo := new(MockAuthRepository)
+
+	mockRepo.On("GetUserByIdentity", mock.Anything, "fake", "attacker").Return(nil, nil)
+	mockRepo.On("GetUserByEmail", mock.Anything, "victim@example.com").Return(&models.User{ID: 1, Email: "victim@example.com"}, nil)
+
+	rr := oauthLogin(t, fake, mockRepo, nil, nil)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	mockRepo.AssertNotCalled(t, "LinkIdentity", mock.Anything, mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "CreateRefreshToken", mock.Anything, mock.Anything)
+}
+
+func TestOAuthCallback_RejectsWrongPKCEVerifier(t *testing.T) {
+	fake := newFakeOIDCServer(t, fakeIdentity{Subject: "sub-4", Email: "pkce@example.com", EmailVerified: true})
+	mockRepo := new(MockAuthRepository)
+
+	rr := oauthLogin(t, fake, mockRepo, nil, func(s *models.OAuthState) { s.CodeVerifier = "not-the-original-verifier-0123456789abcdefghijk" })
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	mockRepo.AssertNotCalled(t, "GetUserByIdentity", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestOAuthCallback_RejectsWrongNonce(t *testing.T) {
+	fake := newFakeOIDCServer(t, fakeIdentity{Subject: "sub-5", Email: "nonce@example.com", EmailVerified: true})
+	mockRepo := new(MockAuthRepository)
+
+	rr := oauthLogin(t, fake, mockRepo, nil, func(s *models.OAuthState) { s.Nonce = "some-other-nonce" })
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestOAuthCallback_RequiresMatchingStateCookie(t *testing.T) {
+	handler := handlers.NewOAuthHandler(handlers.NewAuthHandler(new(MockAuthRepository), nil), oauth.NewRegistry(oauth.NewOIDCProvider(oauth.OIDCConfig{Name: "fake"})))
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /oauth/{provider}/callback", handler.Callback)
+
+	req := httptest.NewRequest("GET", "/oauth/fake/callback?code=abc&state=from-attacker", nil)
+	req.AddCookie(&http.Cookie{Name: "oauth_state", Value: "from-victim"})
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/oauth/unknown/callback?code=abc&state=x", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,198 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"auth-service/internal/events"
+	"cozy-go/shared/outbox"
+	"cozy-go/shared/requestid"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryOutbox is an in-memory outbox.Store with the semantics of the outbox table.
+type memoryOutbox struct {
+	rows []*outboxRow
+}
+
+type outboxRow struct {
+	event         outbox.Event
+	nextAttemptAt time.Time
+	lastError     string
+	published     bool
+}
+
+// add queues event the way the repository does inside a registration.
+func (s *memoryOutbox) add(t *testing.T, ctx context.Context, event events.Event) events.Envelope {
+	t.Helper()
+	envelope, err := events.NewEnvelope(ctx, event)
+	require.NoError(t, err)
+	payload, err := json.Marshal(envelope)
+	require.NoError(t, err)
+	s.rows = append(s.rows, &outboxRow{event: outbox.Event{
+		ID: int64(len(s.rows) + 1), EventID: envelope.ID, EventType: envelope.Type, Payload: payload, CreatedAt: time.Now(),
+	}})
+	return envelope
+}
+
+func (s *memoryOutbox) ClaimOutboxEvents(ctx context.Context, limit int, leaseUntil time.Time) ([]outbox.Event, error) {
+	var claimed []outbox.Event
+	for _, row := range s.rows {
+		if len(claimed) == limit {
+			break
+		}
+		if !row.published && !row.nextAttemptAt.After(time.Now()) {
+			row.nextAttemptAt = leaseUntil
+			claimed = append(claimed, row.event)
+		}
+	}
+	return claimed, nil
+}
+
+func (s *memoryOutbox) MarkOutboxEventPublished(ctx context.Context, id int64) error {
+	s.rows[id-1].published = true
+	s.rows[id-1].event.Payload = nil
+	return nil
+}
+
+func (s *memoryOutbox) MarkOutboxEventFailed(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error {
+	row := s.rows[id-1]
+	row.event.Attempts++
+	row.lastError = lastError
+	row.nextAttemptAt = nextAttemptAt
+	return nil
+}
+
+func (s *memoryOutbox) DeletePublishedOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// makeDue lets every pending row be claimed again without waiting for its backoff.
+func (s *memoryOutbox) makeDue() {
+	for _, row := range s.rows {
+		row.nextAttemptAt = time.Time{}
+	}
+}
+
+func TestOutboxRelay_PublishesStoredEnvelope(t *testing.T) {
+	store := &memoryOutbox{}
+	ctx := requestid.NewContext(context.Background(), "req-77")
+	stored := store.add(t, ctx, events.UserRegisteredEvent{UserID: 7, Email: "ada@example.com", Username: "ada"})
+
+	publisher := new(MockEventPublisher)
+	publisher.On("PublishEnvelope", mock.MatchedBy(func(ctx context.Context) bool {
+		// Publisher logs are tied to the request that registered the user
+		return requestid.FromContext(ctx) == "req-77"
+	}), mock.MatchedBy(func(envelope events.Envelope) bool {
+		return envelope.ID == stored.ID && envelope.Type == events.TypeUserRegistered && envelope.CorrelationID == "req-77"
+	})).Return(nil).Once()
+
+	relay := outbox.NewRelay(store, publisher, outbox.DefaultConfig())
+	published, err := relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.True(t, store.rows[0].published)
+
+	// Published events are not sent again
+	published, err = relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, published)
+	publisher.AssertExpectations(t)
+}
+
+func TestOutboxRelay_RetriesWithBackoffAndSameMessageID(t *testing.T) {
+	store := &memoryOutbox{}
+	stored := store.add(t, context.Background(), events.UserRegisteredEvent{UserID: 7, Email: "ada@example.com", Username: "ada"})
+
+	var sentIDs []string
+	publisher := new(MockEventPublisher)
+	publisher.On("PublishEnvelope", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { sentIDs = append(sentIDs, args.Get(1).(events.Envelope).ID) }).
+		Return(events.ErrNotConnected).Twice()
+	publisher.On("PublishEnvelope", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { sentIDs = append(sentIDs, args.Get(1).(events.Envelope).ID) }).
+		Return(nil).Once()
+
+	relay := outbox.NewRelay(store, publisher, outbox.DefaultConfig())
+
+	// The broker is down: the event stays in the outbox and is retried later
+	published, err := relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, published)
+	row := store.rows[0]
+	assert.False(t, row.published)
+	assert.Equal(t, 1, row.event.Attempts)
+	assert.Equal(t, events.ErrNotConnected.Error(), row.lastError)
+	assert.WithinDuration(t, time.Now().Add(time.Second), row.nextAttemptAt, 500*time.Millisecond)
+
+	// Not due yet
+	published, err = relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, published)
+
+	store.makeDue()
+	_, err = relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, row.event.Attempts)
+	assert.WithinDuration(t, time.Now().Add(2*time.Second), row.nextAttemptAt, 500*time.Millisecond)
+
+	store.makeDue()
+	published, err = relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.True(t, row.published)
+
+	// Every attempt carried the ID the event was stored with
+	assert.Equal(t, []string{stored.ID, stored.ID, stored.ID}, sentIDs)
+	publisher.AssertExpectations(t)
+}
+
+func TestOutboxRelay_FailureDoesNotBlockOtherEvents(t *testing.T) {
+	store := &memoryOutbox{}
+	first := store.add(t, context.Background(), events.UserRegisteredEvent{UserID: 1, Email: "ada@example.com", Username: "ada"})
+	second := store.add(t, context.Background(), events.UserRegisteredEvent{UserID: 2, Email: "bob@example.com", Username: "bob"})
+
+	publisher := new(MockEventPublisher)
+	publisher.On("PublishEnvelope", mock.Anything, mock.MatchedBy(func(e events.Envelope) bool { return e.ID == first.ID })).
+		Return(errors.New("channel closed"))
+	publisher.On("PublishEnvelope", mock.Anything, mock.MatchedBy(func(e events.Envelope) bool { return e.ID == second.ID })).
+		Return(nil)
+
+	published, err := outbox.NewRelay(store, publisher, outbox.DefaultConfig()).RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.False(t, store.rows[0].published)
+	assert.True(t, store.rows[1].published)
+}
+
+func TestOutboxRelay_Backoff(t *testing.T) {
+	config := outbox.DefaultConfig()
+	config.MinBackoff = time.Second
+	config.MaxBackoff = 10 * time.Second
+	relay := outbox.NewRelay(&memoryOutbox{}, nil, config)
+
+	for attempts, want := range map[int]time.Duration{
+		1:   time.Second,
+		2:   2 * time.Second,
+		3:   4 * time.Second,
+		4:   8 * time.Second,
+		5:   10 * time.Second,
+		100: 10 * time.Second,
+	} {
+		assert.Equal(t, want, relay.Backoff(attempts), "attempts=%d", attempts)
+	}
+}
+
+func TestOutboxRelay_ConfigFromEnv(t *testing.T) {
+	t.Setenv("OUTBOX_POLL_INTERVAL", "250ms")
+	t.Setenv("OUTBOX_MAX_BACKOFF", "soon")
+	config := outbox.ConfigFromEnv()
+	assert.Equal(t, 250*time.Millisecond, config.PollInterval)
+	assert.Equal(t, outbox.DefaultConfig().MaxBackoff, config.MaxBackoff)
+}
@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"auth-service/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword_UsesArgon2id(t *testing.T) {
+	hash, err := utils.HashPassword("correct horse battery 9")
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$"), hash)
+	assert.True(t, utils.CheckPassword(hash, "correct horse battery 9"))
+	assert.False(t, utils.CheckPassword(hash, "correct horse battery 8"))
+	assert.False(t, utils.PasswordNeedsRehash(hash))
+
+	other, err := utils.HashPassword("correct horse battery 9")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "Every hash must use a fresh salt")
+}
+
+func TestCheckPassword_AcceptsLegacyBcryptHashes(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	assert.True(t, utils.CheckPassword(string(legacy), "password123"))
+	assert.False(t, utils.CheckPassword(string(legacy), "password124"))
+	assert.True(t, utils.PasswordNeedsRehash(string(legacy)), "bcrypt hashes are upgraded on login")
+
+	_, err = utils.BcryptHasher{}.Hash("password123")
+	assert.ErrorIs(t, err, utils.ErrVerifyOnly)
+}
+
+func TestPasswordNeedsRehash_ComparesWorkFactors(t *testing.T) {
+	weaker := utils.DefaultArgon2Params
+	weaker.Iterations = 1
+	weakHash, err := utils.Argon2idHasher{Params: weaker}.Hash("password123")
+	require.NoError(t, err)
+	assert.True(t, utils.CheckPassword(weakHash, "password123"), "Hashes keep their own parameters")
+	assert.True(t, utils.PasswordNeedsRehash(weakHash))
+
+	stronger := utils.DefaultArgon2Params
+	stronger.Iterations = 3
+	strongHash, err := utils.Argon2idHasher{Params: stronger}.Hash("password123")
+	require.NoError(t, err)
+	assert.False(t, utils.PasswordNeedsRehash(strongHash))
+}
+
+func TestCheckPassword_RejectsMalformedHashes(t *testing.T) {
+	for _, hash := range []string{"", "plaintext", "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA", "$argon2id$v=18$m=1,t=1,p=1$c2FsdA$aGFzaA"} {
+		assert.False(t, utils.CheckPassword(hash, "plaintext"), hash)
+		assert.True(t, utils.PasswordNeedsRehash(hash), hash)
+	}
+}
@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"auth-service/internal/handlers"
+	"auth-service/internal/models"
+	"auth-service/internal/passwordpolicy"
+	"auth-service/internal/utils"
+	"cozy-go/shared/problem"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// rules returns the rule names of violations.
+func rules(violations []passwordpolicy.Violation) []string {
+	names := []string{}
+	for _, v := range violations {
+		names = append(names, v.Rule)
+	}
+	return names
+}
+
+func TestPasswordPolicy_Rules(t *testing.T) {
+	policy := passwordpolicy.Default()
+
+	cases := []struct {
+		password string
+		want     []string
+	}{
+		{"correct horse battery 9", []string{}},
+		{"a", []string{passwordpolicy.RuleMinLength, passwordpolicy.RuleCharacterClasses}},
+		{"alllowercase", []string{passwordpolicy.RuleCharacterClasses}},
+		{strings.Repeat("aB3", 25), []string{passwordpolicy.RuleMaxLength}},
+		{"Ada-Lovelace-1815", []string{passwordpolicy.RulePersonalInfo}},
+		{"my-mail-ADA.L@example.com", []string{passwordpolicy.RulePersonalInfo}},
+	}
+	for _, tc := range cases {
+		got := policy.Check(tc.password, "ada-lovelace", "ada.l@example.com")
+		assert.Equal(t, tc.want, rules(got), tc.password)
+	}
+}
+
+// writeHashFile writes the SHA-1 hashes of passwords in the sorted
+// "<hash>:<count>" format of the Pwned Passwords download.
+func writeHashFile(t *testing.T, passwords ...string) string {
+	t.Helper()
+	var lines []string
+	for _, p := range passwords {
+		sum := sha1.Sum([]byte(p))
+		lines = append(lines, strings.ToUpper(hex.EncodeToString(sum[:]))+":42")
+	}
+	sort.Strings(lines)
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0o600))
+	return path
+}
+
+func TestHashFile_FindsBreachedPasswords(t *testing.T) {
+	breached := []string{"Password1!", "letmein-2024", "Tr0ub4dor&3", "qwerty-123", "Summer2026!"}
+	file, err := passwordpolicy.OpenHashFile(writeHashFile(t, breached...))
+	require.NoError(t, err)
+	defer file.Close()
+
+	for _, p := range breached {
+		found, err := passwordpolicy.IsBreached(file, p)
+		require.NoError(t, err)
+		assert.True(t, found, p)
+	}
+	found, err := passwordpolicy.IsBreached(file, "correct horse battery 9")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	policy := passwordpolicy.Default()
+	policy.Breached = file
+	assert.Equal(t, []string{passwordpolicy.RuleBreached}, rules(policy.Check("Summer2026!")))
+}
+
+func TestRegister_RejectsWeakPassword(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+
+	body, _ := json.Marshal(models.RegisterRequest{Username: "ada", Email: "ada@example.com", Password: "ada"})
+	req, _ := http.NewRequest("POST", "/register", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.Register(rr, req)
+
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	var resp problem.Problem
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, problem.CodeValidationFailed, resp.Code)
+	var failed []string
+	for _, fe := range resp.Errors {
+		assert.Equal(t, "password", fe.Field)
+		assert.NotEmpty(t, fe.Message)
+		failed = append(failed, fe.Code)
+	}
+	assert.Equal(t, []string{passwordpolicy.RuleMinLength, passwordpolicy.RuleCharacterClasses, passwordpolicy.RulePersonalInfo}, failed)
+	mockRepo.AssertNotCalled(t, "Register", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestChangePassword_RejectsPasswordContainingUsername(t *testing.T) {
+	currentHash, err := utils.HashPassword("current-password")
+	require.NoError(t, err)
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("GetPasswordHash", mock.Anything, 7).Return(currentHash, nil)
+	mockRepo.On("GetUserByID", mock.Anything, 7).Return(&models.User{ID: 7, Username: "grace", Email: "hopper@example.com"}, nil)
+
+	rr := httptest.NewRecorder()
+	body := models.ChangePasswordRequest{CurrentPassword: "current-password", NewPassword: "Grace-2026-new"}
+	handlers.NewAuthHandler(mockRepo, nil).ChangePassword(rr, authedRequest("POST", "/me/password", body, 7))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), passwordpolicy.RulePersonalInfo)
+	mockRepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"auth-service/internal/events"
+	"auth-service/internal/handlers"
+	"auth-service/internal/models"
+	"auth-service/internal/ratelimit"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func postForgotPassword(handler *handlers.AuthHandler, email string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.ForgotPasswordRequest{Email: email})
+	req, _ := http.NewRequest("POST", "/password/forgot", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.ForgotPassword(rr, req)
+	return rr
+}
+
+func TestForgotPassword_PublishesResetEvent(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockPublisher := new(MockEventPublisher)
+
+	user := &models.User{ID: 7, Username: "resetuser", Email: "reset@example.com"}
+	var storedHash string
+	mockRepo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+	mockRepo.On("CreatePasswordResetToken", mock.Anything, 7, mock.AnythingOfType("string"), mock.AnythingOfType("time.Time")).
+		Run(func(args mock.Arguments) { storedHash = args.String(2) }).
+		Return(nil)
+
+	published := make(chan events.PasswordResetRequestedEvent, 1)
+	mockPublisher.On("Publish", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { published <- args.Get(1).(events.PasswordResetRequestedEvent) }).
+		Return(nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, mockPublisher)
+	rr := postForgotPassword(handler, user.Email)
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+
+	select {
+	case event := <-published:
+		assert.Equal(t, 7, event.UserID)
+		assert.Equal(t, user.Email, event.Email)
+		assert.NotEmpty(t, event.Token)
+		// Only the hash of the emailed token is stored
+		assert.Equal(t, utils.HashToken(event.Token), storedHash)
+		assert.True(t, event.ExpiresAt.After(time.Now()))
+	case <-time.After(2 * time.Second):
+		t.Fatal("PasswordResetRequestedEvent was not published")
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestForgotPassword_UnknownEmailLooksTheSame(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockPublisher := new(MockEventPublisher)
+
+	mockRepo.On("GetUserByEmail", mock.Anything, "known@example.com").
+		Return(&models.User{ID: 1, Email: "known@example.com"}, nil)
+	unknownLookedUp := make(chan struct{}, 1)
+	mockRepo.On("GetUserByEmail", mock.Anything, "nobody@example.com").
+		Run(func(mock.Arguments) { unknownLookedUp <- struct{}{} }).
+		Return(nil, nil)
+	mockRepo.On("CreatePasswordResetToken", mock.Anything, 1, mock.Anything, mock.Anything).Return(nil)
+	published := make(chan struct{}, 1)
+	mockPublisher.On("Publish", mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { published <- struct{}{} }).
+		Return(nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, mockPublisher)
+	known := postForgotPassword(handler, "known@example.com")
+	unknown := postForgotPassword(handler, "nobody@example.com")
+
+	// Same status and body, so callers cannot probe which emails have accounts
+	assert.Equal(t, http.StatusAccepted, unknown.Code)
+	assert.Equal(t, known.Code, unknown.Code)
+	assert.Equal(t, known.Body.String(), unknown.Body.String())
+
+	for _, done := range []chan struct{}{published, unknownLookedUp} {
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("background password reset work did not run")
+		}
+	}
+	// Only the existing account got a token and an email
+	mockRepo.AssertNumberOfCalls(t, "CreatePasswordResetToken", 1)
+	mockPublisher.AssertNumberOfCalls(t, "Publish", 1)
+}
+
+func TestForgotPassword_PerEmailLimitSendsNothingMore(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	lookedUp := make(chan struct{}, 3)
+	mockRepo.On("GetUserByEmail", mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) { lookedUp <- struct{}{} }).
+		Return(nil, nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+	handler.SetPasswordResetLimiter(ratelimit.NewLimiter(ratelimit.NewMemoryStore(), "forgot-password-email", ratelimit.Limit{Requests: 2, Per: time.Hour}))
+
+	first := postForgotPassword(handler, "victim@example.com")
+	postForgotPassword(handler, "Victim@example.com")
+	limited := postForgotPassword(handler, "victim@example.com")
+
+	// The limit is not revealed to the caller
+	assert.Equal(t, http.StatusAccepted, limited.Code)
+	assert.Equal(t, first.Body.String(), limited.Body.String())
+	for range 2 {
+		select {
+		case <-lookedUp:
+		case <-time.After(2 * time.Second):
+			t.Fatal("background password reset work did not run")
+		}
+	}
+	select {
+	case <-lookedUp:
+		t.Fatal("request over the per-email limit was processed")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestResetPassword_Success(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	rawToken := "emailed-reset-token"
+
+	mockRepo.On("GetPasswordResetUser", mock.Anything, utils.HashToken(rawToken)).
+		Return(&models.User{ID: 7, Username: "ada", Email: "ada@example.com"}, nil)
+	var newEvent func(userID int) events.Event
+	mockRepo.On("ResetPassword", mock.Anything, utils.HashToken(rawToken), mock.MatchedBy(func(hash string) bool {
+		// The new password is stored hashed
+		return utils.CheckPassword(hash, "new-password")
+	}), mock.Anything).
+		Run(func(args mock.Arguments) { newEvent = args.Get(3).(func(userID int) events.Event) }).
+		Return(7, nil)
+	mockPublisher := new(MockEventPublisher)
+
+	handler := handlers.NewAuthHandler(mockRepo, mockPublisher)
+	body, _ := json.Marshal(models.ResetPasswordRequest{Token: rawToken, NewPassword: "new-password"})
+	req, _ := http.NewRequest("POST", "/password/reset", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+
+	handler.ResetPassword(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	mockRepo.AssertExpectations(t)
+	// The event goes to the outbox with the new password
+	mockPublisher.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+	assert.Equal(t, events.PasswordChangedEvent{
+		UserID: 7, Email: "ada@example.com", Username: "ada", Reason: events.PasswordChangedByReset,
+	}, newEvent(7))
+}
+
+func TestResetPassword_InvalidToken(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("GetPasswordResetUser", mock.Anything, mock.Anything).Return(nil, nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+	body, _ := json.Marshal(models.ResetPasswordRequest{Token: "used-or-expired", NewPassword: "new-password"})
+	req, _ := http.NewRequest("POST", "/password/reset", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+
+	handler.ResetPassword(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	mockRepo.AssertNotCalled(t, "ResetPassword", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestResetPassword_TokenRedeemedConcurrently(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("GetPasswordResetUser", mock.Anything, mock.Anything).Return(&models.User{ID: 7, Username: "ada", Email: "ada@example.com"}, nil)
+	mockRepo.On("ResetPassword", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(0, repository.ErrInvalidResetToken)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+	body, _ := json.Marshal(models.ResetPasswordRequest{Token: "just-used", NewPassword: "new-password"})
+	req, _ := http.NewRequest("POST", "/password/reset", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+
+	handler.ResetPassword(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-service/internal/handlers"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatePersonalAccessToken_ReturnsTokenOnceAndStoresHash(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	var stored *models.PersonalAccessToken
+	mockRepo.On("CreatePersonalAccessToken", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*models.PersonalAccessToken)
+			stored.ID = 3
+		}).
+		Return(nil)
+
+	req := models.CreatePersonalAccessTokenRequest{Name: "CI", Scopes: []string{"tasks:read", "tasks:write"}}
+	rr := httptest.NewRecorder()
+	handlers.NewAuthHandler(mockRepo, nil).CreatePersonalAccessToken(rr, authedRequest("POST", "/me/tokens", req, 7))
+
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var resp models.CreatePersonalAccessTokenResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.True(t, strings.HasPrefix(resp.Token, utils.PersonalAccessTokenPrefix))
+	assert.True(t, strings.HasPrefix(resp.Token, resp.Prefix))
+	assert.Equal(t, int64(3), resp.ID)
+	assert.Equal(t, []string{"tasks:read", "tasks:write"}, resp.Scopes)
+	require.NotNil(t, resp.ExpiresAt)
+	assert.WithinDuration(t, time.Now().AddDate(0, 0, 90), *resp.ExpiresAt, time.Minute)
+
+	assert.Equal(t, 7, stored.UserID)
+	assert.Equal(t, utils.HashToken(resp.Token), stored.TokenHash)
+}
+
+func TestCreatePersonalAccessToken_NeverExpiring(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("CreatePersonalAccessToken", mock.Anything, mock.MatchedBy(func(tok *models.PersonalAccessToken) bool {
+		return tok.ExpiresAt == nil
+	})).Return(nil)
+
+	days := 0
+	req := models.CreatePersonalAccessTokenRequest{Name: "cron", Scopes: []string{"tasks:read"}, ExpiresInDays: &days}
+	rr := httptest.NewRecorder()
+	handlers.NewAuthHandler(mockRepo, nil).CreatePersonalAccessToken(rr, authedRequest("POST", "/me/tokens", req, 7))
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreatePersonalAccessToken_RejectsUnknownScopes(t *testing.T) {
+	handler := handlers.NewAuthHandler(new(MockAuthRepository), nil)
+
+	for _, scopes := range [][]string{{"admin"}, {}, {"tasks:read", "tasks:read"}} {
+		req := models.CreatePersonalAccessTokenRequest{Name: "bad", Scopes: scopes}
+		rr := httptest.NewRecorder()
+		handler.CreatePersonalAccessToken(rr, authedRequest("POST", "/me/tokens", req, 7))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "%v", scopes)
+	}
+}
+
+func TestDeletePersonalAccessToken(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("DeletePersonalAccessToken", mock.Anything, 7, int64(3)).Return(nil)
+	mockRepo.On("DeletePersonalAccessToken", mock.Anything, 7, int64(4)).Return(repository.ErrTokenNotFound)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /me/tokens/{id}", handlers.NewAuthHandler(mockRepo, nil).DeletePersonalAccessToken)
+
+	for id, want := range map[string]int{"3": http.StatusNoContent, "4": http.StatusNotFound, "abc": http.StatusBadRequest} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, authedRequest("DELETE", "/me/tokens/"+id, nil, 7))
+		assert.Equal(t, want, rr.Code, id)
+	}
+}
+
+func TestIntrospect_PersonalAccessToken(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	expiresAt := time.Now().Add(24 * time.Hour)
+	mockRepo.On("UsePersonalAccessToken", mock.Anything, utils.HashToken("cozy_pat_valid")).
+		Return(&models.PersonalAccessToken{ID: 5, UserID: 7, Scopes: []string{"tasks:read"}, ExpiresAt: &expiresAt}, nil)
+	mockRepo.On("UsePersonalAccessToken", mock.Anything, utils.HashToken("cozy_pat_revoked")).Return(nil, nil)
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+
+	introspect := func(token string) models.IntrospectionResponse {
+		body, _ := json.Marshal(models.IntrospectionRequest{Token: token})
+		req, _ := http.NewRequest("POST", "/token/introspect", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		handler.Introspect(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var resp models.IntrospectionResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		return resp
+	}
+
+	active := introspect("cozy_pat_valid")
+	assert.True(t, active.Active)
+	assert.Equal(t, "7", active.Subject)
+	assert.Equal(t, "tasks:read", active.Scope)
+	assert.Equal(t, "personal_access_token", active.TokenType)
+	assert.Equal(t, expiresAt.Unix(), active.ExpiresAt)
+
+	assert.Equal(t, models.IntrospectionResponse{Active: false}, introspect("cozy_pat_revoked"))
+}
@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"auth-service/internal/handlers"
+	"auth-service/internal/models"
+	"auth-service/repository"
+	"cozy-go/shared/problem"
+	"cozy-go/shared/requestid"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeProblem checks that rr is a problem+json response and decodes it.
+func decodeProblem(t *testing.T, rr *httptest.ResponseRecorder) problem.Problem {
+	t.Helper()
+	assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+	var p problem.Problem
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&p))
+	assert.Equal(t, rr.Code, p.Status)
+	return p
+}
+
+func TestRegister_ValidationErrorsNameJSONFields(t *testing.T) {
+	handler := handlers.NewAuthHandler(new(MockAuthRepository), nil)
+
+	rr := postJSON(handler.Register, "/register", models.RegisterRequest{Username: "bob@home", Email: "not-an-email"})
+
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	p := decodeProblem(t, rr)
+	assert.Equal(t, problem.CodeValidationFailed, p.Code)
+	assert.Equal(t, "Bad Request", p.Title)
+	assert.Equal(t, "/register", p.Instance)
+	assert.Equal(t, p.Detail, p.Message)
+	assert.ElementsMatch(t, []problem.FieldError{
+		{Field: "username", Code: "excludes", Message: `username must not contain "@"`},
+		{Field: "email", Code: "email", Message: "email must be a valid email address"},
+		{Field: "password", Code: "required", Message: "password is required"},
+	}, p.Errors)
+}
+
+func TestRegister_ConflictNamesField(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("Register", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(0, repository.ErrUsernameTaken)
+
+	rr := postJSON(handlers.NewAuthHandler(mockRepo, nil).Register, "/register",
+		models.RegisterRequest{Username: "bob", Email: "bob@example.com", Password: "password123"})
+
+	require.Equal(t, http.StatusConflict, rr.Code)
+	p := decodeProblem(t, rr)
+	assert.Equal(t, "username_taken", p.Code)
+	assert.Equal(t, []problem.FieldError{{Field: "username", Code: "taken", Message: repository.ErrUsernameTaken.Error()}}, p.Errors)
+}
+
+func TestLogin_InvalidCredentialsProblemCarriesRequestID(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("GetUserByEmail", mock.Anything, "nobody@example.com").Return(nil, nil)
+	mockRepo.On("Authenticate", mock.Anything).Return(false, nil)
+	handler := requestid.Middleware(http.HandlerFunc(handlers.NewAuthHandler(mockRepo, nil).Login))
+
+	rr := postJSON(handler.ServeHTTP, "/login", models.LoginRequest{Email: "nobody@example.com", Password: "password123"})
+
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+	p := decodeProblem(t, rr)
+	assert.Equal(t, "invalid_credentials", p.Code)
+	assert.Equal(t, "Invalid username, email or password", p.Detail)
+	assert.NotEmpty(t, p.RequestID)
+	assert.Equal(t, rr.Header().Get(requestid.Header), p.RequestID)
+}
@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"auth-service/internal/events"
+	"auth-service/internal/handlers"
+	"auth-service/internal/middleware"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// authedRequest builds a request as if JWTAuth had authenticated userID.
+func authedRequest(method, url string, body interface{}, userID int) *http.Request {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req, _ := http.NewRequest(method, url, &buf)
+	ctx := context.WithValue(req.Context(), middleware.UserIDContextKey, strconv.Itoa(userID))
+	return req.WithContext(ctx)
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestUpdateMe_UpdatesProfileFields(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	current := &models.User{ID: 7, Username: "old", Email: "same@example.com", Timezone: "UTC", Locale: "en"}
+	updated := &models.User{ID: 7, Username: "old", Email: "same@example.com", DisplayName: "Ada", Timezone: "Europe/Berlin", Locale: "de-DE"}
+
+	// An empty avatar URL clears the avatar
+	update := models.UpdateProfileRequest{DisplayName: strPtr("Ada"), AvatarURL: strPtr(""), Timezone: strPtr("Europe/Berlin"), Locale: strPtr("de-DE")}
+	mockRepo.On("GetUserByID", mock.Anything, 7).Return(current, nil)
+	mockRepo.On("UpdateProfile", mock.Anything, 7, update, (*models.EmailVerificationToken)(nil), mock.Anything).Return(updated, nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, new(MockEventPublisher))
+	rr := httptest.NewRecorder()
+	handler.UpdateMe(rr, authedRequest("PATCH", "/me", update, 7))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp models.UserResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, "Ada", resp.DisplayName)
+	assert.Equal(t, "Europe/Berlin", resp.Timezone)
+	assert.Equal(t, "de-DE", resp.Locale)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUpdateMe_RejectsInvalidFields(t *testing.T) {
+	handler := handlers.NewAuthHandler(new(MockAuthRepository), nil)
+
+	for name, body := range map[string]interface{}{
+		"timezone": map[string]string{"timezone": "Mars/Olympus"},
+		"locale":   map[string]string{"locale": "not a locale"},
+		"avatar":   map[string]string{"avatar_url": "javascript:alert(1)"},
+		"username": map[string]string{"username": ""},
+		"email":    map[string]string{"email": "nope"},
+	} {
+		rr := httptest.NewRecorder()
+		handler.UpdateMe(rr, authedRequest("PATCH", "/me", body, 7))
+		assert.Equal(t, http.StatusBadRequest, rr.Code, name)
+	}
+}
+
+func TestUpdateMe_EmailChangeRequiresReverification(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockPublisher := new(MockEventPublisher)
+	current := &models.User{ID: 7, Username: "ada", Email: "old@example.com"}
+	updated := &models.User{ID: 7, Username: "ada", Email: "new@example.com"} // EmailVerifiedAt reset by the repository
+
+	update := models.UpdateProfileRequest{Email: strPtr("new@example.com")}
+	var verification *models.EmailVerificationToken
+	var newEvent func(user models.User, oldEmail string) events.Event
+	mockRepo.On("GetUserByID", mock.Anything, 7).Return(current, nil)
+	mockRepo.On("UpdateProfile", mock.Anything, 7, update, mock.AnythingOfType("*models.EmailVerificationToken"), mock.Anything).
+		Run(func(args mock.Arguments) {
+			verification = args.Get(3).(*models.EmailVerificationToken)
+			newEvent = args.Get(4).(func(user models.User, oldEmail string) events.Event)
+		}).
+		Return(updated, nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, mockPublisher)
+	rr := httptest.NewRecorder()
+	handler.UpdateMe(rr, authedRequest("PATCH", "/me", update, 7))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var resp models.UserResponse
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.False(t, resp.EmailVerified)
+	mockRepo.AssertExpectations(t)
+	// The event goes to the outbox with the update, not straight to the broker
+	mockPublisher.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+
+	require.NotNil(t, verification)
+	event, ok := newEvent(*updated, "old@example.com").(events.EmailChangedEvent)
+	require.True(t, ok)
+	assert.Equal(t, "old@example.com", event.OldEmail)
+	assert.Equal(t, "new@example.com", event.NewEmail)
+	assert.Equal(t, verification.TokenHash, utils.HashToken(event.VerificationToken))
+	assert.Equal(t, verification.ExpiresAt, event.VerificationExpiresAt)
+}
+
+func TestUpdateMe_DuplicateUsername(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("GetUserByID", mock.Anything, 7).Return(&models.User{ID: 7}, nil)
+	mockRepo.On("UpdateProfile", mock.Anything, 7, mock.Anything, mock.Anything, mock.Anything).Return(nil, repository.ErrUsernameTaken)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+	rr := httptest.NewRecorder()
+	handler.UpdateMe(rr, authedRequest("PATCH", "/me", map[string]string{"username": "taken"}, 7))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestChangePassword(t *testing.T) {
+	currentHash, err := utils.HashPassword("current-password")
+	require.NoError(t, err)
+
+	t.Run("wrong current password", func(t *testing.T) {
+		mockRepo := new(MockAuthRepository)
+		mockRepo.On("GetPasswordHash", mock.Anything, 7).Return(currentHash, nil)
+
+		handler := handlers.NewAuthHandler(mockRepo, nil)
+		rr := httptest.NewRecorder()
+		body := models.ChangePasswordRequest{CurrentPassword: "guess", NewPassword: "new-password"}
+		handler.ChangePassword(rr, authedRequest("POST", "/me/password", body, 7))
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		mockRepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("success issues fresh tokens", func(t *testing.T) {
+		mockRepo := new(MockAuthRepository)
+		mockRepo.On("GetPasswordHash", mock.Anything, 7).Return(currentHash, nil)
+		mockRepo.On("UpdatePassword", mock.Anything, 7, mock.MatchedBy(func(hash string) bool {
+			return utils.CheckPassword(hash, "new-password")
+		}), events.PasswordChangedEvent{
+			UserID: 7, Email: "ada@example.com", Username: "ada", Reason: events.PasswordChangedByUser,
+		}).Return(nil)
+		mockRepo.On("GetUserByID", mock.Anything, 7).Return(&models.User{ID: 7, Username: "ada", Email: "ada@example.com", TokenVersion: 3}, nil)
+		mockRepo.On("CreateSession", mock.Anything, mock.Anything).Return(nil)
+		mockRepo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+		mockPublisher := new(MockEventPublisher)
+
+		handler := handlers.NewAuthHandler(mockRepo, mockPublisher)
+		rr := httptest.NewRecorder()
+		body := models.ChangePasswordRequest{CurrentPassword: "current-password", NewPassword: "new-password"}
+		handler.ChangePassword(rr, authedRequest("POST", "/me/password", body, 7))
+
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var resp models.TokenResponse
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+		claims, err := utils.ParseJWT(resp.Token)
+		require.NoError(t, err)
+		assert.Equal(t, 3, claims.TokenVersion, "New token must carry the bumped token version")
+		mockRepo.AssertExpectations(t)
+		mockPublisher.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+	})
+}
+
+func TestDeleteMe_QueuesUserDeleted(t *testing.T) {
+	currentHash, err := utils.HashPassword("current-password")
+	require.NoError(t, err)
+
+	mockRepo := new(MockAuthRepository)
+	mockPublisher := new(MockEventPublisher)
+	mockRepo.On("GetUserByID", mock.Anything, 7).Return(&models.User{ID: 7, Username: "ada", Email: "ada@example.com"}, nil)
+	mockRepo.On("GetPasswordHash", mock.Anything, 7).Return(currentHash, nil)
+	// The event is stored in the outbox with the deletion, so a broker outage
+	// cannot leave the user's projects and tasks behind
+	mockRepo.On("DeleteUser", mock.Anything, 7, events.UserDeletedEvent{UserID: 7, Email: "ada@example.com", Username: "ada"}).Return(nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, mockPublisher)
+	rr := httptest.NewRecorder()
+	handler.DeleteMe(rr, authedRequest("DELETE", "/me", models.DeleteAccountRequest{Password: "current-password"}, 7))
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	mockRepo.AssertExpectations(t)
+	mockPublisher.AssertNotCalled(t, "Publish", mock.Anything, mock.Anything)
+}
+
+func TestDeleteMe_RequiresPassword(t *testing.T) {
+	currentHash, err := utils.HashPassword("current-password")
+	require.NoError(t, err)
+
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("GetUserByID", mock.Anything, 7).Return(&models.User{ID: 7}, nil)
+	mockRepo.On("GetPasswordHash", mock.Anything, 7).Return(currentHash, nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+	rr := httptest.NewRecorder()
+	handler.DeleteMe(rr, authedRequest("DELETE", "/me", models.DeleteAccountRequest{Password: "wrong"}, 7))
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	mockRepo.AssertNotCalled(t, "DeleteUser", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"auth-service/internal/handlers"
+	"auth-service/internal/middleware"
+	"auth-service/internal/models"
+	"auth-service/internal/ratelimit"
+	"auth-service/internal/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_TokenBucket(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	limit := ratelimit.Limit{Requests: 3, Per: 3 * time.Second} // One token per second
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		ok, _, err := store.Take(context.Background(), "k", limit, now)
+		require.NoError(t, err)
+		assert.True(t, ok, "burst request %d", i)
+	}
+	ok, retryAfter, _ := store.Take(context.Background(), "k", limit, now)
+	assert.False(t, ok)
+	assert.InDelta(t, time.Second, retryAfter, float64(10*time.Millisecond))
+
+	// Other keys have their own bucket
+	ok, _, _ = store.Take(context.Background(), "other", limit, now)
+	assert.True(t, ok)
+
+	// One token is back after a second
+	ok, _, _ = store.Take(context.Background(), "k", limit, now.Add(time.Second))
+	assert.True(t, ok)
+	ok, _, _ = store.Take(context.Background(), "k", limit, now.Add(time.Second))
+	assert.False(t, ok)
+}
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ratelimit.ParseLimit("10/1m")
+	require.NoError(t, err)
+	assert.Equal(t, ratelimit.Limit{Requests: 10, Per: time.Minute}, limit)
+
+	limit, err = ratelimit.ParseLimit("off")
+	require.NoError(t, err)
+	assert.Zero(t, limit.Requests)
+
+	for _, bad := range []string{"10", "x/1m", "10/soon", "10/0s"} {
+		_, err := ratelimit.ParseLimit(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestIPRateLimit_Returns429WithRetryAfter(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), "test", ratelimit.Limit{Requests: 1, Per: time.Minute})
+	handler := middleware.IPRateLimit(limiter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusNoContent, request("203.0.113.1:5000").Code)
+	rr := request("203.0.113.1:5001") // Same IP, different port
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	assert.InDelta(t, 60, retryAfter, 1)
+
+	assert.Equal(t, http.StatusNoContent, request("203.0.113.2:5000").Code)
+}
+
+func TestClientIP_OnlyTrustsForwardedForWhenConfigured(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.5:1234"
+	req.Header.Set("X-Forwarded-For", "1.2.3.4, 198.51.100.7")
+
+	t.Setenv("TRUST_PROXY_HEADERS", "")
+	assert.Equal(t, "10.0.0.5", middleware.ClientIP(req))
+
+	t.Setenv("TRUST_PROXY_HEADERS", "true")
+	assert.Equal(t, "198.51.100.7", middleware.ClientIP(req)) // Added by our proxy; the first entry is client-controlled
+}
+
+func TestLockoutPolicy_IsProgressive(t *testing.T) {
+	policy := utils.LockoutPolicy{Threshold: 3, BaseDuration: time.Minute, MaxDuration: 10 * time.Minute}
+
+	assert.Zero(t, policy.LockDuration(2))
+	assert.Equal(t, time.Minute, policy.LockDuration(3))
+	assert.Equal(t, 2*time.Minute, policy.LockDuration(4))
+	assert.Equal(t, 8*time.Minute, policy.LockDuration(6))
+	assert.Equal(t, 10*time.Minute, policy.LockDuration(7))
+	assert.Equal(t, 10*time.Minute, policy.LockDuration(100))
+	assert.Zero(t, utils.LockoutPolicy{}.LockDuration(100), "threshold 0 disables lockout")
+}
+
+// postLogin sends a login request for email to handler.
+func postLogin(handler *handlers.AuthHandler, email, password string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.LoginRequest{Email: email, Password: password})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.Login(rr, req)
+	return rr
+}
+
+func TestLogin_LocksAccountAfterRepeatedFailures(t *testing.T) {
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "5")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "1m")
+	mockRepo := new(MockAuthRepository)
+	user := &models.User{ID: 11, Email: "victim@example.com", FailedLoginAttempts: 4}
+
+	mockRepo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+	mockRepo.On("Authenticate", mock.Anything).Return(false, nil)
+	mockRepo.On("RecordFailedLogin", mock.Anything, 11).Return(5, nil)
+	mockRepo.On("LockAccount", mock.Anything, 11, mock.MatchedBy(func(until time.Time) bool {
+		return time.Until(until) > 55*time.Second && time.Until(until) <= time.Minute
+	})).Return(nil)
+
+	rr := postLogin(handlers.NewAuthHandler(mockRepo, nil), user.Email, "wrong")
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLogin_LockedAccountGets429(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	lockedUntil := time.Now().Add(2 * time.Minute)
+	mockRepo.On("GetUserByEmail", mock.Anything, "locked@example.com").
+		Return(&models.User{ID: 12, Email: "locked@example.com", FailedLoginAttempts: 6, LockedUntil: &lockedUntil}, nil)
+
+	rr := postLogin(handlers.NewAuthHandler(mockRepo, nil), "locked@example.com", "even-the-right-password")
+
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	retryAfter, _ := strconv.Atoi(rr.Header().Get("Retry-After"))
+	assert.InDelta(t, 120, retryAfter, 1)
+	mockRepo.AssertNotCalled(t, "Authenticate", mock.Anything)
+}
+
+func TestLogin_SuccessResetsFailedAttempts(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	verifiedAt := time.Now()
+	expired := time.Now().Add(-time.Minute)
+	user := &models.User{ID: 13, Email: "back@example.com", EmailVerifiedAt: &verifiedAt, FailedLoginAttempts: 5, LockedUntil: &expired}
+
+	mockRepo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+	mockRepo.On("Authenticate", mock.Anything).Return(true, nil)
+	mockRepo.On("ResetFailedLogins", mock.Anything, 13).Return(nil)
+	mockRepo.On("CreateSession", mock.Anything, mock.Anything).Return(nil)
+	mockRepo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(nil)
+
+	rr := postLogin(handlers.NewAuthHandler(mockRepo, nil), user.Email, "password123")
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLogin_AccountRateLimitAppliesToUnknownEmails(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("GetUserByEmail", mock.Anything, mock.Anything).Return(nil, nil)
+	mockRepo.On("Authenticate", mock.Anything).Return(false, nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+	handler.SetAccountLimiter(ratelimit.NewLimiter(ratelimit.NewMemoryStore(), "login-account", ratelimit.Limit{Requests: 2, Per: time.Minute}))
+
+	assert.Equal(t, http.StatusUnauthorized, postLogin(handler, "nobody@example.com", "a").Code)
+	assert.Equal(t, http.StatusUnauthorized, postLogin(handler, "Nobody@example.com", "b").Code)
+	rr := postLogin(handler, "nobody@example.com", "c")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+
+	// Unknown accounts are never locked in the database
+	mockRepo.AssertNotCalled(t, "RecordFailedLogin", mock.Anything, mock.Anything)
+}
+
+func TestLogin_AccountRateLimitSharedByUsernameAndEmail(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	user := &models.User{ID: 12, Username: "victim", Email: "victim@example.com"}
+	mockRepo.On("GetUserByEmail", mock.Anything, user.Email).Return(user, nil)
+	mockRepo.On("GetUserByUsername", mock.Anything, user.Username).Return(user, nil)
+	mockRepo.On("Authenticate", mock.Anything).Return(false, nil)
+	mockRepo.On("RecordFailedLogin", mock.Anything, 12).Return(1, nil)
+
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+	handler.SetAccountLimiter(ratelimit.NewLimiter(ratelimit.NewMemoryStore(), "login-account", ratelimit.Limit{Requests: 2, Per: time.Minute}))
+
+	assert.Equal(t, http.StatusUnauthorized, postLogin(handler, user.Email, "a").Code)
+	assert.Equal(t, http.StatusUnauthorized, postJSON(handler.Login, "/login", models.LoginRequest{Login: user.Username, Password: "b"}).Code)
+	assert.Equal(t, http.StatusTooManyRequests, postJSON(handler.Login, "/login", models.LoginRequest{Login: user.Username, Password: "c"}).Code)
+	assert.Equal(t, http.StatusTooManyRequests, postLogin(handler, user.Email, "d").Code)
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"auth-service/internal/handlers"
+	"auth-service/internal/middleware"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"auth-service/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testSessionID  = "6f1c2d3e-4a5b-4c6d-8e9f-0a1b2c3d4e5f"
+	otherSessionID = "0b9a8c7d-6e5f-4a3b-9c2d-1e0f9a8b7c6d"
+)
+
+// sessionRequest builds a request by user 7 whose access token belongs to testSessionID.
+func sessionRequest(method, url string) *http.Request {
+	req := authedRequest(method, url, nil, 7)
+	claims := &utils.Claims{SessionID: testSessionID}
+	return req.WithContext(context.WithValue(req.Context(), middleware.ClaimsContextKey, claims))
+}
+
+func TestListSessions_MarksCurrentSession(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("ListSessions", mock.Anything, 7).Return([]models.Session{
+		{ID: otherSessionID, UserAgent: "curl/8.0", IPAddress: "198.51.100.7"},
+		{ID: testSessionID, UserAgent: "Mozilla/5.0", IPAddress: "203.0.113.9"},
+	}, nil)
+
+	rr := httptest.NewRecorder()
+	handlers.NewAuthHandler(mockRepo, nil).ListSessions(rr, sessionRequest("GET", "/me/sessions"))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var sessions []models.Session
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&sessions))
+	require.Len(t, sessions, 2)
+	assert.False(t, sessions[0].Current)
+	assert.True(t, sessions[1].Current)
+	assert.Equal(t, "Mozilla/5.0", sessions[1].UserAgent)
+}
+
+func TestRevokeSession(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("RevokeSession", mock.Anything, 7, otherSessionID).Return(nil)
+	mockRepo.On("RevokeSession", mock.Anything, 7, testSessionID).Return(repository.ErrSessionNotFound)
+	handler := handlers.NewAuthHandler(mockRepo, nil)
+
+	for id, want := range map[string]int{
+		otherSessionID: http.StatusNoContent,
+		testSessionID:  http.StatusNotFound,
+		"not-a-uuid":   http.StatusBadRequest,
+	} {
+		req := sessionRequest("DELETE", "/me/sessions/"+id)
+		req.SetPathValue("id", id)
+		rr := httptest.NewRecorder()
+		handler.RevokeSession(rr, req)
+		assert.Equal(t, want, rr.Code, id)
+	}
+	mockRepo.AssertNumberOfCalls(t, "RevokeSession", 2)
+}
+
+func TestJWTAuth_TouchesSessionLazily(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	token, err := utils.GenerateJWT(models.User{ID: 7}, testSessionID)
+	require.NoError(t, err)
+	claims, err := utils.ParseJWT(token)
+	require.NoError(t, err)
+	assert.Equal(t, testSessionID, claims.SessionID)
+
+	mockRepo.On("IsAccessTokenRevoked", mock.Anything, claims.ID, 7, 0, testSessionID).Return(false, nil)
+	mockRepo.On("TouchSession", mock.Anything, testSessionID, mock.AnythingOfType("time.Time")).Return(nil)
+
+	authenticator := middleware.NewAuthenticator(mockRepo)
+	authenticator.TrackSessions(mockRepo, time.Hour)
+	protected := authenticator.JWTAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		protected.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+	// Only the first request within the interval writes the last-seen time
+	mockRepo.AssertNumberOfCalls(t, "TouchSession", 1)
+}
+
+func TestJWTAuth_RejectsRevokedSession(t *testing.T) {
+	mockRepo := new(MockAuthRepository)
+	token, err := utils.GenerateJWT(models.User{ID: 7}, testSessionID)
+	require.NoError(t, err)
+	claims, err := utils.ParseJWT(token)
+	require.NoError(t, err)
+	mockRepo.On("IsAccessTokenRevoked", mock.Anything, claims.ID, 7, 0, testSessionID).Return(true, nil)
+
+	authenticator := middleware.NewAuthenticator(mockRepo)
+	authenticator.TrackSessions(mockRepo, time.Hour)
+	protected := authenticator.JWTAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	protected.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	mockRepo.AssertNotCalled(t, "TouchSession", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"auth-service/internal/events"
+	"auth-service/internal/handlers"
+	"auth-service/internal/models"
+	"auth-service/internal/utils"
+	"cozy-go/shared/cloudevents"
+	"cozy-go/shared/outbox"
+	"cozy-go/topology"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopology_Matches(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"user.registered", "user.registered", true},
+		{"user.registered", "user.deleted", false},
+		{"user.*", "user.deleted", true},
+		{"user.*", "user.profile.updated", false},
+		{"user.#", "user.profile.updated", true},
+		{"user.#", "user", true},
+		{"#", "task.created", true},
+		{"*.created", "task.created", true},
+		{"*.created", "created", false},
+	} {
+		assert.Equal(t, tc.want, topology.Matches(tc.pattern, tc.key), "%s ~ %s", tc.pattern, tc.key)
+	}
+}
+
+func TestTopology_RoutesEventsToTheirConsumer(t *testing.T) {
+	for _, eventType := range events.Types() {
+		routes := topology.Routes(eventType)
+		switch eventType {
+		case events.TypeUserLoggedIn:
+			assert.Empty(t, routes, eventType)
+		case events.TypeUserDeleted:
+			assert.Equal(t, []string{topology.TaskQueue}, routes, eventType)
+		default:
+			assert.Equal(t, []string{topology.NotificationQueue}, routes, eventType)
+		}
+	}
+}
+
+func TestTopology_DeclareIsIdempotent(t *testing.T) {
+	broker := topology.NewMemoryBroker()
+	ch, err := broker.Channel()
+	require.NoError(t, err)
+	require.NoError(t, topology.Declare(ch))
+	require.NoError(t, topology.Declare(ch))
+
+	// Bindings are not duplicated, so every event arrives once
+	require.NoError(t, ch.PublishWithContext(context.Background(), topology.Exchange, events.TypeUserDeleted, false, false, amqp.Publishing{Body: []byte("{}")}))
+	_, ok := broker.Get(topology.TaskQueue)
+	assert.True(t, ok)
+	_, ok = broker.Get(topology.TaskQueue)
+	assert.False(t, ok)
+}
+
+// TestTopology_RegistrationReachesNotificationQueue follows a registration from
+// the HTTP handler through the outbox and the relay to the queue
+// notification-service consumes. notification-service's tests continue from
+// there to the email sender.
+func TestTopology_RegistrationReachesNotificationQueue(t *testing.T) {
+	store := &memoryOutbox{}
+	var verification *models.EmailVerificationToken
+	mockRepo := new(MockAuthRepository)
+	mockRepo.On("Register", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			verification = args.Get(2).(*models.EmailVerificationToken)
+			newEvent := args.Get(3).(func(userID int) events.Event)
+			store.add(t, args.Get(0).(context.Context), newEvent(7))
+		}).
+		Return(7, nil)
+
+	rr := postJSON(handlers.NewAuthHandler(mockRepo, nil).Register, "/register",
+		models.RegisterRequest{Username: "ada", Email: "ada@example.com", Password: "password123"})
+	require.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	require.Len(t, store.rows, 1)
+
+	broker := topology.NewMemoryBroker()
+	publisher := events.NewRabbitMqPublisher(broker, cloudevents.ContentModeStructured)
+	published, err := outbox.NewRelay(store, publisher, outbox.DefaultConfig()).RelayPending(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, published)
+
+	d, ok := broker.Get(topology.NotificationQueue)
+	require.True(t, ok, "the registration did not reach notification-service's queue")
+	assert.Equal(t, topology.Exchange, d.Exchange)
+	assert.Equal(t, events.TypeUserRegistered, d.RoutingKey)
+	assert.Equal(t, store.rows[0].event.EventID, d.MessageId)
+
+	var envelope events.Envelope
+	require.NoError(t, json.Unmarshal(d.Body, &envelope))
+	var event events.UserRegisteredEvent
+	require.NoError(t, json.Unmarshal(envelope.Data, &event))
+	assert.Equal(t, 7, event.UserID)
+	assert.Equal(t, "ada@example.com", event.Email)
+	assert.Equal(t, verification.TokenHash, utils.HashToken(event.VerificationToken))
+
+	// Nothing else is bound to user.registered
+	_, ok = broker.Get(topology.TaskQueue)
+	assert.False(t, ok)
+}
+
+func TestTopology_RedialerDialsAgainUntilClosed(t *testing.T) {
+	dials := 0
+	conn := topology.NewRedialer(nil, func() (*amqp.Connection, error) {
+		dials++
+		return nil, errors.New("connection refused")
+	})
+	publisher := events.NewRabbitMqPublisher(conn, cloudevents.ContentModeStructured)
+
+	// A broker outage fails the publish without giving up on the connection
+	for attempt := 1; attempt <= 2; attempt++ {
+		err := publisher.Publish(context.Background(), events.UserDeletedEvent{UserID: 1})
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, events.ErrNotConnected)
+		assert.Equal(t, attempt, dials)
+	}
+
+	require.NoError(t, conn.Close())
+	assert.True(t, conn.IsClosed())
+	err := publisher.Publish(context.Background(), events.UserDeletedEvent{UserID: 1})
+	assert.ErrorIs(t, err, events.ErrNotConnected)
+	assert.Equal(t, 2, dials, "a closed redialer does not dial")
+}
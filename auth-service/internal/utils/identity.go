@@ -0,0 +1,21 @@
+package utils
+
+import "strings"
+
+// NormalizeEmail returns the form in which email addresses are stored and
+// compared: without surrounding whitespace and in lowercase.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizeUsername trims surrounding whitespace. Usernames keep their case for
+// display; uniqueness and login ignore it.
+func NormalizeUsername(username string) string {
+	return strings.TrimSpace(username)
+}
+
+// IsEmailLogin reports whether a login identifier is an email address rather
+// than a username. Usernames cannot contain "@".
+func IsEmailLogin(identifier string) bool {
+	return strings.Contains(identifier, "@")
+}
@@ -2,8 +2,8 @@ package utils
 
 import (
 	"errors" // Ensure errors package is imported
-	"log"
-	"os"
+	"fmt"
+	"log/slog"
 	"time"
 
 	"auth-service/internal/models"
@@ -13,31 +13,99 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func GenerateJWT(user models.User) (string, error) {
-	// Use the correct environment variable name and handle missing secret properly
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		log.Println("Error: JWT_SECRET environment variable not set.")
-		// Return an error instead of using a default key
-		return "", errors.New("JWT secret key is not configured")
+// defaultAccessTokenTTL is used when JWT_ACCESS_TTL is not set.
+// Access tokens are short-lived; clients renew them with a refresh token.
+const defaultAccessTokenTTL = 15 * time.Minute
+
+// AccessTokenTTL returns the lifetime of access tokens.
+// It can be overridden with the JWT_ACCESS_TTL environment variable (e.g. "10m").
+func AccessTokenTTL() time.Duration {
+	return durationFromEnv("JWT_ACCESS_TTL", defaultAccessTokenTTL)
+}
+
+// Claims are the claims carried by access tokens.
+// ID (jti) identifies a single token so it can be revoked on logout;
+// TokenVersion must match the user's current token_version, which lets
+// "logout everywhere" invalidate every outstanding token at once.
+// Role is the user's role (models.RoleUser or models.RoleAdmin) when the token was issued.
+// SessionID (sid) names the login session the token belongs to, see GET /me/sessions.
+type Claims struct {
+	jwt.RegisteredClaims
+	TokenVersion int    `json:"ver"`
+	Role         string `json:"role,omitempty"`
+	SessionID    string `json:"sid,omitempty"`
+}
+
+// GenerateJWT issues an access token for user in sessionID (may be empty), signed
+// with the active key from Keys(). The kid header tells verifiers (see
+// GET /.well-known/jwks.json) which key to use.
+func GenerateJWT(user models.User, sessionID string) (string, error) {
+	keys, err := Keys()
+	if err != nil {
+		slog.Error("JWT signing keys are not available", "error", err)
+		return "", err
+	}
+	signingKey := keys.Active()
+
+	jti, err := NewUUID()
+	if err != nil {
+		return "", err
 	}
 
 	// Use RegisteredClaims and include Subject (user ID)
-	claims := &jwt.RegisteredClaims{
-		Subject:   strconv.Itoa(user.ID), // Use user ID as Subject
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 72)), // Standard expiry claim
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		NotBefore: jwt.NewNumericDate(time.Now()),
-		// You can add custom claims here if needed, e.g.,
-		// "username": user.Username,
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   strconv.Itoa(user.ID),                                // Use user ID as Subject
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL())), // Standard expiry claim
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+		TokenVersion: user.TokenVersion,
+		Role:         user.Role,
+		SessionID:    sessionID,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secretKey))
+	token := jwt.NewWithClaims(signingKey.Method, claims)
+	token.Header["kid"] = signingKey.ID
+	tokenString, err := token.SignedString(signingKey.Private)
 	if err != nil {
-		log.Printf("Error signing JWT token: %v", err)
+		slog.Error("Error signing JWT token", "error", err)
 		return "", err
 	}
-	log.Println("Generated Token:", tokenString)
 	return tokenString, nil
 }
+
+// ParseJWT validates the signature and standard time claims of an access token
+// and returns its claims. It does not check revocation.
+func ParseJWT(tokenString string) (*Claims, error) {
+	keys, err := Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		// The algorithm is pinned by the key, never taken from the token alone
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("invalid signing method")
+		}
+		return key.Public(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return claims, nil
+}
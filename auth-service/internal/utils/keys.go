@@ -0,0 +1,301 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is a private key used to sign access tokens, identified by its kid.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+}
+
+// Public returns the public half of the key.
+func (k *SigningKey) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// KeySet holds every key whose tokens are still accepted. New tokens are signed with
+// the active key only; older keys stay in the set (and in the JWKS) during rotation
+// so tokens they signed keep validating until they expire.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// Active returns the key used for signing new tokens.
+func (ks *KeySet) Active() *SigningKey {
+	return ks.active
+}
+
+// Lookup returns the key with the given kid.
+func (ks *KeySet) Lookup(kid string) (*SigningKey, bool) {
+	k, ok := ks.keys[kid]
+	return k, ok
+}
+
+// NewKeySet builds a KeySet from keys, signing with the key whose ID is activeKID.
+func NewKeySet(keys []*SigningKey, activeKID string) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("key set must contain at least one key")
+	}
+	ks := &KeySet{keys: make(map[string]*SigningKey, len(keys))}
+	for _, k := range keys {
+		if _, dup := ks.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate key id %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+	active, ok := ks.keys[activeKID]
+	if !ok {
+		return nil, fmt.Errorf("active key id %q not found in key set", activeKID)
+	}
+	ks.active = active
+	return ks, nil
+}
+
+var (
+	keySet     *KeySet
+	keySetErr  error
+	keySetOnce sync.Once
+	keySetMu   sync.RWMutex
+)
+
+// InitKeys loads the signing keys from the environment. Calling it at startup makes
+// configuration errors fail fast; otherwise keys are loaded on first use.
+func InitKeys() error {
+	_, err := Keys()
+	return err
+}
+
+// Keys returns the process-wide key set, loading it from the environment on first use.
+func Keys() (*KeySet, error) {
+	keySetOnce.Do(func() {
+		ks, err := LoadKeySetFromEnv()
+		keySetMu.Lock()
+		keySet, keySetErr = ks, err
+		keySetMu.Unlock()
+	})
+	keySetMu.RLock()
+	defer keySetMu.RUnlock()
+	return keySet, keySetErr
+}
+
+// SetKeys replaces the process-wide key set (used by tests and key rotation tooling).
+func SetKeys(ks *KeySet) {
+	keySetOnce.Do(func() {}) // Prevent a later lazy load from overwriting ks
+	keySetMu.Lock()
+	keySet, keySetErr = ks, nil
+	keySetMu.Unlock()
+}
+
+// LoadKeySetFromEnv loads signing keys according to:
+//
+//   - JWT_KEYS_DIR: a directory of PEM private keys (RSA or Ed25519). The file name
+//     without extension is the kid. JWT_ACTIVE_KID picks the signing key; it defaults
+//     to the last file name in lexical order, so naming keys by date rotates naturally.
+//   - JWT_PRIVATE_KEY_FILE: a single PEM private key, kid derived from its public key.
+//   - Neither set: an ephemeral key is generated (JWT_SIGNING_ALG=RS256|EdDSA, default
+//     RS256). Tokens then stop validating when the service restarts; dev only.
+func LoadKeySetFromEnv() (*KeySet, error) {
+	if dir := os.Getenv("JWT_KEYS_DIR"); dir != "" {
+		return loadKeyDir(dir, os.Getenv("JWT_ACTIVE_KID"))
+	}
+
+	if file := os.Getenv("JWT_PRIVATE_KEY_FILE"); file != "" {
+		key, err := loadKeyFile(file, "")
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Loaded JWT signing key", "kid", key.ID, "alg", key.Method.Alg(), "file", file)
+		return NewKeySet([]*SigningKey{key}, key.ID)
+	}
+
+	alg := os.Getenv("JWT_SIGNING_ALG")
+	if alg == "" {
+		alg = "RS256"
+	}
+	slog.Warn("No JWT_KEYS_DIR or JWT_PRIVATE_KEY_FILE set, generating an ephemeral signing key. Tokens will not survive a restart", "alg", alg)
+	key, err := GenerateSigningKey(alg)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySet([]*SigningKey{key}, key.ID)
+}
+
+// GenerateSigningKey creates a new in-memory key for alg ("RS256" or "EdDSA").
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	var priv crypto.Signer
+	var err error
+	switch alg {
+	case "RS256":
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "EdDSA":
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing algorithm %q (use RS256 or EdDSA)", alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key: %w", alg, err)
+	}
+	return newSigningKey(priv, "")
+}
+
+// loadKeyDir loads every *.pem file in dir.
+func loadKeyDir(dir string, activeKID string) (*KeySet, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no *.pem keys found in JWT_KEYS_DIR %s", dir)
+	}
+	sort.Strings(files)
+
+	keys := make([]*SigningKey, 0, len(files))
+	for _, file := range files {
+		kid := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		key, err := loadKeyFile(file, kid)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if activeKID == "" {
+		activeKID = keys[len(keys)-1].ID
+	}
+	slog.Info("Loaded JWT signing keys", "count", len(keys), "dir", dir, "active_kid", activeKID)
+	return NewKeySet(keys, activeKID)
+}
+
+// loadKeyFile parses a PEM encoded PKCS#8 (RSA or Ed25519) or PKCS#1 (RSA) private key.
+func loadKeyFile(file string, kid string) (*SigningKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file %s: %w", file, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", file)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key in %s: %w", file, err)
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type in %s", file)
+	}
+	return newSigningKey(signer, kid)
+}
+
+// newSigningKey wraps priv, picking the JWT algorithm from the key type.
+// An empty kid is replaced by a thumbprint of the public key.
+func newSigningKey(priv crypto.Signer, kid string) (*SigningKey, error) {
+	var method jwt.SigningMethod
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA signing keys must be at least 2048 bits")
+		}
+		method = jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", priv)
+	}
+
+	key := &SigningKey{ID: kid, Method: method, Private: priv}
+	if key.ID == "" {
+		key.ID = thumbprint(key.Public())
+	}
+	return key, nil
+}
+
+// thumbprint derives a short, stable kid from a public key.
+func thumbprint(pub crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "default"
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// --- JWKS ---
+
+// JWK is the public JSON Web Key representation of a signing key (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP (Ed25519)
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the set, sorted by kid.
+func (ks *KeySet) JWKS() JWKS {
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := JWKS{Keys: make([]JWK, 0, len(kids))}
+	for _, kid := range kids {
+		key := ks.keys[kid]
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+		switch pub := key.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// LockoutPolicy locks an account after repeated failed logins. Every failure
+// from Threshold on locks the account for twice as long as the previous one,
+// starting at BaseDuration and capped at MaxDuration. A successful login resets
+// the count. Threshold 0 disables lockout.
+type LockoutPolicy struct {
+	Threshold    int
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+}
+
+// GetLockoutPolicy reads the policy from LOGIN_LOCKOUT_THRESHOLD (default 5),
+// LOGIN_LOCKOUT_DURATION (default 1m) and LOGIN_LOCKOUT_MAX_DURATION (default 1h).
+func GetLockoutPolicy() LockoutPolicy {
+	threshold := 5
+	if value := os.Getenv("LOGIN_LOCKOUT_THRESHOLD"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			slog.Warn("Invalid LOGIN_LOCKOUT_THRESHOLD, using default", "value", value, "default", threshold)
+		} else {
+			threshold = parsed
+		}
+	}
+	return LockoutPolicy{
+		Threshold:    threshold,
+		BaseDuration: durationFromEnv("LOGIN_LOCKOUT_DURATION", time.Minute),
+		MaxDuration:  durationFromEnv("LOGIN_LOCKOUT_MAX_DURATION", time.Hour),
+	}
+}
+
+// LockDuration returns how long to lock an account after its failures-th
+// consecutive failed login, or 0 if it should not be locked.
+func (p LockoutPolicy) LockDuration(failures int) time.Duration {
+	if p.Threshold <= 0 || failures < p.Threshold {
+		return 0
+	}
+	d := p.BaseDuration
+	for i := p.Threshold; i < failures; i++ {
+		d *= 2
+		if d >= p.MaxDuration {
+			return p.MaxDuration
+		}
+	}
+	return min(d, p.MaxDuration)
+}
@@ -1,11 +1,240 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword hashes a plain text password using bcrypt.
+// PasswordHasher is one password hashing algorithm. Hashes are self-describing
+// strings that carry the algorithm and its parameters, so several algorithms
+// and work factors can coexist in the users table.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of password.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded, a hash this hasher Handles.
+	Verify(encoded string, password string) (bool, error)
+	// Handles reports whether encoded was produced by this algorithm.
+	Handles(encoded string) bool
+	// NeedsRehash reports whether encoded should be replaced by a fresh Hash,
+	// because it uses an outdated algorithm or weaker parameters.
+	NeedsRehash(encoded string) bool
+}
+
+// ErrVerifyOnly is returned by hashers that are only kept to check existing hashes.
+var ErrVerifyOnly = errors.New("password hasher is verify-only")
+
+// Argon2Params are the argon2id work factors.
+type Argon2Params struct {
+	MemoryKiB   uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the OWASP password storage recommendation
+// (19 MiB of memory, 2 iterations, 1 degree of parallelism).
+var DefaultArgon2Params = Argon2Params{MemoryKiB: 19 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+// Argon2idHasher hashes passwords with argon2id in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+type Argon2idHasher struct {
+	Params Argon2Params
+}
+
+const argon2idPrefix = "$argon2id$"
+
+// Hash implements PasswordHasher.
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.MemoryKiB, h.Params.Parallelism, h.Params.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version,
+		h.Params.MemoryKiB, h.Params.Iterations, h.Params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify implements PasswordHasher.
+func (h Argon2idHasher) Verify(encoded string, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.MemoryKiB, params.Parallelism, params.KeyLength)
+	return subtle.ConstantTimeCompare(key, candidate) == 1, nil
+}
+
+// Handles implements PasswordHasher.
+func (h Argon2idHasher) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+// NeedsRehash implements PasswordHasher. Hashes with weaker (or unparseable)
+// parameters than h.Params are rehashed; stronger ones are kept.
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, _, _, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.MemoryKiB < h.Params.MemoryKiB ||
+		params.Iterations < h.Params.Iterations ||
+		params.Parallelism < h.Params.Parallelism ||
+		params.SaltLength < h.Params.SaltLength ||
+		params.KeyLength < h.Params.KeyLength
+}
+
+// decodeArgon2id parses an argon2id PHC string.
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(encoded, "$")
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2id version")
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.MemoryKiB, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, errors.New("invalid argon2id hash value")
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// BcryptHasher verifies the bcrypt hashes stored before the switch to argon2id.
+// It never creates hashes, and every bcrypt hash needs a rehash.
+type BcryptHasher struct{}
+
+// Hash implements PasswordHasher; bcrypt is verify-only.
+func (BcryptHasher) Hash(password string) (string, error) {
+	return "", ErrVerifyOnly
+}
+
+// Verify implements PasswordHasher.
+func (BcryptHasher) Verify(encoded string, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Handles implements PasswordHasher.
+func (BcryptHasher) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// NeedsRehash implements PasswordHasher.
+func (BcryptHasher) NeedsRehash(encoded string) bool {
+	return true
+}
+
+// PasswordHashers hashes new passwords with Current and verifies existing
+// hashes with whichever hasher handles them.
+type PasswordHashers struct {
+	Current PasswordHasher
+	Legacy  []PasswordHasher
+}
+
+// find returns the hasher that produced encoded, or nil.
+func (s *PasswordHashers) find(encoded string) PasswordHasher {
+	if s.Current.Handles(encoded) {
+		return s.Current
+	}
+	for _, h := range s.Legacy {
+		if h.Handles(encoded) {
+			return h
+		}
+	}
+	return nil
+}
+
+// passwordHashers are read from the environment on first use: argon2id work
+// factors come from PASSWORD_ARGON2_MEMORY_KIB, PASSWORD_ARGON2_ITERATIONS and
+// PASSWORD_ARGON2_PARALLELISM. Raising them makes existing hashes get upgraded
+// as users log in.
+var passwordHashers = sync.OnceValue(func() *PasswordHashers {
+	params := DefaultArgon2Params
+	params.MemoryKiB = uint32(uintFromEnv("PASSWORD_ARGON2_MEMORY_KIB", uint64(params.MemoryKiB), 32))
+	params.Iterations = uint32(uintFromEnv("PASSWORD_ARGON2_ITERATIONS", uint64(params.Iterations), 32))
+	params.Parallelism = uint8(uintFromEnv("PASSWORD_ARGON2_PARALLELISM", uint64(params.Parallelism), 8))
+	return &PasswordHashers{Current: Argon2idHasher{Params: params}, Legacy: []PasswordHasher{BcryptHasher{}}}
+})
+
+// uintFromEnv reads a positive integer of at most bits bits from the environment variable name.
+func uintFromEnv(name string, def uint64, bits int) uint64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseUint(value, 10, bits)
+	if err != nil || parsed == 0 {
+		slog.Warn("Invalid setting, using default", "name", name, "value", value, "default", def)
+		return def
+	}
+	return parsed
+}
+
+// HashPassword hashes a plain text password with the current algorithm (argon2id).
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+	return passwordHashers().Current.Hash(password)
+}
+
+// CheckPassword reports whether password matches the encoded hash, whichever
+// supported algorithm produced it.
+func CheckPassword(hash string, password string) bool {
+	hasher := passwordHashers().find(hash)
+	if hasher == nil {
+		slog.Warn("Password hash in unknown format")
+		return false
+	}
+	ok, err := hasher.Verify(hash, password)
+	if err != nil {
+		slog.Warn("Failed to verify password hash", "error", err)
+		return false
+	}
+	return ok
+}
+
+// PasswordNeedsRehash reports whether hash uses an outdated algorithm or work
+// factor and should be replaced after the next successful login.
+func PasswordNeedsRehash(hash string) bool {
+	hasher := passwordHashers().find(hash)
+	return hasher == nil || hasher.NeedsRehash(hash)
+}
+
+// dummyPasswordHash is compared against when there is no account, so a login
+// for an unknown email costs the same hashing work as a wrong password.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("not the password of any account")
+	return hash
+})
+
+// SimulatePasswordCheck performs a password comparison that always fails. Call it
+// where a real check is skipped to keep response times indistinguishable.
+func SimulatePasswordCheck(password string) {
+	CheckPassword(dummyPasswordHash(), password)
 }
@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultRefreshTokenTTL is used when REFRESH_TOKEN_TTL is not set.
+const defaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+// RefreshTokenTTL returns the lifetime of refresh tokens.
+// It can be overridden with the REFRESH_TOKEN_TTL environment variable (e.g. "168h").
+func RefreshTokenTTL() time.Duration {
+	return durationFromEnv("REFRESH_TOKEN_TTL", defaultRefreshTokenTTL)
+}
+
+// defaultPasswordResetTTL is used when PASSWORD_RESET_TTL is not set.
+const defaultPasswordResetTTL = time.Hour
+
+// PasswordResetTTL returns how long a password reset link stays valid.
+// It can be overridden with the PASSWORD_RESET_TTL environment variable (e.g. "30m").
+func PasswordResetTTL() time.Duration {
+	return durationFromEnv("PASSWORD_RESET_TTL", defaultPasswordResetTTL)
+}
+
+// defaultMagicLinkTTL is used when MAGIC_LINK_TTL is not set.
+const defaultMagicLinkTTL = 15 * time.Minute
+
+// MagicLinkTTL returns how long an emailed sign-in link stays valid.
+// It can be overridden with the MAGIC_LINK_TTL environment variable (e.g. "10m").
+func MagicLinkTTL() time.Duration {
+	return durationFromEnv("MAGIC_LINK_TTL", defaultMagicLinkTTL)
+}
+
+// defaultOAuthStateTTL is used when OAUTH_STATE_TTL is not set.
+const defaultOAuthStateTTL = 10 * time.Minute
+
+// OAuthStateTTL returns how long a user has to complete a third-party login.
+// It can be overridden with the OAUTH_STATE_TTL environment variable (e.g. "5m").
+func OAuthStateTTL() time.Duration {
+	return durationFromEnv("OAUTH_STATE_TTL", defaultOAuthStateTTL)
+}
+
+// defaultMFAChallengeTTL is used when MFA_CHALLENGE_TTL is not set.
+const defaultMFAChallengeTTL = 5 * time.Minute
+
+// MFAChallengeTTL returns how long a user has to enter their second factor after
+// the password step of /login.
+// It can be overridden with the MFA_CHALLENGE_TTL environment variable (e.g. "10m").
+func MFAChallengeTTL() time.Duration {
+	return durationFromEnv("MFA_CHALLENGE_TTL", defaultMFAChallengeTTL)
+}
+
+// defaultSessionTouchInterval is used when SESSION_TOUCH_INTERVAL is not set.
+const defaultSessionTouchInterval = time.Minute
+
+// SessionTouchInterval returns how often a session's last-seen time is updated
+// while it is in use; requests in between do not write to the database.
+// It can be overridden with the SESSION_TOUCH_INTERVAL environment variable (e.g. "5m").
+func SessionTouchInterval() time.Duration {
+	return durationFromEnv("SESSION_TOUCH_INTERVAL", defaultSessionTouchInterval)
+}
+
+// GenerateOpaqueToken returns a URL-safe random token with 256 bits of entropy.
+// Opaque tokens carry no claims; they are looked up by their hash (see HashToken).
+func GenerateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// PersonalAccessTokenPrefix starts every personal access token, so services and
+// secret scanners can recognise them without a lookup.
+const PersonalAccessTokenPrefix = "cozy_pat_"
+
+// GeneratePersonalAccessToken returns a new personal access token.
+func GeneratePersonalAccessToken() (string, error) {
+	token, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + token, nil
+}
+
+// IsPersonalAccessToken reports whether token looks like a personal access token
+// (as opposed to a JWT access token).
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// HashToken returns the hex encoded SHA-256 hash of a token.
+// A fast hash is fine here because the tokens are high-entropy random values.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewUUID returns a random (version 4) UUID string.
+func NewUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate uuid: %w", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // Version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// durationFromEnv reads a time.Duration from an environment variable,
+// falling back to def if the variable is unset or invalid.
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		slog.Warn("Invalid duration, using default", "name", key, "value", val, "default", def)
+		return def
+	}
+	return d
+}
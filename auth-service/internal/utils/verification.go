@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// EmailVerificationPolicy controls how Login treats accounts whose email is not verified.
+type EmailVerificationPolicy string
+
+const (
+	// VerificationAllow lets unverified accounts log in normally.
+	VerificationAllow EmailVerificationPolicy = "allow"
+	// VerificationLimit lets unverified accounts log in during a grace period after
+	// registering (EMAIL_VERIFICATION_GRACE_PERIOD) and refuses them afterwards.
+	VerificationLimit EmailVerificationPolicy = "limit"
+	// VerificationRequire refuses unverified accounts outright.
+	VerificationRequire EmailVerificationPolicy = "require"
+)
+
+const (
+	defaultEmailVerificationTTL         = 48 * time.Hour
+	defaultEmailVerificationGracePeriod = 72 * time.Hour
+)
+
+// EmailVerificationTTL returns how long a verification link stays valid.
+// It can be overridden with the EMAIL_VERIFICATION_TTL environment variable.
+func EmailVerificationTTL() time.Duration {
+	return durationFromEnv("EMAIL_VERIFICATION_TTL", defaultEmailVerificationTTL)
+}
+
+// EmailVerificationGracePeriod returns how long after registering an unverified
+// account may still log in under VerificationLimit.
+// It can be overridden with the EMAIL_VERIFICATION_GRACE_PERIOD environment variable.
+func EmailVerificationGracePeriod() time.Duration {
+	return durationFromEnv("EMAIL_VERIFICATION_GRACE_PERIOD", defaultEmailVerificationGracePeriod)
+}
+
+// GetEmailVerificationPolicy reads EMAIL_VERIFICATION_POLICY (allow|limit|require, default limit).
+func GetEmailVerificationPolicy() EmailVerificationPolicy {
+	val := strings.ToLower(os.Getenv("EMAIL_VERIFICATION_POLICY"))
+	switch EmailVerificationPolicy(val) {
+	case VerificationAllow, VerificationLimit, VerificationRequire:
+		return EmailVerificationPolicy(val)
+	case "":
+		return VerificationLimit
+	default:
+		slog.Warn("Invalid EMAIL_VERIFICATION_POLICY, using default", "value", val, "default", VerificationLimit)
+		return VerificationLimit
+	}
+}
+
+// LoginAllowed reports whether the policy lets an account log in, given when
+// it registered and whether its email is verified.
+func (p EmailVerificationPolicy) LoginAllowed(emailVerified bool, createdAt time.Time, now time.Time) bool {
+	if emailVerified {
+		return true
+	}
+	switch p {
+	case VerificationAllow:
+		return true
+	case VerificationRequire:
+		return false
+	default:
+		return now.Before(createdAt.Add(EmailVerificationGracePeriod()))
+	}
+}
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+-- token_version is embedded in every access token ("ver" claim). Incrementing it
+-- invalidates all tokens issued before, which is how "logout everywhere" works.
+ALTER TABLE users
+ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+
+-- Individually revoked access tokens, keyed by their jti claim.
+-- Rows are only needed until the token would have expired anyway.
+CREATE TABLE revoked_tokens (
+    jti UUID PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens(expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS revoked_tokens;
+ALTER TABLE users
+DROP COLUMN IF EXISTS token_version;
+-- +goose StatementEnd
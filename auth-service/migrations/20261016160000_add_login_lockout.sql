@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Consecutive failed logins and the resulting lockout (see LOGIN_LOCKOUT_*).
+ALTER TABLE users
+    ADD COLUMN failed_login_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+    DROP COLUMN IF EXISTS locked_until,
+    DROP COLUMN IF EXISTS failed_login_attempts;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Roles for the admin API and the disabled flag it controls. There is no way to
+-- create the first admin through the API; promote an existing account with
+--   UPDATE users SET role = 'admin' WHERE email = '...';
+ALTER TABLE users
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin')),
+    ADD COLUMN disabled_at TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+    DROP COLUMN IF EXISTS disabled_at,
+    DROP COLUMN IF EXISTS role;
+-- +goose StatementEnd
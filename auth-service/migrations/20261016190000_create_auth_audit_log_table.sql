@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Security-relevant authentication events. user_id is NULL for events that
+-- could not be tied to an account (e.g. a failed login for an unknown email).
+-- It is deliberately not a foreign key, so the history outlives deleted accounts.
+CREATE TABLE auth_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    event_type TEXT NOT NULL,
+    user_id INTEGER,
+    ip_address TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    outcome TEXT NOT NULL CHECK (outcome IN ('success', 'failure')),
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_auth_audit_log_user_id_created_at ON auth_audit_log(user_id, created_at DESC);
+CREATE INDEX idx_auth_audit_log_created_at ON auth_audit_log(created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS auth_audit_log;
+-- +goose StatementEnd
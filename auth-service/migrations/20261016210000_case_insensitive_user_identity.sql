@@ -0,0 +1,72 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Usernames and emails become unique regardless of case, so "Bob@x.com" and
+-- "bob@x.com" can no longer be two accounts. Existing duplicates are resolved
+-- first; each change is recorded in the audit log so support can explain it.
+
+-- Emails: the verified (then oldest) account keeps the address. The others get
+-- a placeholder address and can still sign in with their username.
+WITH ranked AS (
+    SELECT id, email,
+           ROW_NUMBER() OVER (PARTITION BY lower(btrim(email)) ORDER BY email_verified_at IS NULL, id) AS rank
+    FROM users
+), renamed AS (
+    UPDATE users u
+    SET email = 'duplicate-' || u.id || '@users.invalid', email_verified_at = NULL
+    FROM ranked
+    WHERE ranked.id = u.id AND ranked.rank > 1
+    RETURNING u.id, ranked.email AS old_email
+)
+INSERT INTO auth_audit_log (event_type, user_id, outcome, reason)
+SELECT 'identity_renamed', id, 'success', 'duplicate email ' || old_email || ' replaced'
+FROM renamed;
+
+-- Usernames: the oldest account keeps the name, the others get their ID appended.
+-- The suffixed name can itself be taken (e.g. "bob-7" next to "Bob" and "bob"),
+-- so a counter is added until it is free.
+DO $$
+DECLARE
+    dup RECORD;
+    candidate users.username%TYPE;
+    attempt INT;
+BEGIN
+    FOR dup IN
+        SELECT id, username
+        FROM (
+            SELECT id, username,
+                   ROW_NUMBER() OVER (PARTITION BY lower(username) ORDER BY id) AS rank
+            FROM users
+        ) ranked
+        WHERE rank > 1
+        ORDER BY id
+    LOOP
+        candidate := dup.username || '-' || dup.id;
+        attempt := 1;
+        WHILE EXISTS (SELECT 1 FROM users WHERE lower(username) = lower(candidate)) LOOP
+            attempt := attempt + 1;
+            candidate := dup.username || '-' || dup.id || '-' || attempt;
+        END LOOP;
+
+        UPDATE users SET username = candidate WHERE id = dup.id;
+        INSERT INTO auth_audit_log (event_type, user_id, outcome, reason)
+        VALUES ('identity_renamed', dup.id, 'success', 'duplicate username ' || dup.username || ' replaced');
+    END LOOP;
+END $$;
+
+-- Emails are stored normalized (trimmed, lowercase); usernames keep their case for display
+UPDATE users SET email = lower(btrim(email)) WHERE email <> lower(btrim(email));
+
+ALTER TABLE users DROP CONSTRAINT users_username_key;
+ALTER TABLE users DROP CONSTRAINT users_email_key;
+CREATE UNIQUE INDEX users_username_lower_key ON users (lower(username));
+CREATE UNIQUE INDEX users_email_lower_key ON users (lower(email));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Renamed duplicates are not restored
+DROP INDEX IF EXISTS users_email_lower_key;
+DROP INDEX IF EXISTS users_username_lower_key;
+ALTER TABLE users ADD CONSTRAINT users_username_key UNIQUE (username);
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+-- +goose StatementEnd
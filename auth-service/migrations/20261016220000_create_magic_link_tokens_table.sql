@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Single-use passwordless sign-in links. Like password reset tokens, only the
+-- SHA-256 hash of the emailed token is stored and used_at marks redemption.
+CREATE TABLE magic_link_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_magic_link_tokens_user_id ON magic_link_tokens(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS magic_link_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Transactional outbox. Events are inserted in the same transaction as the
+-- change they describe and published by the relay in internal/outbox, so a
+-- broker outage delays events instead of losing them. payload is the complete
+-- CloudEvents envelope; event_id is its ID and the message ID on every attempt.
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error TEXT,
+    published_at TIMESTAMPTZ
+);
+
+-- The relay only ever looks for unpublished events that are due
+CREATE INDEX idx_outbox_pending ON outbox(next_attempt_at) WHERE published_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS outbox;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Envelopes can carry single-use tokens (e.g. the email verification token of
+-- user.registered), so the payload is cleared once the event is published and
+-- only the metadata is kept for the retention period.
+ALTER TABLE outbox ALTER COLUMN payload DROP NOT NULL;
+UPDATE outbox SET payload = NULL WHERE published_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM outbox WHERE payload IS NULL;
+ALTER TABLE outbox ALTER COLUMN payload SET NOT NULL;
+-- +goose StatementEnd
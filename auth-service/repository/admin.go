@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"auth-service/internal/models"
+)
+
+// searchPattern turns a search term into an ILIKE pattern matching it anywhere,
+// with the LIKE wildcards in the term escaped.
+func searchPattern(search string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(search)
+	return "%" + escaped + "%"
+}
+
+// ListUsers returns one page of users, ordered by ID, and the total number of
+// users matching filter.Search.
+func (r *authRepository) ListUsers(ctx context.Context, filter models.UserListFilter) ([]models.User, int, error) {
+	where := ""
+	var args []interface{}
+	if filter.Search != "" {
+		args = append(args, searchPattern(filter.Search))
+		where = `WHERE username ILIKE $1 OR email ILIKE $1 OR display_name ILIKE $1`
+	}
+
+	var total int
+	if err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM users `+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query := `SELECT id, username, email, email_verified_at, created_at, display_name, avatar_url, timezone, locale,
+                     locked_until, role, disabled_at, ` + mfaEnabledColumn + `
+              FROM users ` + where + `
+              ORDER BY id
+              LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args))
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.EmailVerifiedAt, &u.CreatedAt, &u.DisplayName, &u.AvatarURL,
+			&u.Timezone, &u.Locale, &u.LockedUntil, &u.Role, &u.DisabledAt, &u.MFAEnabled); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	return users, total, nil
+}
+
+// AdminUpdateUser changes the role and/or disabled state of userID and returns
+// the updated user. Both changes bump the token version, so access tokens with a
+// stale role claim stop working; disabling also revokes every refresh token.
+func (r *authRepository) AdminUpdateUser(ctx context.Context, userID int, update models.AdminUpdateUserRequest) (*models.User, error) {
+	var sets []string
+	var args []interface{}
+	if update.Role != nil {
+		args = append(args, *update.Role)
+		sets = append(sets, "role = $"+strconv.Itoa(len(args)))
+	}
+	disabling := update.Disabled != nil && *update.Disabled
+	if update.Disabled != nil {
+		if disabling {
+			sets = append(sets, "disabled_at = COALESCE(disabled_at, NOW())")
+		} else {
+			sets = append(sets, "disabled_at = NULL")
+		}
+	}
+	if update.Role != nil || disabling {
+		sets = append(sets, "token_version = token_version + 1")
+	}
+
+	if len(sets) > 0 {
+		tx, err := r.db.Begin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback(ctx)
+
+		args = append(args, userID)
+		query := `UPDATE users SET ` + strings.Join(sets, ", ") + ` WHERE id = $` + strconv.Itoa(len(args))
+		tag, err := tx.Exec(ctx, query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return nil, ErrUserNotFound
+		}
+		if disabling {
+			revokeQuery := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+			if _, err := tx.Exec(ctx, revokeQuery, userID); err != nil {
+				return nil, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+			}
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("failed to commit user update: %w", err)
+		}
+		slog.InfoContext(ctx, "Admin update applied", "user_id", userID, "fields", strings.Join(sets, ", "))
+	}
+
+	user, err := r.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// ForceLogout signs userID out everywhere, like POST /logout-all: it bumps the
+// token version and revokes every refresh token.
+func (r *authRepository) ForceLogout(ctx context.Context, userID int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE users SET token_version = token_version + 1 WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to bump token version: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	revokeQuery := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(ctx, revokeQuery, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit forced logout: %w", err)
+	}
+	slog.InfoContext(ctx, "Forced logout", "user_id", userID)
+	return nil
+}
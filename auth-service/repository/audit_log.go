@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"auth-service/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AuditRepository stores the security audit log (auth_audit_log).
+type AuditRepository interface {
+	RecordAuditEvent(ctx context.Context, event models.AuditEvent) error
+	ListAuditEvents(ctx context.Context, filter models.AuditLogFilter) ([]models.AuditEvent, error)
+}
+
+type auditRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewAuditRepository(db *pgxpool.Pool) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+// RecordAuditEvent appends event to the audit log.
+func (r *auditRepository) RecordAuditEvent(ctx context.Context, event models.AuditEvent) error {
+	query := `INSERT INTO auth_audit_log (event_type, user_id, ip_address, user_agent, outcome, reason)
+              VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := r.db.Exec(ctx, query, event.EventType, event.UserID, event.IPAddress, event.UserAgent, event.Outcome, event.Reason)
+	if err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEvents returns the audit events matching filter, newest first.
+func (r *auditRepository) ListAuditEvents(ctx context.Context, filter models.AuditLogFilter) ([]models.AuditEvent, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if filter.UserID != nil {
+		where("user_id = ?", *filter.UserID)
+	}
+	if filter.EventType != "" {
+		where("event_type = ?", filter.EventType)
+	}
+	if !filter.From.IsZero() {
+		where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		where("created_at < ?", filter.To)
+	}
+
+	query := `SELECT id, event_type, user_id, ip_address, user_agent, outcome, reason, created_at FROM auth_audit_log`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += ` ORDER BY created_at DESC, id DESC LIMIT $` + strconv.Itoa(len(args)-1) + ` OFFSET $` + strconv.Itoa(len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var e models.AuditEvent
+		if err := rows.Scan(&e.ID, &e.EventType, &e.UserID, &e.IPAddress, &e.UserAgent, &e.Outcome, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	return events, nil
+}
@@ -3,20 +3,96 @@ package repository
 import (
 	"context"
 	"errors"
-	"log" // Ensure log is imported
+	"fmt"
+	"log/slog"
+	"time"
 
+	"auth-service/internal/events"
 	"auth-service/internal/models"
+	"auth-service/internal/utils"
 
-	"github.com/jackc/pgx"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthRepository interface {
 	Authenticate(user models.User) (bool, error)
-	Register(user models.User) (int, error)
+	Register(ctx context.Context, user models.User, verification *models.EmailVerificationToken, newEvent func(userID int) events.Event) (int, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
 	GetUserByID(ctx context.Context, id int) (*models.User, error) // Added for /me endpoint
+
+	// Refresh token storage (see refresh_tokens.go)
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldID int64, next *models.RefreshToken) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeAllRefreshTokens(ctx context.Context, userID int) error
+
+	// Access token revocation (see revocation.go)
+	RevokeAccessToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error
+	IncrementTokenVersion(ctx context.Context, userID int) (int, error)
+	IsAccessTokenRevoked(ctx context.Context, jti string, userID int, tokenVersion int, sessionID string) (bool, error)
+
+	// Password reset (see password_reset.go)
+	CreatePasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	GetPasswordResetUser(ctx context.Context, tokenHash string) (*models.User, error)
+	ResetPassword(ctx context.Context, tokenHash string, newPasswordHash string, newEvent func(userID int) events.Event) (int, error)
+
+	// Passwordless sign-in links (see magic_link.go)
+	CreateMagicLinkToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	ConsumeMagicLinkToken(ctx context.Context, tokenHash string) (int, error)
+
+	// Email verification (see email_verification.go)
+	CreateEmailVerificationToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	VerifyEmail(ctx context.Context, tokenHash string) (int, error)
+
+	// Profile management (see profile.go)
+	UpdateProfile(ctx context.Context, userID int, update models.UpdateProfileRequest, verification *models.EmailVerificationToken, newEvent func(user models.User, oldEmail string) events.Event) (*models.User, error)
+	GetPasswordHash(ctx context.Context, userID int) (string, error)
+	UpdatePassword(ctx context.Context, userID int, newPasswordHash string, event events.Event) error
+	DeleteUser(ctx context.Context, userID int, event events.Event) error
+
+	// External identities and OAuth login state (see identities.go)
+	GetUserByIdentity(ctx context.Context, provider string, subject string) (*models.User, error)
+	LinkIdentity(ctx context.Context, identity models.UserIdentity, markEmailVerified bool) error
+	CreateUserWithIdentity(ctx context.Context, user models.User, identity models.UserIdentity, verification *models.EmailVerificationToken, newEvent func(userID int) events.Event) (int, error)
+	CreateOAuthState(ctx context.Context, state models.OAuthState) error
+	ConsumeOAuthState(ctx context.Context, stateHash string) (*models.OAuthState, error)
+
+	// TOTP two-factor authentication (see mfa.go)
+	SaveTOTPEnrollment(ctx context.Context, userID int, secret string) error
+	GetTOTPEnrollment(ctx context.Context, userID int) (*models.TOTPEnrollment, error)
+	ConfirmTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error
+	RecordTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error)
+	DisableTOTP(ctx context.Context, userID int) error
+	CreateMFAChallenge(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	GetMFAChallenge(ctx context.Context, tokenHash string) (int, error)
+	RecordMFAChallengeFailure(ctx context.Context, tokenHash string) error
+	ConsumeMFAChallenge(ctx context.Context, tokenHash string) (int, error)
+
+	// Brute-force lockout (see lockout.go)
+	RecordFailedLogin(ctx context.Context, userID int) (int, error)
+	LockAccount(ctx context.Context, userID int, until time.Time) error
+	ResetFailedLogins(ctx context.Context, userID int) error
+
+	// Personal access tokens (see personal_access_tokens.go)
+	CreatePersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken) error
+	ListPersonalAccessTokens(ctx context.Context, userID int) ([]models.PersonalAccessToken, error)
+	DeletePersonalAccessToken(ctx context.Context, userID int, id int64) error
+	UsePersonalAccessToken(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error)
+
+	// Sessions (see sessions.go)
+	CreateSession(ctx context.Context, session *models.Session) error
+	ListSessions(ctx context.Context, userID int) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userID int, sessionID string) error
+	TouchSession(ctx context.Context, sessionID string, staleBefore time.Time) error
+
+	// Admin API (see admin.go)
+	ListUsers(ctx context.Context, filter models.UserListFilter) ([]models.User, int, error)
+	AdminUpdateUser(ctx context.Context, userID int, update models.AdminUpdateUserRequest) (*models.User, error)
+	ForceLogout(ctx context.Context, userID int) error
 }
 
 type authRepository struct {
@@ -27,52 +103,146 @@ func NewAuthRepository(db *pgxpool.Pool) AuthRepository {
 	return &authRepository{db: db}
 }
 
+// Authenticate reports whether user.Password is the password of the account with
+// user.Email. Unknown emails and wrong passwords are indistinguishable: both
+// return false with a nil error after a password hash comparison, so neither the
+// result nor the timing reveals whether an account exists. A correct password
+// stored with an outdated algorithm or work factor is rehashed (see utils.PasswordNeedsRehash).
 func (r *authRepository) Authenticate(user models.User) (bool, error) {
 	var storedPassword string
-	err := r.db.QueryRow(context.Background(), "SELECT password FROM users WHERE email=$1", user.Email).Scan(&storedPassword)
-	if (err != nil) {
-		if err == pgx.ErrNoRows {
-			return false, errors.New("user not found")
+	err := r.db.QueryRow(context.Background(), "SELECT password FROM users WHERE lower(email) = lower($1)", user.Email).Scan(&storedPassword)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			utils.SimulatePasswordCheck(user.Password)
+			return false, nil
 		}
 		return false, err
 	}
 
 	// Compare the hashed password
-	err = bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(user.Password))
-	if err != nil {
-		return false, errors.New("invalid password")
+	if !utils.CheckPassword(storedPassword, user.Password) {
+		return false, nil
+	}
+
+	// Upgrade hashes from older algorithms or work factors while we have the password
+	if utils.PasswordNeedsRehash(storedPassword) {
+		r.rehashPassword(user.Email, storedPassword, user.Password)
 	}
 
 	return true, nil
 }
 
-func (r *authRepository) Register(user models.User) (int, error) {
+// rehashPassword replaces storedHash with a hash using the current algorithm.
+// The update only applies if the password has not changed in the meantime.
+// Failures are logged; the old hash keeps working.
+func (r *authRepository) rehashPassword(email string, storedHash string, password string) {
+	newHash, err := utils.HashPassword(password)
+	if err != nil {
+		slog.Error("Failed to rehash password", "error", err)
+		return
+	}
+	query := `UPDATE users SET password = $1 WHERE lower(email) = lower($2) AND password = $3`
+	tag, err := r.db.Exec(context.Background(), query, newHash, email, storedHash)
+	if err != nil {
+		slog.Error("Failed to store rehashed password", "error", err)
+		return
+	}
+	if tag.RowsAffected() == 1 {
+		slog.Info("Upgraded password hash to the current algorithm after login")
+	}
+}
+
+// Register creates user and, in the same transaction, stores verification (if
+// not nil) as the user's first email verification token and queues the event
+// returned by newEvent in the outbox. newEvent is called with the new user's ID.
+// Either all of it is stored or nothing is, so a registration is never without
+// its event.
+func (r *authRepository) Register(ctx context.Context, user models.User, verification *models.EmailVerificationToken, newEvent func(userID int) events.Event) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
 	query := `INSERT INTO users (username, password, email) VALUES ($1, $2, $3) RETURNING id`
 	var userID int
-	err := r.db.QueryRow(context.Background(), query, user.Username, user.Password, user.Email).Scan(&userID)
+	err = tx.QueryRow(ctx, query, user.Username, user.Password, user.Email).Scan(&userID)
 	if err != nil {
+		// Usernames and emails are unique regardless of case
+		if dupErr := duplicateUserError(err); dupErr != nil {
+			return 0, dupErr
+		}
 		return 0, err
 	}
+
+	if err := insertRegistration(ctx, tx, userID, verification, newEvent); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit registration: %w", err)
+	}
 	return userID, nil
 }
 
-// GetUserByEmail retrieves a user by their email address.
+// insertRegistration stores what comes with a new account within tx: its first
+// email verification token, if verification is not nil, and the event returned
+// by newEvent in the outbox.
+func insertRegistration(ctx context.Context, tx pgx.Tx, userID int, verification *models.EmailVerificationToken, newEvent func(userID int) events.Event) error {
+	if verification != nil {
+		tokenQuery := `INSERT INTO email_verification_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+		if _, err := tx.Exec(ctx, tokenQuery, userID, verification.TokenHash, verification.ExpiresAt); err != nil {
+			return fmt.Errorf("failed to insert verification token: %w", err)
+		}
+	}
+	return insertOutboxEvent(ctx, tx, newEvent(userID))
+}
+
+// GetUserByEmail retrieves a user by their email address, ignoring case.
 // Returns the full User struct (including password hash).
 func (r *authRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	query := `SELECT id, username, email, password FROM users WHERE email = $1`
+	// Matches the users_email_lower_key index
+	return r.getUserWithPassword(ctx, "lower(email) = lower($1)", email)
+}
+
+// GetUserByUsername retrieves a user by their username, ignoring case.
+// Returns the full User struct (including password hash).
+func (r *authRepository) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	// Matches the users_username_lower_key index
+	return r.getUserWithPassword(ctx, "lower(username) = lower($1)", username)
+}
+
+// getUserWithPassword retrieves the user matching condition (with placeholder $1 for arg),
+// including the password hash. Returns nil if there is no such user.
+func (r *authRepository) getUserWithPassword(ctx context.Context, condition string, arg string) (*models.User, error) {
+	query := `SELECT id, username, email, password, token_version, email_verified_at, created_at,
+                     display_name, avatar_url, timezone, locale, failed_login_attempts, locked_until, role, disabled_at, ` + mfaEnabledColumn + `
+              FROM users WHERE ` + condition
 	user := &models.User{} // Pointer to hold the result
 
-	err := r.db.QueryRow(ctx, query, email).Scan(
+	err := r.db.QueryRow(ctx, query, arg).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.Password, // Scan the password hash as well
+		&user.TokenVersion,
+		&user.EmailVerifiedAt,
+		&user.CreatedAt,
+		&user.DisplayName,
+		&user.AvatarURL,
+		&user.Timezone,
+		&user.Locale,
+		&user.FailedLoginAttempts,
+		&user.LockedUntil,
+		&user.Role,
+		&user.DisabledAt,
+		&user.MFAEnabled,
 	)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			// User not found is not necessarily an application error in some contexts,
-			// but here it likely means the email provided doesn't exist.
+			// but here it likely means the email or username provided doesn't exist.
 			return nil, nil // Return nil user and nil error to indicate not found
 		}
 		// For other errors (DB connection issues, etc.), return the error
@@ -86,7 +256,9 @@ func (r *authRepository) GetUserByEmail(ctx context.Context, email string) (*mod
 // GetUserByID retrieves a user by their ID.
 // Excludes the password hash for security.
 func (r *authRepository) GetUserByID(ctx context.Context, id int) (*models.User, error) {
-	query := `SELECT id, username, email FROM users WHERE id = $1`
+	query := `SELECT id, username, email, token_version, email_verified_at, created_at,
+                     display_name, avatar_url, timezone, locale, failed_login_attempts, locked_until, role, disabled_at, ` + mfaEnabledColumn + `
+              FROM users WHERE id = $1`
 	user := &models.User{}
 
 	err := r.db.QueryRow(ctx, query, id).Scan(
@@ -94,13 +266,25 @@ func (r *authRepository) GetUserByID(ctx context.Context, id int) (*models.User,
 		&user.Username,
 		&user.Email,
 		// Do NOT scan password here
+		&user.TokenVersion,
+		&user.EmailVerifiedAt,
+		&user.CreatedAt,
+		&user.DisplayName,
+		&user.AvatarURL,
+		&user.Timezone,
+		&user.Locale,
+		&user.FailedLoginAttempts,
+		&user.LockedUntil,
+		&user.Role,
+		&user.DisabledAt,
+		&user.MFAEnabled,
 	)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil // Return nil user and nil error to indicate not found
 		}
-		log.Printf("Error fetching user by ID %d: %v", id, err)
+		slog.ErrorContext(ctx, "Error fetching user", "user_id", id, "error", err)
 		return nil, err
 	}
 
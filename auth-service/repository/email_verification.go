@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"auth-service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidVerificationToken is returned when a verification token is unknown, expired or already used.
+var ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+
+// CreateEmailVerificationToken stores a new verification token for userID.
+// Earlier unused tokens are invalidated so only the latest email works.
+func (r *authRepository) CreateEmailVerificationToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	verification := &models.EmailVerificationToken{TokenHash: tokenHash, ExpiresAt: expiresAt}
+	if err := replaceVerificationToken(ctx, tx, userID, verification); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// replaceVerificationToken invalidates the unused verification tokens of
+// userID and stores verification within tx.
+func replaceVerificationToken(ctx context.Context, tx pgx.Tx, userID int, verification *models.EmailVerificationToken) error {
+	supersedeQuery := `UPDATE email_verification_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`
+	if _, err := tx.Exec(ctx, supersedeQuery, userID); err != nil {
+		return fmt.Errorf("failed to invalidate previous verification tokens: %w", err)
+	}
+
+	insertQuery := `INSERT INTO email_verification_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, insertQuery, userID, verification.TokenHash, verification.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to insert verification token: %w", err)
+	}
+	return nil
+}
+
+// VerifyEmail redeems a verification token and marks the user's email as verified.
+// Returns the user ID, or ErrInvalidVerificationToken.
+func (r *authRepository) VerifyEmail(ctx context.Context, tokenHash string) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	consumeQuery := `UPDATE email_verification_tokens
+                     SET used_at = NOW()
+                     WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+                     RETURNING user_id`
+	var userID int
+	if err := tx.QueryRow(ctx, consumeQuery, tokenHash).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInvalidVerificationToken
+		}
+		return 0, fmt.Errorf("failed to redeem verification token: %w", err)
+	}
+
+	// COALESCE keeps the original timestamp if the email was already verified
+	updateQuery := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1`
+	if _, err := tx.Exec(ctx, updateQuery, userID); err != nil {
+		return 0, fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit email verification: %w", err)
+	}
+	slog.InfoContext(ctx, "Email verified", "user_id", userID)
+	return userID, nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"auth-service/internal/events"
+	"auth-service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrIdentityConflict is returned when an account is already linked to a different
+// identity of the same provider.
+var ErrIdentityConflict = errors.New("account is already linked to another identity of this provider")
+
+// ErrInvalidOAuthState is returned when an OAuth state is unknown, expired or already used.
+var ErrInvalidOAuthState = errors.New("invalid or expired OAuth state")
+
+// GetUserByIdentity returns the user linked to the provider subject and records the
+// login on the identity. Returns nil, nil if the identity is not linked.
+func (r *authRepository) GetUserByIdentity(ctx context.Context, provider string, subject string) (*models.User, error) {
+	query := `UPDATE user_identities SET last_login_at = NOW()
+              WHERE provider = $1 AND subject = $2
+              RETURNING user_id`
+	var userID int
+	if err := r.db.QueryRow(ctx, query, provider, subject).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to look up identity: %w", err)
+	}
+	return r.GetUserByID(ctx, userID)
+}
+
+// LinkIdentity links an external identity to an existing user. When the provider
+// vouches for the email address, markEmailVerified also marks it verified locally.
+func (r *authRepository) LinkIdentity(ctx context.Context, identity models.UserIdentity, markEmailVerified bool) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertIdentity(ctx, tx, identity); err != nil {
+		return err
+	}
+	if markEmailVerified {
+		verifyQuery := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1`
+		if _, err := tx.Exec(ctx, verifyQuery, identity.UserID); err != nil {
+			return fmt.Errorf("failed to mark email verified: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit identity link: %w", err)
+	}
+	slog.InfoContext(ctx, "Linked OAuth identity", "provider", identity.Provider, "user_id", identity.UserID)
+	return nil
+}
+
+// CreateUserWithIdentity creates a new account for an external identity.
+// user.EmailVerifiedAt, DisplayName and AvatarURL are stored as given. Like
+// Register, it stores verification (if not nil) and queues the event returned
+// by newEvent in the outbox in the same transaction.
+func (r *authRepository) CreateUserWithIdentity(ctx context.Context, user models.User, identity models.UserIdentity, verification *models.EmailVerificationToken, newEvent func(userID int) events.Event) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	userQuery := `INSERT INTO users (username, password, email, email_verified_at, display_name, avatar_url)
+                  VALUES ($1, $2, $3, $4, $5, $6)
+                  RETURNING id`
+	var userID int
+	err = tx.QueryRow(ctx, userQuery, user.Username, user.Password, user.Email, user.EmailVerifiedAt, user.DisplayName, user.AvatarURL).Scan(&userID)
+	if err != nil {
+		if dupErr := duplicateUserError(err); dupErr != nil {
+			return 0, dupErr
+		}
+		return 0, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	identity.UserID = userID
+	if err := insertIdentity(ctx, tx, identity); err != nil {
+		return 0, err
+	}
+	if err := insertRegistration(ctx, tx, userID, verification, newEvent); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit user creation: %w", err)
+	}
+	slog.InfoContext(ctx, "Created user from OAuth identity", "user_id", userID, "provider", identity.Provider)
+	return userID, nil
+}
+
+// insertIdentity stores identity within tx.
+func insertIdentity(ctx context.Context, tx pgx.Tx, identity models.UserIdentity) error {
+	query := `INSERT INTO user_identities (user_id, provider, subject, email, last_login_at)
+              VALUES ($1, $2, $3, $4, NOW())`
+	if _, err := tx.Exec(ctx, query, identity.UserID, identity.Provider, identity.Subject, identity.Email); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return ErrIdentityConflict
+		}
+		return fmt.Errorf("failed to insert identity: %w", err)
+	}
+	return nil
+}
+
+// CreateOAuthState stores a pending OAuth login. Expired states are pruned on the way.
+func (r *authRepository) CreateOAuthState(ctx context.Context, state models.OAuthState) error {
+	if _, err := r.db.Exec(ctx, `DELETE FROM oauth_states WHERE expires_at < NOW()`); err != nil {
+		slog.WarnContext(ctx, "Failed to prune expired OAuth states", "error", err)
+	}
+
+	query := `INSERT INTO oauth_states (state_hash, provider, nonce, code_verifier, expires_at)
+              VALUES ($1, $2, $3, $4, $5)`
+	if _, err := r.db.Exec(ctx, query, state.StateHash, state.Provider, state.Nonce, state.CodeVerifier, state.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to store OAuth state: %w", err)
+	}
+	return nil
+}
+
+// ConsumeOAuthState deletes and returns the pending login for stateHash, so each
+// state can be redeemed only once. Returns ErrInvalidOAuthState if it is unknown or expired.
+func (r *authRepository) ConsumeOAuthState(ctx context.Context, stateHash string) (*models.OAuthState, error) {
+	query := `DELETE FROM oauth_states
+              WHERE state_hash = $1 AND expires_at > NOW()
+              RETURNING state_hash, provider, nonce, code_verifier, expires_at`
+	state := &models.OAuthState{}
+	err := r.db.QueryRow(ctx, query, stateHash).Scan(&state.StateHash, &state.Provider, &state.Nonce, &state.CodeVerifier, &state.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidOAuthState
+		}
+		return nil, fmt.Errorf("failed to redeem OAuth state: %w", err)
+	}
+	return state, nil
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// RecordFailedLogin increments the consecutive failed login count of userID and
+// returns the new count.
+func (r *authRepository) RecordFailedLogin(ctx context.Context, userID int) (int, error) {
+	query := `UPDATE users SET failed_login_attempts = failed_login_attempts + 1
+              WHERE id = $1
+              RETURNING failed_login_attempts`
+	var failures int
+	if err := r.db.QueryRow(ctx, query, userID).Scan(&failures); err != nil {
+		return 0, fmt.Errorf("failed to record failed login: %w", err)
+	}
+	return failures, nil
+}
+
+// LockAccount refuses logins for userID until the given time.
+func (r *authRepository) LockAccount(ctx context.Context, userID int, until time.Time) error {
+	if _, err := r.db.Exec(ctx, `UPDATE users SET locked_until = $2 WHERE id = $1`, userID, until); err != nil {
+		return fmt.Errorf("failed to lock account: %w", err)
+	}
+	slog.WarnContext(ctx, "Locked account after repeated failed logins", "user_id", userID, "until", until.Format(time.RFC3339))
+	return nil
+}
+
+// ResetFailedLogins clears the failed login count and any lockout of userID.
+func (r *authRepository) ResetFailedLogins(ctx context.Context, userID int) error {
+	query := `UPDATE users SET failed_login_attempts = 0, locked_until = NULL WHERE id = $1`
+	if _, err := r.db.Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to reset failed logins: %w", err)
+	}
+	return nil
+}
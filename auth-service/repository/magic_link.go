@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidMagicLink is returned when a sign-in link token is unknown, expired or already used.
+var ErrInvalidMagicLink = errors.New("invalid or expired sign-in link")
+
+// CreateMagicLinkToken stores a new sign-in link token for userID.
+// Earlier unused tokens are invalidated so only the latest email works.
+func (r *authRepository) CreateMagicLinkToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	supersedeQuery := `UPDATE magic_link_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`
+	if _, err := tx.Exec(ctx, supersedeQuery, userID); err != nil {
+		return fmt.Errorf("failed to invalidate previous sign-in links: %w", err)
+	}
+
+	insertQuery := `INSERT INTO magic_link_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, insertQuery, userID, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("failed to insert sign-in link token: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ConsumeMagicLinkToken redeems a sign-in link token and returns its user ID, or
+// ErrInvalidMagicLink. Following the link proves control of the mailbox, so the
+// user's email is marked verified as well.
+func (r *authRepository) ConsumeMagicLinkToken(ctx context.Context, tokenHash string) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Mark the token used only if it is still valid; this makes redemption single-use
+	consumeQuery := `UPDATE magic_link_tokens
+                     SET used_at = NOW()
+                     WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+                     RETURNING user_id`
+	var userID int
+	if err := tx.QueryRow(ctx, consumeQuery, tokenHash).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInvalidMagicLink
+		}
+		return 0, fmt.Errorf("failed to redeem sign-in link token: %w", err)
+	}
+
+	updateQuery := `UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1`
+	if _, err := tx.Exec(ctx, updateQuery, userID); err != nil {
+		return 0, fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit sign-in link redemption: %w", err)
+	}
+	slog.InfoContext(ctx, "Sign-in link redeemed", "user_id", userID)
+	return userID, nil
+}
@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"auth-service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrMFAAlreadyEnabled is returned when enrolling an account whose TOTP enrollment is already confirmed.
+var ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+// ErrInvalidMFAChallenge is returned when an MFA challenge token is unknown,
+// expired, already used or has had too many failed attempts.
+var ErrInvalidMFAChallenge = errors.New("invalid or expired MFA challenge")
+
+// maxMFAChallengeFailures is how many wrong codes a challenge tolerates before it
+// is invalidated and the user has to enter their password again.
+const maxMFAChallengeFailures = 5
+
+// mfaEnabledColumn selects models.User.MFAEnabled in user queries.
+const mfaEnabledColumn = `EXISTS (SELECT 1 FROM user_mfa m WHERE m.user_id = users.id AND m.confirmed_at IS NOT NULL) AS mfa_enabled`
+
+// SaveTOTPEnrollment stores a new, unconfirmed TOTP secret for userID, replacing
+// any earlier unconfirmed one.
+func (r *authRepository) SaveTOTPEnrollment(ctx context.Context, userID int, secret string) error {
+	query := `INSERT INTO user_mfa (user_id, totp_secret)
+              VALUES ($1, $2)
+              ON CONFLICT (user_id) DO UPDATE
+              SET totp_secret = EXCLUDED.totp_secret, last_used_step = 0, created_at = NOW()
+              WHERE user_mfa.confirmed_at IS NULL`
+	tag, err := r.db.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("failed to save TOTP enrollment: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+	return nil
+}
+
+// GetTOTPEnrollment returns the TOTP enrollment of userID, or nil, nil if there is none.
+func (r *authRepository) GetTOTPEnrollment(ctx context.Context, userID int) (*models.TOTPEnrollment, error) {
+	query := `SELECT user_id, totp_secret, confirmed_at, last_used_step FROM user_mfa WHERE user_id = $1`
+	enrollment := &models.TOTPEnrollment{}
+	err := r.db.QueryRow(ctx, query, userID).Scan(&enrollment.UserID, &enrollment.Secret, &enrollment.ConfirmedAt, &enrollment.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get TOTP enrollment: %w", err)
+	}
+	return enrollment, nil
+}
+
+// ConfirmTOTP enables 2FA for userID, records step as used and replaces the
+// user's recovery codes with recoveryCodeHashes.
+func (r *authRepository) ConfirmTOTP(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	confirmQuery := `UPDATE user_mfa SET confirmed_at = NOW(), last_used_step = $2
+                     WHERE user_id = $1 AND confirmed_at IS NULL`
+	tag, err := tx.Exec(ctx, confirmQuery, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to confirm TOTP enrollment: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMFAAlreadyEnabled
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete old recovery codes: %w", err)
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit TOTP confirmation: %w", err)
+	}
+	slog.InfoContext(ctx, "Enabled TOTP two-factor authentication", "user_id", userID)
+	return nil
+}
+
+// RecordTOTPStep marks time step as used for userID. It returns false if the
+// step (or a later one) was already used, i.e. the code is being replayed.
+func (r *authRepository) RecordTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	query := `UPDATE user_mfa SET last_used_step = $2
+              WHERE user_id = $1 AND confirmed_at IS NOT NULL AND last_used_step < $2`
+	tag, err := r.db.Exec(ctx, query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP step: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode redeems one of userID's unused recovery codes. It returns
+// false if codeHash does not match an unused code.
+func (r *authRepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) (bool, error) {
+	query := `UPDATE mfa_recovery_codes SET used_at = NOW()
+              WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	tag, err := r.db.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if tag.RowsAffected() == 1 {
+		slog.InfoContext(ctx, "Recovery code used", "user_id", userID)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// DisableTOTP removes the TOTP enrollment and recovery codes of userID.
+func (r *authRepository) DisableTOTP(ctx context.Context, userID int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete TOTP enrollment: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_challenges WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete MFA challenges: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit TOTP removal: %w", err)
+	}
+	slog.InfoContext(ctx, "Disabled TOTP two-factor authentication", "user_id", userID)
+	return nil
+}
+
+// CreateMFAChallenge stores a challenge issued after the password step of login.
+// Expired challenges are pruned on the way.
+func (r *authRepository) CreateMFAChallenge(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	if _, err := r.db.Exec(ctx, `DELETE FROM mfa_challenges WHERE expires_at < NOW()`); err != nil {
+		slog.WarnContext(ctx, "Failed to prune expired MFA challenges", "error", err)
+	}
+
+	query := `INSERT INTO mfa_challenges (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`
+	if _, err := r.db.Exec(ctx, query, tokenHash, userID, expiresAt); err != nil {
+		return fmt.Errorf("failed to store MFA challenge: %w", err)
+	}
+	return nil
+}
+
+// GetMFAChallenge returns the user ID of a pending challenge without redeeming it.
+func (r *authRepository) GetMFAChallenge(ctx context.Context, tokenHash string) (int, error) {
+	query := `SELECT user_id FROM mfa_challenges
+              WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() AND failed_attempts < $2`
+	var userID int
+	if err := r.db.QueryRow(ctx, query, tokenHash, maxMFAChallengeFailures).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInvalidMFAChallenge
+		}
+		return 0, fmt.Errorf("failed to get MFA challenge: %w", err)
+	}
+	return userID, nil
+}
+
+// RecordMFAChallengeFailure counts a wrong code against the challenge.
+func (r *authRepository) RecordMFAChallengeFailure(ctx context.Context, tokenHash string) error {
+	query := `UPDATE mfa_challenges SET failed_attempts = failed_attempts + 1 WHERE token_hash = $1`
+	if _, err := r.db.Exec(ctx, query, tokenHash); err != nil {
+		return fmt.Errorf("failed to record MFA failure: %w", err)
+	}
+	return nil
+}
+
+// ConsumeMFAChallenge marks the challenge as used and returns its user ID.
+// Like the other single-use tokens, it can only be redeemed once.
+func (r *authRepository) ConsumeMFAChallenge(ctx context.Context, tokenHash string) (int, error) {
+	query := `UPDATE mfa_challenges SET used_at = NOW()
+              WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() AND failed_attempts < $2
+              RETURNING user_id`
+	var userID int
+	if err := r.db.QueryRow(ctx, query, tokenHash, maxMFAChallengeFailures).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInvalidMFAChallenge
+		}
+		return 0, fmt.Errorf("failed to redeem MFA challenge: %w", err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"auth-service/internal/events"
+	"auth-service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidResetToken is returned when a reset token is unknown, expired or already used.
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// CreatePasswordResetToken stores a new reset token for userID.
+// Any earlier unused tokens for the user are invalidated so only the latest email works.
+func (r *authRepository) CreatePasswordResetToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	supersedeQuery := `UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`
+	if _, err := tx.Exec(ctx, supersedeQuery, userID); err != nil {
+		return fmt.Errorf("failed to invalidate previous reset tokens: %w", err)
+	}
+
+	insertQuery := `INSERT INTO password_reset_tokens (user_id, token_hash, expires_at) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, insertQuery, userID, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("failed to insert reset token: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetPasswordResetUser returns the ID, username and email of the user a valid
+// (unused, unexpired) reset token belongs to, or nil if the token is not valid.
+// It does not redeem the token.
+func (r *authRepository) GetPasswordResetUser(ctx context.Context, tokenHash string) (*models.User, error) {
+	query := `SELECT u.id, u.username, u.email
+              FROM password_reset_tokens t JOIN users u ON u.id = t.user_id
+              WHERE t.token_hash = $1 AND t.used_at IS NULL AND t.expires_at > NOW()`
+	user := &models.User{}
+	err := r.db.QueryRow(ctx, query, tokenHash).Scan(&user.ID, &user.Username, &user.Email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to look up password reset token: %w", err)
+	}
+	return user, nil
+}
+
+// ResetPassword redeems a reset token and sets the new password hash in one transaction.
+// It also bumps the user's token version and revokes their refresh tokens, signing
+// out every existing session. The event returned by newEvent is queued in the
+// outbox in the same transaction. Returns the user ID, or ErrInvalidResetToken.
+func (r *authRepository) ResetPassword(ctx context.Context, tokenHash string, newPasswordHash string, newEvent func(userID int) events.Event) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Mark the token used only if it is still valid; this makes redemption single-use
+	consumeQuery := `UPDATE password_reset_tokens
+                     SET used_at = NOW()
+                     WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+                     RETURNING user_id`
+	var userID int
+	if err := tx.QueryRow(ctx, consumeQuery, tokenHash).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInvalidResetToken
+		}
+		return 0, fmt.Errorf("failed to redeem reset token: %w", err)
+	}
+
+	// Proving control of the mailbox also lifts a brute-force lockout
+	updateQuery := `UPDATE users SET password = $1, token_version = token_version + 1,
+                           failed_login_attempts = 0, locked_until = NULL
+                    WHERE id = $2`
+	if _, err := tx.Exec(ctx, updateQuery, newPasswordHash, userID); err != nil {
+		return 0, fmt.Errorf("failed to update password: %w", err)
+	}
+
+	revokeQuery := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(ctx, revokeQuery, userID); err != nil {
+		return 0, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := insertOutboxEvent(ctx, tx, newEvent(userID)); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit password reset: %w", err)
+	}
+	slog.InfoContext(ctx, "Password reset completed", "user_id", userID)
+	return userID, nil
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"auth-service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrTokenNotFound is returned when a personal access token does not exist or
+// belongs to another user.
+var ErrTokenNotFound = errors.New("personal access token not found")
+
+// CreatePersonalAccessToken stores token and sets its ID and CreatedAt.
+func (r *authRepository) CreatePersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken) error {
+	query := `INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+              VALUES ($1, $2, $3, $4, $5, $6)
+              RETURNING id, created_at`
+	err := r.db.QueryRow(ctx, query, token.UserID, token.Name, token.TokenHash, token.Prefix, token.Scopes, token.ExpiresAt).
+		Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create personal access token: %w", err)
+	}
+	return nil
+}
+
+// ListPersonalAccessTokens returns the tokens of userID, newest first. Expired
+// tokens are included so users can see and clean them up.
+func (r *authRepository) ListPersonalAccessTokens(ctx context.Context, userID int) ([]models.PersonalAccessToken, error) {
+	query := `SELECT id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_at
+              FROM personal_access_tokens
+              WHERE user_id = $1
+              ORDER BY created_at DESC, id DESC`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list personal access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []models.PersonalAccessToken{}
+	for rows.Next() {
+		var t models.PersonalAccessToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Scopes, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan personal access token: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeletePersonalAccessToken revokes token id of userID.
+func (r *authRepository) DeletePersonalAccessToken(ctx context.Context, userID int, id int64) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete personal access token: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// UsePersonalAccessToken looks up an unexpired token by hash and records the use.
+// Returns nil, nil if there is no such token or its owner has been disabled.
+func (r *authRepository) UsePersonalAccessToken(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	query := `UPDATE personal_access_tokens SET last_used_at = NOW()
+              WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > NOW())
+                AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = personal_access_tokens.user_id AND u.disabled_at IS NOT NULL)
+              RETURNING id, user_id, name, token_prefix, scopes, expires_at, last_used_at, created_at`
+	var t models.PersonalAccessToken
+	err := r.db.QueryRow(ctx, query, tokenHash).
+		Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Scopes, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to look up personal access token: %w", err)
+	}
+	return &t, nil
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"auth-service/internal/events"
+	"auth-service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrUsernameTaken is returned when a username is already used by another account.
+	ErrUsernameTaken = errors.New("username is already taken")
+	// ErrEmailTaken is returned when an email is already used by another account.
+	ErrEmailTaken = errors.New("email is already in use")
+	// ErrUserNotFound is returned when the user to update or delete does not exist.
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// uniqueViolation is the Postgres error code for unique constraint violations.
+const uniqueViolation = "23505"
+
+// duplicateUserError maps a unique violation on the users table to ErrEmailTaken or
+// ErrUsernameTaken. It returns nil for any other error.
+func duplicateUserError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation {
+		return nil
+	}
+	if strings.Contains(pgErr.ConstraintName, "email") {
+		return ErrEmailTaken
+	}
+	return ErrUsernameTaken
+}
+
+// UpdateProfile applies the non-nil fields of update and returns the updated user.
+// A changed email clears email_verified_at so the new address must be verified.
+// If the email changes, verification (if not nil) replaces the user's pending
+// verification tokens and the event returned by newEvent (if not nil) is
+// queued in the outbox, in the same transaction as the update.
+func (r *authRepository) UpdateProfile(ctx context.Context, userID int, update models.UpdateProfileRequest, verification *models.EmailVerificationToken, newEvent func(user models.User, oldEmail string) events.Event) (*models.User, error) {
+	var sets []string
+	var args []interface{}
+	set := func(column string, value interface{}) {
+		args = append(args, value)
+		sets = append(sets, column+" = $"+strconv.Itoa(len(args)))
+	}
+
+	if update.Username != nil {
+		set("username", *update.Username)
+	}
+	if update.Email != nil {
+		set("email", *update.Email)
+		// Only reset verification when the address actually changes
+		sets = append(sets, "email_verified_at = CASE WHEN email = $"+strconv.Itoa(len(args))+" THEN email_verified_at ELSE NULL END")
+	}
+	if update.DisplayName != nil {
+		set("display_name", *update.DisplayName)
+	}
+	if update.AvatarURL != nil {
+		set("avatar_url", *update.AvatarURL)
+	}
+	if update.Timezone != nil {
+		set("timezone", *update.Timezone)
+	}
+	if update.Locale != nil {
+		set("locale", *update.Locale)
+	}
+
+	if len(sets) > 0 {
+		tx, err := r.db.Begin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback(ctx)
+
+		var oldEmail string
+		if err := tx.QueryRow(ctx, `SELECT email FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&oldEmail); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, ErrUserNotFound
+			}
+			return nil, fmt.Errorf("failed to lock user: %w", err)
+		}
+
+		args = append(args, userID)
+		query := `UPDATE users SET ` + strings.Join(sets, ", ") + ` WHERE id = $` + strconv.Itoa(len(args)) + ` RETURNING username, email`
+		user := models.User{ID: userID}
+		if err := tx.QueryRow(ctx, query, args...).Scan(&user.Username, &user.Email); err != nil {
+			if dupErr := duplicateUserError(err); dupErr != nil {
+				return nil, dupErr
+			}
+			return nil, fmt.Errorf("failed to update profile: %w", err)
+		}
+
+		if user.Email != oldEmail {
+			if verification != nil {
+				if err := replaceVerificationToken(ctx, tx, userID, verification); err != nil {
+					return nil, err
+				}
+			}
+			if newEvent != nil {
+				if err := insertOutboxEvent(ctx, tx, newEvent(user, oldEmail)); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("failed to commit profile update: %w", err)
+		}
+		slog.InfoContext(ctx, "Updated profile", "user_id", userID)
+	}
+
+	user, err := r.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// GetPasswordHash returns the stored password hash of userID.
+func (r *authRepository) GetPasswordHash(ctx context.Context, userID int) (string, error) {
+	var hash string
+	err := r.db.QueryRow(ctx, `SELECT password FROM users WHERE id = $1`, userID).Scan(&hash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrUserNotFound
+		}
+		return "", err
+	}
+	return hash, nil
+}
+
+// UpdatePassword sets a new password hash. Like a password reset, it bumps the
+// token version and revokes every refresh token, signing out all sessions.
+// event is queued in the outbox in the same transaction.
+func (r *authRepository) UpdatePassword(ctx context.Context, userID int, newPasswordHash string, event events.Event) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	updateQuery := `UPDATE users SET password = $1, token_version = token_version + 1 WHERE id = $2`
+	tag, err := tx.Exec(ctx, updateQuery, newPasswordHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	revokeQuery := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(ctx, revokeQuery, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err := insertOutboxEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteUser removes the account. Tokens and other per-user rows are removed by
+// ON DELETE CASCADE; outstanding access tokens fail revocation checks because
+// the user no longer exists. event is queued in the outbox in the same
+// transaction, so other services learn about every deletion that commits.
+func (r *authRepository) DeleteUser(ctx context.Context, userID int, event events.Event) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	if err := insertOutboxEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit account deletion: %w", err)
+	}
+	slog.InfoContext(ctx, "Deleted user", "user_id", userID)
+	return nil
+}
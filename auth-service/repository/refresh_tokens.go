@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"auth-service/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrRefreshTokenReused is returned by RotateRefreshToken when the token being
+// rotated has already been revoked (for example by a concurrent refresh).
+var ErrRefreshTokenReused = errors.New("refresh token already rotated or revoked")
+
+// CreateRefreshToken stores a new refresh token and fills in its ID and CreatedAt.
+func (r *authRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+              VALUES ($1, $2, $3, $4)
+              RETURNING id, created_at`
+	err := r.db.QueryRow(ctx, query, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt).Scan(
+		&token.ID,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error creating refresh token", "user_id", token.UserID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// GetRefreshTokenByHash looks up a refresh token by the hash of its raw value.
+// Returns (nil, nil) if no token matches.
+func (r *authRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	query := `SELECT id, user_id, family_id, token_hash, expires_at, created_at, revoked_at, replaced_by
+              FROM refresh_tokens
+              WHERE token_hash = $1`
+	token := &models.RefreshToken{}
+	err := r.db.QueryRow(ctx, query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.CreatedAt,
+		&token.RevokedAt,
+		&token.ReplacedBy,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		slog.ErrorContext(ctx, "Error fetching refresh token", "error", err)
+		return nil, err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken atomically inserts next and revokes the token identified by oldID,
+// linking the two through replaced_by. If the old token was already revoked,
+// nothing is written and ErrRefreshTokenReused is returned.
+func (r *authRepository) RotateRefreshToken(ctx context.Context, oldID int64, next *models.RefreshToken) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin refresh token rotation: %w", err)
+	}
+	defer tx.Rollback(ctx) // No-op after a successful commit
+
+	insertQuery := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+                    VALUES ($1, $2, $3, $4)
+                    RETURNING id, created_at`
+	err = tx.QueryRow(ctx, insertQuery, next.UserID, next.FamilyID, next.TokenHash, next.ExpiresAt).Scan(
+		&next.ID,
+		&next.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert rotated refresh token: %w", err)
+	}
+
+	// Only revoke if still active; this guards against two concurrent refreshes of the same token
+	revokeQuery := `UPDATE refresh_tokens
+                    SET revoked_at = NOW(), replaced_by = $2
+                    WHERE id = $1 AND revoked_at IS NULL`
+	cmdTag, err := tx.Exec(ctx, revokeQuery, oldID, next.ID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke old refresh token: %w", err)
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return ErrRefreshTokenReused
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit refresh token rotation: %w", err)
+	}
+	return nil
+}
+
+// RevokeRefreshTokenFamily revokes every still-active token in a family.
+func (r *authRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+	cmdTag, err := r.db.Exec(ctx, query, familyID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error revoking refresh token family", "family_id", familyID, "error", err)
+		return err
+	}
+	slog.InfoContext(ctx, "Revoked refresh token family", "family_id", familyID, "count", cmdTag.RowsAffected())
+	return nil
+}
+
+// RevokeAllRefreshTokens revokes every active refresh token belonging to a user.
+func (r *authRepository) RevokeAllRefreshTokens(ctx context.Context, userID int) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	cmdTag, err := r.db.Exec(ctx, query, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error revoking refresh tokens", "user_id", userID, "error", err)
+		return err
+	}
+	slog.InfoContext(ctx, "Revoked refresh tokens", "user_id", userID, "count", cmdTag.RowsAffected())
+	return nil
+}
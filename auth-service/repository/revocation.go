@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RevokeAccessToken records the jti of an access token so it is rejected until it expires.
+// Expired entries are pruned opportunistically on every insert.
+func (r *authRepository) RevokeAccessToken(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	query := `INSERT INTO revoked_tokens (jti, user_id, expires_at)
+              VALUES ($1, $2, $3)
+              ON CONFLICT (jti) DO NOTHING`
+	if _, err := r.db.Exec(ctx, query, jti, userID, expiresAt); err != nil {
+		slog.ErrorContext(ctx, "Error revoking access token", "jti", jti, "user_id", userID, "error", err)
+		return err
+	}
+
+	if _, err := r.db.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < NOW()`); err != nil {
+		// Not fatal; the rows are just dead weight
+		slog.WarnContext(ctx, "Failed to prune expired revoked tokens", "error", err)
+	}
+	return nil
+}
+
+// IncrementTokenVersion bumps the user's token_version and returns the new value.
+// Every access token carrying an older version is rejected from then on.
+func (r *authRepository) IncrementTokenVersion(ctx context.Context, userID int) (int, error) {
+	query := `UPDATE users SET token_version = token_version + 1 WHERE id = $1 RETURNING token_version`
+	var version int
+	if err := r.db.QueryRow(ctx, query, userID).Scan(&version); err != nil {
+		slog.ErrorContext(ctx, "Error incrementing token version", "user_id", userID, "error", err)
+		return 0, err
+	}
+	return version, nil
+}
+
+// IsAccessTokenRevoked reports whether an access token has been revoked, either
+// individually (by jti), because the user's token version has moved on or
+// because its session (sessionID, empty for tokens without one) was signed out.
+// A token for a user that no longer exists or has been disabled is reported as revoked.
+func (r *authRepository) IsAccessTokenRevoked(ctx context.Context, jti string, userID int, tokenVersion int, sessionID string) (bool, error) {
+	query := `SELECT u.token_version <> $3 OR u.disabled_at IS NOT NULL
+                     OR EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = $1)
+                     OR EXISTS(SELECT 1 FROM sessions WHERE id = $4 AND revoked_at IS NOT NULL)
+              FROM users u
+              WHERE u.id = $2`
+	// NULL matches no session
+	var sid *string
+	if sessionID != "" {
+		sid = &sessionID
+	}
+	var revoked bool
+	err := r.db.QueryRow(ctx, query, jti, userID, tokenVersion, sid).Scan(&revoked)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return true, nil
+		}
+		slog.ErrorContext(ctx, "Error checking revocation", "jti", jti, "error", err)
+		return false, err
+	}
+	return revoked, nil
+}
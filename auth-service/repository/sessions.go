@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"auth-service/internal/models"
+)
+
+// ErrSessionNotFound is returned when a session does not exist, belongs to
+// another user or has already been revoked.
+var ErrSessionNotFound = errors.New("session not found")
+
+// CreateSession records a new login. session.ID must be the refresh token family ID.
+func (r *authRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	query := `INSERT INTO sessions (id, user_id, user_agent, ip_address)
+              VALUES ($1, $2, $3, $4)
+              RETURNING created_at, last_seen_at`
+	err := r.db.QueryRow(ctx, query, session.ID, session.UserID, session.UserAgent, session.IPAddress).
+		Scan(&session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// ListSessions returns the active sessions of userID, most recently used first.
+// A session is active until it is revoked or its refresh tokens are all revoked
+// or expired, so logout, logout-all and password changes end sessions as well.
+func (r *authRepository) ListSessions(ctx context.Context, userID int) ([]models.Session, error) {
+	query := `SELECT s.id, s.user_id, s.user_agent, s.ip_address, s.created_at, s.last_seen_at
+              FROM sessions s
+              WHERE s.user_id = $1 AND s.revoked_at IS NULL
+                AND EXISTS (SELECT 1 FROM refresh_tokens rt
+                            WHERE rt.family_id = s.id AND rt.revoked_at IS NULL AND rt.expires_at > NOW())
+              ORDER BY s.last_seen_at DESC`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var s models.Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IPAddress, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession signs a session of userID out: its refresh tokens are revoked
+// and its access tokens fail the revocation check from then on.
+func (r *authRepository) RevokeSession(ctx context.Context, userID int, sessionID string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	tag, err := tx.Exec(ctx, query, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	revokeQuery := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(ctx, revokeQuery, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke session refresh tokens: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit session revocation: %w", err)
+	}
+	slog.InfoContext(ctx, "Revoked session", "session_id", sessionID, "user_id", userID)
+	return nil
+}
+
+// TouchSession sets the session's last_seen_at to now if it was last seen
+// before staleBefore. The condition keeps frequent requests from rewriting the row.
+func (r *authRepository) TouchSession(ctx context.Context, sessionID string, staleBefore time.Time) error {
+	query := `UPDATE sessions SET last_seen_at = NOW() WHERE id = $1 AND last_seen_at < $2`
+	if _, err := r.db.Exec(ctx, query, sessionID, staleBefore); err != nil {
+		return fmt.Errorf("failed to update session last seen: %w", err)
+	}
+	return nil
+}
@@ -1,18 +1,77 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"cozy-go/shared/logging"
+	"cozy-go/topology"
+	"notification-service/internal/email"
 	"notification-service/internal/events"
+	"notification-service/internal/metrics"
 )
 
 func main() {
+	logging.Setup("notification-service")
+
+	// "main replay-dead-letters [-limit n]" moves dead-lettered messages back
+	// to the queue and exits, e.g. once the mail server is reachable again
+	if len(os.Args) > 1 && os.Args[1] == "replay-dead-letters" {
+		replayDeadLetters(os.Args[2:])
+		return
+	}
+
+	// The service has no API, so /metrics gets a server of its own
+	metricsAddr := os.Getenv("METRICS_ADDR")
+	if metricsAddr == "" {
+		metricsAddr = ":9091"
+	}
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.Handler())
+		slog.Info("Serving metrics", "addr", metricsAddr)
+		if err := http.ListenAndServe(metricsAddr, mux); err != nil {
+			slog.Error("Metrics server stopped", "error", err)
+		}
+	}()
+
 	// Connect to RabbitMQ
 	conn, err := events.SetupRabbitMQ()
 	if err != nil {
-		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
+		slog.Error("Failed to connect to RabbitMQ", "error", err)
+		os.Exit(1)
 	}
 	defer conn.Close()
 
+	sender := metrics.InstrumentSender(email.NewSMTPSenderFromEnv())
+
 	// Consume messages
-	events.ConsumeMessages(conn)
+	if err := events.ConsumeMessages(topology.NewConnection(conn), sender, events.ConsumerConfigFromEnv()); err != nil {
+		slog.Error("Consumer stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// replayDeadLetters runs the replay-dead-letters command with args.
+func replayDeadLetters(args []string) {
+	flags := flag.NewFlagSet("replay-dead-letters", flag.ExitOnError)
+	limit := flags.Int("limit", 0, "replay at most this many messages (0 replays all)")
+	flags.Parse(args)
+
+	conn, err := events.SetupRabbitMQ()
+	if err != nil {
+		slog.Error("Failed to connect to RabbitMQ", "error", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	replayed, err := events.ReplayDeadLetters(context.Background(), topology.NewConnection(conn), *limit, events.ConsumerConfigFromEnv().ConfirmTimeout)
+	if err != nil {
+		slog.Error("Failed to replay dead-lettered messages", "replayed", replayed, "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Replayed dead-lettered messages", "replayed", replayed)
 }
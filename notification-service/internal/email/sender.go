@@ -0,0 +1,77 @@
+package email
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"gopkg.in/gomail.v2"
+)
+
+// Message is a rendered email ready to send.
+type Message struct {
+	To       string
+	Subject  string
+	TextBody string
+	HTMLBody string // Optional
+}
+
+// Sender delivers emails.
+type Sender interface {
+	Send(msg Message) error
+}
+
+// smtpSender sends mail through an SMTP server (MailHog in development).
+type smtpSender struct {
+	dialer *gomail.Dialer
+	from   string
+}
+
+// NewSMTPSender creates a Sender for the given SMTP server.
+func NewSMTPSender(host string, port int, username, password, from string) Sender {
+	return &smtpSender{
+		dialer: gomail.NewDialer(host, port, username, password),
+		from:   from,
+	}
+}
+
+// NewSMTPSenderFromEnv builds an SMTP sender from SMTP_HOST (default mailhog),
+// SMTP_PORT (default 1025), SMTP_USERNAME, SMTP_PASSWORD and MAIL_FROM.
+func NewSMTPSenderFromEnv() Sender {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		host = "mailhog"
+	}
+	port := 1025
+	if val := os.Getenv("SMTP_PORT"); val != "" {
+		if p, err := strconv.Atoi(val); err == nil {
+			port = p
+		} else {
+			slog.Warn("Invalid SMTP_PORT, using default", "value", val, "default", port)
+		}
+	}
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@cozy.local"
+	}
+	slog.Info("Sending email via SMTP server", "host", host, "port", port, "from", from)
+	return NewSMTPSender(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+}
+
+// Send delivers msg.
+func (s *smtpSender) Send(msg Message) error {
+	m := gomail.NewMessage()
+	m.SetHeader("From", s.from)
+	m.SetHeader("To", msg.To)
+	m.SetHeader("Subject", msg.Subject)
+	m.SetBody("text/plain", msg.TextBody)
+	if msg.HTMLBody != "" {
+		m.AddAlternative("text/html", msg.HTMLBody)
+	}
+
+	if err := s.dialer.DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", msg.To, err)
+	}
+	return nil
+}
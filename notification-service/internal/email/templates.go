@@ -0,0 +1,243 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// AppBaseURL returns the frontend URL used in email links, from APP_BASE_URL
+// (default http://localhost:3000).
+func AppBaseURL() string {
+	base := os.Getenv("APP_BASE_URL")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return strings.TrimRight(base, "/")
+}
+
+// PasswordResetData is the input for the password reset email.
+type PasswordResetData struct {
+	Username  string
+	ResetURL  string
+	ExpiresAt time.Time
+}
+
+var passwordResetText = template.Must(template.New("password_reset_text").Parse(`Hi {{.Username}},
+
+We received a request to reset the password for your account.
+Open the link below to choose a new password:
+
+{{.ResetURL}}
+
+The link expires at {{.ExpiresAt.UTC.Format "2006-01-02 15:04 MST"}} and can only be used once.
+If you did not request a password reset, you can ignore this email.
+`))
+
+var passwordResetHTML = htmltemplate.Must(htmltemplate.New("password_reset_html").Parse(`<p>Hi {{.Username}},</p>
+<p>We received a request to reset the password for your account.</p>
+<p><a href="{{.ResetURL}}">Choose a new password</a></p>
+<p>The link expires at {{.ExpiresAt.UTC.Format "2006-01-02 15:04 MST"}} and can only be used once.
+If you did not request a password reset, you can ignore this email.</p>
+`))
+
+// PasswordResetMessage renders the password reset email for token.
+// The link points at the frontend's /reset-password page under baseURL.
+func PasswordResetMessage(to, username, token string, expiresAt time.Time, baseURL string) (Message, error) {
+	data := PasswordResetData{
+		Username:  username,
+		ResetURL:  baseURL + "/reset-password?token=" + url.QueryEscape(token),
+		ExpiresAt: expiresAt,
+	}
+	if data.Username == "" {
+		data.Username = "there"
+	}
+
+	var text, html bytes.Buffer
+	if err := passwordResetText.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render password reset email: %w", err)
+	}
+	if err := passwordResetHTML.Execute(&html, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render password reset email: %w", err)
+	}
+
+	return Message{
+		To:       to,
+		Subject:  "Reset your password",
+		TextBody: text.String(),
+		HTMLBody: html.String(),
+	}, nil
+}
+
+// MagicLinkData is the input for the passwordless sign-in email.
+type MagicLinkData struct {
+	Username  string
+	SignInURL string
+	ExpiresAt time.Time
+}
+
+var magicLinkText = template.Must(template.New("magic_link_text").Parse(`Hi {{.Username}},
+
+Open the link below to sign in to your account:
+
+{{.SignInURL}}
+
+The link expires at {{.ExpiresAt.UTC.Format "2006-01-02 15:04 MST"}} and can only be used once.
+If you did not ask to sign in, you can ignore this email.
+`))
+
+var magicLinkHTML = htmltemplate.Must(htmltemplate.New("magic_link_html").Parse(`<p>Hi {{.Username}},</p>
+<p><a href="{{.SignInURL}}">Sign in to your account</a></p>
+<p>The link expires at {{.ExpiresAt.UTC.Format "2006-01-02 15:04 MST"}} and can only be used once.
+If you did not ask to sign in, you can ignore this email.</p>
+`))
+
+// MagicLinkMessage renders the sign-in link email for token.
+// The link points at the frontend's /login/magic-link page under baseURL,
+// which redeems the token with auth-service.
+func MagicLinkMessage(to, username, token string, expiresAt time.Time, baseURL string) (Message, error) {
+	data := MagicLinkData{
+		Username:  username,
+		SignInURL: baseURL + "/login/magic-link?token=" + url.QueryEscape(token),
+		ExpiresAt: expiresAt,
+	}
+	if data.Username == "" {
+		data.Username = "there"
+	}
+
+	var text, html bytes.Buffer
+	if err := magicLinkText.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render sign-in link email: %w", err)
+	}
+	if err := magicLinkHTML.Execute(&html, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render sign-in link email: %w", err)
+	}
+
+	return Message{
+		To:       to,
+		Subject:  "Your sign-in link",
+		TextBody: text.String(),
+		HTMLBody: html.String(),
+	}, nil
+}
+
+// VerificationData is the input for the email verification email.
+type VerificationData struct {
+	Username  string
+	VerifyURL string
+	ExpiresAt *time.Time // Optional
+}
+
+var verificationText = template.Must(template.New("verification_text").Parse(`Hi {{.Username}},
+
+Welcome! Please confirm your email address by opening the link below:
+
+{{.VerifyURL}}
+{{if .ExpiresAt}}
+The link expires at {{.ExpiresAt.UTC.Format "2006-01-02 15:04 MST"}}.{{end}}
+If you did not create an account, you can ignore this email.
+`))
+
+var verificationHTML = htmltemplate.Must(htmltemplate.New("verification_html").Parse(`<p>Hi {{.Username}},</p>
+<p>Welcome! Please confirm your email address:</p>
+<p><a href="{{.VerifyURL}}">Verify my email address</a></p>
+{{if .ExpiresAt}}<p>The link expires at {{.ExpiresAt.UTC.Format "2006-01-02 15:04 MST"}}.</p>
+{{end}}<p>If you did not create an account, you can ignore this email.</p>
+`))
+
+// VerificationMessage renders the email verification email for token.
+// The link points at the frontend's /verify-email page under baseURL.
+func VerificationMessage(to, username, token string, expiresAt *time.Time, baseURL string) (Message, error) {
+	data := VerificationData{
+		Username:  username,
+		VerifyURL: baseURL + "/verify-email?token=" + url.QueryEscape(token),
+		ExpiresAt: expiresAt,
+	}
+	if data.Username == "" {
+		data.Username = "there"
+	}
+
+	var text, html bytes.Buffer
+	if err := verificationText.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render verification email: %w", err)
+	}
+	if err := verificationHTML.Execute(&html, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render verification email: %w", err)
+	}
+
+	return Message{
+		To:       to,
+		Subject:  "Verify your email address",
+		TextBody: text.String(),
+		HTMLBody: html.String(),
+	}, nil
+}
+
+// EmailChangedNoticeData is the input for the notice sent to a previous email address.
+type EmailChangedNoticeData struct {
+	Username string
+	NewEmail string
+}
+
+var emailChangedNoticeText = template.Must(template.New("email_changed_notice_text").Parse(`Hi {{.Username}},
+
+The email address of your account was changed to {{.NewEmail}}.
+If you did not make this change, reset your password immediately and contact support.
+`))
+
+// EmailChangedNoticeMessage renders the security notice sent to the old address
+// after a user changes their email.
+func EmailChangedNoticeMessage(to, username, newEmail string) (Message, error) {
+	data := EmailChangedNoticeData{Username: username, NewEmail: newEmail}
+	if data.Username == "" {
+		data.Username = "there"
+	}
+
+	var text bytes.Buffer
+	if err := emailChangedNoticeText.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render email changed notice: %w", err)
+	}
+	return Message{
+		To:       to,
+		Subject:  "Your email address was changed",
+		TextBody: text.String(),
+	}, nil
+}
+
+// PasswordChangedNoticeData is the input for the notice sent after a password change.
+type PasswordChangedNoticeData struct {
+	Username string
+	// Reset is true when the password was set through a reset link.
+	Reset bool
+}
+
+var passwordChangedNoticeText = template.Must(template.New("password_changed_notice_text").Parse(`Hi {{.Username}},
+
+The password of your account was {{if .Reset}}reset using a link sent to this address{{else}}changed{{end}}.
+You have been signed out of all other sessions.
+If you did not make this change, reset your password immediately and contact support.
+`))
+
+// PasswordChangedNoticeMessage renders the security notice sent after a
+// password change. reason is "reset" for changes made through a reset link.
+func PasswordChangedNoticeMessage(to, username, reason string) (Message, error) {
+	data := PasswordChangedNoticeData{Username: username, Reset: reason == "reset"}
+	if data.Username == "" {
+		data.Username = "there"
+	}
+
+	var text bytes.Buffer
+	if err := passwordChangedNoticeText.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render password changed notice: %w", err)
+	}
+	return Message{
+		To:       to,
+		Subject:  "Your password was changed",
+		TextBody: text.String(),
+	}, nil
+}
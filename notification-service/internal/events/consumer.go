@@ -1,72 +1,112 @@
 package events
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"cozy-go/shared/requestid"
+	"cozy-go/topology"
+	"notification-service/internal/email"
+	"notification-service/internal/metrics"
 
 	amqp "github.com/rabbitmq/amqp091-go"
-	"gopkg.in/gomail.v2"
 )
 
-func ConsumeMessages(conn *amqp.Connection) {
+// handlers maps every event type topology.NotificationQueue is bound to, to
+// the function that sends its email.
+var handlers = map[string]func(context.Context, Envelope, email.Sender) error{
+	typeUserRegistered:         handleUserRegistered,
+	typePasswordChanged:        handlePasswordChanged,
+	typePasswordResetRequested: handlePasswordResetRequested,
+	typeMagicLinkRequested:     handleMagicLinkRequested,
+	typeEmailChanged:           handleEmailChanged,
+	typeVerificationRequested:  handleVerificationRequested,
+}
+
+// ConsumeMessages declares the shared topology and the retry queues and
+// handles the events on topology.NotificationQueue until the connection
+// closes. Messages are CloudEvents in structured or binary content mode; see
+// DecodeDelivery.
+//
+// A message is acknowledged only once its email was sent or it was moved to
+// a delay queue or DeadLetterQueue (see settle), so a crash redelivers it
+// instead of losing it. At most config.Prefetch messages are unacknowledged
+// at once. Publishers deliver at least once, so an event whose ID was among
+// the recently handled ones is acknowledged without sending its email again.
+func ConsumeMessages(conn topology.Connection, sender email.Sender, config ConsumerConfig) error {
 	ch, err := conn.Channel()
 	if err != nil {
-		log.Fatalf("Failed to open a channel: %v", err)
+		return fmt.Errorf("failed to open a channel: %w", err)
 	}
 	defer ch.Close()
 
-	// Declare a queue
-	q, err := ch.QueueDeclare(
-		"login_events", // name
-		false,          // durable
-		false,          // delete when unused
-		false,          // exclusive
-		false,          // no-wait
-		nil,            // arguments
-	)
-	if err != nil {
-		log.Fatalf("Failed to declare a queue: %v", err)
+	if err := topology.Declare(ch); err != nil {
+		return err
+	}
+	if err := declareRetryQueues(ch, config); err != nil {
+		return err
+	}
+	if err := ch.Qos(config.Prefetch, 0, false); err != nil {
+		return fmt.Errorf("failed to set prefetch count: %w", err)
+	}
+	// Messages moved to a delay queue or DeadLetterQueue are acknowledged only
+	// once the broker confirmed the copy; see settle
+	if err := ch.Confirm(false); err != nil {
+		return fmt.Errorf("failed to put the channel in confirm mode: %w", err)
 	}
 
-	// Consume messages
 	msgs, err := ch.Consume(
-		q.Name, // queue
-		"",     // consumer
-		true,   // auto-ack
-		false,  // exclusive
-		false,  // no-local
-		false,  // no-wait
-		nil,    // args
+		topology.NotificationQueue, // queue
+		"",                         // consumer
+		false,                      // auto-ack
+		false,                      // exclusive
+		false,                      // no-local
+		false,                      // no-wait
+		nil,                        // args
 	)
 	if err != nil {
-		log.Fatalf("Failed to register a consumer: %v", err)
+		return fmt.Errorf("failed to register a consumer on %s: %w", topology.NotificationQueue, err)
 	}
 
-	forever := make(chan bool)
-
-	go func() {
-		for d := range msgs {
-			log.Printf("Received a message: %s", d.Body)
-			sendEmail(string(d.Body))
-		}
-	}()
-
-	log.Printf(" [*] Waiting for messages. To exit press CTRL+C")
-	<-forever
+	slog.Info("Waiting for messages", "queue", topology.NotificationQueue)
+	handled := newRecentEvents(recentEventsCapacity)
+	for d := range msgs {
+		ctx, start := deliveryContext(d), time.Now()
+		// Bodies can contain sign-in, reset or verification tokens, so they are never logged
+		slog.InfoContext(ctx, "Received a message", "event_type", eventType(d), "message_id", d.MessageId, "attempt", deliveryAttempts(d)+1)
+		result := settle(ctx, ch, d, handleDelivery(ctx, d, sender, handled), config)
+		metrics.MessageHandled(eventType(d), result, time.Since(start))
+	}
+	return fmt.Errorf("delivery channel of %s closed", topology.NotificationQueue)
 }
 
-func sendEmail(body string) {
-	m := gomail.NewMessage()
-	m.SetHeader("From", "your-email@example.com")
-	m.SetHeader("To", "recipient@example.com")
-	m.SetHeader("Subject", "Login Event")
-	m.SetBody("text/plain", body)
-
-	// Use MailHog's SMTP server
-	d := gomail.NewDialer("mailhog", 1025, "", "")
-
-	if err := d.DialAndSend(m); err != nil {
-		log.Printf("Failed to send email: %v", err)
-	} else {
-		log.Printf("Email sent: %s", body)
+// handleDelivery decodes the CloudEvent in d, in either content mode, and
+// passes it to the handler for its type. It returns errDuplicate if handled
+// contains the event's ID and records the ID once the handler succeeds.
+func handleDelivery(ctx context.Context, d amqp.Delivery, sender email.Sender, handled *recentEvents) error {
+	envelope, err := DecodeDelivery(d)
+	if err != nil {
+		return err
+	}
+	if handled.contains(envelope.ID) {
+		return errDuplicate
 	}
+	handler, ok := handlers[envelope.Type]
+	if !ok {
+		return fmt.Errorf("%w: no handler for %s event %s", ErrMalformedEvent, envelope.Type, envelope.ID)
+	}
+	if err := handler(ctx, envelope, sender); err != nil {
+		return err
+	}
+	handled.add(envelope.ID)
+	return nil
+}
+
+// deliveryContext returns the context to handle d with. It carries the ID of
+// the request that caused the event, which publishers put in the correlation
+// ID, so log lines can be matched with the publisher's.
+func deliveryContext(d amqp.Delivery) context.Context {
+	return requestid.NewContext(context.Background(), d.CorrelationId)
 }
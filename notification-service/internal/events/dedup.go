@@ -0,0 +1,45 @@
+package events
+
+import "errors"
+
+// recentEventsCapacity is the number of handled event IDs ConsumeMessages
+// remembers. Duplicates come from a publisher retrying an event it could not
+// confirm, so they arrive shortly after the original.
+const recentEventsCapacity = 10000
+
+// errDuplicate is returned by handleDelivery for an event that was already
+// handled. settle acknowledges it without sending the email again.
+var errDuplicate = errors.New("event was already handled")
+
+// recentEvents remembers the IDs of the last capacity events handled, oldest
+// first out. It lives in memory, so a restarted consumer handles a duplicate
+// of an event from before the restart again. It is not safe for concurrent use.
+type recentEvents struct {
+	capacity int
+	ids      map[string]struct{}
+	order    []string
+}
+
+func newRecentEvents(capacity int) *recentEvents {
+	return &recentEvents{capacity: capacity, ids: make(map[string]struct{}, capacity)}
+}
+
+// contains reports whether the event with id was handled.
+func (r *recentEvents) contains(id string) bool {
+	_, ok := r.ids[id]
+	return ok
+}
+
+// add records the event with id as handled, forgetting the oldest one if
+// capacity is reached.
+func (r *recentEvents) add(id string) {
+	if r.contains(id) {
+		return
+	}
+	if len(r.order) >= r.capacity {
+		delete(r.ids, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.ids[id] = struct{}{}
+	r.order = append(r.order, id)
+}
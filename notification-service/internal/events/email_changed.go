@@ -0,0 +1,52 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"notification-service/internal/email"
+)
+
+// EmailChangedEvent mirrors the data of auth-service's user.email_changed event.
+type EmailChangedEvent struct {
+	UserID                int       `json:"user_id"`
+	Username              string    `json:"username"`
+	OldEmail              string    `json:"old_email"`
+	NewEmail              string    `json:"new_email"`
+	VerificationToken     string    `json:"verification_token"`
+	VerificationExpiresAt time.Time `json:"verification_expires_at"`
+}
+
+// handleEmailChanged sends the verification link to the new address and a
+// security notice to the old one.
+func handleEmailChanged(ctx context.Context, envelope Envelope, sender email.Sender) error {
+	var event EmailChangedEvent
+	if err := decodeEvent(envelope, typeEmailChanged, &event); err != nil {
+		return err
+	}
+	if event.NewEmail == "" || event.VerificationToken == "" {
+		return fmt.Errorf("%w: email changed event for user %d is missing new email or token", ErrMalformedEvent, event.UserID)
+	}
+
+	msg, err := email.VerificationMessage(event.NewEmail, event.Username, event.VerificationToken, &event.VerificationExpiresAt, email.AppBaseURL())
+	if err != nil {
+		return err
+	}
+	if err := sender.Send(msg); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Verification email for changed address sent", "user_id", event.UserID)
+
+	if event.OldEmail != "" {
+		notice, err := email.EmailChangedNoticeMessage(event.OldEmail, event.Username, event.NewEmail)
+		if err != nil {
+			return err
+		}
+		if err := sender.Send(notice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
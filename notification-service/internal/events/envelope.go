@@ -0,0 +1,65 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"cozy-go/shared/cloudevents"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Event types consumed by the notification service, as published by auth-service.
+const (
+	typeUserRegistered         = "user.registered"
+	typePasswordChanged        = "user.password_changed"
+	typePasswordResetRequested = "user.password_reset_requested"
+	typeMagicLinkRequested     = "user.magic_link_requested"
+	typeEmailChanged           = "user.email_changed"
+	typeVerificationRequested  = "user.verification_requested"
+)
+
+// ErrMalformedEvent marks messages that can never be processed. They are
+// dead-lettered at once instead of being retried.
+var ErrMalformedEvent = errors.New("malformed event")
+
+// dataVersions is the data schema version this service understands for each
+// event type. Events of a newer version are rejected rather than guessed at.
+var dataVersions = map[string]int{
+	typeUserRegistered:         1,
+	typePasswordChanged:        1,
+	typePasswordResetRequested: 1,
+	typeMagicLinkRequested:     1,
+	typeEmailChanged:           1,
+	typeVerificationRequested:  1,
+}
+
+// Envelope is the CloudEvents envelope auth-service wraps every event in.
+type Envelope = cloudevents.Envelope
+
+// DecodeDelivery decodes the CloudEvent in d with cloudevents.DecodeDelivery.
+// Errors wrap ErrMalformedEvent.
+func DecodeDelivery(d amqp.Delivery) (Envelope, error) {
+	envelope, err := cloudevents.DecodeDelivery(d)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("%w: %v", ErrMalformedEvent, err)
+	}
+	return envelope, nil
+}
+
+// decodeEvent checks that envelope carries an event of eventType in a version
+// this service understands and decodes its data into v. Every failure wraps
+// ErrMalformedEvent: retrying the message would not change the outcome.
+func decodeEvent(envelope Envelope, eventType string, v any) error {
+	if envelope.Type != eventType {
+		return fmt.Errorf("%w: expected a %s event, got %q", ErrMalformedEvent, eventType, envelope.Type)
+	}
+	if envelope.DataVersion != dataVersions[eventType] {
+		return fmt.Errorf("%w: unsupported data version %d of %s event %s", ErrMalformedEvent, envelope.DataVersion, eventType, envelope.ID)
+	}
+	if err := json.Unmarshal(envelope.Data, v); err != nil {
+		return fmt.Errorf("%w: failed to decode %s event %s: %v", ErrMalformedEvent, eventType, envelope.ID, err)
+	}
+	return nil
+}
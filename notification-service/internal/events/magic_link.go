@@ -0,0 +1,40 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"notification-service/internal/email"
+)
+
+// MagicLinkRequestedEvent mirrors the data of auth-service's user.magic_link_requested event.
+type MagicLinkRequestedEvent struct {
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	Username  string    `json:"username"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// handleMagicLinkRequested emails the sign-in link for a MagicLinkRequestedEvent.
+func handleMagicLinkRequested(ctx context.Context, envelope Envelope, sender email.Sender) error {
+	var event MagicLinkRequestedEvent
+	if err := decodeEvent(envelope, typeMagicLinkRequested, &event); err != nil {
+		return err
+	}
+	if event.Email == "" || event.Token == "" {
+		return fmt.Errorf("%w: sign-in link event for user %d is missing email or token", ErrMalformedEvent, event.UserID)
+	}
+
+	msg, err := email.MagicLinkMessage(event.Email, event.Username, event.Token, event.ExpiresAt, email.AppBaseURL())
+	if err != nil {
+		return err
+	}
+	if err := sender.Send(msg); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Sign-in link email sent", "user_id", event.UserID)
+	return nil
+}
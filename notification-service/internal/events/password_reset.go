@@ -0,0 +1,40 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"notification-service/internal/email"
+)
+
+// PasswordResetRequestedEvent mirrors the data of auth-service's user.password_reset_requested event.
+type PasswordResetRequestedEvent struct {
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	Username  string    `json:"username"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// handlePasswordResetRequested emails the reset link for a PasswordResetRequestedEvent.
+func handlePasswordResetRequested(ctx context.Context, envelope Envelope, sender email.Sender) error {
+	var event PasswordResetRequestedEvent
+	if err := decodeEvent(envelope, typePasswordResetRequested, &event); err != nil {
+		return err
+	}
+	if event.Email == "" || event.Token == "" {
+		return fmt.Errorf("%w: password reset event for user %d is missing email or token", ErrMalformedEvent, event.UserID)
+	}
+
+	msg, err := email.PasswordResetMessage(event.Email, event.Username, event.Token, event.ExpiresAt, email.AppBaseURL())
+	if err != nil {
+		return err
+	}
+	if err := sender.Send(msg); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Password reset email sent", "user_id", event.UserID)
+	return nil
+}
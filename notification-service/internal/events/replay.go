@@ -0,0 +1,73 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"cozy-go/topology"
+)
+
+// ReplayDeadLetters moves up to limit messages (all if limit is zero or less)
+// from DeadLetterQueue back to topology.NotificationQueue, oldest first, and
+// returns how many it moved. Replayed messages get a fresh set of attempts.
+// Only the messages dead-lettered before the call are replayed, so a message
+// that fails again while the replay runs is not picked up a second time.
+// A message leaves DeadLetterQueue only once the broker confirmed its copy in
+// topology.NotificationQueue, waiting up to confirmTimeout (indefinitely if
+// zero); otherwise it is requeued and the replay stops.
+//
+// It is meant to be run by an operator once the cause is fixed, e.g. the mail
+// server is reachable again; see the replay-dead-letters command.
+func ReplayDeadLetters(ctx context.Context, conn topology.Connection, limit int, confirmTimeout time.Duration) (int, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+	if err := ch.Confirm(false); err != nil {
+		return 0, fmt.Errorf("failed to put the channel in confirm mode: %w", err)
+	}
+
+	if err := topology.Declare(ch); err != nil {
+		return 0, err
+	}
+	q, err := ch.QueueDeclare(DeadLetterQueue, true, false, false, false, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to declare queue %s: %w", DeadLetterQueue, err)
+	}
+	pending := q.Messages
+	if limit > 0 {
+		pending = min(pending, limit)
+	}
+
+	replayed := 0
+	for replayed < pending {
+		d, ok, err := ch.Get(DeadLetterQueue, false)
+		if err != nil {
+			return replayed, fmt.Errorf("failed to get a message from %s: %w", DeadLetterQueue, err)
+		}
+		if !ok {
+			break
+		}
+
+		headers := copyHeaders(d)
+		delete(headers, attemptsHeader)
+		delete(headers, lastErrorHeader)
+		delete(headers, deadReasonHeader)
+		if err := publishConfirmed(ctx, ch, topology.NotificationQueue, republishing(d, headers), confirmTimeout); err != nil {
+			if nackErr := d.Nack(false, true); nackErr != nil {
+				// Closing the channel returns the message to the dead letter queue
+				slog.ErrorContext(ctx, "Failed to requeue dead-lettered message", "message_id", d.MessageId, "error", nackErr)
+			}
+			return replayed, fmt.Errorf("failed to replay message %s: %w", d.MessageId, err)
+		}
+		if err := d.Ack(false); err != nil {
+			return replayed, fmt.Errorf("failed to acknowledge message %s: %w", d.MessageId, err)
+		}
+		replayed++
+		slog.InfoContext(ctx, "Replayed dead-lettered message", "event_type", eventType(d), "message_id", d.MessageId)
+	}
+	return replayed, nil
+}
@@ -0,0 +1,288 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"cozy-go/topology"
+	"notification-service/internal/metrics"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeadLetterQueue holds the messages the consumer gave up on: malformed ones
+// at once, others after ConsumerConfig.MaxAttempts failed attempts. They stay
+// there until replayed with ReplayDeadLetters.
+const DeadLetterQueue = topology.NotificationQueue + ".dead"
+
+// Headers the consumer adds to the messages it retries or dead-letters.
+const (
+	attemptsHeader   = "x-attempts"      // Failed attempts so far
+	routingKeyHeader = "x-routing-key"   // Routing key the event was published with
+	lastErrorHeader  = "x-last-error"    // Error of the last attempt
+	deadReasonHeader = "x-dead-lettered" // "malformed" or "attempts"
+)
+
+// ConsumerConfig tunes ConsumeMessages.
+type ConsumerConfig struct {
+	// Prefetch is the number of unacknowledged messages the consumer holds at
+	// once
+	Prefetch int
+	// MaxAttempts is the number of times a message is handled before it is
+	// dead-lettered
+	MaxAttempts int
+	// MinRetryDelay is the delay before the first retry; it doubles with
+	// every further retry up to MaxRetryDelay
+	MinRetryDelay time.Duration
+	MaxRetryDelay time.Duration
+	// ConfirmTimeout is how long the consumer waits for the broker to confirm
+	// a message it moved to a delay queue or DeadLetterQueue; zero waits
+	// indefinitely
+	ConfirmTimeout time.Duration
+}
+
+// DefaultConsumerConfig returns the settings used unless overridden by the
+// environment. A message is retried after 10s, 20s, 40s and 80s.
+func DefaultConsumerConfig() ConsumerConfig {
+	return ConsumerConfig{
+		Prefetch:       10,
+		MaxAttempts:    5,
+		MinRetryDelay:  10 * time.Second,
+		MaxRetryDelay:  10 * time.Minute,
+		ConfirmTimeout: 10 * time.Second,
+	}
+}
+
+// ConsumerConfigFromEnv returns DefaultConsumerConfig with CONSUMER_PREFETCH,
+// CONSUMER_MAX_ATTEMPTS, CONSUMER_MIN_RETRY_DELAY, CONSUMER_MAX_RETRY_DELAY and
+// CONSUMER_CONFIRM_TIMEOUT applied. Invalid values are logged and ignored.
+func ConsumerConfigFromEnv() ConsumerConfig {
+	config := DefaultConsumerConfig()
+	config.Prefetch = intFromEnv("CONSUMER_PREFETCH", config.Prefetch)
+	config.MaxAttempts = intFromEnv("CONSUMER_MAX_ATTEMPTS", config.MaxAttempts)
+	config.MinRetryDelay = durationFromEnv("CONSUMER_MIN_RETRY_DELAY", config.MinRetryDelay)
+	config.MaxRetryDelay = durationFromEnv("CONSUMER_MAX_RETRY_DELAY", config.MaxRetryDelay)
+	config.ConfirmTimeout = durationFromEnv("CONSUMER_CONFIRM_TIMEOUT", config.ConfirmTimeout)
+	return config
+}
+
+// RetryDelay returns how long a message waits before it is handled again
+// after its failed attempt number attempts.
+func (c ConsumerConfig) RetryDelay(attempts int) time.Duration {
+	delay := c.MinRetryDelay
+	for i := 1; i < attempts && delay < c.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, c.MaxRetryDelay)
+}
+
+// DelayQueue returns the name of the queue messages wait in for delay before
+// they are retried. Each delay has its own queue, as RabbitMQ only expires
+// messages at the head of a queue.
+func DelayQueue(delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", topology.NotificationQueue, delay)
+}
+
+// declareRetryQueues declares DeadLetterQueue and a delay queue for every
+// retry config allows. A delay queue has no consumer: its messages expire
+// after the delay and RabbitMQ dead-letters them through the default exchange
+// back to topology.NotificationQueue. Changing the delays declares new queues;
+// the old ones drain on their own and can then be deleted.
+func declareRetryQueues(ch topology.Channel, config ConsumerConfig) error {
+	if err := declareDeadLetterQueue(ch); err != nil {
+		return err
+	}
+	for attempts := 1; attempts < config.MaxAttempts; attempts++ {
+		delay := config.RetryDelay(attempts)
+		name := DelayQueue(delay)
+		if _, err := ch.QueueDeclare(
+			name,  // name
+			true,  // durable
+			false, // delete when unused
+			false, // exclusive
+			false, // no-wait
+			amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": topology.NotificationQueue,
+			},
+		); err != nil {
+			return fmt.Errorf("failed to declare queue %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func declareDeadLetterQueue(ch topology.Channel) error {
+	if _, err := ch.QueueDeclare(DeadLetterQueue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", DeadLetterQueue, err)
+	}
+	return nil
+}
+
+// settle acknowledges d once what became of it is safe with the broker and
+// returns the metrics result. A message that failed is first published to a
+// delay queue, or to DeadLetterQueue if it is malformed or out of attempts,
+// and d is acknowledged only once the broker confirmed that copy. If the
+// publish fails, is nacked or is not confirmed within config.ConfirmTimeout,
+// d is requeued for the broker to deliver again rather than being lost.
+func settle(ctx context.Context, ch topology.Channel, d amqp.Delivery, handleErr error, config ConsumerConfig) string {
+	if handleErr == nil {
+		ack(ctx, d)
+		return metrics.ResultProcessed
+	}
+	if errors.Is(handleErr, errDuplicate) {
+		slog.InfoContext(ctx, "Skipping duplicate message", "event_type", eventType(d), "message_id", d.MessageId)
+		ack(ctx, d)
+		return metrics.ResultDuplicate
+	}
+
+	attempts := deliveryAttempts(d) + 1
+	headers := copyHeaders(d)
+	headers[attemptsHeader] = int64(attempts)
+	headers[lastErrorHeader] = handleErr.Error()
+	logArgs := []any{"event_type", eventType(d), "message_id", d.MessageId, "attempts", attempts, "error", handleErr}
+
+	var queue, result string
+	switch {
+	case errors.Is(handleErr, ErrMalformedEvent):
+		queue, result = DeadLetterQueue, metrics.ResultDeadLettered
+		headers[deadReasonHeader] = "malformed"
+		slog.ErrorContext(ctx, "Dead-lettering malformed message", logArgs...)
+	case attempts >= config.MaxAttempts:
+		queue, result = DeadLetterQueue, metrics.ResultDeadLettered
+		headers[deadReasonHeader] = "attempts"
+		slog.ErrorContext(ctx, "Dead-lettering message out of attempts", logArgs...)
+	default:
+		delay := config.RetryDelay(attempts)
+		queue, result = DelayQueue(delay), metrics.ResultRetried
+		slog.WarnContext(ctx, "Failed to handle message, retrying", append(logArgs, "retry_in", delay)...)
+	}
+
+	if err := publishConfirmed(ctx, ch, queue, republishing(d, headers), config.ConfirmTimeout); err != nil {
+		slog.ErrorContext(ctx, "Failed to move message, requeueing it", "queue", queue, "message_id", d.MessageId, "error", err)
+		if err := d.Nack(false, true); err != nil {
+			slog.ErrorContext(ctx, "Failed to requeue message", "message_id", d.MessageId, "error", err)
+		}
+		return metrics.ResultRequeued
+	}
+	ack(ctx, d)
+	return result
+}
+
+// publishConfirmed publishes msg to queue through the default exchange on ch,
+// which must be in confirm mode, and waits up to timeout (indefinitely if
+// zero) for the broker to confirm it. It returns an error unless the broker
+// acked the message.
+func publishConfirmed(ctx context.Context, ch topology.Channel, queue string, msg amqp.Publishing, timeout time.Duration) error {
+	confirmation, err := ch.PublishWithConfirmation(ctx, "", queue, false, false, msg)
+	if err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", queue, err)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("no confirmation for the message published to %s: %w", queue, err)
+	}
+	if !acked {
+		return fmt.Errorf("broker nacked the message published to %s", queue)
+	}
+	return nil
+}
+
+func ack(ctx context.Context, d amqp.Delivery) {
+	// A failed ack means the channel is gone; the broker redelivers the message
+	if err := d.Ack(false); err != nil {
+		slog.ErrorContext(ctx, "Failed to acknowledge message", "message_id", d.MessageId, "error", err)
+	}
+}
+
+// deliveryAttempts returns the failed attempts recorded on d.
+func deliveryAttempts(d amqp.Delivery) int {
+	switch n := d.Headers[attemptsHeader].(type) {
+	case int:
+		return n
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	default:
+		return 0
+	}
+}
+
+// eventType returns the routing key d was published with. A retried or
+// replayed message arrives with the name of its queue as routing key instead,
+// so the original is kept in a header.
+func eventType(d amqp.Delivery) string {
+	if key, ok := d.Headers[routingKeyHeader].(string); ok {
+		return key
+	}
+	return d.RoutingKey
+}
+
+// copyHeaders returns a copy of the headers of d that records its original
+// routing key.
+func copyHeaders(d amqp.Delivery) amqp.Table {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[routingKeyHeader] = eventType(d)
+	return headers
+}
+
+// republishing returns d as a message to publish again with headers. Binary
+// mode CloudEvents keep their attributes, which are headers as well.
+func republishing(d amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:       headers,
+		ContentType:   d.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		CorrelationId: d.CorrelationId,
+		MessageId:     d.MessageId,
+		Timestamp:     d.Timestamp,
+		Type:          d.Type,
+		AppId:         d.AppId,
+		Body:          d.Body,
+	}
+}
+
+// intFromEnv parses the positive integer in the environment variable key, or
+// returns def if it is unset or invalid.
+func intFromEnv(key string, def int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n <= 0 {
+		slog.Warn("Invalid number, using default", "name", key, "value", val, "default", def)
+		return def
+	}
+	return n
+}
+
+// durationFromEnv parses the duration in the environment variable key, or
+// returns def if it is unset or invalid.
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		slog.Warn("Invalid duration, using default", "name", key, "value", val, "default", def)
+		return def
+	}
+	return d
+}
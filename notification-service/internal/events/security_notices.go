@@ -0,0 +1,38 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"notification-service/internal/email"
+)
+
+// PasswordChangedEvent mirrors the data of auth-service's user.password_changed event.
+type PasswordChangedEvent struct {
+	UserID   int    `json:"user_id"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Reason   string `json:"reason"`
+}
+
+// handlePasswordChanged sends a security notice for a PasswordChangedEvent.
+func handlePasswordChanged(ctx context.Context, envelope Envelope, sender email.Sender) error {
+	var event PasswordChangedEvent
+	if err := decodeEvent(envelope, typePasswordChanged, &event); err != nil {
+		return err
+	}
+	if event.Email == "" {
+		return fmt.Errorf("%w: password changed event for user %d has no email", ErrMalformedEvent, event.UserID)
+	}
+
+	msg, err := email.PasswordChangedNoticeMessage(event.Email, event.Username, event.Reason)
+	if err != nil {
+		return err
+	}
+	if err := sender.Send(msg); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Password changed notice sent", "user_id", event.UserID)
+	return nil
+}
@@ -0,0 +1,44 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"notification-service/internal/email"
+)
+
+// UserRegisteredEvent mirrors the data of auth-service's user.registered event.
+type UserRegisteredEvent struct {
+	UserID                int        `json:"user_id"`
+	Email                 string     `json:"email"`
+	Username              string     `json:"username"`
+	VerificationToken     string     `json:"verification_token,omitempty"`
+	VerificationExpiresAt *time.Time `json:"verification_expires_at,omitempty"`
+}
+
+// handleUserRegistered emails the verification link for a UserRegisteredEvent.
+// Events without a verification token need no email and are skipped.
+func handleUserRegistered(ctx context.Context, envelope Envelope, sender email.Sender) error {
+	var event UserRegisteredEvent
+	if err := decodeEvent(envelope, typeUserRegistered, &event); err != nil {
+		return err
+	}
+	if event.VerificationToken == "" {
+		return nil
+	}
+	if event.Email == "" {
+		return fmt.Errorf("%w: user registered event for user %d has no email", ErrMalformedEvent, event.UserID)
+	}
+
+	msg, err := email.VerificationMessage(event.Email, event.Username, event.VerificationToken, event.VerificationExpiresAt, email.AppBaseURL())
+	if err != nil {
+		return err
+	}
+	if err := sender.Send(msg); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Verification email sent", "user_id", event.UserID)
+	return nil
+}
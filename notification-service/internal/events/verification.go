@@ -0,0 +1,41 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"notification-service/internal/email"
+)
+
+// VerificationRequestedEvent mirrors the data of auth-service's user.verification_requested event.
+type VerificationRequestedEvent struct {
+	UserID    int       `json:"user_id"`
+	Email     string    `json:"email"`
+	Username  string    `json:"username"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// handleVerificationRequested emails a new verification link for a
+// VerificationRequestedEvent. The email is the one sent after registration.
+func handleVerificationRequested(ctx context.Context, envelope Envelope, sender email.Sender) error {
+	var event VerificationRequestedEvent
+	if err := decodeEvent(envelope, typeVerificationRequested, &event); err != nil {
+		return err
+	}
+	if event.Email == "" || event.Token == "" {
+		return fmt.Errorf("%w: verification requested event for user %d is missing email or token", ErrMalformedEvent, event.UserID)
+	}
+
+	msg, err := email.VerificationMessage(event.Email, event.Username, event.Token, &event.ExpiresAt, email.AppBaseURL())
+	if err != nil {
+		return err
+	}
+	if err := sender.Send(msg); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Verification email resent", "user_id", event.UserID)
+	return nil
+}
@@ -0,0 +1,90 @@
+// Package metrics exposes Prometheus metrics on GET /metrics.
+//
+// Metrics live in Registry rather than the global default registry, so tests
+// can read them with Registry.Gather without running a Prometheus server.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"notification-service/internal/email"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric of the service, including Go runtime and
+// process metrics.
+var Registry = prometheus.NewRegistry()
+
+// Results of handling a message.
+const (
+	ResultProcessed    = "processed"
+	ResultRetried      = "retried"       // Failed and moved to a delay queue to be retried
+	ResultDeadLettered = "dead_lettered" // Malformed or out of attempts, moved to the dead letter queue
+	ResultRequeued     = "requeued"      // Could not be moved, left to the broker to redeliver
+	ResultDuplicate    = "duplicate"     // Already handled, acknowledged without sending the email again
+)
+
+var (
+	messagesConsumedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "messages_consumed_total",
+		Help: "Messages consumed from the message broker by event type and result (processed, retried, dead_lettered or requeued).",
+	}, []string{"event", "result"})
+
+	messageProcessingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "message_processing_duration_seconds",
+		Help:    "Time taken to handle a message, including sending its email, by event type.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"event"})
+
+	emailsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "emails_total",
+		Help: "Emails handed to the mail server by result (sent or failed).",
+	}, []string{"result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		messagesConsumedTotal,
+		messageProcessingDuration,
+		emailsTotal,
+	)
+}
+
+// Handler serves the metrics in Registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// MessageHandled records a message of type event (its routing key, e.g.
+// "user.registered"), what became of it and how long handling it took.
+func MessageHandled(event, result string, took time.Duration) {
+	messagesConsumedTotal.WithLabelValues(event, result).Inc()
+	messageProcessingDuration.WithLabelValues(event).Observe(took.Seconds())
+}
+
+// countingSender counts the emails sent through the wrapped Sender.
+type countingSender struct {
+	email.Sender
+}
+
+// InstrumentSender wraps sender so every email it sends is counted in
+// emails_total.
+func InstrumentSender(sender email.Sender) email.Sender {
+	return countingSender{sender}
+}
+
+func (s countingSender) Send(msg email.Message) error {
+	err := s.Sender.Send(msg)
+	result := "sent"
+	if err != nil {
+		result = "failed"
+	}
+	emailsTotal.WithLabelValues(result).Inc()
+	return err
+}
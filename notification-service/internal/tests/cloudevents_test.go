@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"notification-service/internal/events"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const loginData = `{"user_id": 7, "email": "ada@example.com", "username": "ada", "method": "password"}`
+
+func TestDecodeDelivery_StructuredMode(t *testing.T) {
+	d := amqp.Delivery{
+		ContentType: "application/cloudevents+json; charset=utf-8",
+		Body: []byte(`{"specversion": "1.0", "id": "6f1c2b1e-8a47-4a53-9a0e-2d6c7f3b9e10", "source": "auth-service",
+			"type": "user.logged_in", "subject": "7", "time": "2026-10-16T12:00:00Z",
+			"datacontenttype": "application/json", "dataversion": 1, "correlationid": "req-1", "data": ` + loginData + `}`),
+	}
+
+	envelope, err := events.DecodeDelivery(d)
+	require.NoError(t, err)
+	assert.Equal(t, "6f1c2b1e-8a47-4a53-9a0e-2d6c7f3b9e10", envelope.ID)
+	assert.Equal(t, "user.logged_in", envelope.Type)
+	assert.Equal(t, "auth-service", envelope.Source)
+	assert.Equal(t, "7", envelope.Subject)
+	assert.Equal(t, 1, envelope.DataVersion)
+	assert.Equal(t, "req-1", envelope.CorrelationID)
+	assert.True(t, envelope.Time.Equal(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)))
+	assert.JSONEq(t, loginData, string(envelope.Data))
+}
+
+func TestDecodeDelivery_BinaryMode(t *testing.T) {
+	d := amqp.Delivery{
+		ContentType: "application/json",
+		Headers: amqp.Table{
+			"cloudEvents:specversion":   "1.0",
+			"cloudEvents:id":            "6f1c2b1e-8a47-4a53-9a0e-2d6c7f3b9e10",
+			"cloudEvents:source":        "auth-service",
+			"cloudEvents:type":          "user.logged_in",
+			"cloudEvents:subject":       "7",
+			"cloudEvents:time":          "2026-10-16T12:00:00.123456Z",
+			"cloudEvents:dataversion":   int32(1), // Integers come back from the broker in their wire width
+			"cloudEvents:correlationid": "req-1",
+		},
+		Body: []byte(loginData),
+	}
+
+	envelope, err := events.DecodeDelivery(d)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", envelope.SpecVersion)
+	assert.Equal(t, "6f1c2b1e-8a47-4a53-9a0e-2d6c7f3b9e10", envelope.ID)
+	assert.Equal(t, "user.logged_in", envelope.Type)
+	assert.Equal(t, "7", envelope.Subject)
+	assert.Equal(t, "application/json", envelope.DataContentType)
+	assert.Equal(t, 1, envelope.DataVersion)
+	assert.Equal(t, "req-1", envelope.CorrelationID)
+	assert.True(t, envelope.Time.Equal(time.Date(2026, 10, 16, 12, 0, 0, 123456000, time.UTC)))
+	assert.JSONEq(t, loginData, string(envelope.Data))
+
+	// Both modes decode to the same envelope apart from the data's formatting
+	structured, err := json.Marshal(envelope)
+	require.NoError(t, err)
+	again, err := events.DecodeDelivery(amqp.Delivery{ContentType: "application/cloudevents+json", Body: structured})
+	require.NoError(t, err)
+	assert.Equal(t, envelope.ID, again.ID)
+	assert.Equal(t, envelope.DataVersion, again.DataVersion)
+}
+
+func TestDecodeDelivery_RejectsOtherMessages(t *testing.T) {
+	for name, d := range map[string]amqp.Delivery{
+		"plain JSON":       {ContentType: "application/json", Body: []byte(loginData)},
+		"broken structure": {ContentType: "application/cloudevents+json", Body: []byte(`{"specversion": `)},
+		"other version": {ContentType: "application/cloudevents+json",
+			Body: []byte(`{"specversion": "0.3", "id": "1", "source": "auth-service", "type": "user.logged_in"}`)},
+		"missing type": {ContentType: "application/json", Body: []byte(loginData),
+			Headers: amqp.Table{"cloudEvents:specversion": "1.0", "cloudEvents:id": "1", "cloudEvents:source": "auth-service"}},
+		"bad time": {ContentType: "application/json", Body: []byte(loginData),
+			Headers: amqp.Table{"cloudEvents:specversion": "1.0", "cloudEvents:id": "1", "cloudEvents:source": "auth-service",
+				"cloudEvents:type": "user.logged_in", "cloudEvents:time": "yesterday"}},
+	} {
+		_, err := events.DecodeDelivery(d)
+		assert.Error(t, err, name)
+	}
+}
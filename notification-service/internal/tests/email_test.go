@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"notification-service/internal/email"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordResetMessage_ContainsResetLink(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	msg, err := email.PasswordResetMessage("reset@example.com", "resetuser", "abc+/=token", expiresAt, "https://app.example.com")
+	require.NoError(t, err)
+
+	assert.Equal(t, "reset@example.com", msg.To)
+	assert.Equal(t, "Reset your password", msg.Subject)
+	// The token is query-escaped so it survives being clicked
+	assert.Contains(t, msg.TextBody, "https://app.example.com/reset-password?token=abc%2B%2F%3Dtoken")
+	assert.Contains(t, msg.TextBody, "Hi resetuser,")
+	assert.Contains(t, msg.TextBody, "2026-10-16 12:00 UTC")
+	assert.True(t, strings.Contains(msg.HTMLBody, `href="https://app.example.com/reset-password?token=abc%2B%2F%3Dtoken"`), msg.HTMLBody)
+}
+
+func TestMagicLinkMessage_ContainsSignInLink(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 16, 12, 15, 0, 0, time.UTC)
+
+	msg, err := email.MagicLinkMessage("link@example.com", "", "abc+/=token", expiresAt, "https://app.example.com")
+	require.NoError(t, err)
+
+	assert.Equal(t, "link@example.com", msg.To)
+	assert.Equal(t, "Your sign-in link", msg.Subject)
+	assert.Contains(t, msg.TextBody, "https://app.example.com/login/magic-link?token=abc%2B%2F%3Dtoken")
+	assert.Contains(t, msg.TextBody, "Hi there,")
+	assert.Contains(t, msg.TextBody, "2026-10-16 12:15 UTC")
+	assert.Contains(t, msg.HTMLBody, `href="https://app.example.com/login/magic-link?token=abc%2B%2F%3Dtoken"`)
+}
+
+func TestAppBaseURL_TrimsTrailingSlash(t *testing.T) {
+	t.Setenv("APP_BASE_URL", "https://app.example.com/")
+	assert.Equal(t, "https://app.example.com", email.AppBaseURL())
+}
+
+func TestVerificationMessage_ContainsVerifyLink(t *testing.T) {
+	expiresAt := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+
+	msg, err := email.VerificationMessage("new@example.com", "newuser", "verify-token", &expiresAt, "https://app.example.com")
+	require.NoError(t, err)
+
+	assert.Equal(t, "new@example.com", msg.To)
+	assert.Equal(t, "Verify your email address", msg.Subject)
+	assert.Contains(t, msg.TextBody, "https://app.example.com/verify-email?token=verify-token")
+	assert.Contains(t, msg.TextBody, "2026-10-18 09:30 UTC")
+	assert.Contains(t, msg.HTMLBody, `href="https://app.example.com/verify-email?token=verify-token"`)
+
+	// The expiry line is optional
+	msg, err = email.VerificationMessage("new@example.com", "", "verify-token", nil, "https://app.example.com")
+	require.NoError(t, err)
+	assert.Contains(t, msg.TextBody, "Hi there,")
+	assert.NotContains(t, msg.TextBody, "expires")
+}
+
+func TestEmailChangedNoticeMessage_NamesNewAddress(t *testing.T) {
+	msg, err := email.EmailChangedNoticeMessage("old@example.com", "ada", "new@example.com")
+	require.NoError(t, err)
+
+	assert.Equal(t, "old@example.com", msg.To)
+	assert.Contains(t, msg.TextBody, "changed to new@example.com")
+}
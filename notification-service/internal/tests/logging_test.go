@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"cozy-go/shared/logging"
+	"cozy-go/shared/requestid"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogging_AddsRequestIDAndRedacts(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(logging.NewHandler(&buf, slog.LevelInfo))
+
+	ctx := requestid.NewContext(context.Background(), "req-789")
+	logger.InfoContext(ctx, "Sending http://localhost:3000/reset-password?token=abc123",
+		"token", "abc123", "user_id", 7)
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "req-789", record["request_id"])
+	assert.Equal(t, "Sending http://localhost:3000/reset-password?token="+logging.Redacted, record["msg"])
+	assert.Equal(t, logging.Redacted, record["token"])
+	assert.EqualValues(t, 7, record["user_id"])
+	assert.NotContains(t, buf.String(), "abc123")
+}
+
+func TestLogging_NoRequestIDWithoutCorrelation(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(logging.NewHandler(&buf, slog.LevelInfo))
+
+	logger.InfoContext(requestid.NewContext(context.Background(), ""), "Received a message")
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.NotContains(t, record, "request_id")
+}
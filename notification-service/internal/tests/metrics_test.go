@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"notification-service/internal/email"
+	"notification-service/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// senderFunc adapts a function to email.Sender.
+type senderFunc func(email.Message) error
+
+func (f senderFunc) Send(msg email.Message) error { return f(msg) }
+
+// counterValue returns the counter named name with exactly labels in
+// metrics.Registry, or 0 if it has not been incremented yet.
+func counterValue(t *testing.T, name string, labels prometheus.Labels) float64 {
+	t.Helper()
+	families, err := metrics.Registry.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			got := prometheus.Labels{}
+			for _, label := range m.GetLabel() {
+				got[label.GetName()] = label.GetValue()
+			}
+			if assert.ObjectsAreEqual(labels, got) {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestInstrumentSender_CountsSentAndFailedEmails(t *testing.T) {
+	sent := counterValue(t, "emails_total", prometheus.Labels{"result": "sent"})
+	failed := counterValue(t, "emails_total", prometheus.Labels{"result": "failed"})
+
+	ok := metrics.InstrumentSender(senderFunc(func(email.Message) error { return nil }))
+	broken := metrics.InstrumentSender(senderFunc(func(email.Message) error { return errors.New("smtp down") }))
+	require.NoError(t, ok.Send(email.Message{To: "a@example.com"}))
+	require.NoError(t, ok.Send(email.Message{To: "b@example.com"}))
+	require.Error(t, broken.Send(email.Message{To: "c@example.com"}))
+
+	assert.Equal(t, sent+2, counterValue(t, "emails_total", prometheus.Labels{"result": "sent"}))
+	assert.Equal(t, failed+1, counterValue(t, "emails_total", prometheus.Labels{"result": "failed"}))
+}
+
+func TestMessageHandled_ServedOnMetricsEndpoint(t *testing.T) {
+	labels := prometheus.Labels{"event": "user.password_reset_requested", "result": metrics.ResultRetried}
+	before := counterValue(t, "messages_consumed_total", labels)
+
+	metrics.MessageHandled("user.password_reset_requested", metrics.ResultRetried, 20*time.Millisecond)
+
+	assert.Equal(t, before+1, counterValue(t, "messages_consumed_total", labels))
+	rr := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `message_processing_duration_seconds_count{event="user.password_reset_requested"}`)
+}
@@ -0,0 +1,312 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"cozy-go/topology"
+	"notification-service/internal/email"
+	"notification-service/internal/events"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testConsumerConfig retries after a few milliseconds so tests run fast.
+func testConsumerConfig() events.ConsumerConfig {
+	return events.ConsumerConfig{Prefetch: 10, MaxAttempts: 3, MinRetryDelay: 5 * time.Millisecond, MaxRetryDelay: 20 * time.Millisecond, ConfirmTimeout: time.Second}
+}
+
+// flakySender fails the first failures emails (all while failures is
+// negative) and passes the others to sent.
+type flakySender struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	sent     chan email.Message
+}
+
+func newFlakySender(failures int) *flakySender {
+	return &flakySender{failures: failures, sent: make(chan email.Message, 10)}
+}
+
+func (s *flakySender) Send(msg email.Message) error {
+	s.mu.Lock()
+	s.calls++
+	fail := s.failures < 0 || s.calls <= s.failures
+	s.mu.Unlock()
+	if fail {
+		return errors.New("smtp down")
+	}
+	s.sent <- msg
+	return nil
+}
+
+func (s *flakySender) Calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// startConsumer runs ConsumeMessages on broker until the test ends.
+func startConsumer(t *testing.T, broker *topology.MemoryBroker, sender email.Sender, config events.ConsumerConfig) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- events.ConsumeMessages(broker, sender, config) }()
+	t.Cleanup(func() {
+		broker.Close()
+		<-done
+	})
+}
+
+// queueLength returns the number of messages ready in queue.
+func queueLength(t *testing.T, broker *topology.MemoryBroker, queue string) int {
+	t.Helper()
+	ch, err := broker.Channel()
+	require.NoError(t, err)
+	q, err := ch.QueueDeclare(queue, true, false, false, false, nil)
+	require.NoError(t, err)
+	return q.Messages
+}
+
+// waitForDeadLetter waits for the next message in the dead letter queue.
+func waitForDeadLetter(t *testing.T, broker *topology.MemoryBroker) amqp.Delivery {
+	t.Helper()
+	var d amqp.Delivery
+	require.Eventually(t, func() bool {
+		var ok bool
+		d, ok = broker.Get(events.DeadLetterQueue)
+		return ok
+	}, 5*time.Second, 5*time.Millisecond, "nothing was dead-lettered")
+	return d
+}
+
+func TestConsumerConfig_RetryDelayDoublesUpToMax(t *testing.T) {
+	config := events.ConsumerConfig{MinRetryDelay: 10 * time.Second, MaxRetryDelay: time.Minute}
+	assert.Equal(t, 10*time.Second, config.RetryDelay(1))
+	assert.Equal(t, 20*time.Second, config.RetryDelay(2))
+	assert.Equal(t, 40*time.Second, config.RetryDelay(3))
+	assert.Equal(t, time.Minute, config.RetryDelay(4))
+	assert.Equal(t, time.Minute, config.RetryDelay(30))
+	assert.Equal(t, "notification-service.events.retry.10s", events.DelayQueue(config.RetryDelay(1)))
+}
+
+func TestConsumer_RetriesFailedEmailAfterDelay(t *testing.T) {
+	broker := topology.NewMemoryBroker()
+	sender := newFlakySender(2)
+	publish(t, broker, "user.registered", registeredEvent())
+	startConsumer(t, broker, sender, testConsumerConfig())
+
+	select {
+	case msg := <-sender.sent:
+		assert.Equal(t, "ada@example.com", msg.To)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the email was not retried")
+	}
+	assert.Equal(t, 3, sender.Calls())
+	assert.Eventually(t, func() bool { return broker.Unacked() == 0 }, time.Second, 5*time.Millisecond)
+	_, dead := broker.Get(events.DeadLetterQueue)
+	assert.False(t, dead)
+}
+
+func TestConsumer_RequeuesWhenRetryIsNotConfirmed(t *testing.T) {
+	for name, mode := range map[string]topology.ConfirmMode{
+		"nacked":        topology.ConfirmNack,
+		"not confirmed": topology.ConfirmNever,
+	} {
+		t.Run(name, func(t *testing.T) {
+			broker := topology.NewMemoryBroker()
+			sender := newFlakySender(-1)
+			config := testConsumerConfig()
+			config.ConfirmTimeout = 20 * time.Millisecond
+			firstDelay := events.DelayQueue(config.RetryDelay(1))
+			broker.SetConfirmMode(firstDelay, mode)
+			publish(t, broker, "user.registered", registeredEvent())
+			startConsumer(t, broker, sender, config)
+
+			// The message stays with the broker and is redelivered
+			require.Eventually(t, func() bool { return sender.Calls() >= 2 }, 5*time.Second, 5*time.Millisecond)
+			assert.Zero(t, queueLength(t, broker, firstDelay))
+
+			// Once the broker confirms again, the message goes through its attempts
+			broker.SetConfirmMode(firstDelay, topology.ConfirmAck)
+			d := waitForDeadLetter(t, broker)
+			assert.Equal(t, "6f1c2b1e-8a47-4a53-9a0e-2d6c7f3b9e10", d.MessageId)
+			assert.Equal(t, int64(3), d.Headers["x-attempts"])
+		})
+	}
+}
+
+func TestConsumer_SkipsDuplicateOfHandledEvent(t *testing.T) {
+	broker := topology.NewMemoryBroker()
+	sender := newFlakySender(0)
+	// A publisher that could not confirm the first copy sends it again
+	publish(t, broker, "user.registered", registeredEvent())
+	publish(t, broker, "user.registered", registeredEvent())
+	startConsumer(t, broker, sender, testConsumerConfig())
+
+	assert.Eventually(t, func() bool {
+		return queueLength(t, broker, topology.NotificationQueue) == 0 && broker.Unacked() == 0
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, sender.Calls())
+	assert.Len(t, sender.sent, 1)
+}
+
+func TestConsumer_DeadLettersAfterMaxAttempts(t *testing.T) {
+	broker := topology.NewMemoryBroker()
+	sender := newFlakySender(-1)
+	publish(t, broker, "user.registered", registeredEvent())
+	startConsumer(t, broker, sender, testConsumerConfig())
+
+	d := waitForDeadLetter(t, broker)
+	assert.Equal(t, 3, sender.Calls())
+	assert.Equal(t, "6f1c2b1e-8a47-4a53-9a0e-2d6c7f3b9e10", d.MessageId)
+	assert.Equal(t, registeredEvent().Body, d.Body)
+	assert.Equal(t, int64(3), d.Headers["x-attempts"])
+	assert.Equal(t, "attempts", d.Headers["x-dead-lettered"])
+	assert.Equal(t, "user.registered", d.Headers["x-routing-key"])
+	assert.Contains(t, d.Headers["x-last-error"], "smtp down")
+	assert.Eventually(t, func() bool { return broker.Unacked() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestConsumer_DeadLettersPoisonMessagesAtOnce(t *testing.T) {
+	for name, msg := range map[string]amqp.Publishing{
+		"unparseable body": {ContentType: "application/cloudevents+json", Body: []byte(`{"specversion": `)},
+		"not a CloudEvent": {ContentType: "text/plain", Body: []byte("hello")},
+		"missing email": {ContentType: "application/cloudevents+json", Body: []byte(`{"specversion": "1.0", "id": "e1",
+			"source": "auth-service", "type": "user.registered", "dataversion": 1, "data": {"user_id": 7, "verification_token": "t"}}`)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			broker := topology.NewMemoryBroker()
+			sender := newFlakySender(0)
+			publish(t, broker, "user.registered", msg)
+			startConsumer(t, broker, sender, testConsumerConfig())
+
+			d := waitForDeadLetter(t, broker)
+			assert.Zero(t, sender.Calls())
+			assert.Equal(t, int64(1), d.Headers["x-attempts"])
+			assert.Equal(t, "malformed", d.Headers["x-dead-lettered"])
+		})
+	}
+}
+
+// blockingSender holds every email until release is closed.
+type blockingSender struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSender) Send(email.Message) error {
+	s.entered <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func TestConsumer_PrefetchBoundsUnacknowledgedMessages(t *testing.T) {
+	broker := topology.NewMemoryBroker()
+	sender := &blockingSender{entered: make(chan struct{}, 3), release: make(chan struct{})}
+	for _, id := range []string{"e1", "e2", "e3"} {
+		publish(t, broker, "user.registered", registeredEventWithID(id))
+	}
+	config := testConsumerConfig()
+	config.Prefetch = 1
+	startConsumer(t, broker, sender, config)
+
+	<-sender.entered
+	assert.Equal(t, 1, broker.Unacked())
+	assert.Equal(t, 2, queueLength(t, broker, topology.NotificationQueue))
+
+	close(sender.release)
+	for range 2 {
+		select {
+		case <-sender.entered:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the remaining messages were not delivered")
+		}
+	}
+	assert.Eventually(t, func() bool { return broker.Unacked() == 0 }, time.Second, 5*time.Millisecond)
+}
+
+func TestReplayDeadLetters_MovesMessagesBackWithFreshAttempts(t *testing.T) {
+	broker := topology.NewMemoryBroker()
+	ch, err := broker.Channel()
+	require.NoError(t, err)
+	_, err = ch.QueueDeclare(events.DeadLetterQueue, true, false, false, false, nil)
+	require.NoError(t, err)
+	for _, id := range []string{"e1", "e2", "e3"} {
+		msg := registeredEvent()
+		msg.MessageId = id
+		msg.Headers = amqp.Table{"x-attempts": int64(3), "x-routing-key": "user.registered", "x-last-error": "smtp down", "x-dead-lettered": "attempts"}
+		require.NoError(t, ch.PublishWithContext(context.Background(), "", events.DeadLetterQueue, false, false, msg))
+	}
+
+	replayed, err := events.ReplayDeadLetters(context.Background(), broker, 2, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 2, replayed)
+	assert.Equal(t, 1, queueLength(t, broker, events.DeadLetterQueue))
+	assert.Zero(t, broker.Unacked())
+
+	d, ok := broker.Get(topology.NotificationQueue)
+	require.True(t, ok)
+	assert.Equal(t, "e1", d.MessageId)
+	assert.Equal(t, amqp.Table{"x-routing-key": "user.registered"}, d.Headers)
+
+	replayed, err = events.ReplayDeadLetters(context.Background(), broker, 0, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+	assert.Zero(t, queueLength(t, broker, events.DeadLetterQueue))
+}
+
+func TestReplayDeadLetters_ReplayedMessageIsSent(t *testing.T) {
+	broker := topology.NewMemoryBroker()
+	sender := newFlakySender(-1)
+	publish(t, broker, "user.registered", registeredEvent())
+	config := testConsumerConfig()
+	config.MaxAttempts = 1
+	startConsumer(t, broker, sender, config)
+
+	// The registration is dead-lettered while the mail server is down
+	require.Eventually(t, func() bool { return queueLength(t, broker, events.DeadLetterQueue) == 1 }, 5*time.Second, 5*time.Millisecond)
+
+	sender.mu.Lock()
+	sender.failures = 0
+	sender.mu.Unlock()
+	replayed, err := events.ReplayDeadLetters(context.Background(), broker, 0, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, 1, replayed)
+
+	select {
+	case msg := <-sender.sent:
+		assert.Equal(t, "ada@example.com", msg.To)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the replayed message was not sent")
+	}
+	assert.Zero(t, queueLength(t, broker, events.DeadLetterQueue))
+}
+
+func TestReplayDeadLetters_KeepsMessageWhenReplayIsNotConfirmed(t *testing.T) {
+	for name, mode := range map[string]topology.ConfirmMode{
+		"nacked":        topology.ConfirmNack,
+		"not confirmed": topology.ConfirmNever,
+	} {
+		t.Run(name, func(t *testing.T) {
+			broker := topology.NewMemoryBroker()
+			ch, err := broker.Channel()
+			require.NoError(t, err)
+			_, err = ch.QueueDeclare(events.DeadLetterQueue, true, false, false, false, nil)
+			require.NoError(t, err)
+			require.NoError(t, ch.PublishWithContext(context.Background(), "", events.DeadLetterQueue, false, false, registeredEvent()))
+			broker.SetConfirmMode(topology.NotificationQueue, mode)
+
+			replayed, err := events.ReplayDeadLetters(context.Background(), broker, 0, 20*time.Millisecond)
+			require.Error(t, err)
+			assert.Zero(t, replayed)
+			assert.Equal(t, 1, queueLength(t, broker, events.DeadLetterQueue))
+			assert.Zero(t, broker.Unacked())
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"cozy-go/topology"
+	"notification-service/internal/email"
+	"notification-service/internal/events"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSender passes every email it is asked to send to sent.
+type recordingSender struct {
+	sent chan email.Message
+}
+
+func newRecordingSender() *recordingSender {
+	return &recordingSender{sent: make(chan email.Message, 10)}
+}
+
+func (s *recordingSender) Send(msg email.Message) error {
+	s.sent <- msg
+	return nil
+}
+
+// registeredEvent is a user.registered event as auth-service publishes it in
+// structured content mode.
+func registeredEvent() amqp.Publishing {
+	return amqp.Publishing{
+		ContentType:   "application/cloudevents+json; charset=utf-8",
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     "6f1c2b1e-8a47-4a53-9a0e-2d6c7f3b9e10",
+		Type:          "user.registered",
+		CorrelationId: "req-1",
+		Body: []byte(`{"specversion": "1.0", "id": "6f1c2b1e-8a47-4a53-9a0e-2d6c7f3b9e10", "source": "auth-service",
+			"type": "user.registered", "subject": "7", "time": "2026-10-16T12:00:00Z", "datacontenttype": "application/json",
+			"dataversion": 1, "correlationid": "req-1",
+			"data": {"user_id": 7, "email": "ada@example.com", "username": "ada", "verification_token": "verify-token-123"}}`),
+	}
+}
+
+// registeredEventWithID returns registeredEvent as a different event, with id
+// as its CloudEvents and message ID.
+func registeredEventWithID(id string) amqp.Publishing {
+	msg := registeredEvent()
+	msg.Body = bytes.ReplaceAll(msg.Body, []byte(msg.MessageId), []byte(id))
+	msg.MessageId = id
+	return msg
+}
+
+// publish sends msg to the events exchange the way auth-service does, after
+// declaring the shared topology like its publisher.
+func publish(t *testing.T, broker *topology.MemoryBroker, routingKey string, msg amqp.Publishing) {
+	t.Helper()
+	ch, err := broker.Channel()
+	require.NoError(t, err)
+	require.NoError(t, topology.Declare(ch))
+	require.NoError(t, ch.PublishWithContext(context.Background(), topology.Exchange, routingKey, false, false, msg))
+}
+
+// TestTopology_RegistrationReachesEmailSender publishes a registration the way
+// auth-service does, before the consumer has started, and checks that the
+// verification email is sent.
+func TestTopology_RegistrationReachesEmailSender(t *testing.T) {
+	broker := topology.NewMemoryBroker()
+	publish(t, broker, "user.registered", registeredEvent())
+
+	sender := newRecordingSender()
+	done := make(chan error, 1)
+	go func() { done <- events.ConsumeMessages(broker, sender, events.DefaultConsumerConfig()) }()
+
+	select {
+	case msg := <-sender.sent:
+		assert.Equal(t, "ada@example.com", msg.To)
+		assert.True(t, strings.Contains(msg.TextBody, "verify-token-123"), "the email carries the verification link")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the registration did not reach the email sender")
+	}
+
+	// Closing the connection stops the consumer
+	require.NoError(t, broker.Close())
+	select {
+	case err := <-done:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the consumer did not stop")
+	}
+}
+
+func TestTopology_NotificationQueueOnlyGetsItsEvents(t *testing.T) {
+	broker := topology.NewMemoryBroker()
+	publish(t, broker, "user.deleted", amqp.Publishing{Body: []byte(`{}`)})
+	publish(t, broker, "task.created", amqp.Publishing{Body: []byte(`{}`)})
+
+	_, ok := broker.Get(topology.NotificationQueue)
+	assert.False(t, ok)
+	_, ok = broker.Get(topology.TaskQueue)
+	assert.True(t, ok, "user.deleted is for task-service")
+	assert.Equal(t, []string{topology.NotificationQueue}, topology.Routes("user.magic_link_requested"))
+}
+
+func TestTopology_VerificationRequestReachesEmailSender(t *testing.T) {
+	broker := topology.NewMemoryBroker()
+	publish(t, broker, "user.verification_requested", amqp.Publishing{
+		ContentType:  "application/cloudevents+json; charset=utf-8",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    "0b7e2c4a-3f1d-4e8b-9c6a-5d2f1e0a9b87",
+		Type:         "user.verification_requested",
+		Body: []byte(`{"specversion": "1.0", "id": "0b7e2c4a-3f1d-4e8b-9c6a-5d2f1e0a9b87", "source": "auth-service",
+			"type": "user.verification_requested", "subject": "7", "time": "2026-10-16T12:00:00Z", "datacontenttype": "application/json",
+			"dataversion": 1, "data": {"user_id": 7, "email": "ada@example.com", "username": "ada",
+			"token": "verify-token-456", "expires_at": "2026-10-17T12:00:00Z"}}`),
+	})
+
+	sender := newRecordingSender()
+	startConsumer(t, broker, sender, events.DefaultConsumerConfig())
+
+	select {
+	case msg := <-sender.sent:
+		assert.Equal(t, "ada@example.com", msg.To)
+		assert.Contains(t, msg.TextBody, "verify-token-456", "the email carries the verification link")
+	case <-time.After(5 * time.Second):
+		t.Fatal("the verification request did not reach the email sender")
+	}
+}
@@ -0,0 +1,116 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DecodeDelivery decodes the CloudEvent in d. Publishers send either in
+// structured mode, where the body is the whole event as JSON, or in binary
+// mode, where the body is the event data and the other attributes are
+// "cloudEvents:"-prefixed headers. The mode is told apart by the content type.
+// Redelivering a message that fails to decode would not change the outcome.
+func DecodeDelivery(d amqp.Delivery) (Envelope, error) {
+	mediaType, _, _ := mime.ParseMediaType(d.ContentType)
+
+	var envelope Envelope
+	if mediaType == structuredMediaType {
+		if err := json.Unmarshal(d.Body, &envelope); err != nil {
+			return Envelope{}, fmt.Errorf("failed to decode structured CloudEvent: %w", err)
+		}
+	} else {
+		if _, ok := d.Headers[AttributePrefix+"specversion"]; !ok {
+			return Envelope{}, fmt.Errorf("message with content type %q is not a CloudEvent", d.ContentType)
+		}
+		var err error
+		if envelope, err = binaryEnvelope(d); err != nil {
+			return Envelope{}, err
+		}
+	}
+
+	if envelope.SpecVersion != SpecVersion {
+		return Envelope{}, fmt.Errorf("unsupported CloudEvents spec version %q", envelope.SpecVersion)
+	}
+	if envelope.ID == "" || envelope.Type == "" || envelope.Source == "" {
+		return Envelope{}, fmt.Errorf("CloudEvent is missing id, type or source")
+	}
+	return envelope, nil
+}
+
+// binaryEnvelope builds an Envelope from a binary mode message.
+func binaryEnvelope(d amqp.Delivery) (Envelope, error) {
+	envelope := Envelope{
+		SpecVersion:     headerString(d.Headers, "specversion"),
+		ID:              headerString(d.Headers, "id"),
+		Source:          headerString(d.Headers, "source"),
+		Type:            headerString(d.Headers, "type"),
+		Subject:         headerString(d.Headers, "subject"),
+		DataContentType: d.ContentType,
+		CorrelationID:   headerString(d.Headers, "correlationid"),
+		Data:            d.Body,
+	}
+	if raw := headerString(d.Headers, "time"); raw != "" {
+		t, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("invalid CloudEvent time %q: %w", raw, err)
+		}
+		envelope.Time = t
+	}
+	version, err := headerInt(d.Headers, "dataversion")
+	if err != nil {
+		return Envelope{}, err
+	}
+	envelope.DataVersion = version
+	return envelope, nil
+}
+
+// headerString returns the CloudEvents attribute name from headers as a string.
+func headerString(headers amqp.Table, name string) string {
+	switch v := headers[AttributePrefix+name].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// headerInt returns the CloudEvents attribute name from headers as an int. AMQP
+// brokers may deliver integers in any width, or as strings.
+func headerInt(headers amqp.Table, name string) (int, error) {
+	switch v := headers[AttributePrefix+name].(type) {
+	case int8:
+		return int(v), nil
+	case int16:
+		return int(v), nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case int:
+		return v, nil
+	case byte:
+		return int(v), nil
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("invalid CloudEvent %s %q: %w", name, v, err)
+		}
+		return n, nil
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("invalid CloudEvent %s of type %T", name, v)
+	}
+}
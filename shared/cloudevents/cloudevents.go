@@ -0,0 +1,115 @@
+// Package cloudevents is the wire format of the events the services exchange:
+// a CloudEvents 1.0 envelope around the event's JSON data, sent in structured
+// or binary mode as described by the CloudEvents AMQP protocol binding.
+// Publishers encode envelopes with EncodeMessage; RabbitMQ consumers decode
+// them with DecodeDelivery.
+package cloudevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SpecVersion is the CloudEvents version of every Envelope.
+const SpecVersion = "1.0"
+
+// DataContentType is the content type of Envelope.Data.
+const DataContentType = "application/json"
+
+// Envelope is what goes on the wire for every event: a CloudEvents 1.0 event
+// with the event as JSON data. The metadata lets consumers route, deduplicate
+// and trace events without decoding Data. The JSON encoding is the CloudEvents
+// structured format; see EncodeMessage for the binary format.
+type Envelope struct {
+	SpecVersion string `json:"specversion"`
+	// ID is unique per event; a redelivered message keeps its ID.
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Type   string `json:"type"`
+	// Subject identifies what the event is about, e.g. a user ID.
+	Subject         string    `json:"subject"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	// DataVersion is the version of the schema Data conforms to. It is a
+	// CloudEvents extension attribute, as is CorrelationID.
+	DataVersion int `json:"dataversion"`
+	// CorrelationID is the ID of the request that caused the event, if any.
+	CorrelationID string          `json:"correlationid,omitempty"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// ContentMode selects how an Envelope is put on the wire. Both modes follow the
+// CloudEvents AMQP protocol binding, which RabbitMQ and Service Bus share.
+type ContentMode string
+
+const (
+	// ContentModeStructured sends the whole envelope as the JSON body, with
+	// content type StructuredContentType.
+	ContentModeStructured ContentMode = "structured"
+	// ContentModeBinary sends the event data as the body and every other
+	// attribute as a message header (application property) named
+	// AttributePrefix + attribute.
+	ContentModeBinary ContentMode = "binary"
+)
+
+// structuredMediaType marks a message body holding a whole CloudEvent as JSON.
+const structuredMediaType = "application/cloudevents+json"
+
+// StructuredContentType is the content type of structured mode messages.
+const StructuredContentType = structuredMediaType + "; charset=utf-8"
+
+// AttributePrefix prefixes CloudEvents attributes in binary mode headers.
+const AttributePrefix = "cloudEvents:"
+
+// ParseContentMode parses the CLOUDEVENTS_MODE setting. The default is structured.
+func ParseContentMode(s string) (ContentMode, error) {
+	switch ContentMode(s) {
+	case "", ContentModeStructured:
+		return ContentModeStructured, nil
+	case ContentModeBinary:
+		return ContentModeBinary, nil
+	default:
+		return "", fmt.Errorf("unknown CloudEvents content mode %q, expected %q or %q", s, ContentModeStructured, ContentModeBinary)
+	}
+}
+
+// Message is an Envelope encoded for a message broker.
+type Message struct {
+	Body        []byte
+	ContentType string
+	// Attributes holds the CloudEvents attributes in binary mode, keyed by
+	// AttributePrefix + name. It is nil in structured mode.
+	Attributes map[string]any
+}
+
+// EncodeMessage encodes envelope in mode.
+func EncodeMessage(envelope Envelope, mode ContentMode) (Message, error) {
+	switch mode {
+	case ContentModeStructured:
+		body, err := json.Marshal(envelope)
+		if err != nil {
+			return Message{}, fmt.Errorf("failed to marshal event: %w", err)
+		}
+		return Message{Body: body, ContentType: StructuredContentType}, nil
+
+	case ContentModeBinary:
+		// datacontenttype is carried by the message's own content type
+		attributes := map[string]any{
+			AttributePrefix + "specversion": envelope.SpecVersion,
+			AttributePrefix + "id":          envelope.ID,
+			AttributePrefix + "source":      envelope.Source,
+			AttributePrefix + "type":        envelope.Type,
+			AttributePrefix + "subject":     envelope.Subject,
+			AttributePrefix + "time":        envelope.Time.Format(time.RFC3339Nano),
+			AttributePrefix + "dataversion": envelope.DataVersion,
+		}
+		if envelope.CorrelationID != "" {
+			attributes[AttributePrefix+"correlationid"] = envelope.CorrelationID
+		}
+		return Message{Body: envelope.Data, ContentType: envelope.DataContentType, Attributes: attributes}, nil
+
+	default:
+		return Message{}, fmt.Errorf("unknown CloudEvents content mode %q", mode)
+	}
+}
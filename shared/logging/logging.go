@@ -0,0 +1,124 @@
+// Package logging configures structured JSON logging with log/slog for every
+// service.
+//
+// Every record carries the service name and, when logged with the context of
+// a request or message (slog.InfoContext and friends), the request ID and,
+// for HTTP requests, the ID of the authenticated user. Secrets are redacted
+// before anything is written (see redact.go).
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"cozy-go/shared/requestid"
+)
+
+// Setup installs a JSON logger for service as the default for log/slog and
+// for the standard log package. The level comes from LOG_LEVEL (debug, info,
+// warn or error; default info).
+func Setup(service string) *slog.Logger {
+	logger := slog.New(NewHandler(os.Stdout, levelFromEnv())).With("service", service)
+	slog.SetDefault(logger)
+	return logger
+}
+
+// NewHandler returns the JSON handler used by Setup, writing to w.
+func NewHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	return contextHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	})}
+}
+
+// levelFromEnv parses LOG_LEVEL.
+func levelFromEnv() slog.Level {
+	var level slog.Level
+	value := os.Getenv("LOG_LEVEL")
+	if value == "" {
+		return slog.LevelInfo
+	}
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		slog.Warn("Invalid LOG_LEVEL, using info", "value", value)
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// requestState holds what is learned about a request while it is handled.
+// It is created by AccessLog so the access log line, written after the
+// handler returns, sees the user set by the auth middleware further in.
+type requestState struct {
+	mu     sync.Mutex
+	userID string
+}
+
+type stateKey struct{}
+
+func withRequestState(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(stateKey{}).(*requestState); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, stateKey{}, &requestState{})
+}
+
+// SetUserID records the authenticated user of the request in ctx, so it is
+// added to every later log record of the request and to its access log line.
+// It does nothing outside AccessLog.
+func SetUserID(ctx context.Context, userID string) {
+	if state, ok := ctx.Value(stateKey{}).(*requestState); ok {
+		state.mu.Lock()
+		state.userID = userID
+		state.mu.Unlock()
+	}
+}
+
+// userIDFromContext returns the user recorded by SetUserID, or "".
+func userIDFromContext(ctx context.Context) string {
+	state, ok := ctx.Value(stateKey{}).(*requestState)
+	if !ok {
+		return ""
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.userID
+}
+
+// contextHandler adds request_id and user_id from the context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if id := requestid.FromContext(ctx); id != "" {
+			record.AddAttrs(slog.String("request_id", id))
+		}
+		if userID := userIDFromContext(ctx); userID != "" && !hasAttr(record, "user_id") {
+			record.AddAttrs(slog.String("user_id", userID))
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// hasAttr reports whether record already has a top-level attribute key.
+func hasAttr(record slog.Record, key string) bool {
+	found := false
+	record.Attrs(func(a slog.Attr) bool {
+		found = a.Key == key
+		return !found
+	})
+	return found
+}
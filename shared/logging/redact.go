@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secret values in log output.
+const Redacted = "[REDACTED]"
+
+// secretPatterns find secrets embedded in free text, such as messages and
+// wrapped errors: bearer tokens, JWTs, personal access tokens, passwords in
+// connection URLs and token-like query parameters.
+var secretPatterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9._~+/=-]+`), "${1}" + Redacted},
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), Redacted},
+	{regexp.MustCompile(`\b(cozy_pat_)[A-Za-z0-9_-]+`), "${1}" + Redacted},
+	{regexp.MustCompile(`(://[^:/@\s]+:)[^@\s]+@`), "${1}" + Redacted + "@"},
+	{regexp.MustCompile(`(?i)\b((?:[a-z_]*token|password|secret|code)=)[^&\s"]+`), "${1}" + Redacted},
+}
+
+// Scrub redacts secrets embedded in s.
+func Scrub(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// sensitiveKey reports whether an attribute named key holds a secret, e.g.
+// "password", "token", "refresh_token" or "authorization".
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	switch key {
+	case "token", "password", "secret", "authorization", "cookie", "set-cookie", "code", "api_key":
+		return true
+	}
+	return strings.HasSuffix(key, "_token") || strings.HasSuffix(key, "_secret") || strings.Contains(key, "password")
+}
+
+// redactAttr is the slog ReplaceAttr hook: attributes with sensitive names are
+// replaced wholesale, and string values, errors and the message are scrubbed.
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 {
+		switch a.Key {
+		case slog.MessageKey:
+			return slog.String(a.Key, Scrub(a.Value.String()))
+		case slog.TimeKey, slog.LevelKey, slog.SourceKey:
+			return a
+		}
+	}
+	if sensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Scrub(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Scrub(err.Error()))
+		}
+	}
+	return a
+}
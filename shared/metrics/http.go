@@ -0,0 +1,91 @@
+// Package metrics holds the Prometheus metrics every service exposes: HTTP
+// request counts and latencies, and database connection pool statistics.
+// Each service registers them with its own registry next to its
+// service-specific metrics.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// unmatchedRoute labels requests that matched no route, so scanners probing
+// random paths cannot create new series.
+const unmatchedRoute = "unmatched"
+
+// HTTP holds the http_requests_total and http_request_duration_seconds
+// metrics of a service; see NewHTTP.
+type HTTP struct {
+	requestsTotal   *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+}
+
+// NewHTTP creates the HTTP request metrics and registers them with registerer,
+// typically the service's own registry.
+func NewHTTP(registerer prometheus.Registerer) *HTTP {
+	m := &HTTP{
+		requestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by method, route pattern and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+	}
+	registerer.MustRegister(m.requestsTotal, m.requestDuration)
+	return m
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Instrument counts requests and observes their latency, labelled with the
+// ServeMux pattern that matched them (e.g. "DELETE /me/tokens/{id}") rather
+// than the raw path. It must wrap the ServeMux directly: the mux records the
+// pattern on the request it is given.
+func (m *HTTP) Instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		mux.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		route := r.Pattern
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(rec.status)
+		m.requestsTotal.WithLabelValues(r.Method, route, status).Inc()
+		m.requestDuration.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
+	})
+}
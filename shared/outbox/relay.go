@@ -0,0 +1,220 @@
+// Package outbox publishes the events stored in the outbox table.
+//
+// Repository methods insert an event into the outbox in the same transaction
+// as the change it describes. The Relay polls for those rows and publishes them
+// with the configured Publisher, so an event is delivered at least once even
+// if the broker is down when the change commits. Failed attempts are retried
+// with exponential backoff for as long as it takes. Every attempt carries the
+// envelope's ID as the message ID, so a consumer can recognise the copies that
+// at-least-once delivery can produce; notification-service skips copies of the
+// events it handled recently, and Service Bus drops them when duplicate
+// detection is enabled on the queue. auth-service and task-service each run a
+// relay against their own outbox table.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"cozy-go/shared/cloudevents"
+	"cozy-go/shared/requestid"
+)
+
+// Event is an event waiting in the outbox table to be published. Payload is
+// the JSON of the cloudevents.Envelope, stored when the change that caused the
+// event was committed.
+type Event struct {
+	ID        int64
+	EventID   string
+	EventType string
+	Payload   []byte
+	// Attempts counts the failed publish attempts so far
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// Store is the outbox table; see each service's repository.OutboxRepository.
+type Store interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, leaseUntil time.Time) ([]Event, error)
+	MarkOutboxEventPublished(ctx context.Context, id int64) error
+	MarkOutboxEventFailed(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error
+	DeletePublishedOutboxEvents(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Publisher sends a stored envelope to the message broker, keeping its ID.
+type Publisher interface {
+	PublishEnvelope(ctx context.Context, envelope cloudevents.Envelope) error
+}
+
+// Config tunes the relay.
+type Config struct {
+	// PollInterval is how long the relay sleeps when the outbox is drained
+	PollInterval time.Duration
+	// BatchSize is the number of events claimed at once
+	BatchSize int
+	// Lease is how long claimed events are hidden from other relays. It must
+	// comfortably exceed the time it takes to publish a batch.
+	Lease time.Duration
+	// MinBackoff is the delay after the first failed attempt; it doubles with
+	// every further failure up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Retention is how long published events are kept for troubleshooting
+	Retention time.Duration
+}
+
+// DefaultConfig returns the settings used unless overridden by the environment.
+func DefaultConfig() Config {
+	return Config{
+		PollInterval: time.Second,
+		BatchSize:    100,
+		Lease:        time.Minute,
+		MinBackoff:   time.Second,
+		MaxBackoff:   5 * time.Minute,
+		Retention:    7 * 24 * time.Hour,
+	}
+}
+
+// ConfigFromEnv returns DefaultConfig with OUTBOX_POLL_INTERVAL,
+// OUTBOX_MAX_BACKOFF and OUTBOX_RETENTION applied. Invalid values are logged
+// and ignored.
+func ConfigFromEnv() Config {
+	config := DefaultConfig()
+	config.PollInterval = durationFromEnv("OUTBOX_POLL_INTERVAL", config.PollInterval)
+	config.MaxBackoff = durationFromEnv("OUTBOX_MAX_BACKOFF", config.MaxBackoff)
+	config.Retention = durationFromEnv("OUTBOX_RETENTION", config.Retention)
+	return config
+}
+
+// pruneInterval is how often published events past the retention are deleted.
+const pruneInterval = time.Hour
+
+// Relay publishes pending outbox events. Several relays (one per instance)
+// can run against the same table; each event is claimed by one at a time.
+type Relay struct {
+	store     Store
+	publisher Publisher
+	config    Config
+	// lastPruned is when published events were last pruned
+	lastPruned time.Time
+}
+
+// NewRelay creates a relay that publishes the events in store with publisher.
+func NewRelay(store Store, publisher Publisher, config Config) *Relay {
+	return &Relay{store: store, publisher: publisher, config: config}
+}
+
+// Run relays events until ctx is cancelled. A full batch is followed
+// immediately by the next one; otherwise the relay waits PollInterval.
+func (r *Relay) Run(ctx context.Context) {
+	slog.InfoContext(ctx, "Outbox relay started", "poll_interval", r.config.PollInterval, "batch_size", r.config.BatchSize)
+	for {
+		published, err := r.RelayPending(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to relay outbox events", "error", err)
+		}
+		r.prune(ctx)
+
+		if err == nil && published == r.config.BatchSize && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			slog.InfoContext(ctx, "Outbox relay stopped")
+			return
+		case <-time.After(r.config.PollInterval):
+		}
+	}
+}
+
+// RelayPending claims one batch of due events and publishes them. It returns
+// the number published; failures are recorded on the events and retried later.
+// Only failing to claim a batch is returned as an error.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	batch, err := r.store.ClaimOutboxEvents(ctx, r.config.BatchSize, time.Now().Add(r.config.Lease))
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, event := range batch {
+		if err := r.publish(ctx, event); err != nil {
+			attempts := event.Attempts + 1
+			delay := r.Backoff(attempts)
+			slog.WarnContext(ctx, "Failed to publish outbox event, will retry",
+				"event_id", event.EventID, "event_type", event.EventType, "attempts", attempts, "retry_in", delay, "error", err)
+			if err := r.store.MarkOutboxEventFailed(ctx, event.ID, err.Error(), time.Now().Add(delay)); err != nil {
+				// The event is claimed again when its lease runs out
+				slog.ErrorContext(ctx, "Failed to record outbox publish failure", "event_id", event.EventID, "error", err)
+			}
+			continue
+		}
+		published++
+		if err := r.store.MarkOutboxEventPublished(ctx, event.ID); err != nil {
+			// The event is published again when its lease runs out, with the same
+			// message ID; see the package documentation for how consumers cope
+			slog.ErrorContext(ctx, "Failed to mark outbox event published", "event_id", event.EventID, "error", err)
+		}
+	}
+	return published, nil
+}
+
+// publish sends the stored envelope of event. The request ID it was created
+// under is put back on the context so the publisher's logs can be correlated.
+func (r *Relay) publish(ctx context.Context, event Event) error {
+	var envelope cloudevents.Envelope
+	if err := json.Unmarshal(event.Payload, &envelope); err != nil {
+		return fmt.Errorf("failed to decode outbox event: %w", err)
+	}
+	if envelope.CorrelationID != "" {
+		ctx = requestid.NewContext(ctx, envelope.CorrelationID)
+	}
+	return r.publisher.PublishEnvelope(ctx, envelope)
+}
+
+// Backoff returns the delay before the next attempt after attempts failed ones:
+// MinBackoff doubled for every failure after the first, capped at MaxBackoff.
+func (r *Relay) Backoff(attempts int) time.Duration {
+	delay := r.config.MinBackoff
+	for i := 1; i < attempts && delay < r.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, r.config.MaxBackoff)
+}
+
+// prune deletes published events older than the retention, at most once per
+// pruneInterval.
+func (r *Relay) prune(ctx context.Context) {
+	now := time.Now()
+	if now.Sub(r.lastPruned) < pruneInterval {
+		return
+	}
+	r.lastPruned = now
+	deleted, err := r.store.DeletePublishedOutboxEvents(ctx, now.Add(-r.config.Retention))
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to prune published outbox events", "error", err)
+		return
+	}
+	if deleted > 0 {
+		slog.InfoContext(ctx, "Pruned published outbox events", "deleted", deleted)
+	}
+}
+
+// durationFromEnv parses the duration in the environment variable key, or
+// returns def if it is unset or invalid.
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		slog.Warn("Invalid duration, using default", "name", key, "value", val, "default", def)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,147 @@
+// Package problem writes error responses as RFC 7807 problem details
+// (Content-Type application/problem+json), so every endpoint fails in the
+// same machine-readable shape:
+//
+//	{
+//	  "type": "about:blank",
+//	  "title": "Bad Request",
+//	  "status": 400,
+//	  "detail": "Request validation failed",
+//	  "instance": "/projects",
+//	  "code": "validation_failed",
+//	  "message": "Request validation failed",
+//	  "request_id": "4b0c5c0f6e3f4e1a9d1e0b7a2f9c8d7e",
+//	  "errors": [{"field": "name", "code": "required", "message": "name is required"}]
+//	}
+//
+// code is stable and meant for programs; detail and message are for people.
+// message repeats detail for clients written against the older {"message"} bodies.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"cozy-go/shared/requestid"
+)
+
+// ContentType is the media type of problem responses.
+const ContentType = "application/problem+json"
+
+// Codes shared by several endpoints. Codes for other statuses default to
+// the snake-cased status text (see DefaultCode).
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "service_unavailable"
+)
+
+// FieldError is a problem with one request field. Field is the JSON name of
+// the field; Code is the rule that failed (e.g. "required", "email", "min").
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem details object with this API's extension members.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	Message   string       `json:"message,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// DefaultCode returns the code used for status when a handler does not give a more specific one.
+func DefaultCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusInternalServerError:
+		return CodeInternal
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(text), " ", "_")
+}
+
+// Write writes p as the response. Type, Title, Code, Message, Instance and
+// RequestID are filled in from the status and request when left empty.
+func Write(w http.ResponseWriter, r *http.Request, p Problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Code == "" {
+		p.Code = DefaultCode(p.Status)
+	}
+	if p.Message == "" {
+		p.Message = p.Detail
+	}
+	if r != nil {
+		if p.Instance == "" {
+			p.Instance = r.URL.Path
+		}
+		if p.RequestID == "" {
+			p.RequestID = requestid.FromContext(r.Context())
+		}
+	}
+
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", ContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error replies with a problem for status whose detail is message. It is the
+// problem+json counterpart of http.Error.
+func Error(w http.ResponseWriter, r *http.Request, message string, status int) {
+	Write(w, r, Problem{Status: status, Detail: message})
+}
+
+// ErrorCode is Error with a specific code, for failures clients need to tell
+// apart from others with the same status.
+func ErrorCode(w http.ResponseWriter, r *http.Request, message string, status int, code string) {
+	Write(w, r, Problem{Status: status, Detail: message, Code: code})
+}
+
+// Fields replies 400 validation_failed listing the given field errors.
+func Fields(w http.ResponseWriter, r *http.Request, message string, errs ...FieldError) {
+	Write(w, r, Problem{Status: http.StatusBadRequest, Detail: message, Code: CodeValidationFailed, Errors: errs})
+}
+
+// Field replies 400 validation_failed for a single invalid field. code names
+// the broken rule ("required", "oneof", ...) and message is shown to the user.
+func Field(w http.ResponseWriter, r *http.Request, field, code, message string) {
+	Fields(w, r, message, FieldError{Field: field, Code: code, Message: message})
+}
@@ -0,0 +1,112 @@
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// NewValidator returns a validator whose errors name fields by their JSON
+// names ("email", not "Email"), as clients see them.
+func NewValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	return validate
+}
+
+// Validation replies 400 for an error from validator.Struct, with one
+// FieldError per failed rule. Other errors get a plain invalid_request problem.
+func Validation(w http.ResponseWriter, r *http.Request, err error) {
+	fields := FieldErrors(err)
+	if len(fields) == 0 {
+		Error(w, r, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	Fields(w, r, "Request validation failed", fields...)
+}
+
+// FieldErrors converts validator errors into FieldErrors. It returns nil if
+// err does not come from the validator.
+func FieldErrors(err error) []FieldError {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return nil
+	}
+	fields := make([]FieldError, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		field := fieldPath(fe)
+		fields = append(fields, FieldError{
+			Field:   field,
+			Code:    fe.Tag(),
+			Message: field + " " + ruleMessage(fe),
+		})
+	}
+	return fields
+}
+
+// fieldPath is the field's path below the validated struct, e.g. "email" for
+// "RegisterRequest.email".
+func fieldPath(fe validator.FieldError) string {
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+		return path
+	}
+	return fe.Field()
+}
+
+// ruleMessage describes the rule a field broke, for the rules used by the request models.
+func ruleMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "required_without", "required_with":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "url", "http_url":
+		return "must be a valid URL"
+	case "min":
+		return "must be at least " + fe.Param() + lengthUnit(fe)
+	case "max":
+		return "must be at most " + fe.Param() + lengthUnit(fe)
+	case "len":
+		return "must be exactly " + fe.Param() + lengthUnit(fe)
+	case "gte":
+		return "must be greater than or equal to " + fe.Param()
+	case "lte":
+		return "must be less than or equal to " + fe.Param()
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "excludes":
+		return fmt.Sprintf("must not contain %q", fe.Param())
+	case "numeric":
+		return "must be numeric"
+	case "alphanum":
+		return "must contain only letters and digits"
+	}
+	return "is invalid"
+}
+
+// lengthUnit is the unit for min, max and len: characters for strings, items
+// for collections and nothing for numbers.
+func lengthUnit(fe validator.FieldError) string {
+	switch fe.Kind() {
+	case reflect.String:
+		return " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return " items"
+	}
+	return ""
+}
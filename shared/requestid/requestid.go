@@ -0,0 +1,79 @@
+// Package requestid assigns every HTTP request an ID that is echoed in the
+// X-Request-ID response header and in error responses, so a failure reported
+// by a user can be matched to the server side of the request.
+//
+// The ID travels with the events the request causes: publishers put it in the
+// message's correlation ID and consumers store it in the context they handle
+// the message with, so their log lines can be matched with the publisher's.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header carries the request ID. An ID sent by the client (or a proxy in front
+// of the service) is kept; otherwise one is generated.
+const Header = "X-Request-ID"
+
+// maxLength bounds accepted client IDs so they cannot bloat responses.
+const maxLength = 128
+
+type contextKey struct{}
+
+// New returns a random 128-bit request ID in hex.
+func New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic("requestid: failed to read random bytes: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewContext returns a copy of ctx carrying id. An empty id leaves ctx as is.
+func NewContext(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID in ctx, or "" if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Middleware makes sure every request has an ID: the incoming X-Request-ID
+// header if it is well-formed, a new one otherwise. The ID is stored in the
+// request context and set on the response.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = New()
+		}
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// valid reports whether a client-supplied ID is safe to echo back and log:
+// non-empty, bounded and limited to URL-safe characters.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
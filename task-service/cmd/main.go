@@ -1,19 +1,37 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
+	"cozy-go/shared/logging"
+	"cozy-go/shared/outbox"
+	"cozy-go/shared/requestid"
 	"cozy-go/task-service/internal/database" // Import database package
+	"cozy-go/task-service/internal/events"
 	"cozy-go/task-service/internal/handlers"
+	"cozy-go/task-service/internal/metrics"
+	"cozy-go/task-service/internal/middleware"
 	"cozy-go/task-service/internal/routes" // Import routes package
 	"cozy-go/task-service/repository"      // Import repository package
+	"cozy-go/topology"
 
 	"github.com/rs/cors" // Import CORS package
 )
 
+// Delays before the user deleted consumer is started again after it stopped:
+// the first one, doubled after every further failure up to the last one.
+const (
+	consumerMinRestartDelay = time.Second
+	consumerMaxRestartDelay = time.Minute
+)
+
 func main() {
+	logging.Setup("task-service")
+
 	// Basic configuration (replace with proper config loading later)
 	port := os.Getenv("TASK_SERVICE_PORT")
 	if port == "" {
@@ -22,10 +40,14 @@ func main() {
 
 	// Initialize database connection
 	if err := database.InitDB(); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		slog.Error("Failed to initialize database", "error", err)
+		os.Exit(1)
 	}
 	defer database.CloseDB() // Ensure DB connection is closed on exit
 
+	// Report connection pool statistics on /metrics
+	metrics.RegisterPool(database.DB.Stat)
+
 	// Initialize repositories
 	projectRepo := repository.NewProjectRepository()
 	taskRepo := repository.NewTaskRepository()
@@ -33,32 +55,80 @@ func main() {
 	_ = projectRepo
 	_ = taskRepo
 
+	outboxRepo := repository.NewOutboxRepository()
+
 	// Initialize handlers
 	projectHandler := handlers.NewProjectHandler(projectRepo)
 	taskHandler := handlers.NewTaskHandler(taskRepo)
 
+	// Purge a user's projects and tasks when auth-service deletes the account.
+	// Runs in the background so the API stays available if RabbitMQ is down,
+	// and starts over on a new connection whenever the consumer stops.
+	consumerConfig := events.ConsumerConfigFromEnv()
+	go func() {
+		conn := topology.NewRedialer(nil, events.DialRabbitMQ)
+		defer conn.Close()
+		delay := consumerMinRestartDelay
+		for {
+			start := time.Now()
+			err := events.ConsumeUserDeletedEvents(conn, projectRepo, consumerConfig)
+			// A consumer that ran for a while lost a working connection, so
+			// the next attempt is not delayed by earlier failures
+			if time.Since(start) > consumerMaxRestartDelay {
+				delay = consumerMinRestartDelay
+			}
+			slog.Error("User deleted consumer stopped, restarting", "error", err, "retry_in", delay)
+			time.Sleep(delay)
+			delay = min(delay*2, consumerMaxRestartDelay)
+		}
+	}()
+
+	// Publish the events queued in the outbox over a connection of its own,
+	// dialed on first use and again whenever it is lost. Events that cannot be
+	// published stay in the outbox and are retried.
+	go func() {
+		conn := topology.NewRedialer(nil, events.DialRabbitMQ)
+		defer conn.Close()
+		outbox.NewRelay(outboxRepo, events.NewRabbitMqPublisher(conn), outbox.ConfigFromEnv()).Run(context.Background())
+	}()
+
 	// Basic router setup (using standard library ServeMux)
 	mux := http.NewServeMux()
 
+	// Tokens are verified locally with auth-service's public keys (JWKS);
+	// revocation is checked against auth-service (cached)
+	keySource, err := middleware.NewKeySourceFromEnv()
+	if err != nil {
+		slog.Error("Failed to initialize JWT key source", "error", err)
+		os.Exit(1)
+	}
+	// auth-service's introspection endpoint both checks JWT revocation and resolves personal access tokens
+	introspection := middleware.NewIntrospectionCheckerFromEnv()
+	authenticator := middleware.NewAuthenticator(keySource, introspection, introspection)
+
 	// Setup routes using the routes package
-	routes.SetupRoutes(mux, projectHandler, taskHandler)
+	routes.SetupRoutes(mux, authenticator, projectHandler, taskHandler)
 
 	// Setup CORS middleware
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"}, // Allow all origins for now
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", requestid.Header},
+		ExposedHeaders: []string{requestid.Header}, // Lets browser clients report request IDs
 	})
-	handler := c.Handler(mux) // Wrap the existing mux
+	// Every request gets an ID, echoed in X-Request-ID and in error responses.
+	// It is assigned before the access log so every record of the request carries it.
+	handler := c.Handler(requestid.Middleware(logging.AccessLog(metrics.Instrument(mux)))) // Wrap the existing mux
 
-	log.Printf("Task service starting on port %s", port)
+	slog.Info("Task service starting", "port", port)
 	server := &http.Server{
 		Addr:    ":" + port,
 		Handler: handler, // Use the CORS wrapped handler
 	}
 
-	err := server.ListenAndServe()
+	err = server.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Could not start server: %s\n", err)
+		slog.Error("Could not start server", "error", err)
+		os.Exit(1)
 	}
 }
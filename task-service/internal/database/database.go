@@ -3,7 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"time"
 
@@ -38,7 +38,7 @@ func InitDB() error {
 	config.MaxConnLifetime = time.Hour
 	config.MaxConnIdleTime = 30 * time.Minute
 
-	log.Println("Attempting to connect to database...")
+	slog.Info("Attempting to connect to database...")
 
 	// Connect to the database with retry logic
 	var pool *pgxpool.Pool
@@ -51,14 +51,14 @@ func InitDB() error {
 			// Try pinging the database
 			err = pool.Ping(context.Background())
 			if err == nil {
-				log.Println("Database connection successful!")
+				slog.Info("Database connection successful!")
 				DB = pool // Assign the successful pool to the global variable
 				return nil
 			}
-			log.Printf("Database ping failed: %v. Retrying...", err)
+			slog.Warn("Database ping failed, retrying", "error", err)
 			pool.Close() // Close the pool if ping failed
 		} else {
-			log.Printf("Database connection attempt %d failed: %v. Retrying...", i+1, err)
+			slog.Warn("Database connection attempt failed, retrying", "attempt", i+1, "error", err)
 		}
 
 		if i < maxRetries-1 {
@@ -73,7 +73,7 @@ func InitDB() error {
 // CloseDB closes the database connection pool.
 func CloseDB() {
 	if DB != nil {
-		log.Println("Closing database connection pool...")
+		slog.Info("Closing database connection pool...")
 		DB.Close()
 	}
 }
@@ -0,0 +1,73 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"cozy-go/shared/cloudevents"
+	"cozy-go/shared/requestid"
+)
+
+// Source identifies task-service as the producer of an event.
+const Source = "task-service"
+
+// catalog maps every event type published by task-service to the current
+// version of its data schema. Incompatible changes to an event's JSON need a
+// new version. Events are only ever published through the outbox: the
+// repository method making the change stores them with insertOutboxEvent. No
+// queue in topology.Queues is bound to them yet, so until a consumer is added
+// the exchange drops them.
+var catalog = map[string]int{
+	TypeTaskCreated: 1,
+	TypeTaskUpdated: 1,
+	TypeTaskDeleted: 1,
+}
+
+// Event is a typed domain event published by task-service.
+type Event interface {
+	// EventType returns the type of the event, a key of catalog.
+	EventType() string
+	// EventSubject identifies what the event is about, e.g. a task ID.
+	EventSubject() string
+}
+
+// NewEnvelope wraps event in the CloudEvents envelope shared with auth-service.
+// It fails for events whose type is not in the catalog.
+func NewEnvelope(ctx context.Context, event Event) (Envelope, error) {
+	eventType := event.EventType()
+	version, ok := catalog[eventType]
+	if !ok {
+		return Envelope{}, fmt.Errorf("unknown event type %q", eventType)
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("failed to marshal %s event data: %w", eventType, err)
+	}
+	return Envelope{
+		SpecVersion:     cloudevents.SpecVersion,
+		ID:              newEventID(),
+		Source:          Source,
+		Type:            eventType,
+		Subject:         event.EventSubject(),
+		Time:            time.Now().UTC(),
+		DataContentType: cloudevents.DataContentType,
+		DataVersion:     version,
+		CorrelationID:   requestid.FromContext(ctx),
+		Data:            data,
+	}, nil
+}
+
+// newEventID returns a random (version 4) UUID.
+func newEventID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic("events: failed to read random bytes: " + err.Error())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
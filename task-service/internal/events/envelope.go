@@ -0,0 +1,47 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"cozy-go/shared/cloudevents"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Event types consumed by task-service, as published by auth-service, and the
+// data schema version understood for each.
+const (
+	typeUserDeleted        = "user.deleted"
+	userDeletedDataVersion = 1
+)
+
+// Envelope is the CloudEvents envelope auth-service wraps every event in;
+// task-service publishes its own events in it too (see NewEnvelope).
+type Envelope = cloudevents.Envelope
+
+// DecodeDelivery decodes the CloudEvent in d with cloudevents.DecodeDelivery.
+// Errors wrap ErrMalformedEvent.
+func DecodeDelivery(d amqp.Delivery) (Envelope, error) {
+	envelope, err := cloudevents.DecodeDelivery(d)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("%w: %v", ErrMalformedEvent, err)
+	}
+	return envelope, nil
+}
+
+// decodeEvent checks that envelope carries an event of eventType at
+// dataVersion and decodes its data into v. Every failure wraps
+// ErrMalformedEvent: redelivering the message would not change the outcome.
+func decodeEvent(envelope Envelope, eventType string, dataVersion int, v any) error {
+	if envelope.Type != eventType {
+		return fmt.Errorf("%w: expected a %s event, got %q", ErrMalformedEvent, eventType, envelope.Type)
+	}
+	if envelope.DataVersion != dataVersion {
+		return fmt.Errorf("%w: unsupported data version %d of %s event %s", ErrMalformedEvent, envelope.DataVersion, eventType, envelope.ID)
+	}
+	if err := json.Unmarshal(envelope.Data, v); err != nil {
+		return fmt.Errorf("%w: failed to decode %s event %s: %v", ErrMalformedEvent, eventType, envelope.ID, err)
+	}
+	return nil
+}
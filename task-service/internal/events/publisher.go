@@ -0,0 +1,77 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"cozy-go/shared/cloudevents"
+	"cozy-go/task-service/internal/metrics"
+	"cozy-go/topology"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrNotConnected is returned when the publisher has no usable connection.
+// The outbox relay retries such events later.
+var ErrNotConnected = errors.New("event publisher is not connected")
+
+// EventPublisher sends events to the message broker. task-service only
+// publishes through the outbox (see cozy-go/shared/outbox), so it sends
+// envelopes built when the change was stored, keeping their IDs across
+// attempts.
+type EventPublisher interface {
+	PublishEnvelope(ctx context.Context, envelope Envelope) error
+}
+
+type rabbitMqPublisher struct {
+	conn topology.Connection
+}
+
+// NewRabbitMqPublisher creates a publisher that sends events over conn as
+// structured CloudEvents.
+func NewRabbitMqPublisher(conn topology.Connection) EventPublisher {
+	return &rabbitMqPublisher{conn: conn}
+}
+
+// PublishEnvelope sends envelope as a persistent message to the events
+// exchange, with its type as the routing key. The message ID is the envelope
+// ID, which stays the same when the outbox relay publishes an event again.
+func (p *rabbitMqPublisher) PublishEnvelope(ctx context.Context, envelope Envelope) (err error) {
+	if p.conn == nil || p.conn.IsClosed() {
+		metrics.EventPublished(envelope.Type, ErrNotConnected)
+		return ErrNotConnected
+	}
+	defer func() { metrics.EventPublished(envelope.Type, err) }()
+
+	message, err := cloudevents.EncodeMessage(envelope, cloudevents.ContentModeStructured)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", envelope.Type, err)
+	}
+
+	ch, err := p.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	if err := topology.Declare(ch); err != nil {
+		return err
+	}
+	err = ch.PublishWithContext(ctx, topology.Exchange, envelope.Type, false, false, amqp.Publishing{
+		ContentType:   message.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		MessageId:     envelope.ID,
+		Type:          envelope.Type,
+		Timestamp:     envelope.Time,
+		AppId:         envelope.Source,
+		CorrelationId: envelope.CorrelationID,
+		Body:          message.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", envelope.Type, err)
+	}
+	slog.InfoContext(ctx, "Published event via RabbitMQ", "event_type", envelope.Type, "event_id", envelope.ID, "subject", envelope.Subject)
+	return nil
+}
@@ -0,0 +1,217 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"cozy-go/task-service/internal/metrics"
+	"cozy-go/topology"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeadLetterQueue holds the user.deleted events the consumer gave up on after
+// ConsumerConfig.MaxAttempts failed attempts. They stay there until an
+// operator moves them back to topology.TaskQueue.
+const DeadLetterQueue = topology.TaskQueue + ".dead"
+
+// Headers the consumer adds to the messages it dead-letters.
+const (
+	attemptsHeader  = "x-attempts"   // Failed attempts
+	lastErrorHeader = "x-last-error" // Error of the last attempt
+)
+
+// ConsumerConfig tunes ConsumeUserDeletedEvents.
+type ConsumerConfig struct {
+	// MaxAttempts is the number of times an event is handled before it is
+	// dead-lettered
+	MaxAttempts int
+	// MinRetryDelay is the delay before the first retry; it doubles with
+	// every further retry up to MaxRetryDelay
+	MinRetryDelay time.Duration
+	MaxRetryDelay time.Duration
+	// ConfirmTimeout is how long the consumer waits for the broker to confirm
+	// a message it moved to DeadLetterQueue; zero waits indefinitely
+	ConfirmTimeout time.Duration
+}
+
+// DefaultConsumerConfig returns the settings used unless overridden by the
+// environment. An event is retried for about four minutes, enough to ride
+// out a database restart.
+func DefaultConsumerConfig() ConsumerConfig {
+	return ConsumerConfig{
+		MaxAttempts:    10,
+		MinRetryDelay:  time.Second,
+		MaxRetryDelay:  time.Minute,
+		ConfirmTimeout: 10 * time.Second,
+	}
+}
+
+// ConsumerConfigFromEnv returns DefaultConsumerConfig with
+// CONSUMER_MAX_ATTEMPTS, CONSUMER_MIN_RETRY_DELAY, CONSUMER_MAX_RETRY_DELAY
+// and CONSUMER_CONFIRM_TIMEOUT applied. Invalid values are logged and ignored.
+func ConsumerConfigFromEnv() ConsumerConfig {
+	config := DefaultConsumerConfig()
+	config.MaxAttempts = intFromEnv("CONSUMER_MAX_ATTEMPTS", config.MaxAttempts)
+	config.MinRetryDelay = durationFromEnv("CONSUMER_MIN_RETRY_DELAY", config.MinRetryDelay)
+	config.MaxRetryDelay = durationFromEnv("CONSUMER_MAX_RETRY_DELAY", config.MaxRetryDelay)
+	config.ConfirmTimeout = durationFromEnv("CONSUMER_CONFIRM_TIMEOUT", config.ConfirmTimeout)
+	return config
+}
+
+// RetryDelay returns how long the consumer waits before an event is handled
+// again after its failed attempt number attempts.
+func (c ConsumerConfig) RetryDelay(attempts int) time.Duration {
+	delay := c.MinRetryDelay
+	for i := 1; i < attempts && delay < c.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, c.MaxRetryDelay)
+}
+
+func declareDeadLetterQueue(ch topology.Channel) error {
+	if _, err := ch.QueueDeclare(DeadLetterQueue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", DeadLetterQueue, err)
+	}
+	return nil
+}
+
+// settle acknowledges, requeues or dead-letters d after it was handled with
+// handleErr and returns the metrics result. failures counts the failed
+// attempts of the events being retried by ID; it lives as long as the
+// consumer, so a restart gives every event its full attempts again.
+//
+// A failed event is requeued only after RetryDelay, so an unavailable
+// database does not turn into a tight redelivery loop. The consumer waits
+// rather than moving on: the other messages would most likely fail for the
+// same reason. Once an event is out of attempts it is published to
+// DeadLetterQueue and d is acknowledged only after the broker confirmed the
+// copy.
+func settle(ctx context.Context, ch topology.Channel, d amqp.Delivery, eventID string, handleErr error, failures map[string]int, config ConsumerConfig) string {
+	if handleErr == nil {
+		delete(failures, eventID)
+		ack(ctx, d)
+		return metrics.ResultProcessed
+	}
+	if errors.Is(handleErr, ErrMalformedEvent) {
+		// Malformed messages would fail forever, so they are not redelivered
+		slog.ErrorContext(ctx, "Rejecting malformed message", "message_id", d.MessageId, "error", handleErr)
+		nack(ctx, d, false)
+		return metrics.ResultRejected
+	}
+
+	failures[eventID]++
+	attempts := failures[eventID]
+	logArgs := []any{"event_id", eventID, "attempts", attempts, "error", handleErr}
+	if attempts < config.MaxAttempts {
+		delay := config.RetryDelay(attempts)
+		slog.WarnContext(ctx, "Failed to handle user deleted event, retrying", append(logArgs, "retry_in", delay)...)
+		time.Sleep(delay)
+		nack(ctx, d, true)
+		return metrics.ResultRequeued
+	}
+
+	slog.ErrorContext(ctx, "Dead-lettering user deleted event out of attempts", logArgs...)
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[attemptsHeader] = int64(attempts)
+	headers[lastErrorHeader] = handleErr.Error()
+	if err := publishConfirmed(ctx, ch, DeadLetterQueue, republishing(d, headers), config.ConfirmTimeout); err != nil {
+		slog.ErrorContext(ctx, "Failed to dead-letter message, requeueing it", "message_id", d.MessageId, "error", err)
+		nack(ctx, d, true)
+		return metrics.ResultRequeued
+	}
+	delete(failures, eventID)
+	ack(ctx, d)
+	return metrics.ResultDeadLettered
+}
+
+// publishConfirmed publishes msg to queue through the default exchange on ch,
+// which must be in confirm mode, and waits up to timeout (indefinitely if
+// zero) for the broker to confirm it. It returns an error unless the broker
+// acked the message.
+func publishConfirmed(ctx context.Context, ch topology.Channel, queue string, msg amqp.Publishing, timeout time.Duration) error {
+	confirmation, err := ch.PublishWithConfirmation(ctx, "", queue, false, false, msg)
+	if err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", queue, err)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("no confirmation for the message published to %s: %w", queue, err)
+	}
+	if !acked {
+		return fmt.Errorf("broker nacked the message published to %s", queue)
+	}
+	return nil
+}
+
+// republishing returns d as a message to publish again with headers. Binary
+// mode CloudEvents keep their attributes, which are headers as well.
+func republishing(d amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:       headers,
+		ContentType:   d.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		CorrelationId: d.CorrelationId,
+		MessageId:     d.MessageId,
+		Timestamp:     d.Timestamp,
+		Type:          d.Type,
+		AppId:         d.AppId,
+		Body:          d.Body,
+	}
+}
+
+func ack(ctx context.Context, d amqp.Delivery) {
+	// A failed ack means the channel is gone; the broker redelivers the message
+	if err := d.Ack(false); err != nil {
+		slog.ErrorContext(ctx, "Failed to acknowledge message", "message_id", d.MessageId, "error", err)
+	}
+}
+
+func nack(ctx context.Context, d amqp.Delivery, requeue bool) {
+	if err := d.Nack(false, requeue); err != nil {
+		slog.ErrorContext(ctx, "Failed to reject message", "message_id", d.MessageId, "requeue", requeue, "error", err)
+	}
+}
+
+// intFromEnv parses the positive integer in the environment variable key, or
+// returns def if it is unset or invalid.
+func intFromEnv(key string, def int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n <= 0 {
+		slog.Warn("Invalid number, using default", "name", key, "value", val, "default", def)
+		return def
+	}
+	return n
+}
+
+// durationFromEnv parses the duration in the environment variable key, or
+// returns def if it is unset or invalid.
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		slog.Warn("Invalid duration, using default", "name", key, "value", val, "default", def)
+		return def
+	}
+	return d
+}
@@ -0,0 +1,48 @@
+package events
+
+import "strconv"
+
+// Event types published by task-service. Consumers subscribe by type, so
+// these names are part of the service's public contract.
+const (
+	TypeTaskCreated = "task.created"
+	TypeTaskUpdated = "task.updated"
+	TypeTaskDeleted = "task.deleted"
+)
+
+// TaskCreatedEvent is published after a task was added to a project. UserID
+// is the owner of the project, who created the task.
+type TaskCreatedEvent struct {
+	TaskID    int    `json:"task_id"`
+	ProjectID int    `json:"project_id"`
+	UserID    int    `json:"user_id"`
+	Title     string `json:"title"`
+	Status    string `json:"status"`
+	Priority  string `json:"priority"`
+}
+
+// TaskUpdatedEvent is published after a task was edited or moved to another
+// status.
+type TaskUpdatedEvent struct {
+	TaskID    int    `json:"task_id"`
+	ProjectID int    `json:"project_id"`
+	UserID    int    `json:"user_id"`
+	Title     string `json:"title"`
+	Status    string `json:"status"`
+}
+
+// TaskDeletedEvent is published after a single task was deleted. Tasks
+// removed with their project or account are not announced one by one.
+type TaskDeletedEvent struct {
+	TaskID    int `json:"task_id"`
+	ProjectID int `json:"project_id"`
+	UserID    int `json:"user_id"`
+}
+
+func (TaskCreatedEvent) EventType() string { return TypeTaskCreated }
+func (TaskUpdatedEvent) EventType() string { return TypeTaskUpdated }
+func (TaskDeletedEvent) EventType() string { return TypeTaskDeleted }
+
+func (e TaskCreatedEvent) EventSubject() string { return strconv.Itoa(e.TaskID) }
+func (e TaskUpdatedEvent) EventSubject() string { return strconv.Itoa(e.TaskID) }
+func (e TaskDeletedEvent) EventSubject() string { return strconv.Itoa(e.TaskID) }
@@ -0,0 +1,103 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"cozy-go/shared/requestid"
+	"cozy-go/task-service/internal/metrics"
+	"cozy-go/topology"
+)
+
+// ErrMalformedEvent marks messages that can never be processed and must not be redelivered.
+var ErrMalformedEvent = errors.New("malformed event")
+
+// UserDeletedEvent mirrors the data of the user.deleted event auth-service
+// publishes when an account is deleted.
+type UserDeletedEvent struct {
+	UserID   int    `json:"user_id"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+}
+
+// UserDataPurger deletes everything task-service stores for a user.
+// repository.ProjectRepository satisfies it.
+type UserDataPurger interface {
+	DeleteProjectsByUserID(ctx context.Context, userID int) (int64, error)
+}
+
+// HandleUserDeleted purges the projects and tasks of the user named in a
+// user.deleted event.
+func HandleUserDeleted(ctx context.Context, envelope Envelope, purger UserDataPurger) error {
+	var event UserDeletedEvent
+	if err := decodeEvent(envelope, typeUserDeleted, userDeletedDataVersion, &event); err != nil {
+		return err
+	}
+	if event.UserID <= 0 {
+		return fmt.Errorf("%w: user deleted event has invalid user ID %d", ErrMalformedEvent, event.UserID)
+	}
+
+	if _, err := purger.DeleteProjectsByUserID(ctx, event.UserID); err != nil {
+		return fmt.Errorf("failed to purge data of user %d: %w", event.UserID, err)
+	}
+	return nil
+}
+
+// ConsumeUserDeletedEvents processes UserDeletedEvents from task-service's
+// queue until the connection or channel closes, and returns why it stopped.
+// The queue is bound to user.deleted only (see topology.Queues). Messages are
+// CloudEvents in either content mode; see DecodeDelivery.
+// Messages are acknowledged only after the purge succeeded, so a failed purge is
+// retried instead of leaving orphaned projects behind, up to config.MaxAttempts
+// times before the event is moved to DeadLetterQueue (see settle).
+func ConsumeUserDeletedEvents(conn topology.Connection, purger UserDataPurger, config ConsumerConfig) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %w", err)
+	}
+	defer ch.Close()
+
+	if err := topology.Declare(ch); err != nil {
+		return err
+	}
+	if err := declareDeadLetterQueue(ch); err != nil {
+		return err
+	}
+	// Dead-lettered messages are acknowledged only once the broker confirmed
+	// the copy; see settle
+	if err := ch.Confirm(false); err != nil {
+		return fmt.Errorf("failed to put the channel in confirm mode: %w", err)
+	}
+
+	msgs, err := ch.Consume(
+		topology.TaskQueue, // queue
+		"",                 // consumer
+		false,              // auto-ack
+		false,              // exclusive
+		false,              // no-local
+		false,              // no-wait
+		nil,                // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register a consumer on %s: %w", topology.TaskQueue, err)
+	}
+
+	slog.Info("Waiting for messages", "queue", topology.TaskQueue)
+	failures := map[string]int{}
+	for d := range msgs {
+		// auth-service sets the correlation ID to the ID of the request that
+		// deleted the account, so our log lines can be matched with its own
+		ctx := requestid.NewContext(context.Background(), d.CorrelationId)
+		envelope, err := DecodeDelivery(d)
+		if err == nil {
+			handleCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			err = HandleUserDeleted(handleCtx, envelope, purger)
+			cancel()
+		}
+		metrics.EventConsumed(topology.TaskQueue, settle(ctx, ch, d, envelope.ID, err, failures, config))
+	}
+	return fmt.Errorf("delivery channel of %s closed", topology.TaskQueue)
+}
@@ -3,11 +3,12 @@ package handlers
 import (
 	"encoding/json"
 	"errors" // Keep errors import if needed elsewhere, or remove if not
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 
 	// Keep middleware import for context key
+	"cozy-go/shared/problem"
 	"cozy-go/task-service/internal/models"
 	"cozy-go/task-service/internal/utils" // Import the new utils package
 	"cozy-go/task-service/repository"
@@ -33,22 +34,22 @@ func (h *ProjectHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
 
 	// Decode the request body
 	if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
-		log.Printf("Error decoding create project request: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "Error decoding create project request", "error", err)
+		problem.Error(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
 
 	// Basic validation (can be expanded)
 	if project.Name == "" {
-		http.Error(w, "Project name is required", http.StatusBadRequest)
+		problem.Field(w, r, "name", "required", "Project name is required")
 		return
 	}
 
 	// Get UserID from context using the utility function
 	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError) // Consider StatusUnauthorized if context missing implies bad auth
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError) // Consider StatusUnauthorized if context missing implies bad auth
 		return
 	}
 
@@ -58,8 +59,8 @@ func (h *ProjectHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
 	// Call the repository to create the project
 	_, err = h.repo.CreateProject(r.Context(), &project)
 	if err != nil {
-		log.Printf("Error calling repository CreateProject for user %d: %v", userID, err)
-		http.Error(w, "Failed to create project", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error calling repository CreateProject", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to create project", http.StatusInternalServerError)
 		return
 	}
 
@@ -68,31 +69,31 @@ func (h *ProjectHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(project); err != nil {
 		// Log error if response writing fails, but status is already sent
-		log.Printf("Error encoding create project response: %v", err)
+		slog.ErrorContext(r.Context(), "Error encoding create project response", "error", err)
 	}
-	log.Printf("Successfully handled CreateProject request for project ID: %d", project.ID)
+	slog.InfoContext(r.Context(), "Successfully handled CreateProject request", "project_id", project.ID)
 }
 
 // GetProjectByID handles GET /projects/{id}
 func (h *ProjectHandler) GetProjectByID(w http.ResponseWriter, r *http.Request) {
 	projectIDStr := r.PathValue("id")
 	if projectIDStr == "" {
-		log.Println("Project ID not found in path for GetProjectByID")
-		http.Error(w, "Project ID missing in URL path", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "Project ID not found in path for GetProjectByID")
+		problem.Error(w, r, "Project ID missing in URL path", http.StatusBadRequest)
 		return
 	}
 
 	projectID, err := strconv.Atoi(projectIDStr)
 	if err != nil {
-		log.Printf("Invalid project ID format in GetProjectByID: %s", projectIDStr)
-		http.Error(w, "Invalid project ID format", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "Invalid project ID format in GetProjectByID", "project_id", projectIDStr)
+		problem.Error(w, r, "Invalid project ID format", http.StatusBadRequest)
 		return
 	}
 
 	// Get UserID from context using the utility function
 	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -100,18 +101,18 @@ func (h *ProjectHandler) GetProjectByID(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		// Check for specific "not found" error from repository
 		if errors.Is(err, pgx.ErrNoRows) {
-			log.Printf("Project %d not found or not owned by user %d", projectID, userID)
-			http.Error(w, "Project not found", http.StatusNotFound)
+			slog.InfoContext(r.Context(), "Project not found or not owned by user", "project_id", projectID, "user_id", userID)
+			problem.Error(w, r, "Project not found", http.StatusNotFound)
 		} else {
-			log.Printf("Error calling repository GetProjectByID for project %d, user %d: %v", projectID, userID, err)
-			http.Error(w, "Failed to retrieve project", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error calling repository GetProjectByID", "project_id", projectID, "user_id", userID, "error", err)
+			problem.Error(w, r, "Failed to retrieve project", http.StatusInternalServerError)
 		}
 		return
 	}
 
 	// If repo returns (nil, nil) for not found (as pgx.ErrNoRows might be handled internally)
 	if project == nil {
-		http.Error(w, "Project not found", http.StatusNotFound)
+		problem.Error(w, r, "Project not found", http.StatusNotFound)
 		return
 	}
 
@@ -119,9 +120,9 @@ func (h *ProjectHandler) GetProjectByID(w http.ResponseWriter, r *http.Request)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(project); err != nil {
-		log.Printf("Error encoding GetProjectByID response: %v", err)
+		slog.ErrorContext(r.Context(), "Error encoding GetProjectByID response", "error", err)
 	}
-	log.Printf("Successfully handled GetProjectByID request for project ID: %d", projectID)
+	slog.InfoContext(r.Context(), "Successfully handled GetProjectByID request", "project_id", projectID)
 }
 
 // ListProjects handles GET /projects
@@ -129,23 +130,23 @@ func (h *ProjectHandler) ListProjects(w http.ResponseWriter, r *http.Request) {
 	// Get UserID from context using the utility function
 	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	projects, err := h.repo.GetProjectsByUserID(r.Context(), userID) // Use renamed method and pass userID
 	if err != nil {
-		log.Printf("Error calling repository GetProjectsByUserID for user %d: %v", userID, err)
-		http.Error(w, "Failed to retrieve projects", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error calling repository GetProjectsByUserID", "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to retrieve projects", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(projects); err != nil {
-		log.Printf("Error encoding ListProjects response: %v", err)
+		slog.ErrorContext(r.Context(), "Error encoding ListProjects response", "error", err)
 	}
-	log.Println("Successfully handled ListProjects request")
+	slog.InfoContext(r.Context(), "Successfully handled ListProjects request")
 }
 
 // UpdateProject handles PUT /projects/{id} requests.
@@ -153,14 +154,14 @@ func (h *ProjectHandler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 	// 1. Get Project ID from path
 	projectIDStr := r.PathValue("id")
 	if projectIDStr == "" {
-		log.Println("Project ID not found in path for UpdateProject")
-		http.Error(w, "Project ID missing in URL path", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "Project ID not found in path for UpdateProject")
+		problem.Error(w, r, "Project ID missing in URL path", http.StatusBadRequest)
 		return
 	}
 	projectID, err := strconv.Atoi(projectIDStr)
 	if err != nil {
-		log.Printf("Invalid project ID format in UpdateProject: %s", projectIDStr)
-		http.Error(w, "Invalid project ID format", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "Invalid project ID format in UpdateProject", "project_id", projectIDStr)
+		problem.Error(w, r, "Invalid project ID format", http.StatusBadRequest)
 		return
 	}
 
@@ -168,8 +169,8 @@ func (h *ProjectHandler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 	// Using models.Project directly makes it hard to distinguish "not provided" vs "set to empty"
 	var payload map[string]interface{} // Use a map to see provided fields
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		log.Printf("Error decoding update project request for ID %d: %v", projectID, err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "Error decoding update project request", "project_id", projectID, "error", err)
+		problem.Error(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
@@ -183,7 +184,7 @@ func (h *ProjectHandler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 			updateData.Name = nameStr
 			updateNeeded = true
 		} else {
-			http.Error(w, "Project name cannot be empty if provided", http.StatusBadRequest)
+			problem.Field(w, r, "name", "required", "Project name cannot be empty if provided")
 			return
 		}
 	}
@@ -193,7 +194,7 @@ func (h *ProjectHandler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 			updateData.Description = descStr // Allow setting empty description
 			updateNeeded = true
 		} else {
-			http.Error(w, "Invalid description format", http.StatusBadRequest)
+			problem.Field(w, r, "description", "string", "Invalid description format")
 			return
 		}
 	}
@@ -201,16 +202,16 @@ func (h *ProjectHandler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 	if !updateNeeded {
 		// If only ID was sent or no valid fields, maybe return 304 Not Modified or just success?
 		// Fetching and returning current might be safest.
-		log.Printf("No valid fields provided for update for project ID: %d", projectID)
+		slog.InfoContext(r.Context(), "No valid fields provided for update", "project_id", projectID)
 		// Let's fetch and return current state for simplicity
 		userIDCtx, errCtx := utils.GetUserIDFromContext(r)
 		if errCtx != nil {
-			http.Error(w, errCtx.Error(), http.StatusInternalServerError)
+			problem.Error(w, r, errCtx.Error(), http.StatusInternalServerError)
 			return
 		}
 		currentProject, errFetch := h.repo.GetProjectByID(r.Context(), projectID, userIDCtx)
 		if errFetch != nil || currentProject == nil {
-			http.Error(w, "Project not found", http.StatusNotFound)
+			problem.Error(w, r, "Project not found", http.StatusNotFound)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -224,7 +225,7 @@ func (h *ProjectHandler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 	// Get UserID from context using the utility function
 	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -233,18 +234,18 @@ func (h *ProjectHandler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 	updatedProject, err := h.repo.UpdateProject(r.Context(), &updateData, userID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			log.Printf("Project %d not found or not owned by user %d during update", projectID, userID)
-			http.Error(w, "Project not found or not authorized", http.StatusNotFound) // More accurate error
+			slog.InfoContext(r.Context(), "Project not found or not owned by user during update", "project_id", projectID, "user_id", userID)
+			problem.Error(w, r, "Project not found or not authorized", http.StatusNotFound) // More accurate error
 		} else {
-			log.Printf("Error calling repository UpdateProject for project %d, user %d: %v", projectID, userID, err)
-			http.Error(w, "Failed to update project", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error calling repository UpdateProject", "project_id", projectID, "user_id", userID, "error", err)
+			problem.Error(w, r, "Failed to update project", http.StatusInternalServerError)
 		}
 		return
 	}
 
 	// If repo returns (nil, nil) on not found (shouldn't happen with ErrNoRows check now)
 	if updatedProject == nil {
-		http.Error(w, "Project not found", http.StatusNotFound)
+		problem.Error(w, r, "Project not found", http.StatusNotFound)
 		return
 	}
 
@@ -252,9 +253,9 @@ func (h *ProjectHandler) UpdateProject(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK) // 200 OK for successful update
 	if err := json.NewEncoder(w).Encode(updatedProject); err != nil {
-		log.Printf("Error encoding update project response for ID %d: %v", projectID, err)
+		slog.ErrorContext(r.Context(), "Error encoding update project response", "project_id", projectID, "error", err)
 	}
-	log.Printf("Successfully handled UpdateProject request for project ID: %d", projectID)
+	slog.InfoContext(r.Context(), "Successfully handled UpdateProject request", "project_id", projectID)
 }
 
 // DeleteProject handles DELETE /projects/{id} requests.
@@ -262,21 +263,21 @@ func (h *ProjectHandler) DeleteProject(w http.ResponseWriter, r *http.Request) {
 	// 1. Get Project ID from path
 	projectIDStr := r.PathValue("id")
 	if projectIDStr == "" {
-		log.Println("Project ID not found in path for DeleteProject")
-		http.Error(w, "Project ID missing in URL path", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "Project ID not found in path for DeleteProject")
+		problem.Error(w, r, "Project ID missing in URL path", http.StatusBadRequest)
 		return
 	}
 	projectID, err := strconv.Atoi(projectIDStr)
 	if err != nil {
-		log.Printf("Invalid project ID format in DeleteProject: %s", projectIDStr)
-		http.Error(w, "Invalid project ID format", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "Invalid project ID format in DeleteProject", "project_id", projectIDStr)
+		problem.Error(w, r, "Invalid project ID format", http.StatusBadRequest)
 		return
 	}
 
 	// Get UserID from context using the utility function
 	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -284,11 +285,11 @@ func (h *ProjectHandler) DeleteProject(w http.ResponseWriter, r *http.Request) {
 	err = h.repo.DeleteProject(r.Context(), projectID, userID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			log.Printf("Project %d not found or not owned by user %d for deletion", projectID, userID)
-			http.Error(w, "Project not found or not authorized", http.StatusNotFound) // More accurate error
+			slog.InfoContext(r.Context(), "Project not found or not owned by user for deletion", "project_id", projectID, "user_id", userID)
+			problem.Error(w, r, "Project not found or not authorized", http.StatusNotFound) // More accurate error
 		} else {
-			log.Printf("Error calling repository DeleteProject for project %d, user %d: %v", projectID, userID, err)
-			http.Error(w, "Failed to delete project", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error calling repository DeleteProject", "project_id", projectID, "user_id", userID, "error", err)
+			problem.Error(w, r, "Failed to delete project", http.StatusInternalServerError)
 		}
 		return
 	}
@@ -296,5 +297,5 @@ func (h *ProjectHandler) DeleteProject(w http.ResponseWriter, r *http.Request) {
 	// 3. Respond
 	// Typically 200 OK or 204 No Content for successful DELETE
 	w.WriteHeader(http.StatusNoContent) // 204 No Content is common
-	log.Printf("Successfully handled DeleteProject request for project ID: %d", projectID)
+	slog.InfoContext(r.Context(), "Successfully handled DeleteProject request", "project_id", projectID)
 }
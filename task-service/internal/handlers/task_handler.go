@@ -3,10 +3,11 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 
+	"cozy-go/shared/problem"
 	"cozy-go/task-service/internal/models"
 	"cozy-go/task-service/internal/utils" // Import utils package
 	"cozy-go/task-service/repository"
@@ -33,42 +34,42 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 	// Extract projectID from URL path
 	projectIDStr := r.PathValue("projectID")
 	if projectIDStr == "" {
-		log.Println("Project ID not found in path")
-		http.Error(w, "Project ID missing in URL path", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "Project ID not found in path")
+		problem.Error(w, r, "Project ID missing in URL path", http.StatusBadRequest)
 		return
 	}
 	projectID, err := strconv.Atoi(projectIDStr)
 	if err != nil {
-		log.Printf("Invalid project ID format: %s", projectIDStr)
-		http.Error(w, "Invalid project ID format", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "Invalid project ID format", "project_id", projectIDStr)
+		problem.Error(w, r, "Invalid project ID format", http.StatusBadRequest)
 		return
 	}
 
 	var task models.Task
 	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
-		log.Printf("Error decoding create task request: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		slog.ErrorContext(r.Context(), "Error decoding create task request", "error", err)
+		problem.Error(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
 
 	if task.Title == "" {
-		http.Error(w, "Task title is required", http.StatusBadRequest)
+		problem.Field(w, r, "title", "required", "Task title is required")
 		return
 	}
 	task.ProjectID = projectID // Assign project ID from path
 
 	// Validate enums or set defaults
 	if task.Status == "" { task.Status = models.StatusTodo }
-	if !task.Status.IsValid() { http.Error(w, "Invalid status value", http.StatusBadRequest); return }
-	if !task.Label.IsValid() { http.Error(w, "Invalid label value", http.StatusBadRequest); return } // Assuming empty is valid
+	if !task.Status.IsValid() { problem.Field(w, r, "status", "oneof", "Invalid status value"); return }
+	if !task.Label.IsValid() { problem.Field(w, r, "label", "oneof", "Invalid label value"); return } // Assuming empty is valid
 	if task.Priority == "" { task.Priority = models.PriorityMedium }
-	if !task.Priority.IsValid() { http.Error(w, "Invalid priority value", http.StatusBadRequest); return }
+	if !task.Priority.IsValid() { problem.Field(w, r, "priority", "oneof", "Invalid priority value"); return }
 
 	// Get UserID from context
 	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -77,11 +78,11 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		// Check if the error is due to project ownership check failing
 		if errors.Is(err, pgx.ErrNoRows) {
-			log.Printf("Failed to create task: Project %d not found or not owned by user %d", projectID, userID)
-			http.Error(w, "Project not found or not authorized", http.StatusForbidden) // 403 Forbidden might be more appropriate
+			slog.InfoContext(r.Context(), "Failed to create task: project not found or not owned by user", "project_id", projectID, "user_id", userID)
+			problem.Error(w, r, "Project not found or not authorized", http.StatusForbidden) // 403 Forbidden might be more appropriate
 		} else {
-			log.Printf("Error calling repository CreateTask for user %d: %v", userID, err)
-			http.Error(w, "Failed to create task", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error calling repository CreateTask", "user_id", userID, "error", err)
+			problem.Error(w, r, "Failed to create task", http.StatusInternalServerError)
 		}
 		return
 	}
@@ -89,7 +90,7 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 	// Respond with the created task (fetch again to get all fields like created_at)
 	createdTask, fetchErr := h.repo.GetTaskByID(r.Context(), createdID, userID)
 	if fetchErr != nil || createdTask == nil {
-		log.Printf("Error fetching newly created task %d: %v", createdID, fetchErr)
+		slog.ErrorContext(r.Context(), "Error fetching newly created task", "task_id", createdID, "error", fetchErr)
 		// Still return 201, but maybe with a warning or just the ID
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
@@ -101,30 +102,30 @@ func (h *TaskHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(createdTask); err != nil {
-		log.Printf("Error encoding create task response: %v", err)
+		slog.ErrorContext(r.Context(), "Error encoding create task response", "error", err)
 	}
-	log.Printf("Successfully handled CreateTask request for task ID: %d in project ID: %d", createdID, task.ProjectID)
+	slog.InfoContext(r.Context(), "Successfully handled CreateTask request", "task_id", createdID, "project_id", task.ProjectID)
 }
 
 // ListTasksByProject handles the GET /projects/{projectID}/tasks request.
 func (h *TaskHandler) ListTasksByProject(w http.ResponseWriter, r *http.Request) {
 	projectIDStr := r.PathValue("projectID")
 	if projectIDStr == "" {
-		log.Println("Project ID not found in path for ListTasksByProject")
-		http.Error(w, "Project ID missing in URL path", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "Project ID not found in path for ListTasksByProject")
+		problem.Error(w, r, "Project ID missing in URL path", http.StatusBadRequest)
 		return
 	}
 	projectID, err := strconv.Atoi(projectIDStr)
 	if err != nil {
-		log.Printf("Invalid project ID format in ListTasksByProject: %s", projectIDStr)
-		http.Error(w, "Invalid project ID format", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "Invalid project ID format in ListTasksByProject", "project_id", projectIDStr)
+		problem.Error(w, r, "Invalid project ID format", http.StatusBadRequest)
 		return
 	}
 
 	// Get UserID from context
 	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -132,38 +133,38 @@ func (h *TaskHandler) ListTasksByProject(w http.ResponseWriter, r *http.Request)
 	tasks, err := h.repo.GetTasksByProjectID(r.Context(), projectID, userID)
 	if err != nil {
 		// Repo handles ErrNoRows check for ownership, returns empty slice if not owned/found
-		log.Printf("Error calling repository GetTasksByProjectID for project %d, user %d: %v", projectID, userID, err)
-		http.Error(w, "Failed to retrieve tasks", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error calling repository GetTasksByProjectID", "project_id", projectID, "user_id", userID, "error", err)
+		problem.Error(w, r, "Failed to retrieve tasks", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(tasks); err != nil {
-		log.Printf("Error encoding list tasks response: %v", err)
+		slog.ErrorContext(r.Context(), "Error encoding list tasks response", "error", err)
 	}
-	log.Printf("Successfully handled ListTasksByProject request for project ID: %d, found %d tasks", projectID, len(tasks))
+	slog.InfoContext(r.Context(), "Successfully handled ListTasksByProject request", "project_id", projectID, "count", len(tasks))
 }
 
 // GetTask handles the GET /tasks/{taskID} request.
 func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
 	taskIDStr := r.PathValue("taskID")
 	if taskIDStr == "" {
-		log.Println("Task ID not found in path for GetTask")
-		http.Error(w, "Task ID missing in URL path", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "Task ID not found in path for GetTask")
+		problem.Error(w, r, "Task ID missing in URL path", http.StatusBadRequest)
 		return
 	}
 	taskID, err := strconv.Atoi(taskIDStr)
 	if err != nil {
-		log.Printf("Invalid task ID format in GetTask: %s", taskIDStr)
-		http.Error(w, "Invalid task ID format", http.StatusBadRequest)
+		slog.InfoContext(r.Context(), "Invalid task ID format in GetTask", "task_id", taskIDStr)
+		problem.Error(w, r, "Invalid task ID format", http.StatusBadRequest)
 		return
 	}
 
 	// Get UserID from context
 	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -171,17 +172,17 @@ func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
 	task, err := h.repo.GetTaskByID(r.Context(), taskID, userID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			log.Printf("Task %d not found or not owned by user %d", taskID, userID)
-			http.Error(w, "Task not found", http.StatusNotFound)
+			slog.InfoContext(r.Context(), "Task not found or not owned by user", "task_id", taskID, "user_id", userID)
+			problem.Error(w, r, "Task not found", http.StatusNotFound)
 		} else {
-			log.Printf("Error calling repository GetTaskByID for task %d, user %d: %v", taskID, userID, err)
-			http.Error(w, "Failed to retrieve task", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error calling repository GetTaskByID", "task_id", taskID, "user_id", userID, "error", err)
+			problem.Error(w, r, "Failed to retrieve task", http.StatusInternalServerError)
 		}
 		return
 	}
 	// Repo returns (nil, nil) if not found/owned
 	if task == nil {
-		http.Error(w, "Task not found", http.StatusNotFound)
+		problem.Error(w, r, "Task not found", http.StatusNotFound)
 		return
 	}
 
@@ -189,9 +190,9 @@ func (h *TaskHandler) GetTask(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(task); err != nil {
-		log.Printf("Error encoding get task response: %v", err)
+		slog.ErrorContext(r.Context(), "Error encoding get task response", "error", err)
 	}
-	log.Printf("Successfully handled GetTask request for task ID: %d", taskID)
+	slog.InfoContext(r.Context(), "Successfully handled GetTask request", "task_id", taskID)
 }
 
 // UpdateTask handles the PUT /projects/{projectID}/tasks/{taskID} request.
@@ -200,29 +201,29 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	projectIDStr := r.PathValue("projectID") // Keep projectID for consistency, though repo checks ownership via task->project
 	taskIDStr := r.PathValue("taskID")
 	if projectIDStr == "" || taskIDStr == "" {
-		http.Error(w, "Project ID or Task ID missing in URL path", http.StatusBadRequest)
+		problem.Error(w, r, "Project ID or Task ID missing in URL path", http.StatusBadRequest)
 		return
 	}
 	projectID, errP := strconv.Atoi(projectIDStr)
 	taskID, errT := strconv.Atoi(taskIDStr)
 	if errP != nil || errT != nil {
-		http.Error(w, "Invalid project or task ID format", http.StatusBadRequest)
+		problem.Error(w, r, "Invalid project or task ID format", http.StatusBadRequest)
 		return
 	}
 
 	// Decode payload
 	var taskUpdates models.Task
 	if err := json.NewDecoder(r.Body).Decode(&taskUpdates); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		problem.Error(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
 
 	// Validate payload
-	if taskUpdates.Title == "" { http.Error(w, "Task title is required", http.StatusBadRequest); return }
-	if !taskUpdates.Status.IsValid() { http.Error(w, "Invalid status value", http.StatusBadRequest); return }
-	if !taskUpdates.Label.IsValid() { http.Error(w, "Invalid label value", http.StatusBadRequest); return }
-	if !taskUpdates.Priority.IsValid() { http.Error(w, "Invalid priority value", http.StatusBadRequest); return }
+	if taskUpdates.Title == "" { problem.Field(w, r, "title", "required", "Task title is required"); return }
+	if !taskUpdates.Status.IsValid() { problem.Field(w, r, "status", "oneof", "Invalid status value"); return }
+	if !taskUpdates.Label.IsValid() { problem.Field(w, r, "label", "oneof", "Invalid label value"); return }
+	if !taskUpdates.Priority.IsValid() { problem.Field(w, r, "priority", "oneof", "Invalid priority value"); return }
 
 	// Set IDs from path
 	taskUpdates.ID = taskID
@@ -231,7 +232,7 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	// Get UserID from context
 	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -239,11 +240,11 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	err = h.repo.UpdateTask(r.Context(), &taskUpdates, userID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			log.Printf("Task %d not found or not owned by user %d for update", taskID, userID)
-			http.Error(w, "Task not found or not authorized", http.StatusNotFound) // 404 or 403?
+			slog.InfoContext(r.Context(), "Task not found or not owned by user for update", "task_id", taskID, "user_id", userID)
+			problem.Error(w, r, "Task not found or not authorized", http.StatusNotFound) // 404 or 403?
 		} else {
-			log.Printf("Error calling repository UpdateTask for task %d, user %d: %v", taskID, userID, err)
-			http.Error(w, "Failed to update task", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error calling repository UpdateTask", "task_id", taskID, "user_id", userID, "error", err)
+			problem.Error(w, r, "Failed to update task", http.StatusInternalServerError)
 		}
 		return
 	}
@@ -251,36 +252,36 @@ func (h *TaskHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	// Fetch the updated task again to return it
 	updatedTask, fetchErr := h.repo.GetTaskByID(r.Context(), taskID, userID) // Pass userID
 	if fetchErr != nil || updatedTask == nil {
-		log.Printf("Error fetching updated task %d after update for user %d: %v", taskID, userID, fetchErr)
-		http.Error(w, "Task updated but failed to fetch details", http.StatusInternalServerError)
+		slog.ErrorContext(r.Context(), "Error fetching updated task", "task_id", taskID, "user_id", userID, "error", fetchErr)
+		problem.Error(w, r, "Task updated but failed to fetch details", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(updatedTask); err != nil {
-		log.Printf("Error encoding update task response: %v", err)
+		slog.ErrorContext(r.Context(), "Error encoding update task response", "error", err)
 	}
-	log.Printf("Successfully handled UpdateTask request for task ID: %d in project ID: %d", taskID, projectID)
+	slog.InfoContext(r.Context(), "Successfully handled UpdateTask request", "task_id", taskID, "project_id", projectID)
 }
 
 // DeleteTask handles the DELETE /tasks/{taskID} request.
 func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	taskIDStr := r.PathValue("taskID")
 	if taskIDStr == "" {
-		http.Error(w, "Task ID missing in URL path", http.StatusBadRequest)
+		problem.Error(w, r, "Task ID missing in URL path", http.StatusBadRequest)
 		return
 	}
 	taskID, err := strconv.Atoi(taskIDStr)
 	if err != nil {
-		http.Error(w, "Invalid task ID format", http.StatusBadRequest)
+		problem.Error(w, r, "Invalid task ID format", http.StatusBadRequest)
 		return
 	}
 
 	// Get UserID from context
 	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -288,46 +289,46 @@ func (h *TaskHandler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	err = h.repo.DeleteTask(r.Context(), taskID, userID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			log.Printf("Task %d not found or not owned by user %d for deletion", taskID, userID)
-			http.Error(w, "Task not found or not authorized", http.StatusNotFound) // 404 or 403?
+			slog.InfoContext(r.Context(), "Task not found or not owned by user for deletion", "task_id", taskID, "user_id", userID)
+			problem.Error(w, r, "Task not found or not authorized", http.StatusNotFound) // 404 or 403?
 		} else {
-			log.Printf("Error calling repository DeleteTask for task %d, user %d: %v", taskID, userID, err)
-			http.Error(w, "Failed to delete task", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error calling repository DeleteTask", "task_id", taskID, "user_id", userID, "error", err)
+			problem.Error(w, r, "Failed to delete task", http.StatusInternalServerError)
 		}
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
-	log.Printf("Successfully handled DeleteTask request for task ID: %d", taskID)
+	slog.InfoContext(r.Context(), "Successfully handled DeleteTask request", "task_id", taskID)
 }
 
 // UpdateTaskStatusHandler handles PATCH /tasks/{taskID}/status - Consider deprecating
 func (h *TaskHandler) UpdateTaskStatusHandler(w http.ResponseWriter, r *http.Request) {
 	taskIDStr := r.PathValue("taskID")
 	if taskIDStr == "" {
-		http.Error(w, "Task ID missing in URL path", http.StatusBadRequest)
+		problem.Error(w, r, "Task ID missing in URL path", http.StatusBadRequest)
 		return
 	}
 	taskID, err := strconv.Atoi(taskIDStr)
 	if err != nil {
-		http.Error(w, "Invalid task ID format", http.StatusBadRequest)
+		problem.Error(w, r, "Invalid task ID format", http.StatusBadRequest)
 		return
 	}
 
 	var payload struct { Status models.Status `json:"status"` }
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		problem.Error(w, r, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
 
-	if payload.Status == "" { http.Error(w, "Status is required", http.StatusBadRequest); return }
-	if !payload.Status.IsValid() { http.Error(w, "Invalid status value", http.StatusBadRequest); return }
+	if payload.Status == "" { problem.Field(w, r, "status", "required", "Status is required"); return }
+	if !payload.Status.IsValid() { problem.Field(w, r, "status", "oneof", "Invalid status value"); return }
 
 	// Get UserID from context
 	userID, err := utils.GetUserIDFromContext(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -335,15 +336,15 @@ func (h *TaskHandler) UpdateTaskStatusHandler(w http.ResponseWriter, r *http.Req
 	err = h.repo.UpdateTaskStatus(r.Context(), taskID, payload.Status, userID)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			log.Printf("Task %d not found or not owned by user %d for status update", taskID, userID)
-			http.Error(w, "Task not found or not authorized", http.StatusNotFound) // 404 or 403?
+			slog.InfoContext(r.Context(), "Task not found or not owned by user for status update", "task_id", taskID, "user_id", userID)
+			problem.Error(w, r, "Task not found or not authorized", http.StatusNotFound) // 404 or 403?
 		} else {
-			log.Printf("Error calling repository UpdateTaskStatus for task %d, user %d: %v", taskID, userID, err)
-			http.Error(w, "Failed to update task status", http.StatusInternalServerError)
+			slog.ErrorContext(r.Context(), "Error calling repository UpdateTaskStatus", "task_id", taskID, "user_id", userID, "error", err)
+			problem.Error(w, r, "Failed to update task status", http.StatusInternalServerError)
 		}
 		return
 	}
 
 	w.WriteHeader(http.StatusOK) // Or 204 No Content
-	log.Printf("Successfully handled UpdateTaskStatus request for task ID: %d", taskID)
+	slog.InfoContext(r.Context(), "Successfully handled UpdateTaskStatus request", "task_id", taskID)
 }
@@ -0,0 +1,81 @@
+// Package metrics exposes Prometheus metrics on GET /metrics.
+//
+// Metrics live in Registry rather than the global default registry, so tests
+// can read them with Registry.Gather without running a Prometheus server.
+package metrics
+
+import (
+	"net/http"
+
+	sharedmetrics "cozy-go/shared/metrics"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric of the service, including Go runtime and
+// process metrics.
+var Registry = prometheus.NewRegistry()
+
+// Results of consuming an event.
+const (
+	ResultProcessed    = "processed"
+	ResultRequeued     = "requeued"      // Processing failed and the message will be redelivered
+	ResultRejected     = "rejected"      // Malformed, dropped without redelivery
+	ResultDeadLettered = "dead_lettered" // Out of attempts, moved to the dead letter queue
+)
+
+var eventsConsumedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "events_consumed_total",
+	Help: "Events consumed from the message broker by queue and result (processed, requeued, rejected or dead_lettered).",
+}, []string{"queue", "result"})
+
+var eventsPublishedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "events_published_total",
+	Help: "Events published to the message broker by event type and result (published or failed).",
+}, []string{"event", "result"})
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		eventsConsumedTotal,
+		eventsPublishedTotal,
+	)
+}
+
+// httpMetrics counts the requests served through Instrument.
+var httpMetrics = sharedmetrics.NewHTTP(Registry)
+
+// Instrument counts requests and observes their latency by ServeMux pattern.
+// It must wrap the ServeMux directly; see sharedmetrics.HTTP.Instrument.
+func Instrument(mux *http.ServeMux) http.Handler {
+	return httpMetrics.Instrument(mux)
+}
+
+// RegisterPool adds the statistics of the connection pool returned by stat,
+// typically database.DB.Stat, to Registry.
+func RegisterPool(stat func() *pgxpool.Stat) {
+	Registry.MustRegister(sharedmetrics.NewPoolCollector(stat))
+}
+
+// Handler serves the metrics in Registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// EventConsumed counts an event taken from queue with its result.
+func EventConsumed(queue, result string) {
+	eventsConsumedTotal.WithLabelValues(queue, result).Inc()
+}
+
+// EventPublished counts an attempt to publish an event of type event.
+func EventPublished(event string, err error) {
+	result := "published"
+	if err != nil {
+		result = "failed"
+	}
+	eventsPublishedTotal.WithLabelValues(event, result).Inc()
+}
@@ -3,15 +3,16 @@ package middleware
 import (
 	"context"
 	"errors" // Import the errors package
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
 	"strings"
-
-	// Assuming JWT utility functions will be placed here or imported
-	// "cozy-go/task-service/internal/utils" // Example path if utils are added
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"cozy-go/shared/logging"
+	"cozy-go/shared/problem"
 )
 
 // Define a type for the user ID context key to avoid collisions
@@ -19,85 +20,118 @@ type contextKey string
 
 const UserIDContextKey contextKey = "userID"
 
-// TODO: Replace with actual JWT validation logic (likely copied/adapted from auth-service)
-// This is a placeholder structure.
-func validateToken(tokenString string) (*jwt.RegisteredClaims, error) {
-	// 1. Get the secret key (MUST be the same as in auth-service)
-	jwtSecret := []byte(os.Getenv("JWT_SECRET")) // Ensure JWT_SECRET env var is set
-	if len(jwtSecret) == 0 {
-		log.Println("Warning: JWT_SECRET environment variable not set.")
-		// Depending on policy, either deny all or allow if secret is missing (unsafe)
-		return nil, errors.New("JWT secret key is not configured") // Use standard error
-	}
+// Authenticator validates bearer tokens against auth-service's public keys
+// and checks them against a RevocationChecker. Personal access tokens are
+// resolved by a PersonalTokenVerifier instead.
+type Authenticator struct {
+	keys           KeySource
+	revocations    RevocationChecker
+	personalTokens PersonalTokenVerifier
+}
+
+// NewAuthenticator creates an Authenticator. A nil checker disables revocation checks;
+// a nil verifier rejects personal access tokens.
+func NewAuthenticator(keys KeySource, revocations RevocationChecker, personalTokens PersonalTokenVerifier) *Authenticator {
+	return &Authenticator{keys: keys, revocations: revocations, personalTokens: personalTokens}
+}
 
-	// 2. Parse and validate the token
+// validateToken verifies the token's signature with the key named by its kid header
+// and checks the standard time claims. Only asymmetric algorithms are accepted, so
+// task-service can verify tokens but never mint them.
+func (a *Authenticator) validateToken(ctx context.Context, tokenString string) (*jwt.RegisteredClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("token has no kid header")
+		}
+		key, alg, err := a.keys.PublicKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
 		// Don't forget to validate the alg is what you expect:
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, log.Output(1, "Unexpected signing method: "+token.Header["alg"].(string))
+		if token.Method.Alg() != alg {
+			return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
 		}
-		return jwtSecret, nil
-	})
+		return key, nil
+	}, jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
 
 	if err != nil {
-		log.Printf("Error validating token: %v", err)
+		slog.InfoContext(ctx, "Token validation failed", "error", err)
 		return nil, err // Return specific errors like ErrTokenExpired, ErrSignatureInvalid etc.
 	}
 
-	// 3. Check if claims are valid and extract them
+	// Check if claims are valid and extract them
 	if claims, ok := token.Claims.(*jwt.RegisteredClaims); ok && token.Valid {
-		// TODO: Extract user ID from claims. Subject ('sub') is common.
-		// Need to know how user ID was stored in auth-service/utils/GenerateJWT
-		// Example: userIDStr := claims.Subject
-		// userID, err := strconv.Atoi(userIDStr) ... handle error ...
 		return claims, nil
 	}
 
 	return nil, jwt.ErrTokenInvalidClaims
 }
 
-
 // AuthMiddleware validates the JWT token from the Authorization header.
-func AuthMiddleware(next http.Handler) http.Handler {
+func (a *Authenticator) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			log.Println("AuthMiddleware: Missing Authorization header")
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+			slog.InfoContext(r.Context(), "AuthMiddleware: Missing Authorization header")
+			problem.Error(w, r, "Authorization header required", http.StatusUnauthorized)
 			return
 		}
 
 		// Check if the header format is Bearer <token>
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			log.Println("AuthMiddleware: Invalid Authorization header format")
-			http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
+			slog.InfoContext(r.Context(), "AuthMiddleware: Invalid Authorization header format")
+			problem.Error(w, r, "Invalid Authorization header format", http.StatusUnauthorized)
 			return
 		}
 
 		tokenString := parts[1]
 
-		// Validate the token (using placeholder function for now)
-		claims, err := validateToken(tokenString) // TODO: Implement actual validation
+		// Personal access tokens are opaque and scoped; auth-service resolves them
+		if strings.HasPrefix(tokenString, PersonalTokenPrefix) {
+			a.authenticatePersonalToken(w, r, tokenString, next)
+			return
+		}
+
+		// Validate the token signature and expiry locally
+		claims, err := a.validateToken(r.Context(), tokenString)
 		if err != nil {
-			log.Printf("AuthMiddleware: Token validation failed: %v", err)
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+			slog.InfoContext(r.Context(), "AuthMiddleware: Token validation failed", "error", err)
+			problem.Error(w, r, "Invalid or expired token", http.StatusUnauthorized)
 			return
 		}
 
-		// --- TODO: Extract User ID from claims and add to context ---
-		// Example: Assuming user ID is stored in the 'Subject' claim
+		// Assuming user ID is stored in the 'Subject' claim
 		userIDStr := claims.Subject
 		if userIDStr == "" {
-			 log.Println("AuthMiddleware: User ID (sub) not found in token claims")
-			 http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-			 return
+			slog.InfoContext(r.Context(), "AuthMiddleware: User ID (sub) not found in token claims")
+			problem.Error(w, r, "Invalid token claims", http.StatusUnauthorized)
+			return
 		}
-		// Convert userIDStr to appropriate type (e.g., int) if needed
-		// For now, let's assume it's a string and add it directly. Adjust as needed.
-		// userID, err := strconv.Atoi(userIDStr) ... handle error ...
 
-		log.Printf("AuthMiddleware: Token validated successfully for user ID (sub): %s", userIDStr)
+		// Ask auth-service (through the local cache) whether the token was revoked
+		if a.revocations != nil {
+			var expiresAt time.Time
+			if claims.ExpiresAt != nil {
+				expiresAt = claims.ExpiresAt.Time
+			}
+			revoked, err := a.revocations.IsRevoked(r.Context(), tokenString, claims.ID, expiresAt)
+			if err != nil {
+				// Fail closed: without auth-service we cannot tell whether the token was revoked
+				slog.ErrorContext(r.Context(), "AuthMiddleware: Revocation check failed", "error", err)
+				problem.Error(w, r, "Unable to verify token", http.StatusServiceUnavailable)
+				return
+			}
+			if revoked {
+				slog.InfoContext(r.Context(), "AuthMiddleware: Revoked token presented", "user_id", userIDStr)
+				problem.Error(w, r, "Token has been revoked", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		slog.DebugContext(r.Context(), "AuthMiddleware: Token validated", "user_id", userIDStr)
+		logging.SetUserID(r.Context(), userIDStr)
 
 		// Add user ID to the request context
 		ctx := context.WithValue(r.Context(), UserIDContextKey, userIDStr) // Use string ID for now
@@ -106,3 +140,30 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// authenticatePersonalToken verifies a personal access token and stores its
+// owner and scopes in the request context for RequireScope.
+func (a *Authenticator) authenticatePersonalToken(w http.ResponseWriter, r *http.Request, tokenString string, next http.Handler) {
+	if a.personalTokens == nil {
+		problem.Error(w, r, "Personal access tokens are not supported", http.StatusUnauthorized)
+		return
+	}
+	info, err := a.personalTokens.VerifyPersonalToken(r.Context(), tokenString)
+	if err != nil {
+		// Fail closed, like the revocation check
+		slog.InfoContext(r.Context(), "AuthMiddleware: Personal access token verification failed", "error", err)
+		problem.Error(w, r, "Unable to verify token", http.StatusServiceUnavailable)
+		return
+	}
+	if info == nil {
+		slog.InfoContext(r.Context(), "AuthMiddleware: Inactive personal access token presented")
+		problem.Error(w, r, "Invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+
+	slog.DebugContext(r.Context(), "AuthMiddleware: Personal access token validated", "user_id", info.Subject)
+	logging.SetUserID(r.Context(), info.Subject)
+	ctx := context.WithValue(r.Context(), UserIDContextKey, info.Subject)
+	ctx = context.WithValue(ctx, ScopesContextKey, info.Scopes)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
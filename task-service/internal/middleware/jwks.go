@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// KeySource resolves the public key (and its algorithm) for a token's kid header.
+type KeySource interface {
+	PublicKey(ctx context.Context, kid string) (crypto.PublicKey, string, error)
+}
+
+// ErrUnknownKey is returned when no key matches a token's kid.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// verificationKey is a parsed public JWK.
+type verificationKey struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// jwk mirrors auth-service's JWKS entries (RFC 7517).
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+}
+
+// parseJWKS decodes a JSON Web Key Set, skipping keys it does not understand.
+func parseJWKS(data []byte) (map[string]verificationKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]verificationKey, len(set.Keys))
+	for _, k := range set.Keys {
+		switch {
+		case k.KeyType == "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				slog.Warn("Skipping malformed RSA key in JWKS", "kid", k.KeyID)
+				continue
+			}
+			alg := k.Algorithm
+			if alg == "" {
+				alg = "RS256"
+			}
+			keys[k.KeyID] = verificationKey{
+				key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())},
+				alg: alg,
+			}
+		case k.KeyType == "OKP" && k.Curve == "Ed25519":
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				slog.Warn("Skipping malformed Ed25519 key in JWKS", "kid", k.KeyID)
+				continue
+			}
+			keys[k.KeyID] = verificationKey{key: ed25519.PublicKey(x), alg: "EdDSA"}
+		default:
+			slog.Warn("Skipping unsupported key in JWKS", "kid", k.KeyID, "kty", k.KeyType)
+		}
+	}
+	return keys, nil
+}
+
+// --- Remote JWKS ---
+
+const (
+	defaultJWKSRefreshInterval = 10 * time.Minute
+	// minJWKSRefetchInterval stops tokens with made-up kids from hammering auth-service
+	minJWKSRefetchInterval = 30 * time.Second
+)
+
+// JWKSClient fetches auth-service's JWKS and caches it. The set is refreshed
+// periodically and whenever a token names a kid that is not cached yet, which
+// is what happens right after auth-service rotates to a new key.
+type JWKSClient struct {
+	url             string
+	httpClient      *http.Client
+	refreshInterval time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]verificationKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// NewJWKSClient creates a JWKSClient for url.
+func NewJWKSClient(url string, refreshInterval time.Duration) *JWKSClient {
+	if refreshInterval <= 0 {
+		refreshInterval = defaultJWKSRefreshInterval
+	}
+	return &JWKSClient{
+		url:             url,
+		httpClient:      &http.Client{Timeout: 5 * time.Second},
+		refreshInterval: refreshInterval,
+		keys:            map[string]verificationKey{},
+	}
+}
+
+// PublicKey returns the key for kid, refetching the JWKS when needed.
+func (c *JWKSClient) PublicKey(ctx context.Context, kid string) (crypto.PublicKey, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	key, ok := c.keys[kid]
+	stale := now.Sub(c.fetchedAt) > c.refreshInterval
+	if (!ok || stale) && now.Sub(c.lastAttempt) >= minJWKSRefetchInterval {
+		c.lastAttempt = now
+		keys, err := c.fetch(ctx)
+		if err != nil {
+			// Keep serving cached keys if auth-service is briefly unreachable
+			slog.WarnContext(ctx, "Failed to refresh JWKS", "url", c.url, "error", err)
+		} else {
+			c.keys = keys
+			c.fetchedAt = now
+			key, ok = c.keys[kid]
+		}
+	}
+
+	if !ok {
+		return nil, "", fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+	return key.key, key.alg, nil
+}
+
+func (c *JWKSClient) fetch(ctx context.Context) (map[string]verificationKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned status %d", resp.StatusCode)
+	}
+
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	keys, err := parseJWKS(body)
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "Fetched JWKS signing keys", "count", len(keys), "url", c.url)
+	return keys, nil
+}
+
+// --- File based JWKS (offline development) ---
+
+// FileKeySource serves keys from a JWKS file on disk, e.g. a copy of
+// auth-service's /.well-known/jwks.json for working without auth-service running.
+type FileKeySource struct {
+	keys map[string]verificationKey
+}
+
+// NewFileKeySource loads the JWKS file at path.
+func NewFileKeySource(path string) (*FileKeySource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file %s: %w", path, err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Loaded signing keys from JWKS file", "count", len(keys), "path", path)
+	return &FileKeySource{keys: keys}, nil
+}
+
+// PublicKey returns the key for kid.
+func (s *FileKeySource) PublicKey(_ context.Context, kid string) (crypto.PublicKey, string, error) {
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, "", fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+	return key.key, key.alg, nil
+}
+
+// NewKeySourceFromEnv picks the key source:
+// JWKS_FILE if set, otherwise the JWKS URL from AUTH_JWKS_URL
+// (default: AUTH_SERVICE_URL + "/.well-known/jwks.json").
+// JWKS_REFRESH_INTERVAL controls the periodic refresh (default 10m).
+func NewKeySourceFromEnv() (KeySource, error) {
+	if path := os.Getenv("JWKS_FILE"); path != "" {
+		return NewFileKeySource(path)
+	}
+
+	url := os.Getenv("AUTH_JWKS_URL")
+	if url == "" {
+		baseURL := os.Getenv("AUTH_SERVICE_URL")
+		if baseURL == "" {
+			baseURL = "http://auth-service:8080"
+		}
+		url = baseURL + "/.well-known/jwks.json"
+	}
+
+	interval := defaultJWKSRefreshInterval
+	if val := os.Getenv("JWKS_REFRESH_INTERVAL"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			interval = d
+		} else {
+			slog.Warn("Invalid JWKS_REFRESH_INTERVAL, using default", "value", val, "default", interval)
+		}
+	}
+
+	slog.Info("Using JWKS", "url", url)
+	return NewJWKSClient(url, interval), nil
+}
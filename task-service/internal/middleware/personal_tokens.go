@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"cozy-go/shared/problem"
+)
+
+// PersonalTokenPrefix starts every personal access token issued by auth-service
+// (POST /me/tokens). Such tokens are opaque, so they are verified by introspection.
+const PersonalTokenPrefix = "cozy_pat_"
+
+// ScopesContextKey holds the []string scopes of a personal access token. It is
+// absent for session JWTs, which are not scoped.
+const ScopesContextKey contextKey = "scopes"
+
+// Scopes understood by task-service.
+const (
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
+)
+
+// TokenInfo describes an active personal access token.
+type TokenInfo struct {
+	Subject   string
+	Scopes    []string
+	ExpiresAt time.Time // Zero if the token does not expire
+}
+
+// PersonalTokenVerifier resolves personal access tokens. It returns nil, nil for
+// tokens that are unknown, expired or revoked.
+type PersonalTokenVerifier interface {
+	VerifyPersonalToken(ctx context.Context, token string) (*TokenInfo, error)
+}
+
+type personalTokenEntry struct {
+	info      *TokenInfo // nil if inactive
+	expiresAt time.Time
+}
+
+// VerifyPersonalToken asks auth-service about token. Answers are cached for the
+// same TTL as revocation checks, keyed by the token's hash, so a deleted token
+// stops working within REVOCATION_CACHE_TTL.
+func (c *IntrospectionChecker) VerifyPersonalToken(ctx context.Context, token string) (*TokenInfo, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.personalTokens[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.info, nil
+	}
+
+	result, err := c.introspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var info *TokenInfo
+	if result.Active && result.Subject != "" {
+		info = &TokenInfo{Subject: result.Subject, Scopes: strings.Fields(result.Scope)}
+		if result.ExpiresAt > 0 {
+			info.ExpiresAt = time.Unix(result.ExpiresAt, 0)
+		}
+	}
+
+	entry = personalTokenEntry{info: info, expiresAt: now.Add(c.activeTTL)}
+	if info != nil && !info.ExpiresAt.IsZero() && info.ExpiresAt.Before(entry.expiresAt) {
+		entry.expiresAt = info.ExpiresAt
+	}
+	c.mu.Lock()
+	if len(c.personalTokens) > pruneThreshold {
+		for k, e := range c.personalTokens {
+			if now.After(e.expiresAt) {
+				delete(c.personalTokens, k)
+			}
+		}
+	}
+	c.personalTokens[key] = entry
+	c.mu.Unlock()
+	return info, nil
+}
+
+// RequireScope rejects personal access tokens that lack scope with 403.
+// Session JWTs carry no scopes and may use every route.
+func RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if scopes, ok := r.Context().Value(ScopesContextKey).([]string); ok && !slices.Contains(scopes, scope) {
+			slog.InfoContext(r.Context(), "RequireScope: token lacks scope", "scope", scope, "method", r.Method, "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="`+scope+`"`)
+			problem.Error(w, r, "Token lacks required scope: "+scope, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
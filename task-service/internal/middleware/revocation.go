@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"cozy-go/shared/requestid"
+)
+
+// RevocationChecker reports whether an otherwise valid token has been revoked.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, tokenString string, jti string, expiresAt time.Time) (bool, error)
+}
+
+// defaultActiveCacheTTL bounds how long a revoked token can keep working in task-service.
+const defaultActiveCacheTTL = 30 * time.Second
+
+// pruneThreshold is the cache size above which expired entries are swept on insert.
+const pruneThreshold = 1000
+
+// introspectionResponse mirrors auth-service's POST /token/introspect response.
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	Scope     string `json:"scope"`
+}
+
+type cacheEntry struct {
+	revoked   bool
+	expiresAt time.Time
+}
+
+// IntrospectionChecker asks auth-service whether tokens are still active and caches the
+// answer per token ID, so task-service does not call auth-service on every request.
+// Active results are cached for a short TTL; revoked results are cached until the
+// token would have expired anyway.
+type IntrospectionChecker struct {
+	url        string
+	secret     string // Sent as bearer token; see SetSecret
+	httpClient *http.Client
+	activeTTL  time.Duration
+
+	mu             sync.Mutex
+	cache          map[string]cacheEntry
+	personalTokens map[string]personalTokenEntry // By token hash, see personal_tokens.go
+}
+
+// NewIntrospectionChecker creates a checker that calls the given introspection URL.
+func NewIntrospectionChecker(introspectionURL string, activeTTL time.Duration) *IntrospectionChecker {
+	if activeTTL <= 0 {
+		activeTTL = defaultActiveCacheTTL
+	}
+	return &IntrospectionChecker{
+		url:            introspectionURL,
+		httpClient:     &http.Client{Timeout: 5 * time.Second},
+		activeTTL:      activeTTL,
+		cache:          make(map[string]cacheEntry),
+		personalTokens: make(map[string]personalTokenEntry),
+	}
+}
+
+// SetSecret makes the checker authenticate to auth-service with secret, which
+// must match auth-service's INTROSPECTION_SECRET.
+func (c *IntrospectionChecker) SetSecret(secret string) {
+	c.secret = secret
+}
+
+// NewIntrospectionCheckerFromEnv builds a checker from AUTH_SERVICE_URL
+// (default http://auth-service:8080), REVOCATION_CACHE_TTL (default 30s) and
+// INTROSPECTION_SECRET.
+func NewIntrospectionCheckerFromEnv() *IntrospectionChecker {
+	baseURL := os.Getenv("AUTH_SERVICE_URL")
+	if baseURL == "" {
+		baseURL = "http://auth-service:8080"
+		slog.Info("AUTH_SERVICE_URL not set, using default", "url", baseURL)
+	}
+
+	ttl := defaultActiveCacheTTL
+	if val := os.Getenv("REVOCATION_CACHE_TTL"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			ttl = d
+		} else {
+			slog.Warn("Invalid REVOCATION_CACHE_TTL, using default", "value", val, "default", ttl)
+		}
+	}
+
+	checker := NewIntrospectionChecker(baseURL+"/token/introspect", ttl)
+	checker.SetSecret(os.Getenv("INTROSPECTION_SECRET"))
+	return checker
+}
+
+// IsRevoked returns the cached answer for jti if there is one, otherwise asks auth-service.
+func (c *IntrospectionChecker) IsRevoked(ctx context.Context, tokenString string, jti string, expiresAt time.Time) (bool, error) {
+	now := time.Now()
+
+	if jti != "" {
+		c.mu.Lock()
+		entry, ok := c.cache[jti]
+		c.mu.Unlock()
+		if ok && now.Before(entry.expiresAt) {
+			return entry.revoked, nil
+		}
+	}
+
+	result, err := c.introspect(ctx, tokenString)
+	if err != nil {
+		return false, err
+	}
+	revoked := !result.Active
+
+	if jti != "" {
+		entry := cacheEntry{revoked: revoked, expiresAt: now.Add(c.activeTTL)}
+		if revoked && expiresAt.After(now) {
+			entry.expiresAt = expiresAt
+		}
+		c.mu.Lock()
+		if len(c.cache) > pruneThreshold {
+			c.pruneLocked(now)
+		}
+		c.cache[jti] = entry
+		c.mu.Unlock()
+	}
+	return revoked, nil
+}
+
+// introspect performs the HTTP call to auth-service.
+func (c *IntrospectionChecker) introspect(ctx context.Context, tokenString string) (*introspectionResponse, error) {
+	body, err := json.Marshal(map[string]string{"token": tokenString})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.secret != "" {
+		req.Header.Set("Authorization", "Bearer "+c.secret)
+	}
+	// Forward the request ID so auth-service logs the introspection under it too
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token introspection request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token introspection returned status %d", resp.StatusCode)
+	}
+
+	var result introspectionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode introspection response: %w", err)
+	}
+	return &result, nil
+}
+
+// pruneLocked drops expired cache entries. The caller must hold c.mu.
+func (c *IntrospectionChecker) pruneLocked(now time.Time) {
+	for jti, entry := range c.cache {
+		if now.After(entry.expiresAt) {
+			delete(c.cache, jti)
+		}
+	}
+}
@@ -2,45 +2,48 @@ package routes
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"cozy-go/task-service/internal/handlers"
+	"cozy-go/task-service/internal/metrics"
 	"cozy-go/task-service/internal/middleware" // Import the middleware package
 )
 
-// Helper function to wrap a handler with middleware
-func applyAuth(handler http.HandlerFunc) http.Handler {
-	return middleware.AuthMiddleware(handler)
-}
-
 // SetupRoutes configures the application routes.
-func SetupRoutes(mux *http.ServeMux, projectHandler *handlers.ProjectHandler, taskHandler *handlers.TaskHandler) {
+func SetupRoutes(mux *http.ServeMux, authenticator *middleware.Authenticator, projectHandler *handlers.ProjectHandler, taskHandler *handlers.TaskHandler) {
+	// Helper function to wrap a handler with middleware.
+	// scope is required of personal access tokens; session JWTs may use every route.
+	applyAuth := func(scope string, handler http.HandlerFunc) http.Handler {
+		return authenticator.AuthMiddleware(middleware.RequireScope(scope, handler))
+	}
+	const read, write = middleware.ScopeTasksRead, middleware.ScopeTasksWrite
+
 	// Basic health check (public)
 	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintln(w, `{"status": "healthy"}`)
-		log.Println("Health check endpoint hit")
+		slog.InfoContext(r.Context(), "Health check endpoint hit")
 	})
+	mux.Handle("GET /metrics", metrics.Handler()) // Prometheus scrape endpoint (public)
 
 	// --- Project Routes (Protected) ---
-	mux.Handle("POST /projects", applyAuth(projectHandler.CreateProject))
-	mux.Handle("GET /projects/{id}", applyAuth(projectHandler.GetProjectByID))
-	mux.Handle("GET /projects", applyAuth(projectHandler.ListProjects))
-	mux.Handle("PUT /projects/{id}", applyAuth(projectHandler.UpdateProject))
-	mux.Handle("DELETE /projects/{id}", applyAuth(projectHandler.DeleteProject))
+	mux.Handle("POST /projects", applyAuth(write, projectHandler.CreateProject))
+	mux.Handle("GET /projects/{id}", applyAuth(read, projectHandler.GetProjectByID))
+	mux.Handle("GET /projects", applyAuth(read, projectHandler.ListProjects))
+	mux.Handle("PUT /projects/{id}", applyAuth(write, projectHandler.UpdateProject))
+	mux.Handle("DELETE /projects/{id}", applyAuth(write, projectHandler.DeleteProject))
 
 	// --- Task Routes (Protected) ---
 	// Note: Assumes Go 1.22+ for path parameters like {projectID} and {taskID}
-	mux.Handle("POST /projects/{projectID}/tasks", applyAuth(taskHandler.CreateTask))
-	mux.Handle("GET /projects/{projectID}/tasks", applyAuth(taskHandler.ListTasksByProject))
-	mux.Handle("GET /tasks/{taskID}", applyAuth(taskHandler.GetTask))
-	mux.Handle("PUT /projects/{projectID}/tasks/{taskID}", applyAuth(taskHandler.UpdateTask))
-	mux.Handle("DELETE /tasks/{taskID}", applyAuth(taskHandler.DeleteTask))
+	mux.Handle("POST /projects/{projectID}/tasks", applyAuth(write, taskHandler.CreateTask))
+	mux.Handle("GET /projects/{projectID}/tasks", applyAuth(read, taskHandler.ListTasksByProject))
+	mux.Handle("GET /tasks/{taskID}", applyAuth(read, taskHandler.GetTask))
+	mux.Handle("PUT /projects/{projectID}/tasks/{taskID}", applyAuth(write, taskHandler.UpdateTask))
+	mux.Handle("DELETE /tasks/{taskID}", applyAuth(write, taskHandler.DeleteTask))
 	// Optional: Route for updating only status (consider deprecating)
-	mux.Handle("PATCH /tasks/{taskID}/status", applyAuth(taskHandler.UpdateTaskStatusHandler))
-
+	mux.Handle("PATCH /tasks/{taskID}/status", applyAuth(write, taskHandler.UpdateTaskStatusHandler))
 
-	log.Println("Registered protected API routes with AuthMiddleware")
+	slog.Info("Registered protected API routes with AuthMiddleware")
 }
@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cozy-go/shared/logging"
+	"cozy-go/shared/requestid"
+	"cozy-go/task-service/internal/handlers"
+	"cozy-go/task-service/internal/middleware"
+	"cozy-go/task-service/internal/routes"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLog_PersonalTokenRequest(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(logging.NewHandler(&buf, slog.LevelInfo)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	// The introspection call made on behalf of the request carries its ID
+	var forwardedID string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwardedID = r.Header.Get(requestid.Header)
+		json.NewEncoder(w).Encode(map[string]any{"active": true, "sub": "42", "scope": "tasks:read", "token_type": "personal_access_token"})
+	}))
+	t.Cleanup(srv.Close)
+
+	mux := http.NewServeMux()
+	routes.SetupRoutes(mux, middleware.NewAuthenticator(staticKey{}, nil, middleware.NewIntrospectionChecker(srv.URL, time.Minute)),
+		handlers.NewProjectHandler(&fakeProjectRepo{}), handlers.NewTaskHandler(nil))
+	handler := requestid.Middleware(logging.AccessLog(mux))
+
+	req := httptest.NewRequest(http.MethodGet, "/projects", nil)
+	req.Header.Set("Authorization", "Bearer "+testPAT)
+	req.Header.Set(requestid.Header, "req-456")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "req-456", forwardedID)
+
+	assert.NotContains(t, buf.String(), testPAT)
+	var access map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		if record["msg"] == "HTTP request" {
+			access = record
+		}
+	}
+	require.NotNil(t, access)
+	assert.Equal(t, "req-456", access["request_id"])
+	assert.Equal(t, "42", access["user_id"])
+	assert.Equal(t, "/projects", access["path"])
+	assert.EqualValues(t, http.StatusOK, access["status"])
+}
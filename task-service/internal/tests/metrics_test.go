@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"cozy-go/task-service/internal/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scrapeMetrics fetches /metrics through handler and returns the text exposition.
+func scrapeMetrics(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	return rr.Body.String()
+}
+
+func TestMetrics_CountsRequestsByRoutePattern(t *testing.T) {
+	mux, _ := newTestMux(t, staticKey{}, new(atomic.Int32))
+	handler := metrics.Instrument(mux)
+
+	for _, path := range []string{"/projects/1", "/projects/2"} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer not-a-token")
+		handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+	}
+
+	// /metrics is public and served by the same mux
+	body := scrapeMetrics(t, handler)
+	// Requests are labelled with the pattern they matched, never the raw path
+	assert.Contains(t, body, `http_requests_total{method="GET",route="GET /projects/{id}",status="401"}`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="GET /projects/{id}",status="401"}`)
+	assert.NotContains(t, body, `route="/projects/1"`)
+}
+
+func TestMetrics_EventsConsumed(t *testing.T) {
+	metrics.EventConsumed("task-service.events", metrics.ResultRejected)
+
+	body := scrapeMetrics(t, metrics.Handler())
+	assert.Contains(t, body, `events_consumed_total{queue="task-service.events",result="rejected"}`)
+}
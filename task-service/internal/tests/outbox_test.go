@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"cozy-go/shared/outbox"
+	"cozy-go/shared/requestid"
+	"cozy-go/task-service/internal/events"
+	"cozy-go/topology"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryOutbox is an in-memory outbox.Store with the semantics of the outbox table.
+type memoryOutbox struct {
+	events    []outbox.Event
+	due       []time.Time
+	published []bool
+}
+
+// add stores event the way insertOutboxEvent does.
+func (s *memoryOutbox) add(t *testing.T, event events.Event) events.Envelope {
+	t.Helper()
+	envelope, err := events.NewEnvelope(context.Background(), event)
+	require.NoError(t, err)
+	payload, err := json.Marshal(envelope)
+	require.NoError(t, err)
+	s.events = append(s.events, outbox.Event{ID: int64(len(s.events) + 1), EventID: envelope.ID, EventType: envelope.Type, Payload: payload})
+	s.due = append(s.due, time.Time{})
+	s.published = append(s.published, false)
+	return envelope
+}
+
+func (s *memoryOutbox) ClaimOutboxEvents(_ context.Context, limit int, leaseUntil time.Time) ([]outbox.Event, error) {
+	var claimed []outbox.Event
+	for i := range s.events {
+		if len(claimed) < limit && !s.published[i] && !s.due[i].After(time.Now()) {
+			s.due[i] = leaseUntil
+			claimed = append(claimed, s.events[i])
+		}
+	}
+	return claimed, nil
+}
+
+func (s *memoryOutbox) MarkOutboxEventPublished(_ context.Context, id int64) error {
+	s.published[id-1] = true
+	return nil
+}
+
+func (s *memoryOutbox) MarkOutboxEventFailed(_ context.Context, id int64, _ string, nextAttemptAt time.Time) error {
+	s.events[id-1].Attempts++
+	s.due[id-1] = nextAttemptAt
+	return nil
+}
+
+func (s *memoryOutbox) DeletePublishedOutboxEvents(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+// unknownEvent is an event type missing from the catalog.
+type unknownEvent struct{}
+
+func (unknownEvent) EventType() string    { return "task.unknown" }
+func (unknownEvent) EventSubject() string { return "1" }
+
+// flakyPublisher fails the first failures calls and records every envelope it is given.
+type flakyPublisher struct {
+	failures int
+	sent     []events.Envelope
+}
+
+func (p *flakyPublisher) PublishEnvelope(_ context.Context, envelope events.Envelope) error {
+	p.sent = append(p.sent, envelope)
+	if len(p.sent) <= p.failures {
+		return events.ErrNotConnected
+	}
+	return nil
+}
+
+func TestTaskEvents_UnknownTypeIsRejected(t *testing.T) {
+	_, err := events.NewEnvelope(context.Background(), unknownEvent{})
+	assert.Error(t, err)
+}
+
+func TestTaskEvents_EnvelopeCarriesEvent(t *testing.T) {
+	ctx := requestid.NewContext(context.Background(), "req-42")
+	for _, event := range []events.Event{
+		events.TaskCreatedEvent{TaskID: 12, ProjectID: 3, UserID: 7, Title: "Write docs", Status: "todo", Priority: "medium"},
+		events.TaskUpdatedEvent{TaskID: 12, ProjectID: 3, UserID: 7, Title: "Write docs", Status: "done"},
+		events.TaskDeletedEvent{TaskID: 12, ProjectID: 3, UserID: 7},
+	} {
+		envelope, err := events.NewEnvelope(ctx, event)
+		require.NoError(t, err, event.EventType())
+		assert.Equal(t, event.EventType(), envelope.Type)
+		assert.Equal(t, events.Source, envelope.Source)
+		assert.Equal(t, "12", envelope.Subject)
+		assert.Equal(t, 1, envelope.DataVersion)
+		assert.Equal(t, "req-42", envelope.CorrelationID)
+
+		var data map[string]any
+		require.NoError(t, json.Unmarshal(envelope.Data, &data))
+		assert.EqualValues(t, 12, data["task_id"])
+		assert.EqualValues(t, 7, data["user_id"])
+	}
+}
+
+func TestOutboxRelay_RetriesUntilPublished(t *testing.T) {
+	store := &memoryOutbox{}
+	stored := store.add(t, events.TaskCreatedEvent{TaskID: 12, ProjectID: 3, UserID: 7, Title: "Write docs", Status: "todo", Priority: "medium"})
+	publisher := &flakyPublisher{failures: 1}
+	relay := outbox.NewRelay(store, publisher, outbox.DefaultConfig())
+
+	published, err := relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, published)
+	assert.Equal(t, 1, store.events[0].Attempts)
+	assert.WithinDuration(t, time.Now().Add(relay.Backoff(1)), store.due[0], 500*time.Millisecond)
+
+	store.due[0] = time.Time{} // Skip the backoff
+	published, err = relay.RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.True(t, store.published[0])
+
+	// Both attempts carried the ID the event was stored with
+	require.Len(t, publisher.sent, 2)
+	assert.Equal(t, stored.ID, publisher.sent[0].ID)
+	assert.Equal(t, stored.ID, publisher.sent[1].ID)
+}
+
+func TestOutboxRelay_UndecodablePayloadIsRetriedNotDropped(t *testing.T) {
+	store := &memoryOutbox{}
+	store.add(t, events.TaskDeletedEvent{TaskID: 1, ProjectID: 3, UserID: 7})
+	store.events[0].Payload = []byte(`{"id": `)
+	publisher := &flakyPublisher{}
+
+	published, err := outbox.NewRelay(store, publisher, outbox.DefaultConfig()).RelayPending(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, published)
+	assert.Empty(t, publisher.sent)
+	assert.False(t, store.published[0])
+	assert.Equal(t, 1, store.events[0].Attempts)
+}
+
+func TestOutboxRelay_DialsAgainWhileBrokerIsDown(t *testing.T) {
+	store := &memoryOutbox{}
+	store.add(t, events.TaskUpdatedEvent{TaskID: 3, ProjectID: 3, UserID: 7, Title: "Write docs", Status: "done"})
+	dials := 0
+	conn := topology.NewRedialer(nil, func() (*amqp.Connection, error) {
+		dials++
+		return nil, errors.New("connection refused")
+	})
+	relay := outbox.NewRelay(store, events.NewRabbitMqPublisher(conn), outbox.DefaultConfig())
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		store.due[0] = time.Time{} // Skip the backoff
+		published, err := relay.RelayPending(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, published)
+		assert.Equal(t, attempt, dials, "every attempt dials a new connection")
+		assert.Equal(t, attempt, store.events[0].Attempts)
+	}
+	assert.False(t, store.published[0])
+}
@@ -0,0 +1,167 @@
+package tests
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cozy-go/task-service/internal/handlers"
+	"cozy-go/task-service/internal/middleware"
+	"cozy-go/task-service/internal/models"
+	"cozy-go/task-service/internal/routes"
+	"cozy-go/task-service/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPAT = "cozy_pat_readonly"
+
+// fakeIntrospection stands in for auth-service's POST /token/introspect.
+// Only testPAT is active, with the tasks:read scope.
+func fakeIntrospection(t *testing.T, calls *atomic.Int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req struct {
+			Token string `json:"token"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		resp := map[string]any{"active": false}
+		if req.Token == testPAT {
+			resp = map[string]any{"active": true, "sub": "42", "scope": "tasks:read", "token_type": "personal_access_token"}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// fakeIntrospectionURL starts fakeIntrospection without counting calls.
+func fakeIntrospectionURL(t *testing.T) string {
+	return fakeIntrospection(t, new(atomic.Int32)).URL
+}
+
+// staticKey is a KeySource with a single Ed25519 key.
+type staticKey struct{ key crypto.PublicKey }
+
+func (s staticKey) PublicKey(_ context.Context, _ string) (crypto.PublicKey, string, error) {
+	return s.key, "EdDSA", nil
+}
+
+// fakeProjectRepo serves an empty project list and refuses to create projects;
+// other methods are not used.
+type fakeProjectRepo struct {
+	repository.ProjectRepository
+	listedFor []int
+}
+
+func (f *fakeProjectRepo) GetProjectsByUserID(_ context.Context, userID int) ([]models.Project, error) {
+	f.listedFor = append(f.listedFor, userID)
+	return []models.Project{}, nil
+}
+
+func (f *fakeProjectRepo) CreateProject(_ context.Context, _ *models.Project) (int, error) {
+	return 0, errors.New("read-only")
+}
+
+// newTestMux wires the real routes to a fake introspection endpoint.
+func newTestMux(t *testing.T, keys middleware.KeySource, calls *atomic.Int32) (*http.ServeMux, *fakeProjectRepo) {
+	srv := fakeIntrospection(t, calls)
+	checker := middleware.NewIntrospectionChecker(srv.URL, time.Minute)
+	projects := &fakeProjectRepo{}
+	mux := http.NewServeMux()
+	routes.SetupRoutes(mux, middleware.NewAuthenticator(keys, nil, checker),
+		handlers.NewProjectHandler(projects), handlers.NewTaskHandler(nil))
+	return mux, projects
+}
+
+func serve(mux *http.ServeMux, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(`{"name":"x"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPersonalToken_ReadScopeAllowsReads(t *testing.T) {
+	var calls atomic.Int32
+	mux, projects := newTestMux(t, staticKey{}, &calls)
+
+	rr := serve(mux, "GET", "/projects", testPAT)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, []int{42}, projects.listedFor)
+
+	// The answer is cached
+	serve(mux, "GET", "/projects", testPAT)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestPersonalToken_MissingScopeIsForbidden(t *testing.T) {
+	var calls atomic.Int32
+	mux, _ := newTestMux(t, staticKey{}, &calls)
+
+	for _, route := range [][2]string{{"POST", "/projects"}, {"PUT", "/projects/1"}, {"DELETE", "/tasks/1"}, {"PATCH", "/tasks/1/status"}} {
+		rr := serve(mux, route[0], route[1], testPAT)
+		assert.Equal(t, http.StatusForbidden, rr.Code, "%s %s", route[0], route[1])
+		assert.Contains(t, rr.Header().Get("WWW-Authenticate"), `scope="tasks:write"`)
+	}
+}
+
+func TestPersonalToken_InactiveTokenIsRejected(t *testing.T) {
+	var calls atomic.Int32
+	mux, projects := newTestMux(t, staticKey{}, &calls)
+
+	rr := serve(mux, "GET", "/projects", "cozy_pat_deleted")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Empty(t, projects.listedFor)
+}
+
+func TestPersonalToken_SessionJWTIsNotScoped(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.RegisteredClaims{
+		Subject:   "7",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	})
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(priv)
+	require.NoError(t, err)
+
+	var calls atomic.Int32
+	mux, projects := newTestMux(t, staticKey{key: pub}, &calls)
+
+	// A write route passes the scope check and reaches the repository
+	rr := serve(mux, "POST", "/projects", signed)
+	assert.NotEqual(t, http.StatusForbidden, rr.Code)
+	assert.NotEqual(t, http.StatusUnauthorized, rr.Code)
+
+	rr = serve(mux, "GET", "/projects", signed)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []int{7}, projects.listedFor)
+	assert.Zero(t, calls.Load())
+}
+
+func TestIntrospectionChecker_SendsSecret(t *testing.T) {
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(map[string]any{"active": false})
+	}))
+	t.Cleanup(srv.Close)
+
+	checker := middleware.NewIntrospectionChecker(srv.URL, time.Minute)
+	checker.SetSecret("s3cret")
+	_, err := checker.VerifyPersonalToken(context.Background(), testPAT)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer s3cret", authorization)
+}
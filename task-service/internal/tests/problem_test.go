@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cozy-go/shared/problem"
+	"cozy-go/shared/requestid"
+	"cozy-go/task-service/internal/handlers"
+	"cozy-go/task-service/internal/middleware"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeProblem checks that rr is a problem+json response and decodes it.
+func decodeProblem(t *testing.T, rr *httptest.ResponseRecorder) problem.Problem {
+	t.Helper()
+	assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+	var p problem.Problem
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&p))
+	assert.Equal(t, rr.Code, p.Status)
+	return p
+}
+
+func TestCreateProject_MissingNameIsFieldError(t *testing.T) {
+	handler := requestid.Middleware(http.HandlerFunc(handlers.NewProjectHandler(nil).CreateProject))
+
+	req := httptest.NewRequest("POST", "/projects", strings.NewReader(`{"description": "no name"}`))
+	req.Header.Set(requestid.Header, "client-id-1")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	p := decodeProblem(t, rr)
+	assert.Equal(t, problem.CodeValidationFailed, p.Code)
+	assert.Equal(t, "Project name is required", p.Message)
+	assert.Equal(t, "/projects", p.Instance)
+	assert.Equal(t, "client-id-1", p.RequestID)
+	assert.Equal(t, []problem.FieldError{{Field: "name", Code: "required", Message: "Project name is required"}}, p.Errors)
+}
+
+func TestAuthMiddleware_ErrorsAreProblems(t *testing.T) {
+	auth := middleware.NewAuthenticator(staticKey{}, nil, middleware.NewIntrospectionChecker(fakeIntrospectionURL(t), time.Minute))
+	handler := requestid.Middleware(auth.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("Handler must not be reached without a token")
+	})))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/projects", nil))
+
+	require.Equal(t, http.StatusUnauthorized, rr.Code)
+	p := decodeProblem(t, rr)
+	assert.Equal(t, problem.CodeUnauthorized, p.Code)
+	// A generated ID is returned in both the header and the body
+	assert.Len(t, p.RequestID, 32)
+	assert.Equal(t, rr.Header().Get(requestid.Header), p.RequestID)
+}
+
+func TestRequestID_RejectsMalformedClientIDs(t *testing.T) {
+	var seen string
+	handler := requestid.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestid.FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(requestid.Header, "bad id\r\nwith newline")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.NotEqual(t, "bad id\r\nwith newline", seen)
+	assert.Len(t, seen, 32)
+	assert.Equal(t, seen, rr.Header().Get(requestid.Header))
+}
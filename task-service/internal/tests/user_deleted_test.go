@@ -0,0 +1,219 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"cozy-go/task-service/internal/events"
+	"cozy-go/topology"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePurger records which users' data was purged.
+type fakePurger struct {
+	purged []int
+	err    error
+}
+
+func (f *fakePurger) DeleteProjectsByUserID(_ context.Context, userID int) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.purged = append(f.purged, userID)
+	return 1, nil
+}
+
+// structuredUserDeleted is a user.deleted event as auth-service publishes it in
+// structured content mode.
+func structuredUserDeleted(data string) amqp.Delivery {
+	return amqp.Delivery{
+		ContentType: "application/cloudevents+json; charset=utf-8",
+		Body: []byte(`{"specversion": "1.0", "id": "6f1c2b1e-8a47-4a53-9a0e-2d6c7f3b9e10", "source": "auth-service",
+			"type": "user.deleted", "subject": "42", "time": "2026-10-16T12:00:00Z", "datacontenttype": "application/json",
+			"dataversion": 1, "correlationid": "req-1", "data": ` + data + `}`),
+	}
+}
+
+// binaryUserDeleted is a user.deleted event as auth-service publishes it in
+// binary content mode.
+func binaryUserDeleted(data string) amqp.Delivery {
+	return amqp.Delivery{
+		ContentType: "application/json",
+		Headers: amqp.Table{
+			"cloudEvents:specversion": "1.0",
+			"cloudEvents:id":          "6f1c2b1e-8a47-4a53-9a0e-2d6c7f3b9e10",
+			"cloudEvents:source":      "auth-service",
+			"cloudEvents:type":        "user.deleted",
+			"cloudEvents:subject":     "42",
+			"cloudEvents:time":        "2026-10-16T12:00:00Z",
+			"cloudEvents:dataversion": int64(1),
+		},
+		Body: []byte(data),
+	}
+}
+
+// handleDelivery decodes d and handles it like the consumer does.
+func handleDelivery(d amqp.Delivery, purger events.UserDataPurger) error {
+	envelope, err := events.DecodeDelivery(d)
+	if err != nil {
+		return err
+	}
+	return events.HandleUserDeleted(context.Background(), envelope, purger)
+}
+
+func TestHandleUserDeleted_PurgesUserData(t *testing.T) {
+	data := `{"user_id": 42, "email": "gone@example.com", "username": "gone"}`
+
+	for mode, d := range map[string]amqp.Delivery{"structured": structuredUserDeleted(data), "binary": binaryUserDeleted(data)} {
+		purger := &fakePurger{}
+		require.NoError(t, handleDelivery(d, purger), mode)
+		assert.Equal(t, []int{42}, purger.purged, mode)
+	}
+}
+
+func TestHandleUserDeleted_MalformedEventsAreNotRetried(t *testing.T) {
+	purger := &fakePurger{}
+
+	otherType := binaryUserDeleted(`{"user_id": 42}`)
+	otherType.Headers["cloudEvents:type"] = "user.registered"
+	newerVersion := binaryUserDeleted(`{"user_id": 42}`)
+	newerVersion.Headers["cloudEvents:dataversion"] = int64(2)
+
+	for name, d := range map[string]amqp.Delivery{
+		"not json":      {ContentType: "application/cloudevents+json", Body: []byte(`not json`)},
+		"invalid user":  structuredUserDeleted(`{"user_id": 0}`),
+		"not an object": binaryUserDeleted(`"not an object"`),
+		// An event from before CloudEvents were introduced
+		"bare event":    {ContentType: "application/json", Body: []byte(`{"user_id": 42}`)},
+		"other type":    otherType,
+		"newer version": newerVersion,
+	} {
+		err := handleDelivery(d, purger)
+		assert.ErrorIs(t, err, events.ErrMalformedEvent, name)
+	}
+	assert.Empty(t, purger.purged)
+}
+
+func TestHandleUserDeleted_PurgeFailureIsRetryable(t *testing.T) {
+	purger := &fakePurger{err: errors.New("database unavailable")}
+
+	err := handleDelivery(binaryUserDeleted(`{"user_id": 42}`), purger)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, events.ErrMalformedEvent)
+}
+
+// testConsumerConfig retries after a few milliseconds so tests run fast.
+func testConsumerConfig() events.ConsumerConfig {
+	return events.ConsumerConfig{MaxAttempts: 3, MinRetryDelay: time.Millisecond, MaxRetryDelay: 5 * time.Millisecond, ConfirmTimeout: time.Second}
+}
+
+// flakyPurger fails the first failures purges (all while failures is
+// negative) and records the users purged after that.
+type flakyPurger struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	purged   []int
+}
+
+func (p *flakyPurger) DeleteProjectsByUserID(_ context.Context, userID int) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.failures < 0 || p.calls <= p.failures {
+		return 0, errors.New("database unavailable")
+	}
+	p.purged = append(p.purged, userID)
+	return 1, nil
+}
+
+func (p *flakyPurger) Calls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+func (p *flakyPurger) Purged() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]int(nil), p.purged...)
+}
+
+// startConsumer runs ConsumeUserDeletedEvents on broker until the test ends
+// and publishes d to the user.deleted routing key.
+func startConsumer(t *testing.T, broker *topology.MemoryBroker, purger events.UserDataPurger, d amqp.Delivery) {
+	t.Helper()
+	ch, err := broker.Channel()
+	require.NoError(t, err)
+	require.NoError(t, topology.Declare(ch))
+	require.NoError(t, ch.PublishWithContext(context.Background(), topology.Exchange, "user.deleted", false, false, amqp.Publishing{
+		Headers: d.Headers, ContentType: d.ContentType, MessageId: "6f1c2b1e-8a47-4a53-9a0e-2d6c7f3b9e10", Body: d.Body,
+	}))
+
+	done := make(chan error, 1)
+	go func() { done <- events.ConsumeUserDeletedEvents(broker, purger, testConsumerConfig()) }()
+	t.Cleanup(func() {
+		broker.Close()
+		<-done
+	})
+}
+
+func TestConsumeUserDeletedEvents_RetriesFailedPurge(t *testing.T) {
+	broker := topology.NewMemoryBroker()
+	purger := &flakyPurger{failures: 2}
+	startConsumer(t, broker, purger, binaryUserDeleted(`{"user_id": 42}`))
+
+	require.Eventually(t, func() bool { return len(purger.Purged()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, []int{42}, purger.Purged())
+	assert.Equal(t, 3, purger.Calls())
+	_, ok := broker.Get(events.DeadLetterQueue)
+	assert.False(t, ok)
+}
+
+func TestConsumeUserDeletedEvents_DeadLettersAfterMaxAttempts(t *testing.T) {
+	broker := topology.NewMemoryBroker()
+	purger := &flakyPurger{failures: -1}
+	startConsumer(t, broker, purger, binaryUserDeleted(`{"user_id": 42}`))
+
+	var d amqp.Delivery
+	require.Eventually(t, func() bool {
+		var ok bool
+		d, ok = broker.Get(events.DeadLetterQueue)
+		return ok
+	}, time.Second, time.Millisecond)
+
+	// The event is not redelivered once it was dead-lettered
+	assert.Equal(t, testConsumerConfig().MaxAttempts, purger.Calls())
+	assert.Equal(t, "6f1c2b1e-8a47-4a53-9a0e-2d6c7f3b9e10", d.MessageId)
+	assert.Equal(t, "user.deleted", d.Headers["cloudEvents:type"])
+	assert.EqualValues(t, 3, d.Headers["x-attempts"])
+	assert.Contains(t, d.Headers["x-last-error"], "database unavailable")
+	assert.Eventually(t, func() bool { return broker.Unacked() == 0 }, time.Second, time.Millisecond)
+}
+
+func TestConsumeUserDeletedEvents_DeadLetterRequiresConfirmation(t *testing.T) {
+	broker := topology.NewMemoryBroker()
+	broker.SetConfirmMode(events.DeadLetterQueue, topology.ConfirmNack)
+	purger := &flakyPurger{failures: -1}
+	startConsumer(t, broker, purger, binaryUserDeleted(`{"user_id": 42}`))
+
+	// A nacked copy leaves the event on the queue, to be retried again
+	require.Eventually(t, func() bool { return purger.Calls() > testConsumerConfig().MaxAttempts }, time.Second, time.Millisecond)
+	_, ok := broker.Get(events.DeadLetterQueue)
+	assert.False(t, ok)
+}
+
+func TestConsumerConfig_RetryDelayDoublesUpToMax(t *testing.T) {
+	config := events.ConsumerConfig{MinRetryDelay: time.Second, MaxRetryDelay: 5 * time.Second}
+
+	assert.Equal(t, time.Second, config.RetryDelay(1))
+	assert.Equal(t, 2*time.Second, config.RetryDelay(2))
+	assert.Equal(t, 4*time.Second, config.RetryDelay(3))
+	assert.Equal(t, 5*time.Second, config.RetryDelay(4))
+}
@@ -2,7 +2,7 @@ package utils
 
 import (
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 
@@ -14,13 +14,13 @@ import (
 func GetUserIDFromContext(r *http.Request) (int, error) {
 	userIDStr, ok := r.Context().Value(middleware.UserIDContextKey).(string)
 	if !ok || userIDStr == "" {
-		log.Println("Error getting user ID from context")
+		slog.ErrorContext(r.Context(), "Error getting user ID from context")
 		// This should technically not happen if middleware runs correctly
 		return 0, errors.New("user ID not found in context")
 	}
 	userID, err := strconv.Atoi(userIDStr)
 	if err != nil {
-		log.Printf("Error converting userID string '%s' to int: %v", userIDStr, err)
+		slog.ErrorContext(r.Context(), "Error converting user ID to int", "user_id", userIDStr, "error", err)
 		return 0, errors.New("invalid user ID format in context")
 	}
 	return userID, nil
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"cozy-go/shared/outbox"
+	"cozy-go/task-service/internal/database"
+	"cozy-go/task-service/internal/events"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// OutboxRepository reads the outbox table for the relay (see
+// cozy-go/shared/outbox). Events are written to the outbox by the repository
+// method that makes the change they describe, in the same transaction (see
+// insertOutboxEvent).
+type OutboxRepository interface {
+	ClaimOutboxEvents(ctx context.Context, limit int, leaseUntil time.Time) ([]outbox.Event, error)
+	MarkOutboxEventPublished(ctx context.Context, id int64) error
+	MarkOutboxEventFailed(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error
+	DeletePublishedOutboxEvents(ctx context.Context, before time.Time) (int64, error)
+}
+
+// outboxRepository implements OutboxRepository using pgxpool.
+type outboxRepository struct {
+	db *pgxpool.Pool
+}
+
+// NewOutboxRepository creates a new instance of OutboxRepository.
+func NewOutboxRepository() OutboxRepository {
+	if database.DB == nil {
+		slog.Error("Database pool is not initialized")
+		os.Exit(1)
+	}
+	return &outboxRepository{db: database.DB}
+}
+
+// insertOutboxEvent wraps event in an envelope and stores it in the outbox
+// within tx, so the event is published if and only if tx commits.
+func insertOutboxEvent(ctx context.Context, tx pgx.Tx, event events.Event) error {
+	envelope, err := events.NewEnvelope(ctx, event)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", envelope.Type, err)
+	}
+	query := `INSERT INTO outbox (event_id, event_type, payload) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, query, envelope.ID, envelope.Type, payload); err != nil {
+		return fmt.Errorf("failed to store %s event in outbox: %w", envelope.Type, err)
+	}
+	return nil
+}
+
+// ClaimOutboxEvents returns up to limit unpublished events that are due, oldest
+// first, and hides them from other relays until leaseUntil. Rows claimed by a
+// concurrent relay are skipped rather than waited for. An event whose relay
+// dies before marking it is claimed again once the lease runs out.
+func (r *outboxRepository) ClaimOutboxEvents(ctx context.Context, limit int, leaseUntil time.Time) ([]outbox.Event, error) {
+	query := `UPDATE outbox SET next_attempt_at = $2
+              WHERE id IN (SELECT id FROM outbox
+                           WHERE published_at IS NULL AND next_attempt_at <= NOW()
+                           ORDER BY id
+                           LIMIT $1
+                           FOR UPDATE SKIP LOCKED)
+              RETURNING id, event_id::text, event_type, payload, attempts, created_at`
+	rows, err := r.db.Query(ctx, query, limit, leaseUntil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var claimed []outbox.Event
+	for rows.Next() {
+		var event outbox.Event
+		if err := rows.Scan(&event.ID, &event.EventID, &event.EventType, &event.Payload, &event.Attempts, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		claimed = append(claimed, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	// RETURNING does not keep the subquery's order
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].ID < claimed[j].ID })
+	return claimed, nil
+}
+
+// MarkOutboxEventPublished records that the event with id reached the broker.
+func (r *outboxRepository) MarkOutboxEventPublished(ctx context.Context, id int64) error {
+	query := `UPDATE outbox SET published_at = NOW(), last_error = NULL WHERE id = $1`
+	if _, err := r.db.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to mark outbox event %d published: %w", id, err)
+	}
+	return nil
+}
+
+// MarkOutboxEventFailed records a failed publish attempt of the event with id
+// and schedules the next one.
+func (r *outboxRepository) MarkOutboxEventFailed(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error {
+	query := `UPDATE outbox SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3 WHERE id = $1`
+	if _, err := r.db.Exec(ctx, query, id, lastError, nextAttemptAt); err != nil {
+		return fmt.Errorf("failed to record publish failure of outbox event %d: %w", id, err)
+	}
+	return nil
+}
+
+// DeletePublishedOutboxEvents removes events published before before and
+// returns how many were removed. Unpublished events are never removed.
+func (r *outboxRepository) DeletePublishedOutboxEvents(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM outbox WHERE published_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune published outbox events: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
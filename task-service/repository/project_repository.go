@@ -2,7 +2,8 @@ package repository
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"os"
 	"time"
 
 	"cozy-go/task-service/internal/database"
@@ -24,6 +25,8 @@ type ProjectRepository interface {
 	UpdateProject(ctx context.Context, project *models.Project, userID int) (*models.Project, error)
 	// DeleteProject now requires userID for authorization
 	DeleteProject(ctx context.Context, id int, userID int) error
+	// DeleteProjectsByUserID removes every project (and task) of a deleted account
+	DeleteProjectsByUserID(ctx context.Context, userID int) (int64, error)
 }
 
 // pgProjectRepository implements ProjectRepository using pgxpool.
@@ -36,7 +39,8 @@ type pgProjectRepository struct {
 func NewProjectRepository() ProjectRepository {
 	if database.DB == nil {
 		// This should ideally not happen if InitDB is called correctly in main.
-		log.Fatal("Database pool is not initialized")
+		slog.Error("Database pool is not initialized")
+		os.Exit(1)
 	}
 	return &pgProjectRepository{db: database.DB}
 }
@@ -54,10 +58,10 @@ func (r *pgProjectRepository) CreateProject(ctx context.Context, project *models
 		&project.UpdatedAt,
 	)
 	if err != nil {
-		log.Printf("Error creating project for user %d: %v", project.UserID, err)
+		slog.ErrorContext(ctx, "Error creating project", "user_id", project.UserID, "error", err)
 		return 0, err
 	}
-	log.Printf("Created project with ID: %d for user ID: %d", project.ID, project.UserID)
+	slog.InfoContext(ctx, "Created project", "project_id", project.ID, "user_id", project.UserID)
 	return project.ID, nil
 }
 
@@ -79,7 +83,7 @@ func (r *pgProjectRepository) GetProjectByID(ctx context.Context, id int, userID
 		if err == pgx.ErrNoRows {
 			return nil, nil // Or return a specific "not found" error
 		}
-		log.Printf("Error getting project by ID %d: %v", id, err)
+		slog.ErrorContext(ctx, "Error getting project", "project_id", id, "error", err)
 		return nil, err
 	}
 	return project, nil
@@ -93,7 +97,7 @@ func (r *pgProjectRepository) GetProjectsByUserID(ctx context.Context, userID in
               ORDER BY created_at DESC` // Filter by user_id
 	rows, err := r.db.Query(ctx, query, userID)
 	if err != nil {
-		log.Printf("Error querying projects for user %d: %v", userID, err)
+		slog.ErrorContext(ctx, "Error querying projects", "user_id", userID, "error", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -110,14 +114,14 @@ func (r *pgProjectRepository) GetProjectsByUserID(ctx context.Context, userID in
 			&project.UpdatedAt,
 		)
 		if err != nil {
-			log.Printf("Error scanning project row: %v", err)
+			slog.ErrorContext(ctx, "Error scanning project row", "error", err)
 			return nil, err
 		}
 		projects = append(projects, project)
 	}
 
 	if err = rows.Err(); err != nil {
-		log.Printf("Error iterating project rows: %v", err)
+		slog.ErrorContext(ctx, "Error iterating project rows", "error", err)
 		return nil, err
 	}
 
@@ -149,7 +153,7 @@ func (r *pgProjectRepository) UpdateProject(ctx context.Context, project *models
 	// We need to pass the userID here as well to ensure we fetch the correct project
 	existingProject, err := r.GetProjectByID(ctx, project.ID, userID) // Pass userID
 	if err != nil {
-		log.Printf("Error fetching project %d for user %d before update: %v", project.ID, userID, err)
+		slog.ErrorContext(ctx, "Error fetching project before update", "project_id", project.ID, "user_id", userID, "error", err)
 		return nil, err // Could be not found or other error
 	}
 	if existingProject == nil {
@@ -193,13 +197,13 @@ func (r *pgProjectRepository) UpdateProject(ctx context.Context, project *models
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			// This means either the project ID didn't exist OR it didn't belong to the user
-			log.Printf("Error updating project %d for user %d: project not found or not owned by user", project.ID, userID)
+			slog.InfoContext(ctx, "Error updating project: project not found or not owned by user", "project_id", project.ID, "user_id", userID)
 			return nil, err // Return ErrNoRows
 		}
-		log.Printf("Error updating project %d for user %d: %v", project.ID, userID, err)
+		slog.ErrorContext(ctx, "Error updating project", "project_id", project.ID, "user_id", userID, "error", err)
 		return nil, err
 	}
-	log.Printf("Updated project with ID: %d for user ID: %d", updatedProject.ID, updatedProject.UserID)
+	slog.InfoContext(ctx, "Updated project", "project_id", updatedProject.ID, "user_id", updatedProject.UserID)
 	return &updatedProject, nil
 }
 
@@ -209,7 +213,7 @@ func (r *pgProjectRepository) DeleteProject(ctx context.Context, id int, userID
 	// Use a transaction to ensure atomicity
 	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		log.Printf("Error starting transaction for deleting project %d for user %d: %v", id, userID, err)
+		slog.ErrorContext(ctx, "Error starting transaction for deleting project", "project_id", id, "user_id", userID, "error", err)
 		return err
 	}
 	defer tx.Rollback(ctx) // Rollback if anything fails
@@ -218,23 +222,23 @@ func (r *pgProjectRepository) DeleteProject(ctx context.Context, id int, userID
 	taskQuery := `DELETE FROM tasks WHERE project_id = $1`
 	_, err = tx.Exec(ctx, taskQuery, id)
 	if err != nil {
-		log.Printf("Error deleting tasks for project %d: %v", id, err)
+		slog.ErrorContext(ctx, "Error deleting tasks of project", "project_id", id, "error", err)
 		return err
 	}
-	log.Printf("Deleted tasks associated with project ID: %d", id)
+	slog.InfoContext(ctx, "Deleted tasks associated with project", "project_id", id)
 
 
 	// 2. Delete the project itself, ensuring the user owns it
 	projectQuery := `DELETE FROM projects WHERE id = $1 AND user_id = $2` // Added user_id check
 	cmdTag, err := tx.Exec(ctx, projectQuery, id, userID)
 	if err != nil {
-		log.Printf("Error deleting project %d for user %d: %v", id, userID, err)
+		slog.ErrorContext(ctx, "Error deleting project", "project_id", id, "user_id", userID, "error", err)
 		return err
 	}
 
 	// Check if any row was actually deleted (if 0, means project didn't exist or wasn't owned by user)
 	if cmdTag.RowsAffected() == 0 {
-		log.Printf("Project with ID %d not found for deletion or not owned by user %d.", id, userID)
+		slog.InfoContext(ctx, "Project not found for deletion or not owned by user", "project_id", id, "user_id", userID)
 		// Return a specific error or nil? Returning nil might be acceptable if "delete non-existent" is ok.
 		// return fmt.Errorf("project with ID %d not found or not owned by user %d", id, userID)
 		return pgx.ErrNoRows // Indicate not found
@@ -244,10 +248,43 @@ func (r *pgProjectRepository) DeleteProject(ctx context.Context, id int, userID
 	// Commit the transaction
 	err = tx.Commit(ctx)
 	if err != nil {
-		log.Printf("Error committing transaction for deleting project %d for user %d: %v", id, userID, err)
+		slog.ErrorContext(ctx, "Error committing transaction for deleting project", "project_id", id, "user_id", userID, "error", err)
 		return err
 	}
 
-	log.Printf("Deleted project with ID: %d for user ID: %d", id, userID)
+	slog.InfoContext(ctx, "Deleted project", "project_id", id, "user_id", userID)
 	return nil
 }
+
+// DeleteProjectsByUserID deletes all projects of userID and their tasks, returning the
+// number of projects removed. Used when the account is deleted in auth-service.
+func (r *pgProjectRepository) DeleteProjectsByUserID(ctx context.Context, userID int) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error starting transaction for purging projects of user", "user_id", userID, "error", err)
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Tasks cascade with their project, but delete them explicitly like DeleteProject does
+	taskQuery := `DELETE FROM tasks WHERE project_id IN (SELECT id FROM projects WHERE user_id = $1)`
+	taskTag, err := tx.Exec(ctx, taskQuery, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error deleting tasks of user", "user_id", userID, "error", err)
+		return 0, err
+	}
+
+	projectTag, err := tx.Exec(ctx, `DELETE FROM projects WHERE user_id = $1`, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error deleting projects of user", "user_id", userID, "error", err)
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "Error committing purge of user", "user_id", userID, "error", err)
+		return 0, err
+	}
+
+	slog.InfoContext(ctx, "Purged projects and tasks of user", "projects", projectTag.RowsAffected(), "tasks", taskTag.RowsAffected(), "user_id", userID)
+	return projectTag.RowsAffected(), nil
+}
@@ -2,10 +2,12 @@ package repository
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"os"
 	"time"
 
 	"cozy-go/task-service/internal/database"
+	"cozy-go/task-service/internal/events"
 	"cozy-go/task-service/internal/models"
 
 	"github.com/jackc/pgx/v5"
@@ -36,7 +38,8 @@ type pgTaskRepository struct {
 // NewTaskRepository creates a new instance of TaskRepository.
 func NewTaskRepository() TaskRepository {
 	if database.DB == nil {
-		log.Fatal("Database pool is not initialized")
+		slog.Error("Database pool is not initialized")
+		os.Exit(1)
 	}
 	return &pgTaskRepository{db: database.DB}
 }
@@ -48,11 +51,11 @@ func (r *pgTaskRepository) checkProjectOwnership(ctx context.Context, projectID
 	checkQuery := `SELECT EXISTS(SELECT 1 FROM projects WHERE id = $1 AND user_id = $2)`
 	err := r.db.QueryRow(ctx, checkQuery, projectID, userID).Scan(&exists)
 	if err != nil { // Handle potential DB errors during the check
-		log.Printf("Error checking project ownership for project %d, user %d: %v", projectID, userID, err)
+		slog.ErrorContext(ctx, "Error checking project ownership", "project_id", projectID, "user_id", userID, "error", err)
 		return err
 	}
 	if !exists {
-		log.Printf("Ownership check failed: Project %d not found or not owned by user %d", projectID, userID)
+		slog.InfoContext(ctx, "Ownership check failed: project not found or not owned by user", "project_id", projectID, "user_id", userID)
 		return pgx.ErrNoRows // Use ErrNoRows to indicate not found or not authorized
 	}
 	return nil // Ownership verified
@@ -90,14 +93,39 @@ func (r *pgTaskRepository) CreateTask(ctx context.Context, task *models.Task, us
 	// 	task.Priority = models.PriorityMedium // Default to medium priority
 	// }
 
-	err := r.db.QueryRow(ctx, query,
+	// The task and its TaskCreatedEvent are stored together, so the event is
+	// published if and only if the task exists
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error starting transaction for creating task", "project_id", task.ProjectID, "user_id", userID, "error", err)
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, query,
 		task.ProjectID, task.Title, task.Description, string(task.Status), string(task.Label), string(task.Priority), task.DueDate, task.StartTime, task.EndTime, now, now,
 	).Scan(&task.ID, &task.CreatedAt, &task.UpdatedAt)
 	if err != nil {
-		log.Printf("Error creating task for project %d, user %d: %v", task.ProjectID, userID, err)
+		slog.ErrorContext(ctx, "Error creating task", "project_id", task.ProjectID, "user_id", userID, "error", err)
+		return 0, err
+	}
+	event := events.TaskCreatedEvent{
+		TaskID:    task.ID,
+		ProjectID: task.ProjectID,
+		UserID:    userID,
+		Title:     task.Title,
+		Status:    string(task.Status),
+		Priority:  string(task.Priority),
+	}
+	if err := insertOutboxEvent(ctx, tx, event); err != nil {
+		slog.ErrorContext(ctx, "Error storing task created event", "task_id", task.ID, "error", err)
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "Error committing transaction for creating task", "project_id", task.ProjectID, "user_id", userID, "error", err)
 		return 0, err
 	}
-	log.Printf("Created task with ID: %d for project ID: %d", task.ID, task.ProjectID)
+	slog.InfoContext(ctx, "Created task", "task_id", task.ID, "project_id", task.ProjectID)
 	return task.ID, nil
 }
 
@@ -124,10 +152,10 @@ func (r *pgTaskRepository) GetTaskByID(ctx context.Context, id int, userID int)
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			log.Printf("Task %d not found or not owned by user %d", id, userID)
+			slog.InfoContext(ctx, "Task not found or not owned by user", "task_id", id, "user_id", userID)
 			return nil, nil // Not found or not authorized
 		}
-		log.Printf("Error getting task by ID %d for user %d: %v", id, userID, err)
+		slog.ErrorContext(ctx, "Error getting task", "task_id", id, "user_id", userID, "error", err)
 		return nil, err
 	}
 	return task, nil
@@ -153,7 +181,7 @@ func (r *pgTaskRepository) GetTasksByProjectID(ctx context.Context, projectID in
 
 	rows, err := r.db.Query(ctx, query, projectID)
 	if err != nil {
-		log.Printf("Error querying tasks for project ID %d: %v", projectID, err)
+		slog.ErrorContext(ctx, "Error querying tasks", "project_id", projectID, "error", err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -176,14 +204,14 @@ func (r *pgTaskRepository) GetTasksByProjectID(ctx context.Context, projectID in
 			&task.UpdatedAt,
 		)
 		if err != nil {
-			log.Printf("Error scanning task row: %v", err)
+			slog.ErrorContext(ctx, "Error scanning task row", "error", err)
 			return nil, err // Return error if scanning fails
 		}
 		tasks = append(tasks, task)
 	}
 
 	if err = rows.Err(); err != nil {
-		log.Printf("Error iterating task rows: %v", err)
+		slog.ErrorContext(ctx, "Error iterating task rows", "error", err)
 		return nil, err
 	}
 
@@ -202,19 +230,35 @@ func (r *pgTaskRepository) UpdateTask(ctx context.Context, task *models.Task, us
               SET title = $1, description = $2, status = $3, label = $4, priority = $5, due_date = $6, start_time = $7, end_time = $8, updated_at = $9
               WHERE id = $10` // Only need task ID here, ownership checked via project
 	now := time.Now()
-	commandTag, err := r.db.Exec(ctx, query,
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error starting transaction for updating task", "task_id", task.ID, "user_id", userID, "error", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	commandTag, err := tx.Exec(ctx, query,
 		task.Title, task.Description, string(task.Status), string(task.Label), string(task.Priority), task.DueDate, task.StartTime, task.EndTime, now,
 		task.ID,
 	)
 	if err != nil {
-		log.Printf("Error updating task ID %d for user %d: %v", task.ID, userID, err)
+		slog.ErrorContext(ctx, "Error updating task", "task_id", task.ID, "user_id", userID, "error", err)
 		return err
 	}
 	if commandTag.RowsAffected() == 0 {
-		log.Printf("No task found with ID %d to update", task.ID)
+		slog.InfoContext(ctx, "No task found to update", "task_id", task.ID)
 		return pgx.ErrNoRows // Or a custom not found error
 	}
-	log.Printf("Updated task ID: %d", task.ID)
+	event := events.TaskUpdatedEvent{TaskID: task.ID, ProjectID: task.ProjectID, UserID: userID, Title: task.Title, Status: string(task.Status)}
+	if err := insertOutboxEvent(ctx, tx, event); err != nil {
+		slog.ErrorContext(ctx, "Error storing task updated event", "task_id", task.ID, "error", err)
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "Error committing transaction for updating task", "task_id", task.ID, "user_id", userID, "error", err)
+		return err
+	}
+	slog.InfoContext(ctx, "Updated task", "task_id", task.ID)
 	return nil
 }
 
@@ -226,10 +270,10 @@ func (r *pgTaskRepository) DeleteTask(ctx context.Context, id int, userID int) e
 	err := r.db.QueryRow(ctx, projectIDQuery, id).Scan(&projectID)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			log.Printf("Task %d not found for deletion check", id)
+			slog.InfoContext(ctx, "Task not found for deletion check", "task_id", id)
 			return pgx.ErrNoRows // Task doesn't exist
 		}
-		log.Printf("Error fetching project_id for task %d: %v", id, err)
+		slog.ErrorContext(ctx, "Error fetching project_id of task", "task_id", id, "error", err)
 		return err // Other DB error
 	}
 
@@ -240,17 +284,32 @@ func (r *pgTaskRepository) DeleteTask(ctx context.Context, id int, userID int) e
 	}
 
 	// 3. Proceed with deletion if ownership is verified
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error starting transaction for deleting task", "task_id", id, "user_id", userID, "error", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
 	query := `DELETE FROM tasks WHERE id = $1`
-	commandTag, err := r.db.Exec(ctx, query, id)
+	commandTag, err := tx.Exec(ctx, query, id)
 	if err != nil {
-		log.Printf("Error deleting task ID %d for user %d: %v", id, userID, err)
+		slog.ErrorContext(ctx, "Error deleting task", "task_id", id, "user_id", userID, "error", err)
 		return err
 	}
 	if commandTag.RowsAffected() == 0 {
-		log.Printf("No task found with ID %d to delete", id)
+		slog.InfoContext(ctx, "No task found to delete", "task_id", id)
 		return pgx.ErrNoRows // Or a custom not found error
 	}
-	log.Printf("Deleted task ID: %d", id)
+	if err := insertOutboxEvent(ctx, tx, events.TaskDeletedEvent{TaskID: id, ProjectID: projectID, UserID: userID}); err != nil {
+		slog.ErrorContext(ctx, "Error storing task deleted event", "task_id", id, "error", err)
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "Error committing transaction for deleting task", "task_id", id, "user_id", userID, "error", err)
+		return err
+	}
+	slog.InfoContext(ctx, "Deleted task", "task_id", id)
 	return nil
 }
 
@@ -263,10 +322,10 @@ func (r *pgTaskRepository) UpdateTaskStatus(ctx context.Context, id int, status
 	err := r.db.QueryRow(ctx, projectIDQuery, id).Scan(&projectID)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			log.Printf("Task %d not found for status update check", id)
+			slog.InfoContext(ctx, "Task not found for status update check", "task_id", id)
 			return pgx.ErrNoRows // Task doesn't exist
 		}
-		log.Printf("Error fetching project_id for task %d: %v", id, err)
+		slog.ErrorContext(ctx, "Error fetching project_id of task", "task_id", id, "error", err)
 		return err // Other DB error
 	}
 
@@ -277,17 +336,34 @@ func (r *pgTaskRepository) UpdateTaskStatus(ctx context.Context, id int, status
 	}
 
 	// 3. Proceed with status update if ownership is verified
-	query := `UPDATE tasks SET status = $1, updated_at = $2 WHERE id = $3`
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Error starting transaction for updating task status", "task_id", id, "user_id", userID, "error", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE tasks SET status = $1, updated_at = $2 WHERE id = $3 RETURNING title`
 	now := time.Now()
-	commandTag, err := r.db.Exec(ctx, query, string(status), now, id)
+	var title string
+	err = tx.QueryRow(ctx, query, string(status), now, id).Scan(&title)
 	if err != nil {
-		log.Printf("Error updating status for task ID %d for user %d: %v", id, userID, err)
+		if err == pgx.ErrNoRows {
+			slog.InfoContext(ctx, "No task found to update status", "task_id", id)
+			return pgx.ErrNoRows // Or a custom not found error
+		}
+		slog.ErrorContext(ctx, "Error updating task status", "task_id", id, "user_id", userID, "error", err)
 		return err
 	}
-	if commandTag.RowsAffected() == 0 {
-		log.Printf("No task found with ID %d to update status", id)
-		return pgx.ErrNoRows // Or a custom not found error
+	event := events.TaskUpdatedEvent{TaskID: id, ProjectID: projectID, UserID: userID, Title: title, Status: string(status)}
+	if err := insertOutboxEvent(ctx, tx, event); err != nil {
+		slog.ErrorContext(ctx, "Error storing task updated event", "task_id", id, "error", err)
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		slog.ErrorContext(ctx, "Error committing transaction for updating task status", "task_id", id, "user_id", userID, "error", err)
+		return err
 	}
-	log.Printf("Updated status for task ID: %d", id)
+	slog.InfoContext(ctx, "Updated task status", "task_id", id)
 	return nil
 }
@@ -0,0 +1,5 @@
+module cozy-go/topology
+
+go 1.23.2
+
+require github.com/rabbitmq/amqp091-go v1.10.0
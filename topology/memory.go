@@ -0,0 +1,595 @@
+package topology
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// MemoryBroker is an in-memory stand-in for RabbitMQ with the semantics the
+// services rely on: the default exchange, topic exchanges, durable queues,
+// acknowledgements with a prefetch limit, publisher confirms, and queues whose
+// messages expire into a dead letter exchange. It lets tests run publishers
+// and consumers against the real topology without a broker. All its channels
+// share one set of exchanges and queues.
+type MemoryBroker struct {
+	mu        sync.Mutex
+	closed    bool
+	exchanges map[string]string // Exchange name to kind
+	queues    map[string]*memoryQueue
+	bindings  []memoryBinding
+	channels  []*memoryChannel
+	lastTag   uint64
+	confirms  map[string]ConfirmMode // Routing key to how its messages are confirmed
+}
+
+// ConfirmMode is how a MemoryBroker answers a message published in confirm
+// mode; see SetConfirmMode.
+type ConfirmMode int
+
+const (
+	// ConfirmAck delivers the message and acks it
+	ConfirmAck ConfirmMode = iota
+	// ConfirmNack drops the message and nacks it, as RabbitMQ does when it
+	// cannot take a message
+	ConfirmNack
+	// ConfirmNever drops the message and never answers, like a stalled broker
+	ConfirmNever
+)
+
+type memoryBinding struct {
+	exchange, pattern, queue string
+}
+
+// memoryQueue buffers the messages of a queue until they are consumed.
+type memoryQueue struct {
+	name     string
+	args     amqp.Table
+	messages chan amqp.Delivery
+}
+
+// memoryQueueCapacity bounds the messages a queue holds; publishing to a full
+// queue fails rather than blocking the test.
+const memoryQueueCapacity = 1024
+
+// NewMemoryBroker creates an empty broker.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{exchanges: map[string]string{}, queues: map[string]*memoryQueue{}, confirms: map[string]ConfirmMode{}}
+}
+
+// SetConfirmMode sets how messages published in confirm mode with routing
+// key are answered. Messages published without confirm mode are unaffected.
+func (b *MemoryBroker) SetConfirmMode(key string, mode ConfirmMode) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.confirms[key] = mode
+}
+
+// confirmMode returns how messages published with routing key are answered.
+func (b *MemoryBroker) confirmMode(key string) ConfirmMode {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.confirms[key]
+}
+
+// Channel returns a channel on the broker.
+func (b *MemoryBroker) Channel() (Channel, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, amqp.ErrClosed
+	}
+	c := &memoryChannel{broker: b, unacked: map[uint64]memoryDelivery{}, done: make(chan struct{})}
+	b.channels = append(b.channels, c)
+	return c, nil
+}
+
+// IsClosed reports whether Close was called.
+func (b *MemoryBroker) IsClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// Close closes the broker, which ends every consumer's delivery channel.
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for _, queue := range b.queues {
+		close(queue.messages)
+	}
+	return nil
+}
+
+// Get takes the next message from queue without waiting, like basic.get with
+// auto-ack. It reports false if the queue is empty or does not exist.
+func (b *MemoryBroker) Get(queue string) (amqp.Delivery, bool) {
+	b.mu.Lock()
+	q, ok := b.queues[queue]
+	b.mu.Unlock()
+	if !ok {
+		return amqp.Delivery{}, false
+	}
+	select {
+	case d, ok := <-q.messages:
+		return d, ok
+	default:
+		return amqp.Delivery{}, false
+	}
+}
+
+// Unacked returns the number of messages delivered on any channel and not yet
+// acknowledged.
+func (b *MemoryBroker) Unacked() int {
+	b.mu.Lock()
+	channels := b.channels
+	b.mu.Unlock()
+
+	n := 0
+	for _, c := range channels {
+		c.mu.Lock()
+		n += len(c.unacked)
+		c.mu.Unlock()
+	}
+	return n
+}
+
+// publish routes msg from exchange with key to the queues bound to it.
+func (b *MemoryBroker) publish(exchange, key string, msg amqp.Publishing) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return amqp.ErrClosed
+	}
+
+	var targets []*memoryQueue
+	if exchange == "" {
+		// The default exchange routes to the queue named by the key
+		if q, ok := b.queues[key]; ok {
+			targets = append(targets, q)
+		}
+	} else {
+		if _, ok := b.exchanges[exchange]; !ok {
+			return fmt.Errorf("no exchange %q", exchange)
+		}
+		seen := map[string]bool{}
+		for _, binding := range b.bindings {
+			if binding.exchange == exchange && !seen[binding.queue] && Matches(binding.pattern, key) {
+				seen[binding.queue] = true
+				targets = append(targets, b.queues[binding.queue])
+			}
+		}
+	}
+
+	// Unroutable messages are dropped, as they are without the mandatory flag
+	for _, q := range targets {
+		b.lastTag++
+		d := amqp.Delivery{
+			Acknowledger:  memoryAcknowledger{},
+			Headers:       msg.Headers,
+			ContentType:   msg.ContentType,
+			DeliveryMode:  msg.DeliveryMode,
+			CorrelationId: msg.CorrelationId,
+			Expiration:    msg.Expiration,
+			MessageId:     msg.MessageId,
+			Timestamp:     msg.Timestamp,
+			Type:          msg.Type,
+			AppId:         msg.AppId,
+			DeliveryTag:   b.lastTag,
+			Exchange:      exchange,
+			RoutingKey:    key,
+			Body:          msg.Body,
+		}
+		if err := b.enqueue(q, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueue adds d to q. Messages of a queue with a message TTL and a dead
+// letter exchange are dead-lettered once the TTL passes; they cannot be
+// consumed from the queue in the meantime. b.mu must be held.
+func (b *MemoryBroker) enqueue(q *memoryQueue, d amqp.Delivery) error {
+	if ttl, ok := q.messageTTL(); ok {
+		if _, ok := q.args["x-dead-letter-exchange"]; ok {
+			time.AfterFunc(ttl, func() { b.deadLetter(q, d) })
+			return nil
+		}
+	}
+	select {
+	case q.messages <- d:
+		return nil
+	default:
+		return fmt.Errorf("queue %s is full", q.name)
+	}
+}
+
+// requeue puts a message that was delivered but not acknowledged back in its
+// queue, at the end rather than in its original position.
+func (b *MemoryBroker) requeue(q *memoryQueue, d amqp.Delivery) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	d.Acknowledger = memoryAcknowledger{}
+	d.Redelivered = true
+	select {
+	case q.messages <- d:
+	default:
+	}
+}
+
+// deadLetter republishes d to the dead letter exchange of q, with the dead
+// letter routing key of q if it has one. Unlike RabbitMQ it adds no x-death
+// header.
+func (b *MemoryBroker) deadLetter(q *memoryQueue, d amqp.Delivery) {
+	exchange, ok := q.args["x-dead-letter-exchange"].(string)
+	if !ok {
+		return
+	}
+	key := d.RoutingKey
+	if k, ok := q.args["x-dead-letter-routing-key"].(string); ok {
+		key = k
+	}
+	// Fails only once the broker is closed, when the message is lost anyway
+	_ = b.publish(exchange, key, amqp.Publishing{
+		Headers:       d.Headers,
+		ContentType:   d.ContentType,
+		DeliveryMode:  d.DeliveryMode,
+		CorrelationId: d.CorrelationId,
+		MessageId:     d.MessageId,
+		Timestamp:     d.Timestamp,
+		Type:          d.Type,
+		AppId:         d.AppId,
+		Body:          d.Body,
+	})
+}
+
+// messageTTL returns the x-message-ttl argument of q.
+func (q *memoryQueue) messageTTL() (time.Duration, bool) {
+	switch ttl := q.args["x-message-ttl"].(type) {
+	case int:
+		return time.Duration(ttl) * time.Millisecond, true
+	case int32:
+		return time.Duration(ttl) * time.Millisecond, true
+	case int64:
+		return time.Duration(ttl) * time.Millisecond, true
+	default:
+		return 0, false
+	}
+}
+
+// memoryAcknowledger accepts every acknowledgement. It is the Acknowledger of
+// messages delivered with auto-ack.
+type memoryAcknowledger struct{}
+
+func (memoryAcknowledger) Ack(tag uint64, multiple bool) error           { return nil }
+func (memoryAcknowledger) Nack(tag uint64, multiple, requeue bool) error { return nil }
+func (memoryAcknowledger) Reject(tag uint64, requeue bool) error         { return nil }
+
+// memoryDelivery is a message delivered on a channel and not yet acknowledged.
+type memoryDelivery struct {
+	queue    *memoryQueue
+	delivery amqp.Delivery
+	prefetch bool // Counts against the prefetch limit
+}
+
+// memoryChannel is a Channel on a MemoryBroker. It is the Acknowledger of the
+// messages it delivers without auto-ack.
+type memoryChannel struct {
+	broker *MemoryBroker
+
+	mu       sync.Mutex
+	closed   bool
+	confirm  bool // In confirm mode
+	prefetch int
+	credit   chan struct{} // Holds a token per unacknowledged consumed message
+	unacked  map[uint64]memoryDelivery
+	done     chan struct{} // Closed by Close
+}
+
+func (c *memoryChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if existing, ok := b.exchanges[name]; ok && existing != kind {
+		return fmt.Errorf("exchange %s exists with kind %s, not %s", name, existing, kind)
+	}
+	b.exchanges[name] = kind
+	return nil
+}
+
+// QueueDeclare creates queue name with args unless it exists. Like RabbitMQ it
+// returns the number of messages ready in the queue.
+func (c *memoryChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return amqp.Queue{}, amqp.ErrClosed
+	}
+	q, ok := b.queues[name]
+	if !ok {
+		q = &memoryQueue{name: name, args: args, messages: make(chan amqp.Delivery, memoryQueueCapacity)}
+		b.queues[name] = q
+	}
+	return amqp.Queue{Name: name, Messages: len(q.messages)}, nil
+}
+
+func (c *memoryChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	b := c.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.queues[name]; !ok {
+		return fmt.Errorf("no queue %q", name)
+	}
+	if _, ok := b.exchanges[exchange]; !ok {
+		return fmt.Errorf("no exchange %q", exchange)
+	}
+	binding := memoryBinding{exchange: exchange, pattern: key, queue: name}
+	for _, existing := range b.bindings {
+		if existing == binding {
+			return nil
+		}
+	}
+	b.bindings = append(b.bindings, binding)
+	return nil
+}
+
+func (c *memoryChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.broker.publish(exchange, key, msg)
+}
+
+// Confirm puts the channel in confirm mode.
+func (c *memoryChannel) Confirm(noWait bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.confirm = true
+	return nil
+}
+
+// PublishWithConfirmation publishes msg and answers it as set with
+// SetConfirmMode for key.
+func (c *memoryChannel) PublishWithConfirmation(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (Confirmation, error) {
+	c.mu.Lock()
+	confirm := c.confirm
+	c.mu.Unlock()
+	if !confirm {
+		return nil, ErrNotConfirmMode
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mode := c.broker.confirmMode(key)
+	if mode != ConfirmAck {
+		return memoryConfirmation{mode: mode}, nil
+	}
+	if err := c.broker.publish(exchange, key, msg); err != nil {
+		return nil, err
+	}
+	return memoryConfirmation{mode: mode}, nil
+}
+
+// memoryConfirmation answers at once, or never if its mode is ConfirmNever.
+type memoryConfirmation struct {
+	mode ConfirmMode
+}
+
+func (c memoryConfirmation) WaitContext(ctx context.Context) (bool, error) {
+	if c.mode == ConfirmNever {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+	return c.mode == ConfirmAck, nil
+}
+
+// Qos limits the unacknowledged messages of the consumers started afterwards
+// to prefetchCount; zero means no limit.
+func (c *memoryChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prefetch = prefetchCount
+	return nil
+}
+
+// Consume returns the messages of queue. Consumers of the same queue compete
+// for its messages. Without auto-ack a message stays unacknowledged until it
+// is acknowledged through the delivery, and at most the prefetch count of
+// messages are unacknowledged at once.
+func (c *memoryChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	b := c.broker
+	b.mu.Lock()
+	q, ok := b.queues[queue]
+	b.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no queue %q", queue)
+	}
+	if autoAck {
+		return q.messages, nil
+	}
+
+	c.mu.Lock()
+	if c.prefetch > 0 && c.credit == nil {
+		c.credit = make(chan struct{}, c.prefetch)
+	}
+	credit := c.credit
+	c.mu.Unlock()
+
+	out := make(chan amqp.Delivery)
+	go c.deliver(q, credit, out)
+	return out, nil
+}
+
+// deliver passes the messages of q to out until the queue or the channel is
+// closed, waiting for acknowledgements while the prefetch limit is reached.
+func (c *memoryChannel) deliver(q *memoryQueue, credit chan struct{}, out chan<- amqp.Delivery) {
+	defer close(out)
+	for {
+		if credit != nil {
+			select {
+			case credit <- struct{}{}:
+			case <-c.done:
+				return
+			}
+		}
+
+		var d amqp.Delivery
+		select {
+		case next, ok := <-q.messages:
+			if !ok {
+				return
+			}
+			d = next
+		case <-c.done:
+			return
+		}
+
+		d.Acknowledger = c
+		if !c.track(q, d, credit != nil) {
+			return
+		}
+		select {
+		case out <- d:
+		case <-c.done:
+			// Close requeues what it finds unacknowledged, which may not have included d yet
+			c.requeueUnacked()
+			return
+		}
+	}
+}
+
+// track records d as unacknowledged. If the channel is already closed, d is
+// requeued instead and track returns false.
+func (c *memoryChannel) track(q *memoryQueue, d amqp.Delivery, prefetch bool) bool {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		c.broker.requeue(q, d)
+		return false
+	}
+	c.unacked[d.DeliveryTag] = memoryDelivery{queue: q, delivery: d, prefetch: prefetch}
+	c.mu.Unlock()
+	return true
+}
+
+// Get takes the next message from queue without waiting, like basic.get.
+// Without auto-ack the message must be acknowledged; it does not count against
+// the prefetch limit.
+func (c *memoryChannel) Get(queue string, autoAck bool) (amqp.Delivery, bool, error) {
+	b := c.broker
+	b.mu.Lock()
+	q, ok := b.queues[queue]
+	b.mu.Unlock()
+	if !ok {
+		return amqp.Delivery{}, false, fmt.Errorf("no queue %q", queue)
+	}
+
+	var d amqp.Delivery
+	select {
+	case next, ok := <-q.messages:
+		if !ok {
+			return amqp.Delivery{}, false, amqp.ErrClosed
+		}
+		d = next
+	default:
+		return amqp.Delivery{}, false, nil
+	}
+	if !autoAck {
+		d.Acknowledger = c
+		if !c.track(q, d, false) {
+			return amqp.Delivery{}, false, amqp.ErrClosed
+		}
+	}
+	return d, true, nil
+}
+
+// settle removes the unacknowledged deliveries tag (and every earlier one if
+// multiple) and returns them.
+func (c *memoryChannel) settle(tag uint64, multiple bool) ([]memoryDelivery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var settled []memoryDelivery
+	for t, pending := range c.unacked {
+		if t == tag || (multiple && t < tag) {
+			settled = append(settled, pending)
+			delete(c.unacked, t)
+		}
+	}
+	if len(settled) == 0 {
+		// RabbitMQ closes the channel with PRECONDITION_FAILED here
+		return nil, fmt.Errorf("unknown delivery tag %d", tag)
+	}
+	for _, pending := range settled {
+		if pending.prefetch {
+			<-c.credit
+		}
+	}
+	return settled, nil
+}
+
+func (c *memoryChannel) Ack(tag uint64, multiple bool) error {
+	_, err := c.settle(tag, multiple)
+	return err
+}
+
+// Nack requeues the messages if requeue is set, and otherwise dead-letters
+// them if their queue has a dead letter exchange or drops them.
+func (c *memoryChannel) Nack(tag uint64, multiple, requeue bool) error {
+	settled, err := c.settle(tag, multiple)
+	if err != nil {
+		return err
+	}
+	for _, pending := range settled {
+		if requeue {
+			c.broker.requeue(pending.queue, pending.delivery)
+		} else {
+			c.broker.deadLetter(pending.queue, pending.delivery)
+		}
+	}
+	return nil
+}
+
+func (c *memoryChannel) Reject(tag uint64, requeue bool) error {
+	return c.Nack(tag, false, requeue)
+}
+
+// Close stops the channel's consumers and, like RabbitMQ, requeues the
+// messages they left unacknowledged.
+func (c *memoryChannel) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	c.mu.Unlock()
+
+	c.requeueUnacked()
+	return nil
+}
+
+func (c *memoryChannel) requeueUnacked() {
+	c.mu.Lock()
+	pending := c.unacked
+	c.unacked = map[uint64]memoryDelivery{}
+	c.mu.Unlock()
+
+	for _, p := range pending {
+		c.broker.requeue(p.queue, p.delivery)
+	}
+}
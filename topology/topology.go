@@ -0,0 +1,263 @@
+// Package topology declares the RabbitMQ exchange, queues and bindings that
+// connect the services.
+//
+// Every event is published to the topic exchange Exchange with its type as
+// the routing key (e.g. "user.registered"). Each consuming service has one
+// durable queue, bound to the exchange with the routing key patterns of the
+// events it handles. Publishers and consumers both call Declare before using
+// the broker, so whichever starts first creates the whole topology and no
+// event is published to an exchange without its queues.
+//
+// auth-service, notification-service and task-service all import this module
+// through a replace directive pointing at ../topology, so they cannot drift
+// apart. Their Docker images are built from the repository root to include it.
+package topology
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Exchange is the topic exchange all events are published to.
+const Exchange = "cozy.events"
+
+// Queues of the consuming services.
+const (
+	NotificationQueue = "notification-service.events"
+	TaskQueue         = "task-service.events"
+)
+
+// Queue is a durable consumer queue and the routing key patterns binding it to
+// Exchange. In a pattern "*" matches exactly one dot-separated word and "#"
+// matches zero or more.
+type Queue struct {
+	Name     string
+	Bindings []string
+}
+
+// Queues lists every consumer queue. A new consumer (or a new event for an
+// existing one) is added here; events nobody is bound to are dropped by the
+// exchange.
+var Queues = []Queue{
+	{Name: NotificationQueue, Bindings: []string{
+		"user.registered",
+		"user.password_changed",
+		"user.password_reset_requested",
+		"user.magic_link_requested",
+		"user.email_changed",
+		"user.verification_requested",
+	}},
+	{Name: TaskQueue, Bindings: []string{
+		"user.deleted",
+	}},
+}
+
+// Channel is the part of *amqp.Channel the services use. MemoryBroker
+// implements it for tests.
+type Channel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Get(queue string, autoAck bool) (amqp.Delivery, bool, error)
+	// Confirm puts the channel in confirm mode, in which the broker acks or
+	// nacks every message published on it
+	Confirm(noWait bool) error
+	// PublishWithConfirmation publishes msg on a channel in confirm mode and
+	// returns the broker's answer to it
+	PublishWithConfirmation(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (Confirmation, error)
+	Close() error
+}
+
+// Confirmation is the broker's answer to a message published in confirm mode.
+// WaitContext blocks until it arrives and reports whether the message was
+// acked; *amqp.DeferredConfirmation implements it.
+type Confirmation interface {
+	WaitContext(ctx context.Context) (bool, error)
+}
+
+// ErrNotConfirmMode is returned by PublishWithConfirmation on a channel that
+// is not in confirm mode.
+var ErrNotConfirmMode = errors.New("channel is not in confirm mode")
+
+// Connection opens channels; see NewConnection.
+type Connection interface {
+	Channel() (Channel, error)
+	IsClosed() bool
+}
+
+// amqpConnection adapts *amqp.Connection to Connection.
+type amqpConnection struct {
+	*amqp.Connection
+}
+
+// NewConnection wraps a RabbitMQ connection.
+func NewConnection(conn *amqp.Connection) Connection {
+	return amqpConnection{conn}
+}
+
+func (c amqpConnection) Channel() (Channel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return amqpChannel{ch}, nil
+}
+
+// amqpChannel adapts *amqp.Channel to Channel.
+type amqpChannel struct {
+	*amqp.Channel
+}
+
+func (c amqpChannel) PublishWithConfirmation(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (Confirmation, error) {
+	confirmation, err := c.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, immediate, msg)
+	if err != nil {
+		return nil, err
+	}
+	if confirmation == nil {
+		return nil, ErrNotConfirmMode
+	}
+	return confirmation, nil
+}
+
+// Redialer is a Connection that dials RabbitMQ again when its connection is
+// lost, so a long-running publisher such as the outbox relay survives broker
+// restarts. A failed dial is reported by Channel and retried on the next call.
+type Redialer struct {
+	dial func() (*amqp.Connection, error)
+
+	mu     sync.Mutex
+	conn   *amqp.Connection
+	closed bool
+}
+
+// NewRedialer returns a Redialer that starts with conn, which may be nil to
+// dial on first use, and replaces it with dial once it is closed.
+func NewRedialer(conn *amqp.Connection, dial func() (*amqp.Connection, error)) *Redialer {
+	return &Redialer{dial: dial, conn: conn}
+}
+
+// Channel opens a channel, dialing a new connection first if there is none
+// or the current one was closed.
+func (r *Redialer) Channel() (Channel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, amqp.ErrClosed
+	}
+	if r.conn == nil || r.conn.IsClosed() {
+		conn, err := r.dial()
+		if err != nil {
+			return nil, fmt.Errorf("failed to reconnect to RabbitMQ: %w", err)
+		}
+		r.conn = conn
+	}
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return amqpChannel{ch}, nil
+}
+
+// IsClosed reports whether Close was called. A lost connection does not
+// count, since Channel replaces it.
+func (r *Redialer) IsClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+// Close closes the current connection and stops dialing new ones.
+func (r *Redialer) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.conn == nil || r.conn.IsClosed() {
+		return nil
+	}
+	return r.conn.Close()
+}
+
+// Declare declares Exchange and every queue in Queues with its bindings.
+// Declarations are idempotent, so it is safe to call on every start (or every
+// publish), but they fail if an existing exchange or queue was declared with
+// other settings.
+func Declare(ch Channel) error {
+	if err := ch.ExchangeDeclare(
+		Exchange, // name
+		"topic",  // kind
+		true,     // durable
+		false,    // auto-deleted
+		false,    // internal
+		false,    // no-wait
+		nil,      // arguments
+	); err != nil {
+		return fmt.Errorf("failed to declare exchange %s: %w", Exchange, err)
+	}
+
+	for _, queue := range Queues {
+		if _, err := ch.QueueDeclare(
+			queue.Name, // name
+			true,       // durable
+			false,      // delete when unused
+			false,      // exclusive
+			false,      // no-wait
+			nil,        // arguments
+		); err != nil {
+			return fmt.Errorf("failed to declare queue %s: %w", queue.Name, err)
+		}
+		for _, pattern := range queue.Bindings {
+			if err := ch.QueueBind(queue.Name, pattern, Exchange, false, nil); err != nil {
+				return fmt.Errorf("failed to bind queue %s to %s: %w", queue.Name, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Routes returns the names of the queues in Queues that an event published
+// with routingKey reaches.
+func Routes(routingKey string) []string {
+	var names []string
+	for _, queue := range Queues {
+		for _, pattern := range queue.Bindings {
+			if Matches(pattern, routingKey) {
+				names = append(names, queue.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// Matches reports whether routingKey matches the topic exchange binding pattern.
+func Matches(pattern, routingKey string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func matchWords(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		// Try every number of words for the hash, including none
+		for i := 0; i <= len(key); i++ {
+			if matchWords(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && matchWords(pattern[1:], key[1:])
+	default:
+		return len(key) > 0 && pattern[0] == key[0] && matchWords(pattern[1:], key[1:])
+	}
+}